@@ -3,29 +3,150 @@ package main
 import (
 	"flag"
 	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/ordernumber"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
 	"github.com/caarlos0/env"
+	"time"
 )
 
 type config struct {
-	ConnectAddr string `env:"RUN_ADDRESS"`
-	DataBaseURI string `env:"DATABASE_URI"`
-	AccrualURI  string `env:"ACCRUAL_SYSTEM_ADDRESS"`
-	LogLevel    string `env:"LOG_LEVEL"`
-	SecretKey   string `env:"SECRET_KEY"`
+	ConnectAddr  string        `env:"RUN_ADDRESS"`
+	GRPCAddr     string        `env:"GRPC_ADDRESS"`
+	DataBaseURI  string        `env:"DATABASE_URI"`
+	AccrualURI   string        `env:"ACCRUAL_SYSTEM_ADDRESS"`
+	LogLevel     string        `env:"LOG_LEVEL"`
+	SecretKey    string        `env:"SECRET_KEY"`
+	SkipMigrate  bool          `env:"SKIP_MIGRATION"`
+	CallbackKey  string        `env:"ACCRUAL_CALLBACK_KEY"`
+	PollInterval time.Duration `env:"ACCRUAL_POLL_INTERVAL"`
+	OutboxURL    string        `env:"OUTBOX_WEBHOOK_URL"`
+	OutboxFile   string        `env:"OUTBOX_FILE"`
+	SwaggerUI    bool          `env:"SWAGGER_UI"`
+	CompressSize int           `env:"COMPRESS_MIN_SIZE"`
+	MaxInflated  int64         `env:"MAX_DECOMPRESSED_SIZE"`
+	RateGlobal   string        `env:"RATE_LIMIT_GLOBAL"`
+	RateAuth     string        `env:"RATE_LIMIT_AUTH"`
+	RateOrders   string        `env:"RATE_LIMIT_ORDERS"`
+	RateAPI      string        `env:"RATE_LIMIT_API"`
+	RateShared   bool          `env:"RATE_LIMIT_SHARED"`
+	TLSCert      string        `env:"TLS_CERT_FILE"`
+	TLSKey       string        `env:"TLS_KEY_FILE"`
+	RedirectAddr string        `env:"HTTP_REDIRECT_ADDRESS"`
+	OrderSources string        `env:"ORDER_SOURCES"`
+	Referrals    string        `env:"REFERRAL_PROGRAM"`
+	AdminKey     string        `env:"ADMIN_KEY"`
+	Tiers        string        `env:"LOYALTY_TIERS"`
+	TiersAt      string        `env:"TIER_RECOMPUTE_AT"`
+	EventsKeep   time.Duration `env:"USER_EVENTS_RETENTION"`
+	rateLimits   rateLimits
+	orderSources ordernumber.Sources
+	// referralProgram is nil when the referral bonuses are disabled.
+	referralProgram *services.ReferralProgram
+	// loyaltyTiers are nil when the tiers are disabled.
+	loyaltyTiers services.LoyaltyTiers
+	tiersAt      time.Duration
+}
+
+type rateLimits struct {
+	global internal.RateLimit
+	auth   internal.RateLimit
+	orders internal.RateLimit
+	api    internal.RateLimit
 }
 
 var cfg config
 
 func parseFlags() error {
 	flag.StringVar(&cfg.ConnectAddr, "a", "localhost:8080", "address to run HTTP server")
+	flag.StringVar(&cfg.GRPCAddr, "g", "", "address to run gRPC server, it isn't started when empty")
 	flag.StringVar(&cfg.DataBaseURI, "d", "", "URI to database")
 	flag.StringVar(&cfg.AccrualURI, "r", "", "URI to accrual system")
 	flag.StringVar(&cfg.LogLevel, "l", "info", "log level")
 	flag.StringVar(&cfg.SecretKey, "k", "", "secret key for sha256")
+	flag.BoolVar(&cfg.SkipMigrate, "skip-migration", false, "don't apply migrations on startup")
+	flag.StringVar(&cfg.CallbackKey, "callback-key", "", "secret key for signature of accrual callbacks")
+	flag.DurationVar(&cfg.PollInterval, "poll-interval", 5*time.Second, "interval of polling the accrual system")
+	flag.StringVar(&cfg.OutboxURL, "outbox-webhook", "", "URL of webhook for events of orders and withdrawals")
+	flag.StringVar(&cfg.OutboxFile, "outbox-file", "", "file for events of orders and withdrawals")
+	flag.BoolVar(&cfg.SwaggerUI, "swagger-ui", false, "serve Swagger UI at /api/docs")
+	flag.IntVar(&cfg.CompressSize, "compress-min-size", 1024, "minimal size of response body to compress")
+	flag.Int64Var(&cfg.MaxInflated, "max-decompressed-size", 1<<20, "maximal size of decompressed request body")
+	flag.StringVar(&cfg.RateGlobal, "rate-limit-global", "", "limit of all user requests together as requests/period")
+	flag.StringVar(&cfg.RateAuth, "rate-limit-auth", "", "limit of register and login by IP as requests/period, e.g. 10/1m")
+	flag.StringVar(&cfg.RateOrders, "rate-limit-orders", "", "limit of upload of orders by user as requests/period")
+	flag.StringVar(&cfg.RateAPI, "rate-limit-api", "", "limit of all user requests by user as requests/period")
+	flag.BoolVar(&cfg.RateShared, "rate-limit-shared", false, "share state of rate limits between replicas through DB")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", "", "file of TLS certificate, HTTPS is served when it is set")
+	flag.StringVar(&cfg.TLSKey, "tls-key", "", "file of TLS private key")
+	flag.StringVar(&cfg.RedirectAddr, "http-redirect", "", "address to redirect plain HTTP to HTTPS, it isn't started when empty")
+	flag.StringVar(&cfg.OrderSources, "order-sources", "", "rules of order numbers by source, e.g. marketplace=length:6-40,prefix:MP")
+	flag.StringVar(&cfg.Referrals, "referral-program", services.DefaultReferralProgram,
+		"referral bonuses and limits, e.g. referrer=100,referee=50,min-accrual=100,limit=10/720h, empty disables them")
+	flag.StringVar(&cfg.AdminKey, "admin-key", "", "key of operators for the admin API of campaigns and pool state, it isn't served when empty")
+	flag.StringVar(&cfg.Tiers, "loyalty-tiers", services.DefaultLoyaltyTiers,
+		"loyalty tiers by points accrued in 12 months, e.g. bronze=from:0,campaign:1,withdraw:5000/24h;silver=..., off disables them")
+	flag.StringVar(&cfg.TiersAt, "tier-recompute-at", "03:00", "time of day to recompute loyalty tiers")
+	flag.DurationVar(&cfg.EventsKeep, "user-events-retention", 7*24*time.Hour, "how long the events of the user stream are kept")
+	flag.Parse()
 
 	if err := env.Parse(&cfg); err != nil {
 		return fmt.Errorf("can't parse env; %w", err)
 	}
+	if cfg.PollInterval <= 0 {
+		return fmt.Errorf("poll interval must be positive; %v", cfg.PollInterval)
+	}
+
+	for _, limit := range []struct {
+		value  string
+		target *internal.RateLimit
+	}{
+		{cfg.RateGlobal, &cfg.rateLimits.global},
+		{cfg.RateAuth, &cfg.rateLimits.auth},
+		{cfg.RateOrders, &cfg.rateLimits.orders},
+		{cfg.RateAPI, &cfg.rateLimits.api},
+	} {
+		if limit.value == "" {
+			continue
+		}
+		parsed, err := services.ParseRateLimit(limit.value)
+		if err != nil {
+			return err
+		}
+		*limit.target = parsed
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return fmt.Errorf("TLS certificate and key must be set together")
+	}
+	if cfg.RedirectAddr != "" && cfg.TLSCert == "" {
+		return fmt.Errorf("redirect to HTTPS requires TLS certificate")
+	}
+	if cfg.EventsKeep <= 0 {
+		return fmt.Errorf("retention of user events must be positive; %v", cfg.EventsKeep)
+	}
+	if cfg.MaxInflated <= 0 {
+		return fmt.Errorf("max decompressed size must be positive; %v", cfg.MaxInflated)
+	}
+	sources, err := ordernumber.ParseSources(cfg.OrderSources)
+	if err != nil {
+		return fmt.Errorf("can't parse order sources; %w", err)
+	}
+	cfg.orderSources = sources
+	referrals, err := services.ParseReferralProgram(cfg.Referrals)
+	if err != nil {
+		return fmt.Errorf("can't parse referral program; %w", err)
+	}
+	cfg.referralProgram = referrals
+	tiers, err := services.ParseLoyaltyTiers(cfg.Tiers)
+	if err != nil {
+		return fmt.Errorf("can't parse loyalty tiers; %w", err)
+	}
+	cfg.loyaltyTiers = tiers
+	tiersAt, err := services.ParseTimeOfDay(cfg.TiersAt)
+	if err != nil {
+		return fmt.Errorf("can't parse time of tier recomputation; %w", err)
+	}
+	cfg.tiersAt = tiersAt
 
 	return nil
 }
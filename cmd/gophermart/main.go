@@ -1,26 +1,44 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/certs"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/clients"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/handlers"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/middlewares"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/rpc"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/sinks"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal/migrations"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories/memory"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
 	"github.com/go-resty/resty/v2"
 	"github.com/jmoiron/sqlx"
+	"google.golang.org/grpc"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
 const (
-	countWorker             = 5
-	retryTimeCheckNewOrders = 5 * time.Second
-	migrationsPath          = "file://internal/migrations/sql"
+	countWorker        = 5
+	dispatchInterval   = 1 * time.Second
+	webhookTimeout     = 10 * time.Second
+	rateSweepInterval  = 1 * time.Minute
+	eventSweepInterval = 1 * time.Hour
+	certCheckInterval  = 1 * time.Minute
+	shutdownTimeout    = 10 * time.Second
+	memoryStoreScheme  = "mem://"
 )
 
 func main() {
@@ -35,20 +53,24 @@ func main() {
 		os.Exit(1)
 	}
 
-	err := migrations.Start(cfg.DataBaseURI, migrationsPath)
-	if err != nil {
-		internal.Logf.Errorf("migration of data to DB is failed %v", err)
-		os.Exit(1)
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(cfg.DataBaseURI, flag.Args()[1:]); err != nil {
+			internal.Logf.Errorf("migrate command is failed %v", err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	db, err := sqlx.Open("pgx", cfg.DataBaseURI)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	store, err := newStore()
 	if err != nil {
-		internal.Logf.Errorf("can't connected to DB %v", err)
+		internal.Logf.Errorf("can't open store %v", err)
 		os.Exit(1)
 	}
-	store := repositories.NewStore(db)
 
-	service := services.NewUserService(store)
+	service := services.NewUserService(store, cfg.orderSources, cfg.referralProgram, cfg.loyaltyTiers)
 	secretKey, err := base64.StdEncoding.DecodeString(cfg.SecretKey)
 	if err != nil || len(secretKey) < 16 {
 		secretKey = make([]byte, 16)
@@ -62,19 +84,159 @@ func main() {
 	internal.Logf.Infof("starting integration to: %s", cfg.AccrualURI)
 	client := resty.New()
 	accrual := clients.NewClientAccrual(client, cfg.AccrualURI)
-	ticker := time.NewTicker(retryTimeCheckNewOrders)
-	worker := services.NewPoolWorker(accrual, service)
+	ticker := time.NewTicker(cfg.PollInterval)
+	worker := services.NewPoolWorker(accrual, service, cfg.PollInterval)
 	go func() {
-		worker.StarIntegration(countWorker, ticker)
+		worker.StarIntegration(ctx, countWorker, ticker)
 	}()
 
+	webhookService := services.NewWebhookService(store, clients.NewClientWebhook(resty.New().SetTimeout(webhookTimeout)))
+	go webhookService.Start(ctx, time.NewTicker(dispatchInterval))
+
+	eventSinks := []services.EventSink{webhookService}
+	if cfg.OutboxURL != "" {
+		eventSinks = append(eventSinks, sinks.NewWebhookSink(resty.New(), cfg.OutboxURL))
+	}
+	if cfg.OutboxFile != "" {
+		eventSinks = append(eventSinks, sinks.NewFileSink(cfg.OutboxFile))
+	}
+	internal.Logf.Infof("starting dispatch of events to %d sinks", len(eventSinks))
+	dispatcher := services.NewOutboxDispatcher(store, eventSinks...)
+	go dispatcher.Start(ctx, time.NewTicker(dispatchInterval))
+
+	if len(cfg.loyaltyTiers) > 0 {
+		go services.NewTierService(store, cfg.loyaltyTiers).Start(ctx, cfg.tiersAt)
+	}
+
+	limits := newRateLimits(ctx, store)
+	broker := services.NewEventBroker(store)
+	go broker.Start(ctx)
+	go broker.Cleanup(ctx, cfg.EventsKeep, time.NewTicker(eventSweepInterval))
+
+	var grpcServer *grpc.Server
+	if cfg.GRPCAddr != "" {
+		listener, err := net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			internal.Logf.Errorf("can't listen gRPC address %v", err)
+			os.Exit(1)
+		}
+		internal.Logf.Infof("starting gRPC server on address: %s", cfg.GRPCAddr)
+		grpcServer = rpc.NewServer(rpc.NewServerUser(service, secretKey), limits)
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				internal.Logf.Errorf("error gRPC server %v", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
 	internal.Logf.Infof("starting HTTP server on address: %s", cfg.ConnectAddr)
-	handlerUser := handlers.NewHandlerUser(service, secretKey)
-	router := handlers.UserRouter(handlerUser, secretKey)
-	err = http.ListenAndServe(cfg.ConnectAddr, router)
-	if err != nil {
+	handlerUser := handlers.NewHandlerUser(service, secretKey, cfg.TLSCert != "")
+	handlerWebhook := handlers.NewHandlerWebhook(webhookService)
+	handlerEvents := handlers.NewHandlerEvents(broker)
+	router := handlers.UserRouter(handlerUser, handlerWebhook, handlerEvents, secretKey, limits)
+	handlerPool := handlers.NewHandlerPool(worker)
+	handlerAccrual := handlers.NewHandlerAccrual(service)
+	handlerCampaign := handlers.NewHandlerCampaign(services.NewCampaignService(store))
+	router.Mount("/api/internal", handlers.InternalRouter(handlerPool, handlerAccrual, handlerCampaign,
+		[]byte(cfg.CallbackKey), []byte(cfg.AdminKey)))
+	router.Mount("/api", handlers.DocsRouter(cfg.SwaggerUI))
+	handler := middlewares.Decompress(cfg.MaxInflated)(middlewares.Compress(cfg.CompressSize)(router))
+	server := &http.Server{Addr: cfg.ConnectAddr, Handler: handler,
+		BaseContext: func(net.Listener) context.Context { return ctx }}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		shutdown(ctx, server)
+		if grpcServer != nil {
+			grpcServer.GracefulStop()
+		}
+	}()
+	if cfg.TLSCert == "" {
+		err = server.ListenAndServe()
+	} else {
+		err = serveTLS(ctx, server)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		internal.Logf.Errorf("error HTTP server %v", err)
 		os.Exit(1)
 	}
+	<-stopped
+	internal.Log.Info("server is stopped")
+}
+
+// shutdown stops server once ctx is done, the requests in progress are given shutdownTimeout.
+func shutdown(ctx context.Context, server *http.Server) {
+	<-ctx.Done()
+	internal.Logf.Infof("shutting down server on address: %s", server.Addr)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		internal.Logf.Errorf("can't shut down server %v", err)
+	}
+}
+
+// serveTLS serves HTTPS with HTTP/2, the certificate is reloaded when its files change.
+func serveTLS(ctx context.Context, server *http.Server) error {
+	reloader, err := certs.NewReloader(cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return err
+	}
+	go reloader.Start(ctx, time.NewTicker(certCheckInterval))
+	server.TLSConfig = reloader.TLSConfig()
+
+	if cfg.RedirectAddr != "" {
+		internal.Logf.Infof("starting HTTP redirect to HTTPS on address: %s", cfg.RedirectAddr)
+		redirect := &http.Server{Addr: cfg.RedirectAddr, Handler: handlers.RedirectHTTPS(cfg.ConnectAddr)}
+		go shutdown(ctx, redirect)
+		go func() {
+			if err := redirect.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				internal.Logf.Errorf("error HTTP redirect server %v", err)
+				os.Exit(1)
+			}
+		}()
+	}
+	return server.ListenAndServeTLS("", "")
+}
+
+// newStore opens the store of DataBaseURI, the store of mem:// keeps the data in memory
+// and loses it on restart.
+func newStore() (repositories.Store, error) {
+	if strings.HasPrefix(cfg.DataBaseURI, memoryStoreScheme) {
+		internal.Log.Warn("data is kept in memory and is lost on restart")
+		return memory.NewStore(), nil
+	}
+	if !cfg.SkipMigrate {
+		if err := migrations.Start(cfg.DataBaseURI); err != nil {
+			return nil, fmt.Errorf("migration of data to DB is failed %w", err)
+		}
+	}
+	db, err := sqlx.Open("pgx", cfg.DataBaseURI)
+	if err != nil {
+		return nil, fmt.Errorf("can't connected to DB %w", err)
+	}
+	return repositories.NewStore(db), nil
+}
 
+func newRateLimits(ctx context.Context, store repositories.Store) handlers.RateLimits {
+	limits := handlers.RateLimits{
+		Global: cfg.rateLimits.global,
+		Auth:   cfg.rateLimits.auth,
+		Orders: cfg.rateLimits.orders,
+		API:    cfg.rateLimits.api,
+	}
+	if !cfg.RateShared {
+		limits.Limiter = services.NewMemoryRateLimiter()
+		return limits
+	}
+	var idle time.Duration
+	for _, limit := range []internal.RateLimit{limits.Global, limits.Auth, limits.Orders, limits.API} {
+		if limit.Period > idle {
+			idle = limit.Period
+		}
+	}
+	limiter := services.NewStoreRateLimiter(store, idle)
+	go limiter.Start(ctx, time.NewTicker(rateSweepInterval))
+	limits.Limiter = limiter
+	return limits
 }
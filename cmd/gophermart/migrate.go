@@ -0,0 +1,93 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/migrations"
+	"strconv"
+	"strings"
+)
+
+var errMigrateUsage = errors.New("usage: gophermart [OPTIONS] migrate up|down [N|--all]|goto VERSION|version|force VERSION")
+
+func runMigrate(connect string, args []string) error {
+	if len(args) == 0 {
+		return errMigrateUsage
+	}
+	if strings.HasPrefix(connect, memoryStoreScheme) {
+		return errors.New("store in memory has no migrations")
+	}
+
+	migrator, err := migrations.NewMigrator(connect)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up()
+	case "down":
+		var steps int
+		steps, err = parseDownSteps(args)
+		switch {
+		case err != nil:
+		case steps == 0:
+			err = migrator.Down()
+		default:
+			err = migrator.Steps(-steps)
+		}
+	case "goto":
+		var version uint64
+		version, err = parseVersion(args)
+		if err == nil {
+			err = migrator.Goto(uint(version))
+		}
+	case "force":
+		var version uint64
+		version, err = parseVersion(args)
+		if err == nil {
+			err = migrator.Force(int(version))
+		}
+	case "version":
+	default:
+		return errMigrateUsage
+	}
+	if err != nil {
+		return err
+	}
+
+	version, dirty, err := migrator.Version()
+	if err != nil {
+		return err
+	}
+	internal.Logf.Infof("database schema version %d, dirty %t", version, dirty)
+	return nil
+}
+
+func parseVersion(args []string) (uint64, error) {
+	if len(args) < 2 {
+		return 0, errMigrateUsage
+	}
+	version, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("can't parse version %s; %w", args[1], err)
+	}
+	return version, nil
+}
+
+// parseDownSteps returns the number of migrations to revert, 1 by default and 0 for --all.
+func parseDownSteps(args []string) (int, error) {
+	if len(args) < 2 {
+		return 1, nil
+	}
+	if args[1] == "--all" {
+		return 0, nil
+	}
+	steps, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil || steps == 0 {
+		return 0, fmt.Errorf("can't parse steps %s; %w", args[1], errMigrateUsage)
+	}
+	return int(steps), nil
+}
@@ -35,3 +35,10 @@ func CheckPassword(password string, passwordIsExs string) (bool, error) {
 	sign := hash.Sum(nil)
 	return hmac.Equal(sign, hashPass[8:]), nil
 }
+
+// SignBody returns hex encoded HMAC-SHA256 of body.
+func SignBody(body []byte, secretKey []byte) string {
+	hash := hmac.New(sha256.New, secretKey)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
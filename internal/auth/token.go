@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+)
+
+// Sign returns the value with its HMAC, the name is signed too so the value of one
+// cookie or token can't be used as another.
+func Sign(name string, value string, secret []byte) string {
+	hash := hmac.New(sha256.New, secret)
+	hash.Write([]byte(name))
+	hash.Write([]byte(value))
+	signature := hash.Sum(nil)
+	return base64.URLEncoding.EncodeToString(append(signature, value...))
+}
+
+// ReadSigned checks the signature made by Sign and returns the value.
+func ReadSigned(name string, signed string, secret []byte) (string, error) {
+	signedValue, err := base64.URLEncoding.DecodeString(signed)
+	if err != nil {
+		return "", errors2.ErrInvalidValue
+	}
+	if len(signedValue) < sha256.Size {
+		return "", errors2.ErrInvalidValue
+	}
+
+	signature := signedValue[:sha256.Size]
+	value := signedValue[sha256.Size:]
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(name))
+	mac.Write(value)
+	expectedSignature := mac.Sum(nil)
+
+	if !hmac.Equal(signature, expectedSignature) {
+		return "", errors2.ErrInvalidValue
+	}
+
+	return string(value), nil
+}
@@ -33,11 +33,27 @@ var ErrUserNotFound = errors.New("user not found")
 var ErrOrderIsExistThisUser = errors.New("this order is exist the user")
 var ErrOrderIsExistAnotherUser = errors.New("this order is exist another user")
 var ErrNotEnoughAmount = errors.New("not enough amount")
+var ErrWebhookNotFound = errors.New("webhook not found")
+var ErrWebhookLimit = errors.New("webhook limit is exceeded")
+var ErrOrderNotFound = errors.New("order not found")
+var ErrCampaignNotFound = errors.New("campaign not found")
 
 // service errors
 var ErrIllegalUserArgument = errors.New("illegal user argument")
 var ErrIllegalOrder = errors.New("illegal order")
+var ErrIllegalBatch = errors.New("illegal batch of orders")
+var ErrIllegalPeriod = errors.New("illegal period")
 var ErrWrongAuth = errors.New("wrong authorization")
+var ErrIllegalWebhook = errors.New("illegal webhook")
+var ErrOrderOfAnotherUser = errors.New("order belongs to another user")
+var ErrUnknownOrderSource = errors.New("unknown source of order")
+var ErrIllegalReferralCode = errors.New("illegal referral code")
+var ErrReferralRefused = errors.New("referral is refused")
+var ErrIllegalCampaign = errors.New("illegal campaign")
+var ErrWithdrawalLimit = errors.New("withdrawal limit is exceeded")
 
 // auth error
 var ErrInvalidValue = errors.New("invalid cookie value")
+var ErrInvalidSignature = errors.New("invalid signature")
+var ErrMissingToken = errors.New("token is missing")
+var ErrTokenExpired = errors.New("token is expired")
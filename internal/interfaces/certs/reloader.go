@@ -0,0 +1,109 @@
+// Package certs serves the TLS certificate which is reloaded when its files change.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"time"
+)
+
+// fileStamp changes when the file is replaced or rewritten.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Reloader keeps the certificate of certFile and keyFile and replaces it when
+// the files change, so a renewed certificate is used without restart.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	stamps   [2]fileStamp
+}
+
+// NewReloader loads the certificate, it fails when the files can't be loaded.
+func NewReloader(certFile string, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig returns the server config with the certificate of the reloader, it offers
+// HTTP/2 and HTTP/1.1 and accepts TLS 1.2 and later.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: r.GetCertificate,
+	}
+}
+
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Reload loads the certificate again when any of the files has changed. The current
+// certificate is kept when the new one can't be loaded, e.g. while the files are written.
+func (r *Reloader) Reload() (bool, error) {
+	stamps, err := r.stat()
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	changed := r.cert == nil || stamps != r.stamps
+	r.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("can't load certificate %s, %w", r.certFile, err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.stamps = stamps
+	return true, nil
+}
+
+func (r *Reloader) stat() ([2]fileStamp, error) {
+	var stamps [2]fileStamp
+	for i, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return stamps, fmt.Errorf("can't stat certificate file, %w", err)
+		}
+		stamps[i] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps, nil
+}
+
+// Start checks the files on every tick until ctx is done.
+func (r *Reloader) Start(ctx context.Context, requestTime *time.Ticker) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-requestTime.C:
+		}
+		reloaded, err := r.Reload()
+		if err != nil {
+			internal.Log.Error("certificate isn't reloaded", zap.Error(err))
+			continue
+		}
+		if reloaded {
+			internal.Logf.Infof("certificate %s is reloaded", r.certFile)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+const (
+	HeaderSignature       = "X-Signature"
+	HeaderWebhookEvent    = "X-Webhook-Event"
+	HeaderWebhookDelivery = "X-Webhook-Delivery"
+)
+
+var ErrForbiddenAddress = errors.New("address is forbidden")
+
+// forbiddenPrefixes are the ranges which net.IP has no method for: "this network" and the shared address space of CGNAT.
+var forbiddenPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+type ClientWebhook struct {
+	client *resty.Client
+}
+
+// NewClientWebhook makes client safe for the URLs of users: it doesn't follow redirects,
+// doesn't use a proxy and refuses to connect to loopback, private, CGNAT, link-local and
+// unspecified addresses, the check is done on dial so DNS rebinding doesn't bypass it.
+func NewClientWebhook(client *resty.Client) *ClientWebhook {
+	return newClientWebhook(client, checkDialAddress)
+}
+
+func newClientWebhook(client *resty.Client, control func(network, address string, c syscall.RawConn) error) *ClientWebhook {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	client.SetTransport(transport)
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	return &ClientWebhook{client: client}
+}
+
+// Send posts the signed body to url and returns the status code of the response,
+// the redirect is returned as is.
+func (cw *ClientWebhook) Send(ctx context.Context, url string, headers map[string]string, body []byte) (int, error) {
+	response, err := cw.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetHeaders(headers).
+		SetBody(body).
+		Post(url)
+	if err != nil {
+		return 0, err
+	}
+	return response.StatusCode(), nil
+}
+
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("%s %w", address, ErrForbiddenAddress)
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("%s %w", address, ErrForbiddenAddress)
+	}
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return fmt.Errorf("%s %w", address, ErrForbiddenAddress)
+	}
+	addr = addr.Unmap()
+	for _, prefix := range forbiddenPrefixes {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("%s %w", address, ErrForbiddenAddress)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package clients
+
+import (
+	"context"
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckDialAddress(t *testing.T) {
+	tests := []struct {
+		address   string
+		forbidden bool
+	}{
+		{address: "93.184.216.34:443"},
+		{address: "[2606:2800:220:1:248:1893:25c8:1946]:443"},
+		{address: "127.0.0.1:8080", forbidden: true},
+		{address: "[::1]:8080", forbidden: true},
+		{address: "10.1.2.3:80", forbidden: true},
+		{address: "172.16.0.1:80", forbidden: true},
+		{address: "192.168.1.1:80", forbidden: true},
+		{address: "169.254.169.254:80", forbidden: true},
+		{address: "[fe80::1]:80", forbidden: true},
+		{address: "[fd00::1]:80", forbidden: true},
+		{address: "0.0.0.0:80", forbidden: true},
+		{address: "[::ffff:127.0.0.1]:80", forbidden: true},
+		{address: "0.1.2.3:80", forbidden: true},
+		{address: "100.64.0.1:80", forbidden: true},
+		{address: "100.127.255.254:80", forbidden: true},
+		{address: "[::ffff:100.100.100.200]:80", forbidden: true},
+		{address: "[::ffff:0.1.2.3]:80", forbidden: true},
+		{address: "100.128.0.1:80"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := checkDialAddress("tcp", tt.address, nil)
+			if tt.forbidden {
+				assert.ErrorIs(t, err, ErrForbiddenAddress)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestClientWebhook_Send(t *testing.T) {
+	var redirected bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/target" {
+			redirected = true
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		http.Redirect(w, r, "/target", http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+
+	t.Run("loopback_is_refused", func(t *testing.T) {
+		code, err := NewClientWebhook(resty.New()).Send(context.Background(), server.URL+"/hook", nil, []byte(`{}`))
+		assert.ErrorIs(t, err, ErrForbiddenAddress)
+		assert.Equal(t, 0, code)
+	})
+	t.Run("redirect_isn't_followed", func(t *testing.T) {
+		code, err := newClientWebhook(resty.New(), nil).Send(context.Background(), server.URL+"/hook", nil, []byte(`{}`))
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusTemporaryRedirect, code)
+		assert.False(t, redirected)
+	})
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type HandlerAccrual struct {
+	us *services.UserService
+}
+
+func NewHandlerAccrual(service *services.UserService) *HandlerAccrual {
+	return &HandlerAccrual{us: service}
+}
+
+// Callback applies the accrual state pushed by the accrual system.
+func (ha *HandlerAccrual) Callback(w http.ResponseWriter, r *http.Request) {
+	internal.Log.Debug("decoding message")
+	var dto internal.AccrualDto
+	if err := decodeJSON(w, r, &dto); err != nil {
+		internal.Logf.Errorf("cannot decode request JSON body %v", err)
+		writeRequestError(w, err)
+		return
+	}
+
+	if err := ha.us.UpdateOrder(&dto, internal.UpdateSourceCallback); err != nil {
+		internal.Log.Error("update order by callback", zap.Error(err))
+		if errors.Is(err, errors2.ErrIllegalOrder) {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/auth"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/middlewares"
+	mock "github.com/bonus2k/go-musthave-diploma-tpl/internal/mocks"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/ordernumber"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerAccrual_Callback(t *testing.T) {
+	callbackKey := []byte("accrual-secret")
+	ctrl := gomock.NewController(t)
+	mockStore := mock.NewMockStore(ctrl)
+	service := services.NewUserService(mockStore, ordernumber.DefaultSources(), nil, nil)
+	router := InternalRouter(NewHandlerPool(services.NewPoolWorker(nil, service, time.Second)), NewHandlerAccrual(service), &HandlerCampaign{}, callbackKey, nil)
+
+	mockStore.EXPECT().
+		UpdateOrder(gomock.Any(), &internal.Order{
+			Number:       "4539088167512356",
+			Accrual:      500,
+			Status:       internal.OrderStatusProcessed,
+			UpdateSource: internal.UpdateSourceCallback,
+		}, gomock.Any(), gomock.Any()).
+		Return(nil).Times(2)
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		signature   string
+		statusCode  int
+	}{
+		{
+			name:        "Callback 200",
+			body:        `{"order":"4539088167512356","status":"PROCESSED","accrual":500}`,
+			contentType: "application/json",
+			statusCode:  200,
+		},
+		{
+			name:        "Callback 200 repeated",
+			body:        `{"order":"4539088167512356","status":"PROCESSED","accrual":500}`,
+			contentType: "application/json",
+			statusCode:  200,
+		},
+		{
+			name:        "Callback 401",
+			body:        `{"order":"4539088167512356","status":"PROCESSED","accrual":500}`,
+			contentType: "application/json",
+			signature:   auth.SignBody([]byte(`{}`), callbackKey),
+			statusCode:  401,
+		},
+		{
+			name:        "Callback 415 content type",
+			body:        `{"order":"4539088167512356","status":"PROCESSED","accrual":500}`,
+			contentType: "text/plain",
+			statusCode:  415,
+		},
+		{
+			name:        "Callback 400 body",
+			body:        `{"order":`,
+			contentType: "application/json",
+			statusCode:  400,
+		},
+		{
+			name:        "Callback 422",
+			body:        `{"order":"number_1","status":"PROCESSED","accrual":500}`,
+			contentType: "application/json",
+			statusCode:  422,
+		},
+		{
+			name:        "Callback 422 status",
+			body:        `{"order":"4539088167512356","status":"NEW","accrual":500}`,
+			contentType: "application/json",
+			statusCode:  422,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/accrual/callback", strings.NewReader(tt.body))
+			signature := tt.signature
+			if signature == "" {
+				signature = auth.SignBody([]byte(tt.body), callbackKey)
+			}
+			request.Header.Set(middlewares.HeaderSignature, signature)
+			request.Header.Set("Content-Type", tt.contentType)
+			responseRecorder := httptest.NewRecorder()
+
+			router.ServeHTTP(responseRecorder, request)
+			result := responseRecorder.Result()
+			defer result.Body.Close()
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+		})
+	}
+}
+
+func TestInternalRouter_CallbackIsDisabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	service := services.NewUserService(mock.NewMockStore(ctrl), ordernumber.DefaultSources(), nil, nil)
+	router := InternalRouter(NewHandlerPool(services.NewPoolWorker(nil, service, time.Second)), NewHandlerAccrual(service), &HandlerCampaign{}, nil, nil)
+
+	request := httptest.NewRequest(http.MethodPost, "/accrual/callback", strings.NewReader(`{}`))
+	responseRecorder := httptest.NewRecorder()
+	router.ServeHTTP(responseRecorder, request)
+	result := responseRecorder.Result()
+	defer result.Body.Close()
+	assert.Equal(t, http.StatusNotFound, result.StatusCode)
+}
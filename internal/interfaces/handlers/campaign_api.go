@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type HandlerCampaign struct {
+	cs *services.CampaignService
+}
+
+func NewHandlerCampaign(service *services.CampaignService) *HandlerCampaign {
+	return &HandlerCampaign{cs: service}
+}
+
+func (hc *HandlerCampaign) AddCampaign(w http.ResponseWriter, r *http.Request) {
+	var dto internal.CampaignDto
+	internal.Log.Debug("decoding message")
+	if err := decodeJSON(w, r, &dto); err != nil {
+		internal.Logf.Errorf("cannot decode request JSON body %v", err)
+		writeRequestError(w, err)
+		return
+	}
+	campaign, err := hc.cs.CreateCampaign(r.Context(), dto)
+	if err != nil {
+		internal.Log.Error("add campaign", zap.Error(err))
+		writeCampaignError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, campaign)
+}
+
+func (hc *HandlerCampaign) GetCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := hc.cs.GetCampaigns(r.Context())
+	if err != nil {
+		internal.Log.Error("get campaigns", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(*campaigns) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, campaigns)
+}
+
+func (hc *HandlerCampaign) GetCampaign(w http.ResponseWriter, r *http.Request) {
+	campaign, err := hc.cs.GetCampaign(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeCampaignError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, campaign)
+}
+
+func (hc *HandlerCampaign) DeleteCampaign(w http.ResponseWriter, r *http.Request) {
+	if err := hc.cs.DeleteCampaign(r.Context(), chi.URLParam(r, "id")); err != nil {
+		internal.Log.Error("delete campaign", zap.Error(err))
+		writeCampaignError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeCampaignError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errors2.ErrCampaignNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errors2.ErrIllegalCampaign) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+}
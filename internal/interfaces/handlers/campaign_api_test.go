@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	mock "github.com/bonus2k/go-musthave-diploma-tpl/internal/mocks"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/ordernumber"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerCampaign(t *testing.T) {
+	adminKey := []byte("admin-secret")
+	ctrl := gomock.NewController(t)
+	mockStore := mock.NewMockStore(ctrl)
+	service := services.NewUserService(mockStore, ordernumber.DefaultSources(), nil, nil)
+	router := InternalRouter(NewHandlerPool(services.NewPoolWorker(nil, service, time.Second)), NewHandlerAccrual(service),
+		NewHandlerCampaign(services.NewCampaignService(mockStore)), nil, adminKey)
+
+	campaignID := uuid.MustParse("334b0360-8222-44fc-bf2e-77ced208f2cd")
+	unknownID := uuid.MustParse("c4d1e8a0-9f5a-4a8e-a7a1-0d2f0a5c3b11")
+	campaign := &internal.Campaign{
+		ID:         campaignID,
+		CreateAt:   time.Date(2023, 11, 1, 10, 0, 0, 0, time.UTC),
+		Name:       "Double weekends",
+		Multiplier: 2,
+		StartsAt:   time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:     time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC),
+		Weekdays:   "SAT,SUN",
+	}
+	mockStore.EXPECT().AddCampaign(gomock.Any(), gomock.Any()).Return(nil)
+	mockStore.EXPECT().GetCampaigns(gomock.Any()).Return(&[]internal.Campaign{*campaign}, nil)
+	mockStore.EXPECT().GetCampaign(gomock.Any(), campaignID).Return(campaign, nil)
+	mockStore.EXPECT().GetCampaign(gomock.Any(), unknownID).Return(nil, errors2.ErrCampaignNotFound)
+	mockStore.EXPECT().DeleteCampaign(gomock.Any(), campaignID).Return(nil)
+
+	campaignBody := `{"id":"334b0360-8222-44fc-bf2e-77ced208f2cd","name":"Double weekends","multiplier":2,
+		"starts_at":"2023-11-01T00:00:00Z","ends_at":"2023-12-01T00:00:00Z","weekdays":["SAT","SUN"],
+		"created_at":"2023-11-01T10:00:00Z"}`
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		body        string
+		contentType string
+		key         string
+		statusCode  int
+		resBody     string
+	}{
+		{
+			name:        "AddCampaign 201",
+			method:      http.MethodPost,
+			target:      "/campaigns",
+			body:        `{"name":"New users","multiplier":1.5,"starts_at":"2023-11-01T00:00:00Z","ends_at":"2024-01-01T00:00:00Z","new_user_days":30}`,
+			contentType: "application/json",
+			statusCode:  201,
+		},
+		{
+			name:        "AddCampaign 422",
+			method:      http.MethodPost,
+			target:      "/campaigns",
+			body:        `{"name":"Weekdays","multiplier":2,"starts_at":"2023-11-01T00:00:00Z","ends_at":"2023-12-01T00:00:00Z","weekdays":["HOLIDAY"]}`,
+			contentType: "application/json",
+			statusCode:  422,
+		},
+		{
+			name:        "AddCampaign 400",
+			method:      http.MethodPost,
+			target:      "/campaigns",
+			body:        `{"name":"Bad dates","multiplier":2,"starts_at":"yesterday"}`,
+			contentType: "application/json",
+			statusCode:  400,
+		},
+		{
+			name:        "AddCampaign 401",
+			method:      http.MethodPost,
+			target:      "/campaigns",
+			body:        `{"name":"New users","multiplier":1.5,"starts_at":"2023-11-01T00:00:00Z","ends_at":"2024-01-01T00:00:00Z"}`,
+			contentType: "application/json",
+			key:         "another-secret",
+			statusCode:  401,
+		},
+		{
+			name:       "GetCampaigns 200",
+			method:     http.MethodGet,
+			target:     "/campaigns",
+			statusCode: 200,
+			resBody:    "[" + campaignBody + "]",
+		},
+		{
+			name:       "GetCampaign 200",
+			method:     http.MethodGet,
+			target:     "/campaigns/" + campaignID.String(),
+			statusCode: 200,
+			resBody:    campaignBody,
+		},
+		{
+			name:       "GetCampaign 404",
+			method:     http.MethodGet,
+			target:     "/campaigns/" + unknownID.String(),
+			statusCode: 404,
+		},
+		{
+			name:       "GetCampaign 404 wrong id",
+			method:     http.MethodGet,
+			target:     "/campaigns/campaign",
+			statusCode: 404,
+		},
+		{
+			name:       "DeleteCampaign 204",
+			method:     http.MethodDelete,
+			target:     "/campaigns/" + campaignID.String(),
+			statusCode: 204,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			key := tt.key
+			if key == "" {
+				key = string(adminKey)
+			}
+			request.Header.Set("Authorization", "Bearer "+key)
+			if tt.contentType != "" {
+				request.Header.Set("Content-Type", tt.contentType)
+			}
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+			result := responseRecorder.Result()
+			defer result.Body.Close()
+			resBody, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			if tt.resBody != "" {
+				assert.JSONEq(t, tt.resBody, string(resBody))
+			}
+		})
+	}
+}
+
+func TestInternalRouter_CampaignsAreDisabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	service := services.NewUserService(mock.NewMockStore(ctrl), ordernumber.DefaultSources(), nil, nil)
+	router := InternalRouter(NewHandlerPool(services.NewPoolWorker(nil, service, time.Second)), NewHandlerAccrual(service), &HandlerCampaign{}, nil, nil)
+
+	request := httptest.NewRequest(http.MethodGet, "/campaigns", nil)
+	request.Header.Set("Authorization", "Bearer ")
+	responseRecorder := httptest.NewRecorder()
+	router.ServeHTTP(responseRecorder, request)
+	result := responseRecorder.Result()
+	defer result.Body.Close()
+	assert.Equal(t, http.StatusNotFound, result.StatusCode)
+}
@@ -1,24 +1,100 @@
 package handlers
 
 import (
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/middlewares"
 	"github.com/go-chi/chi/v5"
+	"net/http"
 )
 
-func UserRouter(uh *HandlerUser, secretKey []byte) chi.Router {
+// RateLimits are the limits of the route groups: Global is for all requests of the users
+// together, Auth is for register and login by the address of the client, API is for all
+// routes of the user and Orders is for the upload of orders in addition. The group with
+// zero limit isn't limited. The gRPC API is limited by the same groups.
+type RateLimits struct {
+	Limiter middlewares.RateLimiter
+	Global  internal.RateLimit
+	Auth    internal.RateLimit
+	Orders  internal.RateLimit
+	API     internal.RateLimit
+}
+
+func (rl RateLimits) middleware(group string, limit internal.RateLimit, key func(r *http.Request) string) func(http.Handler) http.Handler {
+	if rl.Limiter == nil || limit.Limit == 0 {
+		return func(h http.Handler) http.Handler {
+			return h
+		}
+	}
+	return middlewares.RateLimit(rl.Limiter, group, limit, key)
+}
+
+func UserRouter(uh *HandlerUser, hw *HandlerWebhook, he *HandlerEvents, secretKey []byte, limits RateLimits) chi.Router {
 	router := chi.NewRouter()
 
 	authentication := middlewares.Authentication(secretKey)
+	globalLimit := limits.middleware("global", limits.Global, middlewares.KeyGlobal)
+	authLimit := limits.middleware("auth", limits.Auth, middlewares.KeyByIP)
+	apiLimit := limits.middleware("api", limits.API, middlewares.KeyByUser)
+	ordersLimit := limits.middleware("orders", limits.Orders, middlewares.KeyByUser)
 
 	router.Route("/api/user", func(r chi.Router) {
-		r.Post("/register", uh.RegisterUser)
-		r.Post("/login", uh.Login)
-		r.With(authentication).Post("/orders", uh.AddOrder)
-		r.With(authentication).Get("/orders", uh.GetOrders)
-		r.With(authentication).Get("/balance", uh.GetBalance)
-		r.With(authentication).Post("/balance/withdraw", uh.AddWithdraw)
-		r.With(authentication).Get("/withdrawals", uh.GetWithdrawals)
+		r.Use(globalLimit)
+		r.With(authLimit).Post("/register", uh.RegisterUser)
+		r.With(authLimit).Post("/login", uh.Login)
+		r.With(authentication, apiLimit, ordersLimit).Post("/orders", uh.AddOrder)
+		r.With(authentication, apiLimit, ordersLimit).Post("/orders/batch", uh.AddOrders)
+		r.With(authentication, apiLimit).Get("/orders", uh.GetOrders)
+		r.With(authentication, apiLimit).Get("/orders/{number}", uh.GetOrder)
+		r.With(authentication, apiLimit).Get("/balance", uh.GetBalance)
+		r.With(authentication, apiLimit).Post("/balance/withdraw", uh.AddWithdraw)
+		r.With(authentication, apiLimit).Get("/withdrawals", uh.GetWithdrawals)
+		r.With(authentication, apiLimit).Get("/statement", uh.GetStatement)
+		r.With(authentication, apiLimit).Get("/referral", uh.GetReferral)
+		r.With(authentication, apiLimit).Get("/profile", uh.GetProfile)
+		r.With(authentication, apiLimit).Get("/events", he.Stream)
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Use(authentication, apiLimit)
+			r.Post("/", hw.AddWebhook)
+			r.Get("/", hw.GetWebhooks)
+			r.Get("/{id}", hw.GetWebhook)
+			r.Put("/{id}", hw.UpdateWebhook)
+			r.Delete("/{id}", hw.DeleteWebhook)
+			r.Get("/{id}/deliveries", hw.GetDeliveries)
+			r.Post("/{id}/test", hw.SendTestEvent)
+		})
 	})
 
 	return router
 }
+
+// DocsRouter serves the OpenAPI document at /openapi.json and Swagger UI at /docs when swaggerUI is set.
+func DocsRouter(swaggerUI bool) chi.Router {
+	router := chi.NewRouter()
+	router.Get("/openapi.json", GetOpenAPI)
+	if swaggerUI {
+		router.Get("/docs", GetSwaggerUI)
+	}
+	return router
+}
+
+// InternalRouter serves the endpoints for the accrual system and the operators,
+// the callback is registered only when callbackKey is set, the pool state and
+// the campaigns only when adminKey is set.
+func InternalRouter(hp *HandlerPool, ha *HandlerAccrual, hc *HandlerCampaign, callbackKey []byte, adminKey []byte) chi.Router {
+	router := chi.NewRouter()
+	if len(callbackKey) != 0 {
+		router.With(middlewares.Signature(callbackKey)).Post("/accrual/callback", ha.Callback)
+	}
+	if len(adminKey) != 0 {
+		admin := middlewares.AdminKey(adminKey)
+		router.With(admin).Get("/pool", hp.GetStatus)
+		router.Route("/campaigns", func(r chi.Router) {
+			r.Use(admin)
+			r.Post("/", hc.AddCampaign)
+			r.Get("/", hc.GetCampaigns)
+			r.Get("/{id}", hc.GetCampaign)
+			r.Delete("/{id}", hc.DeleteCampaign)
+		})
+	}
+	return router
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUserRouter_RateLimits(t *testing.T) {
+	testServices := initTestServices(t)
+	testServices.mockStore.EXPECT().AddUser(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	testServices.mockStore.EXPECT().AddOrder(gomock.Any(), gomock.Any()).Return(&internal.Order{}, nil).AnyTimes()
+	testServices.mockStore.EXPECT().GetUserVersion(gomock.Any(), gomock.Any()).Return(int64(1), nil).AnyTimes()
+	testServices.mockStore.EXPECT().GetOrders(gomock.Any(), gomock.Any()).Return(&[]internal.Order{}, nil).AnyTimes()
+
+	limits := RateLimits{
+		Limiter: services.NewMemoryRateLimiter(),
+		Auth:    internal.RateLimit{Limit: 1, Period: time.Hour},
+		Orders:  internal.RateLimit{Limit: 1, Period: time.Hour},
+		API:     internal.RateLimit{Limit: 3, Period: time.Hour},
+	}
+	router := UserRouter(testServices.handlerUser, &HandlerWebhook{}, &HandlerEvents{}, testServices.handlerUser.secret, limits)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		remoteAddr string
+		user       bool
+		statusCode int
+	}{
+		{name: "register", method: http.MethodPost, path: "/api/user/register", body: `{"login":"user1","password":"password"}`, remoteAddr: "10.0.0.1:1000", statusCode: http.StatusOK},
+		{name: "register again from the address", method: http.MethodPost, path: "/api/user/register", body: `{"login":"user2","password":"password"}`, remoteAddr: "10.0.0.1:1001", statusCode: http.StatusTooManyRequests},
+		{name: "login from the address", method: http.MethodPost, path: "/api/user/login", body: `{"login":"user1","password":"password"}`, remoteAddr: "10.0.0.1:1002", statusCode: http.StatusTooManyRequests},
+		{name: "register from another address", method: http.MethodPost, path: "/api/user/register", body: `{"login":"user3","password":"password"}`, remoteAddr: "10.0.0.2:1000", statusCode: http.StatusOK},
+		{name: "add order", method: http.MethodPost, path: "/api/user/orders", body: "4539088167512356", remoteAddr: "10.0.0.1:1003", user: true, statusCode: http.StatusAccepted},
+		{name: "add order again", method: http.MethodPost, path: "/api/user/orders", body: "3536137811022331", remoteAddr: "10.0.0.3:1000", user: true, statusCode: http.StatusTooManyRequests},
+		{name: "get orders", method: http.MethodGet, path: "/api/user/orders", remoteAddr: "10.0.0.1:1004", user: true, statusCode: http.StatusNoContent},
+		{name: "api limit is spent", method: http.MethodGet, path: "/api/user/orders", remoteAddr: "10.0.0.1:1005", user: true, statusCode: http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			request.RemoteAddr = tt.remoteAddr
+			if tt.method == http.MethodPost {
+				request.Header.Set("Content-Type", "application/json")
+			}
+			if tt.path == "/api/user/orders" {
+				request.Header.Set("Content-Type", "text/plain")
+			}
+			if tt.user {
+				request.AddCookie(&testServices.cookie1)
+			}
+			responseRecorder := httptest.NewRecorder()
+
+			router.ServeHTTP(responseRecorder, request)
+
+			assert.Equal(t, tt.statusCode, responseRecorder.Code)
+			assert.NotEmpty(t, responseRecorder.Header().Get("RateLimit-Limit"))
+		})
+	}
+}
+
+func TestUserRouter_GlobalRateLimit(t *testing.T) {
+	testServices := initTestServices(t)
+	testServices.mockStore.EXPECT().AddUser(gomock.Any(), gomock.Any()).Return(nil)
+
+	limits := RateLimits{
+		Limiter: services.NewMemoryRateLimiter(),
+		Global:  internal.RateLimit{Limit: 1, Period: time.Hour},
+	}
+	router := UserRouter(testServices.handlerUser, &HandlerWebhook{}, &HandlerEvents{}, testServices.handlerUser.secret, limits)
+
+	for i, want := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		request := httptest.NewRequest(http.MethodPost, "/api/user/register", strings.NewReader(`{"login":"user1","password":"password"}`))
+		request.RemoteAddr = fmt.Sprintf("10.0.0.%d:1000", i+1)
+		request.Header.Set("Content-Type", "application/json")
+		responseRecorder := httptest.NewRecorder()
+
+		router.ServeHTTP(responseRecorder, request)
+
+		assert.Equal(t, want, responseRecorder.Code, "request from another address %d", i)
+	}
+}
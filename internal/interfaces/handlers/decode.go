@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+const (
+	contentTypeJSON = "application/json"
+	contentTypeText = "text/plain"
+	maxBodySize     = 1 << 20
+)
+
+// requestError is the fault of the request body with the status to answer it.
+type requestError struct {
+	status int
+	err    error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+func badRequest(format string, args ...any) error {
+	return &requestError{status: http.StatusBadRequest, err: fmt.Errorf(format, args...)}
+}
+
+// mediaType returns the media type of the request without parameters such as charset.
+func mediaType(r *http.Request) string {
+	value, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+func checkContentType(r *http.Request, expected string) error {
+	if got := mediaType(r); got != expected {
+		return &requestError{
+			status: http.StatusUnsupportedMediaType,
+			err:    fmt.Errorf("content type %q isn't supported, expected %q", r.Header.Get("Content-Type"), expected),
+		}
+	}
+	return nil
+}
+
+// decodeJSON decodes the single JSON value of the body into v, the body is limited
+// by maxBodySize and the fields unknown to v are refused.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	if err := checkContentType(r, contentTypeJSON); err != nil {
+		return err
+	}
+	return decodeJSONBody(w, r, v)
+}
+
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v any) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return bodyError(err)
+	}
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		if err != nil {
+			return bodyError(err)
+		}
+		return badRequest("body must have a single JSON value")
+	}
+	return nil
+}
+
+// readText reads the text/plain body limited by maxBodySize.
+func readText(w http.ResponseWriter, r *http.Request) (string, error) {
+	if err := checkContentType(r, contentTypeText); err != nil {
+		return "", err
+	}
+	return readTextBody(w, r)
+}
+
+func readTextBody(w http.ResponseWriter, r *http.Request) (string, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		return "", bodyError(err)
+	}
+	return string(body), nil
+}
+
+func bodyError(err error) error {
+	var maxBytesError *http.MaxBytesError
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytesError):
+		return &requestError{status: http.StatusRequestEntityTooLarge, err: fmt.Errorf("body is larger than %d bytes", maxBytesError.Limit)}
+	case errors.Is(err, io.EOF):
+		return badRequest("body is empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return badRequest("body is truncated")
+	case errors.As(err, &syntaxError):
+		return badRequest("malformed JSON at offset %d", syntaxError.Offset)
+	case errors.As(err, &typeError):
+		return badRequest("wrong type of field %q", typeError.Field)
+	default:
+		return badRequest("can't decode body: %v", err)
+	}
+}
+
+// writeRequestError answers the fault of the request body, other errors are answered with 500.
+func writeRequestError(w http.ResponseWriter, err error) {
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		http.Error(w, reqErr.Error(), reqErr.status)
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+// notModified sets the weak ETag of the account version of the user and answers 304 when
+// the client has it already. The version is read before the data, so the data changed
+// meanwhile is sent with the older tag and the client just reloads it next time.
+func (hu *HandlerUser) notModified(w http.ResponseWriter, r *http.Request) bool {
+	userID := r.Header.Get("user")
+	version, err := hu.us.GetVersion(r.Context(), userID)
+	if err != nil {
+		internal.Log.Error("get version of user", zap.Error(err))
+		return false
+	}
+	etag := fmt.Sprintf(`W/"%s.%d"`, userID, version)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if matchETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// matchETag compares the tags of If-None-Match weakly, as RFC 9110 requires for GET.
+func matchETag(header string, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_matchETag(t *testing.T) {
+	etag := `W/"98dcfb07-e16f-4e53-9a28-d2a2e4eed026.7"`
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{name: "no header", header: "", want: false},
+		{name: "same tag", header: etag, want: true},
+		{name: "strong tag", header: `"98dcfb07-e16f-4e53-9a28-d2a2e4eed026.7"`, want: true},
+		{name: "one of tags", header: `W/"98dcfb07-e16f-4e53-9a28-d2a2e4eed026.6", ` + etag, want: true},
+		{name: "older version", header: `W/"98dcfb07-e16f-4e53-9a28-d2a2e4eed026.6"`, want: false},
+		{name: "another user", header: `W/"98dcfb07-e16f-4e53-9a28-d2a2e4eed027.7"`, want: false},
+		{name: "any tag", header: "*", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchETag(tt.header, etag))
+		})
+	}
+}
+
+func TestHandlerUser_ETag(t *testing.T) {
+	testServices := initTestServices(t)
+	userID := uuid.MustParse(testServices.userID1)
+	etag := `W/"` + testServices.userID1 + `.3"`
+
+	testServices.mockStore.EXPECT().GetUserVersion(gomock.Any(), userID).Return(int64(3), nil).AnyTimes()
+	testServices.mockStore.EXPECT().GetOrders(gomock.Any(), userID).Return(&[]internal.Order{}, nil).Times(1)
+	testServices.mockStore.EXPECT().GetWithdrawals(gomock.Any(), userID).Return(&[]internal.Withdraw{}, nil).Times(2)
+	testServices.mockStore.EXPECT().GetUser(gomock.Any(), userID).Return(&internal.User{ID: userID, Bill: 100}, nil).Times(1)
+
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		ifNoneMatch string
+		statusCode  int
+	}{
+		{name: "orders without tag", handler: testServices.handlerUser.GetOrders, statusCode: http.StatusNoContent},
+		{name: "orders with tag", handler: testServices.handlerUser.GetOrders, ifNoneMatch: etag, statusCode: http.StatusNotModified},
+		{name: "balance without tag", handler: testServices.handlerUser.GetBalance, statusCode: http.StatusOK},
+		{name: "balance with tag", handler: testServices.handlerUser.GetBalance, ifNoneMatch: etag, statusCode: http.StatusNotModified},
+		{name: "withdrawals with old tag", handler: testServices.handlerUser.GetWithdrawals, ifNoneMatch: `W/"` + testServices.userID1 + `.2"`, statusCode: http.StatusNoContent},
+		{name: "withdrawals with tag", handler: testServices.handlerUser.GetWithdrawals, ifNoneMatch: etag, statusCode: http.StatusNotModified},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set("user", testServices.userID1)
+			request.Header.Set("If-None-Match", tt.ifNoneMatch)
+			responseRecorder := httptest.NewRecorder()
+
+			tt.handler(responseRecorder, request)
+
+			assert.Equal(t, tt.statusCode, responseRecorder.Code)
+			assert.Equal(t, etag, responseRecorder.Header().Get("ETag"))
+			assert.Equal(t, "private, no-cache", responseRecorder.Header().Get("Cache-Control"))
+			if tt.statusCode == http.StatusNotModified {
+				assert.Empty(t, responseRecorder.Body.String())
+			}
+		})
+	}
+}
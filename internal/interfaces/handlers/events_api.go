@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	heartbeatInterval = 15 * time.Second
+	retryInterval     = 3 * time.Second
+)
+
+type HandlerEvents struct {
+	broker    *services.EventBroker
+	heartbeat time.Duration
+}
+
+func NewHandlerEvents(broker *services.EventBroker) *HandlerEvents {
+	return &HandlerEvents{broker: broker, heartbeat: heartbeatInterval}
+}
+
+// Stream sends the events of the user as Server-Sent Events. The stream is resumed
+// after Last-Event-ID, without it only the new events are sent.
+func (he *HandlerEvents) Stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		internal.Log.Error("streaming isn't supported by response writer")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var lastID int64
+	if header := r.Header.Get("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseInt(header, 10, 64)
+		if err != nil || id < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		lastID = id
+	}
+
+	ctx := r.Context()
+	subscription, err := he.broker.Subscribe(r.Header.Get("user"))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer subscription.Close()
+	if r.Header.Get("Last-Event-ID") == "" {
+		lastID, err = he.broker.LastEventID(ctx, subscription.UserID)
+		if err != nil {
+			internal.Log.Error("get last event", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", retryInterval.Milliseconds())
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(he.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		lastID, err = he.sendEvents(w, r, subscription, lastID)
+		if err != nil {
+			internal.Log.Error("send events", zap.Error(err))
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-subscription.C:
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func (he *HandlerEvents) sendEvents(w http.ResponseWriter, r *http.Request, subscription *services.Subscription, lastID int64) (int64, error) {
+	for {
+		events, err := he.broker.Events(r.Context(), subscription.UserID, lastID)
+		if err != nil {
+			return lastID, err
+		}
+		for _, event := range *events {
+			_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Payload)
+			if err != nil {
+				return lastID, err
+			}
+			lastID = event.ID
+		}
+		if len(*events) == 0 {
+			return lastID, nil
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	mock "github.com/bonus2k/go-musthave-diploma-tpl/internal/mocks"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandlerEvents_Stream(t *testing.T) {
+	userID := uuid.MustParse("6e2a9d4e-2a0b-4e4b-9a55-8c6e1f0c6e21")
+	events := &[]internal.UserEvent{
+		{ID: 6, UserID: userID, Type: internal.EventOrderStatus, Payload: []byte(`{"order":"4539088167512356","status":"PROCESSED","accrual":500}`)},
+		{ID: 7, UserID: userID, Type: internal.EventBalanceChanged, Payload: []byte(`{"current":500,"withdrawn":0}`)},
+	}
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		prepare     func(store *mock.MockStore, cancel context.CancelFunc)
+		statusCode  int
+		resBody     string
+	}{
+		{
+			name:        "Stream resume",
+			lastEventID: "5",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				gomock.InOrder(
+					store.EXPECT().GetUserEvents(gomock.Any(), userID, int64(5), gomock.Any()).Return(events, nil),
+					store.EXPECT().GetUserEvents(gomock.Any(), userID, int64(7), gomock.Any()).DoAndReturn(
+						func(ctx context.Context, userID uuid.UUID, afterID int64, limit int) (*[]internal.UserEvent, error) {
+							cancel()
+							return &[]internal.UserEvent{}, nil
+						}),
+				)
+			},
+			statusCode: 200,
+			resBody: "retry: 3000\n\n" +
+				"id: 6\nevent: order.status\ndata: {\"order\":\"4539088167512356\",\"status\":\"PROCESSED\",\"accrual\":500}\n\n" +
+				"id: 7\nevent: balance.changed\ndata: {\"current\":500,\"withdrawn\":0}\n\n",
+		},
+		{
+			name: "Stream new events",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetLastUserEventID(gomock.Any(), userID).Return(int64(7), nil)
+				store.EXPECT().GetUserEvents(gomock.Any(), userID, int64(7), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, userID uuid.UUID, afterID int64, limit int) (*[]internal.UserEvent, error) {
+						cancel()
+						return &[]internal.UserEvent{}, nil
+					})
+			},
+			statusCode: 200,
+			resBody:    "retry: 3000\n\n",
+		},
+		{
+			name:        "Stream 400",
+			lastEventID: "event",
+			prepare:     func(store *mock.MockStore, cancel context.CancelFunc) {},
+			statusCode:  400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockStore := mock.NewMockStore(ctrl)
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			tt.prepare(mockStore, cancel)
+			handlerEvents := NewHandlerEvents(services.NewEventBroker(mockStore))
+
+			request := httptest.NewRequest(http.MethodGet, "/api/user/events", nil).WithContext(ctx)
+			request.Header.Set("user", userID.String())
+			if tt.lastEventID != "" {
+				request.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			responseRecorder := httptest.NewRecorder()
+			handlerEvents.Stream(responseRecorder, request)
+			result := responseRecorder.Result()
+			defer result.Body.Close()
+			resBody, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			if tt.statusCode == http.StatusOK {
+				assert.Equal(t, "text/event-stream", result.Header.Get("Content-Type"))
+				assert.Equal(t, tt.resBody, string(resBody))
+			}
+		})
+	}
+}
@@ -0,0 +1,540 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/auth"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	mock "github.com/bonus2k/go-musthave-diploma-tpl/internal/mocks"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/openapi"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/ordernumber"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type contractCase struct {
+	name        string
+	method      string
+	path        string
+	body        string
+	contentType string
+	header      map[string]string
+	anonymous   bool
+	prepare     func(store *mock.MockStore, cancel context.CancelFunc)
+	statusCode  int
+}
+
+func loadSpec(t *testing.T) (*openapi3.T, routers.Router) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(openapi.Spec)
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(loader.Context))
+	router, err := gorillamux.NewRouter(doc)
+	require.NoError(t, err)
+	return doc, router
+}
+
+func TestOpenAPI_Spec(t *testing.T) {
+	doc, _ := loadSpec(t)
+	router := UserRouter(&HandlerUser{}, &HandlerWebhook{}, &HandlerEvents{}, nil, RateLimits{})
+
+	routes := make(map[string]bool)
+	err := chi.Walk(router, func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		route = strings.TrimSuffix(route, "/")
+		routes[method+" "+route] = true
+		operation := doc.Paths.Find(route)
+		if assert.NotNilf(t, operation, "route %s isn't described", route) {
+			assert.NotNilf(t, operation.GetOperation(method), "route %s %s isn't described", method, route)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			assert.Truef(t, routes[method+" "+path], "operation %s %s isn't routed", method, path)
+		}
+	}
+}
+
+func TestOpenAPI_GetOpenAPI(t *testing.T) {
+	router := DocsRouter(true)
+	for _, path := range []string{"/openapi.json", "/docs"} {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		responseRecorder := httptest.NewRecorder()
+		router.ServeHTTP(responseRecorder, request)
+		assert.Equal(t, http.StatusOK, responseRecorder.Code)
+	}
+	request := httptest.NewRequest(http.MethodGet, "/docs", nil)
+	responseRecorder := httptest.NewRecorder()
+	DocsRouter(false).ServeHTTP(responseRecorder, request)
+	assert.Equal(t, http.StatusNotFound, responseRecorder.Code)
+}
+
+// TestOpenAPI_Contract sends requests through UserRouter and checks both the requests and
+// the responses against the OpenAPI document, every operation must be covered by a case.
+func TestOpenAPI_Contract(t *testing.T) {
+	doc, specRouter := loadSpec(t)
+	openapi3filter.RegisterBodyDecoder("text/event-stream", openapi3filter.FileBodyDecoder)
+	defer openapi3filter.UnregisterBodyDecoder("text/event-stream")
+
+	secret := []byte{116, 79, 253, 154, 106, 127, 165, 70, 139, 56, 218, 213, 105, 253, 76}
+	userID := uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026")
+	cookie := writeSigned(userID.String(), secret)
+	password, err := auth.SignPassword("password")
+	require.NoError(t, err)
+	created := time.Date(2023, 11, 10, 11, 0, 0, 0, time.UTC)
+	webhookID := uuid.MustParse("334b0360-8222-44fc-bf2e-77ced208f2cd")
+	webhook := &internal.Webhook{ID: webhookID, CreateAt: created, UserID: userID, URL: "https://partner.example/hook",
+		Secret: "secret", EventTypes: "order.processed", Active: true}
+	webhookPath := "/api/user/webhooks/" + webhookID.String()
+	delivery := internal.WebhookDelivery{ID: uuid.New(), CreateAt: created, WebhookID: webhookID, EventID: uuid.New(),
+		EventType: internal.EventOrderProcessed, Payload: []byte(`{}`), Status: internal.OutboxStatusPending,
+		Attempts: 1, NextAttemptAt: created, LastError: "webhook responded 500", ResponseCode: 500}
+	noEvents := func(cancel context.CancelFunc) func(ctx context.Context, userID uuid.UUID, afterID int64, limit int) (*[]internal.UserEvent, error) {
+		return func(ctx context.Context, userID uuid.UUID, afterID int64, limit int) (*[]internal.UserEvent, error) {
+			cancel()
+			return &[]internal.UserEvent{}, nil
+		}
+	}
+
+	tests := []contractCase{
+		{
+			name: "register 200", method: http.MethodPost, path: "/api/user/register", anonymous: true,
+			body: `{"login":"user","password":"password"}`, contentType: "application/json",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().AddUser(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "register 409", method: http.MethodPost, path: "/api/user/register", anonymous: true,
+			body: `{"login":"user","password":"password"}`, contentType: "application/json",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().AddUser(gomock.Any(), gomock.Any()).Return(errors2.ErrUserIsExist)
+			},
+			statusCode: 409,
+		},
+		{
+			name: "register 200 referral", method: http.MethodPost, path: "/api/user/register", anonymous: true,
+			body: `{"login":"user","password":"password","referral_code":"k7m2p9qa"}`, contentType: "application/json",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().FindUserByReferralCode(gomock.Any(), "K7M2P9QA").Return(&internal.User{ID: uuid.New()}, nil)
+				store.EXPECT().AddUser(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "register 400 referral code", method: http.MethodPost, path: "/api/user/register", anonymous: true,
+			body: `{"login":"user","password":"password","referral_code":"K7M2P9QA"}`, contentType: "application/json",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().FindUserByReferralCode(gomock.Any(), "K7M2P9QA").Return(nil, errors2.ErrUserNotFound)
+			},
+			statusCode: 400,
+		},
+		{
+			name: "login 200", method: http.MethodPost, path: "/api/user/login", anonymous: true,
+			body: `{"login":"user","password":"password"}`, contentType: "application/json",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().FindUserByLogin(gomock.Any(), "user").Return(&internal.User{ID: userID, Login: "user", Password: password}, nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "login 401", method: http.MethodPost, path: "/api/user/login", anonymous: true,
+			body: `{"login":"user","password":"password"}`, contentType: "application/json",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().FindUserByLogin(gomock.Any(), "user").Return(nil, errors2.ErrUserNotFound)
+			},
+			statusCode: 401,
+		},
+		{
+			name: "add order 202", method: http.MethodPost, path: "/api/user/orders",
+			body: "4539088167512356", contentType: "text/plain",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().AddOrder(gomock.Any(), gomock.Any()).Return(&internal.Order{}, nil)
+			},
+			statusCode: 202,
+		},
+		{
+			name: "add order 409", method: http.MethodPost, path: "/api/user/orders",
+			body: "4539088167512356", contentType: "text/plain",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().AddOrder(gomock.Any(), gomock.Any()).Return(nil, errors2.ErrOrderIsExistAnotherUser)
+			},
+			statusCode: 409,
+		},
+		{
+			name: "add order 422", method: http.MethodPost, path: "/api/user/orders",
+			body: "12345", contentType: "text/plain",
+			statusCode: 422,
+		},
+		{
+			name: "add order 400 source", method: http.MethodPost, path: "/api/user/orders?source=partner",
+			body: "4539088167512356", contentType: "text/plain",
+			statusCode: 400,
+		},
+		{
+			name: "add order 401", method: http.MethodPost, path: "/api/user/orders", anonymous: true,
+			body: "4539088167512356", contentType: "text/plain",
+			statusCode: 401,
+		},
+		{
+			name: "get orders 200", method: http.MethodGet, path: "/api/user/orders",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetOrders(gomock.Any(), userID).Return(&[]internal.Order{
+					{Number: "4539088167512356", Status: internal.OrderStatusProcessed, Accrual: 750, CampaignBonus: 250, CreateAt: created},
+					{Number: "3536137811022331", Status: internal.OrderStatusNew, CreateAt: created},
+				}, nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "get orders 204", method: http.MethodGet, path: "/api/user/orders",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetOrders(gomock.Any(), userID).Return(&[]internal.Order{}, nil)
+			},
+			statusCode: 204,
+		},
+		{
+			name: "get order 200", method: http.MethodGet, path: "/api/user/orders/4539088167512356",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				orderID := uuid.New()
+				store.EXPECT().GetOrder(gomock.Any(), "4539088167512356").Return(&internal.Order{ID: orderID,
+					Number: "4539088167512356", Status: internal.OrderStatusProcessing, CreateAt: created, UserID: userID,
+					PollCount: 2, CheckedAt: &created, NextCheckAt: &created}, nil)
+				store.EXPECT().GetOrderHistory(gomock.Any(), orderID).Return(&[]internal.OrderStatusChange{
+					{ID: 1, OrderID: orderID, CreateAt: created, Status: internal.OrderStatusNew, Source: internal.UpdateSourceUpload},
+					{ID: 2, OrderID: orderID, CreateAt: created, FromStatus: internal.OrderStatusNew,
+						Status: internal.OrderStatusProcessing, Source: internal.UpdateSourceCallback},
+				}, nil)
+				store.EXPECT().GetOrderWithdrawals(gomock.Any(), userID, "4539088167512356").Return(&[]internal.Withdraw{
+					{ID: uuid.New(), CreateAt: created, Order: "4539088167512356", Sum: 100, UserID: userID},
+				}, nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "get order 200 campaign", method: http.MethodGet, path: "/api/user/orders/4539088167512356",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				orderID := uuid.New()
+				campaignID := uuid.New()
+				store.EXPECT().GetOrder(gomock.Any(), "4539088167512356").Return(&internal.Order{ID: orderID,
+					Number: "4539088167512356", Status: internal.OrderStatusProcessed, Accrual: 150, CampaignBonus: 50,
+					CampaignID: &campaignID, CreateAt: created, UserID: userID, PollCount: 1, CheckedAt: &created}, nil)
+				store.EXPECT().GetOrderHistory(gomock.Any(), orderID).Return(&[]internal.OrderStatusChange{}, nil)
+				store.EXPECT().GetOrderWithdrawals(gomock.Any(), userID, "4539088167512356").Return(&[]internal.Withdraw{}, nil)
+				store.EXPECT().GetCampaign(gomock.Any(), campaignID).Return(&internal.Campaign{ID: campaignID, Name: "Welcome"}, nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "get order 404 of another user", method: http.MethodGet, path: "/api/user/orders/4539088167512356",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetOrder(gomock.Any(), "4539088167512356").Return(&internal.Order{ID: uuid.New(),
+					Number: "4539088167512356", Status: internal.OrderStatusNew, CreateAt: created, UserID: uuid.New()}, nil)
+			},
+			statusCode: 404,
+		},
+		{
+			name: "get order 404", method: http.MethodGet, path: "/api/user/orders/4539088167512356",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetOrder(gomock.Any(), "4539088167512356").Return(nil, errors2.ErrOrderNotFound)
+			},
+			statusCode: 404,
+		},
+		{
+			name: "add orders 200 json", method: http.MethodPost, path: "/api/user/orders/batch",
+			body: `["4539088167512356","12345"]`, contentType: "application/json",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().AddOrders(gomock.Any(), gomock.Any()).Return(&[]internal.Order{}, nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "add orders 200 text", method: http.MethodPost, path: "/api/user/orders/batch",
+			body: "4539088167512356\n3536137811022331\n", contentType: "text/plain",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().AddOrders(gomock.Any(), gomock.Any()).Return(&[]internal.Order{{Number: "3536137811022331", UserID: userID}}, nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "add orders 400", method: http.MethodPost, path: "/api/user/orders/batch",
+			body: "\n", contentType: "text/plain",
+			statusCode: 400,
+		},
+		{
+			name: "get balance 200", method: http.MethodGet, path: "/api/user/balance",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetWithdrawals(gomock.Any(), userID).Return(&[]internal.Withdraw{{Sum: 12.5}}, nil)
+				store.EXPECT().GetUser(gomock.Any(), userID).Return(&internal.User{ID: userID, Bill: 487.5}, nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "get balance 304", method: http.MethodGet, path: "/api/user/balance",
+			header:     map[string]string{"If-None-Match": `W/"` + userID.String() + `.1"`},
+			statusCode: 304,
+		},
+		{
+			name: "withdraw 200", method: http.MethodPost, path: "/api/user/balance/withdraw",
+			body: `{"order":"2377225624","sum":751}`, contentType: "application/json",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().SaveWithdrawal(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "withdraw 402", method: http.MethodPost, path: "/api/user/balance/withdraw",
+			body: `{"order":"2377225624","sum":751}`, contentType: "application/json",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().SaveWithdrawal(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors2.ErrNotEnoughAmount)
+			},
+			statusCode: 402,
+		},
+		{
+			name: "withdraw 403", method: http.MethodPost, path: "/api/user/balance/withdraw",
+			body: `{"order":"2377225624","sum":751}`, contentType: "application/json",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().SaveWithdrawal(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, withdrawal *internal.Withdraw, rules repositories.WithdrawalRules) error {
+						return rules(&internal.User{ID: userID, Tier: internal.TierBronze}, func(since time.Time) (float32, error) {
+							return 4500, nil
+						})
+					})
+			},
+			statusCode: 403,
+		},
+		{
+			name: "withdraw 422", method: http.MethodPost, path: "/api/user/balance/withdraw",
+			body: `{"order":"12345","sum":751}`, contentType: "application/json",
+			statusCode: 422,
+		},
+		{
+			name: "withdraw 400 source", method: http.MethodPost, path: "/api/user/balance/withdraw?source=partner",
+			body: `{"order":"2377225624","sum":751}`, contentType: "application/json",
+			statusCode: 400,
+		},
+		{
+			name: "get withdrawals 200", method: http.MethodGet, path: "/api/user/withdrawals",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetWithdrawals(gomock.Any(), userID).Return(&[]internal.Withdraw{
+					{Order: "2377225624", Sum: 500, CreateAt: created},
+				}, nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "get withdrawals 204", method: http.MethodGet, path: "/api/user/withdrawals",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetWithdrawals(gomock.Any(), userID).Return(&[]internal.Withdraw{}, nil)
+			},
+			statusCode: 204,
+		},
+		{
+			name: "get statement 200 json", method: http.MethodGet, path: "/api/user/statement?from=2023-11-01&to=2023-11-30",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetStatement(gomock.Any(), userID, gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, userID uuid.UUID, from time.Time, to time.Time, fn func(entry *internal.StatementEntry) error) error {
+						return fn(&internal.StatementEntry{Date: created, Operation: internal.StatementAccrual, Order: "4539088167512356", Amount: 500, Balance: 500})
+					})
+			},
+			statusCode: 200,
+		},
+		{
+			name: "get statement 200 csv", method: http.MethodGet, path: "/api/user/statement?format=csv",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetStatement(gomock.Any(), userID, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "get statement 400", method: http.MethodGet, path: "/api/user/statement?from=yesterday",
+			statusCode: 400,
+		},
+		{
+			name: "get referral 200", method: http.MethodGet, path: "/api/user/referral",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetUser(gomock.Any(), userID).Return(&internal.User{ID: userID, ReferralCode: "K7M2P9QA"}, nil)
+				store.EXPECT().CountReferees(gomock.Any(), userID).Return(2, nil)
+				store.EXPECT().GetReferralCredits(gomock.Any(), userID).Return(&[]internal.ReferralCredit{
+					{ID: uuid.New(), CreateAt: created, UserID: userID, RefereeID: uuid.New(),
+						Role: internal.ReferralRoleReferrer, Order: "4539088167512356", Sum: 100},
+				}, nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "get profile 200", method: http.MethodGet, path: "/api/user/profile",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetUser(gomock.Any(), userID).Return(&internal.User{ID: userID, Login: "user", CreateAt: created,
+					Tier: internal.TierSilver, TierAccrual: 1500, TierUpdatedAt: &created}, nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "get events 200", method: http.MethodGet, path: "/api/user/events",
+			header: map[string]string{"Last-Event-ID": "5"},
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetUserEvents(gomock.Any(), userID, int64(5), gomock.Any()).DoAndReturn(noEvents(cancel))
+			},
+			statusCode: 200,
+		},
+		{
+			name: "add webhook 201", method: http.MethodPost, path: "/api/user/webhooks",
+			body: `{"url":"https://partner.example/hook","event_types":["order.processed"]}`, contentType: "application/json",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().AddWebhook(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+			},
+			statusCode: 201,
+		},
+		{
+			name: "add webhook 422", method: http.MethodPost, path: "/api/user/webhooks",
+			body: `{"url":"ftp://partner.example/hook","event_types":["order.processed"]}`, contentType: "application/json",
+			statusCode: 422,
+		},
+		{
+			name: "get webhooks 200", method: http.MethodGet, path: "/api/user/webhooks",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetWebhooks(gomock.Any(), userID).Return(&[]internal.Webhook{*webhook}, nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "get webhooks 204", method: http.MethodGet, path: "/api/user/webhooks",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetWebhooks(gomock.Any(), userID).Return(&[]internal.Webhook{}, nil)
+			},
+			statusCode: 204,
+		},
+		{
+			name: "get webhook 200", method: http.MethodGet, path: webhookPath,
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetWebhook(gomock.Any(), userID, webhookID).Return(webhook, nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "get webhook 404", method: http.MethodGet, path: webhookPath,
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetWebhook(gomock.Any(), userID, webhookID).Return(nil, errors2.ErrWebhookNotFound)
+			},
+			statusCode: 404,
+		},
+		{
+			name: "update webhook 200", method: http.MethodPut, path: webhookPath,
+			body: `{"url":"https://partner.example/hook","event_types":["order.invalid"],"active":false}`, contentType: "application/json",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetWebhook(gomock.Any(), userID, webhookID).Return(webhook, nil)
+				store.EXPECT().UpdateWebhook(gomock.Any(), gomock.Any()).Return(nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "delete webhook 204", method: http.MethodDelete, path: webhookPath,
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().DeleteWebhook(gomock.Any(), userID, webhookID).Return(nil)
+			},
+			statusCode: 204,
+		},
+		{
+			name: "get deliveries 200", method: http.MethodGet, path: webhookPath + "/deliveries",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetWebhook(gomock.Any(), userID, webhookID).Return(webhook, nil)
+				store.EXPECT().GetWebhookDeliveries(gomock.Any(), userID, webhookID, gomock.Any()).Return(&[]internal.WebhookDelivery{delivery}, nil)
+			},
+			statusCode: 200,
+		},
+		{
+			name: "send test event 404", method: http.MethodPost, path: webhookPath + "/test",
+			prepare: func(store *mock.MockStore, cancel context.CancelFunc) {
+				store.EXPECT().GetWebhook(gomock.Any(), userID, webhookID).Return(nil, errors2.ErrWebhookNotFound)
+			},
+			statusCode: 404,
+		},
+	}
+
+	tiers, err := services.ParseLoyaltyTiers(services.DefaultLoyaltyTiers)
+	require.NoError(t, err)
+	covered := make(map[*openapi3.Operation]bool)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			mockStore := mock.NewMockStore(ctrl)
+			mockStore.EXPECT().GetUserVersion(gomock.Any(), userID).Return(int64(1), nil).AnyTimes()
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			if tt.prepare != nil {
+				tt.prepare(mockStore, cancel)
+			}
+			service := services.NewUserService(mockStore, ordernumber.DefaultSources(), nil, tiers)
+			router := UserRouter(
+				NewHandlerUser(service, secret, false),
+				NewHandlerWebhook(services.NewWebhookService(mockStore, stubSender{})),
+				NewHandlerEvents(services.NewEventBroker(mockStore)),
+				secret,
+				RateLimits{})
+
+			request := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)).WithContext(ctx)
+			if tt.contentType != "" {
+				request.Header.Set("Content-Type", tt.contentType)
+			}
+			for k, v := range tt.header {
+				request.Header.Set(k, v)
+			}
+			if !tt.anonymous {
+				request.AddCookie(&cookie)
+			}
+
+			route, pathParams, err := specRouter.FindRoute(request)
+			require.NoError(t, err, "request isn't described")
+			covered[route.Operation] = true
+			requestInput := &openapi3filter.RequestValidationInput{
+				Request:    request,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+			}
+			require.NoError(t, openapi3filter.ValidateRequest(ctx, requestInput))
+			request.Body = io.NopCloser(strings.NewReader(tt.body))
+
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+			result := responseRecorder.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			responseInput := &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: requestInput,
+				Status:                 result.StatusCode,
+				Header:                 result.Header,
+				Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+			}
+			responseInput.SetBodyBytes(responseRecorder.Body.Bytes())
+			assert.NoError(t, openapi3filter.ValidateResponse(context.Background(), responseInput))
+		})
+	}
+
+	for path, item := range doc.Paths.Map() {
+		for method, operation := range item.Operations() {
+			assert.True(t, covered[operation], fmt.Sprintf("operation %s %s isn't covered by contract test", method, path))
+		}
+	}
+}
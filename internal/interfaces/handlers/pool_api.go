@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type HandlerPool struct {
+	pool *services.PoolWorker
+}
+
+func NewHandlerPool(pool *services.PoolWorker) *HandlerPool {
+	return &HandlerPool{pool: pool}
+}
+
+func (hp *HandlerPool) GetStatus(w http.ResponseWriter, r *http.Request) {
+	status := hp.pool.Status()
+	w.Header().Set("Content-Type", "application/json")
+	if status.State == services.PoolStateDegraded || status.State == services.PoolStateStopped {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(status); err != nil {
+		internal.Log.Error("error encoding response", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+}
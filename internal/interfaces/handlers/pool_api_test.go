@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	mock "github.com/bonus2k/go-musthave-diploma-tpl/internal/mocks"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/ordernumber"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandlerPool_GetStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	service := services.NewUserService(mock.NewMockStore(ctrl), ordernumber.DefaultSources(), nil, nil)
+	handlerPool := NewHandlerPool(services.NewPoolWorker(nil, service, time.Second))
+
+	request := httptest.NewRequest(http.MethodGet, "/api/internal/pool", nil)
+	responseRecorder := httptest.NewRecorder()
+	handlerPool.GetStatus(responseRecorder, request)
+	result := responseRecorder.Result()
+	defer result.Body.Close()
+	resBody, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusServiceUnavailable, result.StatusCode)
+	assert.JSONEq(t, `{"state":"STOPPED","workers":0,"stalled":0,"restarts":0}`, string(resBody))
+}
+
+func TestInternalRouter_PoolRequiresAdminKey(t *testing.T) {
+	adminKey := []byte("admin-secret")
+	ctrl := gomock.NewController(t)
+	service := services.NewUserService(mock.NewMockStore(ctrl), ordernumber.DefaultSources(), nil, nil)
+	handlerPool := NewHandlerPool(services.NewPoolWorker(nil, service, time.Second))
+
+	tests := []struct {
+		name       string
+		adminKey   []byte
+		header     string
+		statusCode int
+	}{
+		{name: "without_key", adminKey: adminKey, statusCode: http.StatusUnauthorized},
+		{name: "wrong_key", adminKey: adminKey, header: "Bearer wrong", statusCode: http.StatusUnauthorized},
+		{name: "admin_key", adminKey: adminKey, header: "Bearer admin-secret", statusCode: http.StatusServiceUnavailable},
+		{name: "admin_api_is_disabled", header: "Bearer ", statusCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := InternalRouter(handlerPool, NewHandlerAccrual(service), &HandlerCampaign{}, nil, tt.adminKey)
+			request := httptest.NewRequest(http.MethodGet, "/pool", nil)
+			if tt.header != "" {
+				request.Header.Set("Authorization", tt.header)
+			}
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+			result := responseRecorder.Result()
+			defer result.Body.Close()
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+)
+
+// RedirectHTTPS redirects the plain HTTP requests to the same URL on the HTTPS server
+// listening on tlsAddress.
+func RedirectHTTPS(tlsAddress string) http.Handler {
+	_, port, _ := net.SplitHostPort(tlsAddress)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
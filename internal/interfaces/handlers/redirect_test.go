@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectHTTPS(t *testing.T) {
+	tests := []struct {
+		name       string
+		tlsAddress string
+		target     string
+		method     string
+		want       string
+	}{
+		{
+			name:       "default HTTPS port",
+			tlsAddress: ":443",
+			target:     "http://example.com:8080/api/user/orders?limit=10",
+			method:     http.MethodGet,
+			want:       "https://example.com/api/user/orders?limit=10",
+		},
+		{
+			name:       "custom HTTPS port",
+			tlsAddress: "localhost:8443",
+			target:     "http://localhost/api/user/login",
+			method:     http.MethodPost,
+			want:       "https://localhost:8443/api/user/login",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.target, nil)
+			recorder := httptest.NewRecorder()
+			RedirectHTTPS(tt.tlsAddress).ServeHTTP(recorder, request)
+			assert.Equal(t, http.StatusPermanentRedirect, recorder.Code)
+			assert.Equal(t, tt.want, recorder.Header().Get("Location"))
+		})
+	}
+}
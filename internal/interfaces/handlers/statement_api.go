@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	statementFormatCSV  = "csv"
+	statementFormatJSON = "json"
+	statementDate       = "2006-01-02"
+	statementFlushSize  = 100
+)
+
+// GetStatement streams the accruals and withdrawals of the user for the period as CSV or JSON.
+// The period is from the first day of the current month till now by default, the dates of
+// from and to are inclusive.
+func (hu *HandlerUser) GetStatement(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("user")
+	from, to, err := parsePeriod(r.URL.Query().Get("from"), r.URL.Query().Get("to"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var writer statementWriter
+	switch format := r.URL.Query().Get("format"); format {
+	case "", statementFormatJSON:
+		writer = &jsonStatement{w: w}
+	case statementFormatCSV:
+		writer = &csvStatement{w: w}
+	default:
+		http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	var count int
+	err = hu.us.WriteStatement(r.Context(), userID, from, to, func(dto *internal.StatementDto) error {
+		if count == 0 {
+			writer.Begin()
+		}
+		count++
+		if err := writer.Write(dto); err != nil {
+			return err
+		}
+		if count%statementFlushSize == 0 {
+			writer.Flush()
+		}
+		return nil
+	})
+	if err != nil && count == 0 {
+		internal.Log.Error("get statement", zap.Error(err))
+		if errors.Is(err, errors2.ErrIllegalPeriod) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		internal.Log.Error("statement is interrupted", zap.Int("entries", count), zap.Error(err))
+		panic(http.ErrAbortHandler)
+	}
+	if count == 0 {
+		writer.Begin()
+	}
+	if err = writer.End(); err != nil {
+		internal.Log.Error("error encoding response", zap.Error(err))
+	}
+}
+
+// parsePeriod reads the period as dates or as RFC 3339 timestamps and returns it as [from, to).
+func parsePeriod(fromParam string, toParam string, now time.Time) (time.Time, time.Time, error) {
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	to := now
+	if fromParam != "" {
+		t, _, err := parseStatementTime(fromParam, now.Location())
+		if err != nil {
+			return from, to, fmt.Errorf("wrong from %q", fromParam)
+		}
+		from = t
+	}
+	if toParam != "" {
+		t, isDate, err := parseStatementTime(toParam, now.Location())
+		if err != nil {
+			return from, to, fmt.Errorf("wrong to %q", toParam)
+		}
+		to = t
+		if isDate {
+			to = t.AddDate(0, 0, 1)
+		}
+	}
+	return from, to, nil
+}
+
+func parseStatementTime(value string, location *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation(statementDate, value, location); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
+
+type statementWriter interface {
+	Begin()
+	Write(dto *internal.StatementDto) error
+	Flush()
+	End() error
+}
+
+func flush(w http.ResponseWriter) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+type jsonStatement struct {
+	w     http.ResponseWriter
+	comma bool
+}
+
+func (s *jsonStatement) Begin() {
+	s.w.Header().Set("Content-Type", "application/json")
+	s.w.WriteHeader(http.StatusOK)
+	fmt.Fprint(s.w, "[")
+}
+
+func (s *jsonStatement) Write(dto *internal.StatementDto) error {
+	data, err := json.Marshal(dto)
+	if err != nil {
+		return err
+	}
+	if s.comma {
+		if _, err = fmt.Fprint(s.w, ","); err != nil {
+			return err
+		}
+	}
+	s.comma = true
+	_, err = s.w.Write(data)
+	return err
+}
+
+func (s *jsonStatement) Flush() {
+	flush(s.w)
+}
+
+func (s *jsonStatement) End() error {
+	_, err := fmt.Fprint(s.w, "]")
+	return err
+}
+
+type csvStatement struct {
+	w      http.ResponseWriter
+	writer *csv.Writer
+}
+
+func (s *csvStatement) Begin() {
+	s.w.Header().Set("Content-Type", "text/csv")
+	s.w.Header().Set("Content-Disposition", `attachment; filename="statement.csv"`)
+	s.w.WriteHeader(http.StatusOK)
+	s.writer = csv.NewWriter(s.w)
+	_ = s.writer.Write([]string{"date", "operation", "order", "amount", "balance"})
+}
+
+func (s *csvStatement) Write(dto *internal.StatementDto) error {
+	err := s.writer.Write([]string{
+		dto.Date.Format(time.RFC3339),
+		dto.Operation,
+		dto.Order,
+		strconv.FormatFloat(float64(dto.Amount), 'f', -1, 32),
+		strconv.FormatFloat(float64(dto.Balance), 'f', -1, 32),
+	})
+	return err
+}
+
+func (s *csvStatement) Flush() {
+	s.writer.Flush()
+	flush(s.w)
+}
+
+func (s *csvStatement) End() error {
+	s.writer.Flush()
+	return s.writer.Error()
+}
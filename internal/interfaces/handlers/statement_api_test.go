@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandlerUser_GetStatement(t *testing.T) {
+	testServices := initTestServices(t)
+	userID := uuid.MustParse(testServices.userID1)
+	entries := []internal.StatementEntry{
+		{Date: time.Date(2023, 11, 10, 11, 0, 0, 0, time.UTC), Operation: internal.StatementAccrual, Order: "4539088167512356", Amount: 100, Balance: 100},
+		{Date: time.Date(2023, 11, 11, 11, 0, 0, 0, time.UTC), Operation: internal.StatementWithdrawal, Order: "140672056", Amount: -12.64, Balance: 87.36},
+	}
+	from := time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	testServices.mockStore.EXPECT().
+		GetStatement(gomock.Any(), userID, from, to, gomock.Any()).
+		DoAndReturn(func(ctx context.Context, userID uuid.UUID, from time.Time, to time.Time, fn func(entry *internal.StatementEntry) error) error {
+			for i := range entries {
+				if err := fn(&entries[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Times(2)
+	testServices.mockStore.EXPECT().
+		GetStatement(gomock.Any(), userID, to, to.AddDate(0, 0, 1), gomock.Any()).
+		Return(nil)
+
+	tests := []struct {
+		name        string
+		query       string
+		statusCode  int
+		contentType string
+		resBody     string
+	}{
+		{
+			name:        "statement json",
+			query:       "?from=2023-11-01T00:00:00Z&to=2023-12-01T00:00:00Z",
+			statusCode:  200,
+			contentType: "application/json",
+			resBody: `[{"date":"2023-11-10T11:00:00Z","operation":"ACCRUAL","order":"4539088167512356","amount":100,"balance":100},
+				{"date":"2023-11-11T11:00:00Z","operation":"WITHDRAWAL","order":"140672056","amount":-12.64,"balance":87.36}]`,
+		},
+		{
+			name:        "statement csv",
+			query:       "?from=2023-11-01T00:00:00Z&to=2023-12-01T00:00:00Z&format=csv",
+			statusCode:  200,
+			contentType: "text/csv",
+			resBody: "date,operation,order,amount,balance\n" +
+				"2023-11-10T11:00:00Z,ACCRUAL,4539088167512356,100,100\n" +
+				"2023-11-11T11:00:00Z,WITHDRAWAL,140672056,-12.64,87.36\n",
+		},
+		{
+			name:        "statement empty",
+			query:       "?from=2023-12-01T00:00:00Z&to=2023-12-02T00:00:00Z",
+			statusCode:  200,
+			contentType: "application/json",
+			resBody:     `[]`,
+		},
+		{
+			name:       "statement 400 format",
+			query:      "?format=xml",
+			statusCode: 400,
+		},
+		{
+			name:       "statement 400 from",
+			query:      "?from=yesterday",
+			statusCode: 400,
+		},
+		{
+			name:       "statement 400 period",
+			query:      "?from=2023-12-01T00:00:00Z&to=2023-11-01T00:00:00Z",
+			statusCode: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/user/statement"+tt.query, nil)
+			request.Header.Set("user", testServices.userID1)
+			responseRecorder := httptest.NewRecorder()
+
+			testServices.handlerUser.GetStatement(responseRecorder, request)
+			result := responseRecorder.Result()
+			defer result.Body.Close()
+			resBody, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, tt.contentType, result.Header.Get("Content-Type"))
+			if tt.contentType == "application/json" {
+				assert.JSONEq(t, tt.resBody, string(resBody))
+			} else {
+				assert.Equal(t, tt.resBody, string(resBody))
+			}
+		})
+	}
+}
+
+func Test_parsePeriod(t *testing.T) {
+	location := time.FixedZone("MSK", 3*60*60)
+	now := time.Date(2023, 11, 15, 12, 0, 0, 0, location)
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		wantFrom time.Time
+		wantTo   time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "default period",
+			wantFrom: time.Date(2023, 11, 1, 0, 0, 0, 0, location),
+			wantTo:   now,
+		},
+		{
+			name:     "dates are inclusive",
+			from:     "2023-10-01",
+			to:       "2023-10-31",
+			wantFrom: time.Date(2023, 10, 1, 0, 0, 0, 0, location),
+			wantTo:   time.Date(2023, 11, 1, 0, 0, 0, 0, location),
+		},
+		{
+			name:     "timestamps",
+			from:     "2023-10-01T10:00:00Z",
+			to:       "2023-10-02T10:00:00Z",
+			wantFrom: time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC),
+			wantTo:   time.Date(2023, 10, 2, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "wrong to",
+			to:      "31.10.2023",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, to, err := parsePeriod(tt.from, tt.to, now)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.wantFrom.Equal(from), "from = %v, want %v", from, tt.wantFrom)
+			assert.True(t, tt.wantTo.Equal(to), "to = %v, want %v", to, tt.wantTo)
+		})
+	}
+}
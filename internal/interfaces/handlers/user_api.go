@@ -1,39 +1,37 @@
 package handlers
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/auth"
 	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
+	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
-	"io"
 	"net/http"
+	"strings"
 )
 
 type HandlerUser struct {
 	us     *services.UserService
 	secret []byte
+	secure bool
 }
 
-func NewHandlerUser(service *services.UserService, secretKey []byte) *HandlerUser {
-	return &HandlerUser{us: service, secret: secretKey}
+// NewHandlerUser creates the handler, secureCookie marks the session cookie Secure
+// and SameSite when the service is served over TLS.
+func NewHandlerUser(service *services.UserService, secretKey []byte, secureCookie bool) *HandlerUser {
+	return &HandlerUser{us: service, secret: secretKey, secure: secureCookie}
 }
 
 func (hu *HandlerUser) RegisterUser(w http.ResponseWriter, r *http.Request) {
-	if r.Header.Get("Content-Type") != "application/json" {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
 	internal.Log.Debug("decoding message")
 	var user internal.UserDto
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&user); err != nil {
+	if err := decodeJSON(w, r, &user); err != nil {
 		internal.Logf.Errorf("cannot decode request JSON body %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeRequestError(w, err)
 		return
 	}
 	newUser, err := hu.us.CreateNewUser(r.Context(), &user)
@@ -47,25 +45,24 @@ func (hu *HandlerUser) RegisterUser(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusConflict)
 			return
 		}
+		if errors.Is(err, errors2.ErrIllegalReferralCode) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	signed := writeSigned(newUser.ID.String(), hu.secret)
+	signed := hu.sessionCookie(newUser.ID.String())
 	http.SetCookie(w, &signed)
 	w.WriteHeader(http.StatusOK)
 }
 
 func (hu *HandlerUser) Login(w http.ResponseWriter, r *http.Request) {
-	if r.Header.Get("Content-Type") != "application/json" {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
 	internal.Log.Debug("decoding message")
 	var user internal.UserDto
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&user); err != nil {
+	if err := decodeJSON(w, r, &user); err != nil {
 		internal.Logf.Errorf("cannot decode request JSON body %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeRequestError(w, err)
 		return
 	}
 	userID, err := hu.us.LoginUser(r.Context(), user)
@@ -78,25 +75,24 @@ func (hu *HandlerUser) Login(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	signed := writeSigned(userID.String(), hu.secret)
+	signed := hu.sessionCookie(userID.String())
 	http.SetCookie(w, &signed)
 	w.WriteHeader(http.StatusOK)
 }
 
+// orderSourceParam is the query parameter with the source of the uploaded or paid order,
+// the rules of the numbers of orders are chosen by it.
+const orderSourceParam = "source"
+
 func (hu *HandlerUser) AddOrder(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("user")
-	if r.Header.Get("Content-Type") != "text/plain" {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-
-	body, err := io.ReadAll(r.Body)
+	body, err := readText(w, r)
 	if err != nil {
 		internal.Log.Error("can't get body", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		writeRequestError(w, err)
 		return
 	}
-	if err = hu.us.AddOrder(r.Context(), userID, string(body)); err != nil {
+	if err = hu.us.AddOrder(r.Context(), userID, r.URL.Query().Get(orderSourceParam), body); err != nil {
 		internal.Log.Error("add order", zap.Error(err))
 		if errors.Is(err, errors2.ErrOrderIsExistThisUser) {
 			w.WriteHeader(http.StatusOK)
@@ -110,14 +106,62 @@ func (hu *HandlerUser) AddOrder(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusUnprocessableEntity)
 			return
 		}
+		if errors.Is(err, errors2.ErrUnknownOrderSource) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// AddOrders uploads the batch of numbers as a JSON array or as text with one number per line.
+func (hu *HandlerUser) AddOrders(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("user")
+	var numbers []string
+	switch mediaType(r) {
+	case contentTypeJSON:
+		if err := decodeJSONBody(w, r, &numbers); err != nil {
+			internal.Logf.Errorf("cannot decode request JSON body %v", err)
+			writeRequestError(w, err)
+			return
+		}
+	case contentTypeText:
+		body, err := readTextBody(w, r)
+		if err != nil {
+			internal.Log.Error("can't get body", zap.Error(err))
+			writeRequestError(w, err)
+			return
+		}
+		for _, line := range strings.Split(body, "\n") {
+			if number := strings.TrimSpace(line); number != "" {
+				numbers = append(numbers, number)
+			}
+		}
+	default:
+		http.Error(w, fmt.Sprintf("content type %q isn't supported", r.Header.Get("Content-Type")), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	results, err := hu.us.AddOrders(r.Context(), userID, r.URL.Query().Get(orderSourceParam), numbers)
+	if err != nil {
+		internal.Log.Error("add orders", zap.Error(err))
+		if errors.Is(err, errors2.ErrIllegalBatch) || errors.Is(err, errors2.ErrUnknownOrderSource) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
 func (hu *HandlerUser) GetOrders(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("user")
+	if hu.notModified(w, r) {
+		return
+	}
 	orders, err := hu.us.GetOrders(r.Context(), userID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -137,8 +181,54 @@ func (hu *HandlerUser) GetOrders(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// GetOrder answers 404 for the order of another user as for an unknown one.
+func (hu *HandlerUser) GetOrder(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("user")
+	order, err := hu.us.GetOrder(r.Context(), userID, chi.URLParam(r, "number"))
+	if err != nil {
+		switch {
+		case errors.Is(err, errors2.ErrIllegalOrder):
+			w.WriteHeader(http.StatusBadRequest)
+		case errors.Is(err, errors2.ErrOrderNotFound), errors.Is(err, errors2.ErrOrderOfAnotherUser):
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			internal.Log.Error("get order", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, order)
+}
+
+// GetReferral returns the referral code of the user and the referral bonuses credited to the user.
+// It has no ETag, the registration of a referee doesn't change the version of the referrer.
+func (hu *HandlerUser) GetReferral(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("user")
+	referral, err := hu.us.GetReferral(r.Context(), userID)
+	if err != nil {
+		internal.Log.Error("get referral", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, referral)
+}
+
+func (hu *HandlerUser) GetProfile(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("user")
+	profile, err := hu.us.GetProfile(r.Context(), userID)
+	if err != nil {
+		internal.Log.Error("get profile", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, profile)
+}
+
 func (hu *HandlerUser) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("user")
+	if hu.notModified(w, r) {
+		return
+	}
 	withdrawals, err := hu.us.GetWithdrawals(r.Context(), userID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -160,6 +250,9 @@ func (hu *HandlerUser) GetWithdrawals(w http.ResponseWriter, r *http.Request) {
 
 func (hu *HandlerUser) GetBalance(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("user")
+	if hu.notModified(w, r) {
+		return
+	}
 	balance, err := hu.us.GetBalance(r.Context(), userID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -179,21 +272,29 @@ func (hu *HandlerUser) AddWithdraw(w http.ResponseWriter, r *http.Request) {
 	userID := r.Header.Get("user")
 	internal.Log.Debug("decoding message")
 	var dto internal.WithdrawDto
-	decoder := json.NewDecoder(r.Body)
-	if err := decoder.Decode(&dto); err != nil {
+	if err := decodeJSON(w, r, &dto); err != nil {
 		internal.Logf.Errorf("cannot decode request JSON body %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeRequestError(w, err)
 		return
 	}
 
-	if err := hu.us.AddWithdraw(r.Context(), dto, userID); err != nil {
+	if err := hu.us.AddWithdraw(r.Context(), dto, userID, r.URL.Query().Get(orderSourceParam)); err != nil {
 		internal.Log.Error("add withdraw", zap.Error(err))
 		if errors.Is(err, errors2.ErrNotEnoughAmount) {
 			w.WriteHeader(http.StatusPaymentRequired)
 			return
 		}
+		if errors.Is(err, errors2.ErrWithdrawalLimit) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		if errors.Is(err, errors2.ErrIllegalOrder) {
 			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		if errors.Is(err, errors2.ErrUnknownOrderSource) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -202,6 +303,17 @@ func (hu *HandlerUser) AddWithdraw(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// sessionCookie is the signed cookie of the user, over TLS it isn't sent by plain HTTP
+// and with the cross-site requests.
+func (hu *HandlerUser) sessionCookie(userID string) http.Cookie {
+	cookie := writeSigned(userID, hu.secret)
+	if hu.secure {
+		cookie.Secure = true
+		cookie.SameSite = http.SameSiteStrictMode
+	}
+	return cookie
+}
+
 func writeSigned(value string, secret []byte) http.Cookie {
 	cookie := http.Cookie{
 		Name:     "gophermart",
@@ -210,12 +322,6 @@ func writeSigned(value string, secret []byte) http.Cookie {
 		MaxAge:   3600,
 		HttpOnly: true,
 	}
-
-	hash := hmac.New(sha256.New, secret)
-	hash.Write([]byte(cookie.Name))
-	hash.Write([]byte(cookie.Value))
-	signature := hash.Sum(nil)
-	value = string(signature) + cookie.Value
-	cookie.Value = base64.URLEncoding.EncodeToString([]byte(value))
+	cookie.Value = auth.Sign(cookie.Name, cookie.Value, secret)
 	return cookie
 }
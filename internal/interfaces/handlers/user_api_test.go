@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"fmt"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
 	mock "github.com/bonus2k/go-musthave-diploma-tpl/internal/mocks"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/ordernumber"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
+	"github.com/go-chi/chi/v5"
 	"github.com/golang/mock/gomock"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
@@ -40,10 +43,10 @@ func initTestServices(t *testing.T) *testData {
 	sign := []byte{116, 79, 253, 154, 106, 127, 165, 70, 139, 56, 218, 213, 105, 253, 76}
 	ctrl := gomock.NewController(t)
 	mockStore := mock.NewMockStore(ctrl)
-	service := services.NewUserService(mockStore)
+	service := services.NewUserService(mockStore, ordernumber.DefaultSources(), nil, nil)
 	return &testData{
 		mockStore:   mockStore,
-		handlerUser: NewHandlerUser(service, sign),
+		handlerUser: NewHandlerUser(service, sign, false),
 		userID1:     "98dcfb07-e16f-4e53-9a28-d2a2e4eed026",
 		cookie1:     writeSigned("98dcfb07-e16f-4e53-9a28-d2a2e4eed026", sign),
 		userID2:     "98dcfb07-e16f-4e53-9a28-d2a2e4eed027",
@@ -54,7 +57,7 @@ func TestNewHandlerUser(t *testing.T) {
 	sign := []byte{116, 79, 253, 154, 106, 127, 165, 70, 139, 56, 218, 213, 105, 253, 76}
 	ctrl := gomock.NewController(t)
 	mockStore := mock.NewMockStore(ctrl)
-	service := services.NewUserService(mockStore)
+	service := services.NewUserService(mockStore, ordernumber.DefaultSources(), nil, nil)
 
 	type args struct {
 		service   *services.UserService
@@ -71,12 +74,12 @@ func TestNewHandlerUser(t *testing.T) {
 				service:   service,
 				secretKey: sign,
 			},
-			want: NewHandlerUser(service, sign),
+			want: NewHandlerUser(service, sign, false),
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := NewHandlerUser(tt.args.service, tt.args.secretKey); !reflect.DeepEqual(got, tt.want) {
+			if got := NewHandlerUser(tt.args.service, tt.args.secretKey, false); !reflect.DeepEqual(got, tt.want) {
 				t.Fatalf("NewHandlerUser() = %v, want %v", got, tt.want)
 			}
 		})
@@ -87,35 +90,43 @@ func TestHandlerUser_AddOrder(t *testing.T) {
 	testServices := initTestServices(t)
 
 	testServices.mockStore.EXPECT().
-		AddOrder(gomock.Any(), &mock.MatchOrder{Order: &internal.Order{Number: 4539088167512356}}).
+		AddOrder(gomock.Any(), &mock.MatchOrder{Order: &internal.Order{Number: "4539088167512356"}}).
 		Return(&internal.Order{}, nil).AnyTimes()
 
 	testServices.mockStore.EXPECT().
-		AddOrder(gomock.Any(), &mock.MatchOrder{Order: &internal.Order{Number: 3533841638640315}}).
+		AddOrder(gomock.Any(), &mock.MatchOrder{Order: &internal.Order{Number: "3533841638640315"}}).
 		Return(nil, errors.ErrOrderIsExistAnotherUser).AnyTimes()
 
 	testServices.mockStore.EXPECT().
-		AddOrder(gomock.Any(), &mock.MatchOrder{Order: &internal.Order{Number: 3536137811022331}}).
+		AddOrder(gomock.Any(), &mock.MatchOrder{Order: &internal.Order{Number: "3536137811022331"}}).
 		Return(nil, errors.ErrOrderIsExistThisUser).AnyTimes()
 
 	tests := []struct {
 		name        string
+		path        string
 		body        string
 		contentType string
 		statusCode  int
 		userID      string
 	}{
 		{
-			name:        "add order 400",
+			name:        "add order 415",
 			body:        "4539088167512356",
 			contentType: "application/json",
-			statusCode:  400,
+			statusCode:  415,
+			userID:      testServices.userID1,
+		},
+		{
+			name:        "add order 413",
+			body:        strings.Repeat("4", maxBodySize+1),
+			contentType: "text/plain",
+			statusCode:  413,
 			userID:      testServices.userID1,
 		},
 		{
 			name:        "add order 200",
 			body:        "3536137811022331",
-			contentType: "text/plain",
+			contentType: "text/plain; charset=utf-8",
 			statusCode:  200,
 			userID:      testServices.userID1,
 		},
@@ -140,11 +151,31 @@ func TestHandlerUser_AddOrder(t *testing.T) {
 			statusCode:  202,
 			userID:      testServices.userID1,
 		},
+		{
+			name:        "add order 202 normalized",
+			path:        "/?source=default",
+			body:        " 4539 0881 6751 2356 ",
+			contentType: "text/plain",
+			statusCode:  202,
+			userID:      testServices.userID1,
+		},
+		{
+			name:        "add order 400 source",
+			path:        "/?source=partner",
+			body:        "4539088167512356",
+			contentType: "text/plain",
+			statusCode:  400,
+			userID:      testServices.userID1,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			request := httptest.NewRequest(http.MethodGet, "/", strings.NewReader(tt.body))
+			path := tt.path
+			if path == "" {
+				path = "/"
+			}
+			request := httptest.NewRequest(http.MethodGet, path, strings.NewReader(tt.body))
 
 			request.Header.Set("user", tt.userID)
 			request.Header.Set("Content-Type", tt.contentType)
@@ -158,15 +189,94 @@ func TestHandlerUser_AddOrder(t *testing.T) {
 	}
 }
 
+func TestHandlerUser_AddOrders(t *testing.T) {
+	testServices := initTestServices(t)
+	userID := uuid.MustParse(testServices.userID1)
+
+	testServices.mockStore.EXPECT().
+		AddOrders(gomock.Any(), gomock.Any()).
+		Return(&[]internal.Order{{Number: "3533841638640315", UserID: uuid.MustParse(testServices.userID2)}}, nil).Times(2)
+
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		statusCode  int
+		resBody     string
+	}{
+		{
+			name:        "add orders 200 json",
+			body:        `["4539088167512356","3533841638640315","12345"]`,
+			contentType: "application/json",
+			statusCode:  200,
+			resBody: `[{"number":"4539088167512356","result":"ACCEPTED"},
+				{"number":"3533841638640315","result":"UPLOADED_BY_ANOTHER_USER"},
+				{"number":"12345","result":"INVALID_NUMBER"}]`,
+		},
+		{
+			name:        "add orders 200 text",
+			body:        "4539088167512356\r\n\n3533841638640315\n",
+			contentType: "text/plain",
+			statusCode:  200,
+			resBody: `[{"number":"4539088167512356","result":"ACCEPTED"},
+				{"number":"3533841638640315","result":"UPLOADED_BY_ANOTHER_USER"}]`,
+		},
+		{
+			name:        "add orders 400 empty",
+			body:        "\n",
+			contentType: "text/plain",
+			statusCode:  400,
+		},
+		{
+			name:        "add orders 400 json",
+			body:        `{"number":"4539088167512356"}`,
+			contentType: "application/json",
+			statusCode:  400,
+		},
+		{
+			name:        "add orders 415 content type",
+			body:        "4539088167512356",
+			contentType: "text/csv",
+			statusCode:  415,
+		},
+		{
+			name:        "add orders 400 unknown JSON",
+			body:        `{"numbers":["4539088167512356"]}`,
+			contentType: "application/json",
+			statusCode:  400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/user/orders/batch", strings.NewReader(tt.body))
+			request.Header.Set("user", userID.String())
+			request.Header.Set("Content-Type", tt.contentType)
+			responseRecorder := httptest.NewRecorder()
+
+			testServices.handlerUser.AddOrders(responseRecorder, request)
+			result := responseRecorder.Result()
+			defer result.Body.Close()
+			resBody, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			if tt.resBody != "" {
+				assert.JSONEq(t, tt.resBody, string(resBody))
+			}
+		})
+	}
+}
+
 func TestHandlerUser_AddWithdraw(t *testing.T) {
 	testServices := initTestServices(t)
 
 	testServices.mockStore.EXPECT().
-		SaveWithdrawal(gomock.Any(), &mock.MatchWithdraw{Withdraw: &internal.Withdraw{Order: 4539088167512356}}).
+		SaveWithdrawal(gomock.Any(), &mock.MatchWithdraw{Withdraw: &internal.Withdraw{Order: "4539088167512356"}}, gomock.Any()).
 		Return(errors.ErrNotEnoughAmount).AnyTimes()
 
 	testServices.mockStore.EXPECT().
-		SaveWithdrawal(gomock.Any(), &mock.MatchWithdraw{Withdraw: &internal.Withdraw{Order: 3533841638640315}}).
+		SaveWithdrawal(gomock.Any(), &mock.MatchWithdraw{Withdraw: &internal.Withdraw{Order: "3533841638640315"}}, gomock.Any()).
 		Return(nil).AnyTimes()
 
 	tests := []struct {
@@ -177,10 +287,38 @@ func TestHandlerUser_AddWithdraw(t *testing.T) {
 		userID      string
 	}{
 		{
-			name:        "AddWithdraw 500",
+			name:        "AddWithdraw 400 empty body",
 			body:        "",
 			contentType: "application/json",
-			statusCode:  500,
+			statusCode:  400,
+			userID:      testServices.userID1,
+		},
+		{
+			name:        "AddWithdraw 400 unknown field",
+			body:        `{"order": "4539088167512356", "sum": 751, "currency": "RUB"}`,
+			contentType: "application/json",
+			statusCode:  400,
+			userID:      testServices.userID1,
+		},
+		{
+			name:        "AddWithdraw 400 wrong type",
+			body:        `{"order": 4539088167512356, "sum": 751}`,
+			contentType: "application/json",
+			statusCode:  400,
+			userID:      testServices.userID1,
+		},
+		{
+			name:        "AddWithdraw 400 two values",
+			body:        `{"order": "4539088167512356", "sum": 751}{}`,
+			contentType: "application/json",
+			statusCode:  400,
+			userID:      testServices.userID1,
+		},
+		{
+			name:        "AddWithdraw 415",
+			body:        `{"order": "4539088167512356", "sum": 751}`,
+			contentType: "text/plain",
+			statusCode:  415,
 			userID:      testServices.userID1,
 		},
 		{
@@ -224,12 +362,15 @@ func TestHandlerUser_AddWithdraw(t *testing.T) {
 
 func TestHandlerUser_GetBalance(t *testing.T) {
 	testServices := initTestServices(t)
+	testServices.mockStore.EXPECT().
+		GetUserVersion(gomock.Any(), gomock.Any()).
+		Return(int64(1), nil).AnyTimes()
 
 	withdraws := &[]internal.Withdraw{
 		{
 			ID:       uuid.MustParse("35e1cbd0-c3ba-44eb-8632-0d91c280dee6"),
 			CreateAt: time.Date(2023, 11, 10, 14, 00, 00, 000, time.Local),
-			Order:    140672056,
+			Order:    "140672056",
 			Sum:      12.64,
 			UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
 		},
@@ -292,12 +433,15 @@ func TestHandlerUser_GetBalance(t *testing.T) {
 
 func TestHandlerUser_GetOrders(t *testing.T) {
 	testServices := initTestServices(t)
+	testServices.mockStore.EXPECT().
+		GetUserVersion(gomock.Any(), gomock.Any()).
+		Return(int64(1), nil).AnyTimes()
 
 	orders := &[]internal.Order{
 		{
 			ID:       uuid.MustParse("334b0360-8222-44fc-bf2e-77ced208f2cd"),
 			CreateAt: time.Date(2023, 01, 01, 14, 01, 00, 000, time.Local),
-			Number:   4539088167512356,
+			Number:   "4539088167512356",
 			Accrual:  100.0,
 			Status:   internal.OrderStatusProcessed,
 			UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
@@ -305,7 +449,7 @@ func TestHandlerUser_GetOrders(t *testing.T) {
 		{
 			ID:       uuid.MustParse("334b0360-8222-44fc-bf2e-77ced208f2ce"),
 			CreateAt: time.Date(2023, 01, 01, 14, 02, 00, 000, time.Local),
-			Number:   3536137811022331,
+			Number:   "3536137811022331",
 			Accrual:  0,
 			Status:   internal.OrderStatusNew,
 			UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
@@ -313,7 +457,7 @@ func TestHandlerUser_GetOrders(t *testing.T) {
 		{
 			ID:       uuid.MustParse("334b0360-8222-44fc-bf2e-77ced208f2cf"),
 			CreateAt: time.Date(2023, 01, 01, 14, 03, 00, 000, time.Local),
-			Number:   3533841638640315,
+			Number:   "3533841638640315",
 			Accrual:  0,
 			Status:   internal.OrderStatusInvalid,
 			UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
@@ -385,14 +529,141 @@ func TestHandlerUser_GetOrders(t *testing.T) {
 	}
 }
 
+func TestHandlerUser_GetOrder(t *testing.T) {
+	testServices := initTestServices(t)
+
+	orderID := uuid.MustParse("334b0360-8222-44fc-bf2e-77ced208f2cd")
+	checkedAt := time.Date(2023, 01, 01, 14, 05, 00, 000, time.Local)
+	nextCheckAt := time.Date(2023, 01, 01, 14, 05, 05, 000, time.Local)
+	order := &internal.Order{
+		ID:          orderID,
+		CreateAt:    time.Date(2023, 01, 01, 14, 01, 00, 000, time.Local),
+		Number:      "4539088167512356",
+		Accrual:     100.0,
+		Status:      internal.OrderStatusProcessed,
+		UserID:      uuid.MustParse(testServices.userID1),
+		PollCount:   3,
+		CheckedAt:   &checkedAt,
+		NextCheckAt: &nextCheckAt,
+	}
+	history := &[]internal.OrderStatusChange{
+		{
+			ID:       1,
+			OrderID:  orderID,
+			CreateAt: time.Date(2023, 01, 01, 14, 01, 00, 000, time.Local),
+			Status:   internal.OrderStatusNew,
+			Source:   internal.UpdateSourceUpload,
+		},
+		{
+			ID:         2,
+			OrderID:    orderID,
+			CreateAt:   time.Date(2023, 01, 01, 14, 05, 00, 000, time.Local),
+			FromStatus: internal.OrderStatusNew,
+			Status:     internal.OrderStatusProcessed,
+			Source:     internal.UpdateSourcePoll,
+		},
+	}
+
+	testServices.mockStore.EXPECT().
+		GetOrder(gomock.Any(), "4539088167512356").
+		Return(order, nil).AnyTimes()
+	testServices.mockStore.EXPECT().
+		GetOrder(gomock.Any(), "3536137811022331").
+		Return(nil, errors.ErrOrderNotFound).AnyTimes()
+	testServices.mockStore.EXPECT().
+		GetOrderHistory(gomock.Any(), orderID).
+		Return(history, nil).AnyTimes()
+	testServices.mockStore.EXPECT().
+		GetOrderWithdrawals(gomock.Any(), uuid.MustParse(testServices.userID1), "4539088167512356").
+		Return(&[]internal.Withdraw{
+			{
+				ID:       uuid.MustParse("334b0360-8222-44fc-bf2e-77ced208f2ce"),
+				CreateAt: time.Date(2023, 01, 01, 15, 00, 00, 000, time.Local),
+				Order:    "4539088167512356",
+				Sum:      50,
+				UserID:   uuid.MustParse(testServices.userID1),
+			},
+		}, nil).AnyTimes()
+
+	router := chi.NewRouter()
+	router.Get("/{number}", testServices.handlerUser.GetOrder)
+
+	tests := []struct {
+		name       string
+		number     string
+		statusCode int
+		wantBody   string
+		userID     string
+	}{
+		{
+			name:       "GetOrder 200",
+			number:     "4539088167512356",
+			statusCode: 200,
+			userID:     testServices.userID1,
+			wantBody: fmt.Sprintf(`{"number":"4539088167512356","status":"PROCESSED","accrual":100,"uploaded_at":%q,
+						"history":[
+							{"status":"NEW","source":"UPLOAD","changed_at":%[1]q},
+							{"from":"NEW","status":"PROCESSED","source":"POLL","changed_at":%[2]q}
+						],
+						"poll_count":3,"checked_at":%[2]q,
+						"withdrawals":[{"order":"4539088167512356","sum":50,"processed_at":%[3]q}]}`,
+				order.CreateAt.Format(time.RFC3339), checkedAt.Format(time.RFC3339),
+				time.Date(2023, 01, 01, 15, 00, 00, 000, time.Local).Format(time.RFC3339)),
+		},
+		{
+			name:       "GetOrder 400",
+			number:     "order_1",
+			statusCode: 400,
+			userID:     testServices.userID1,
+		},
+		{
+			name:       "GetOrder 404 of another user",
+			number:     "4539088167512356",
+			statusCode: 404,
+			userID:     testServices.userID2,
+		},
+		{
+			name:       "GetOrder 404",
+			number:     "3536137811022331",
+			statusCode: 404,
+			userID:     testServices.userID1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/"+tt.number, nil)
+			request.Header.Set("user", tt.userID)
+			responseRecorder := httptest.NewRecorder()
+
+			router.ServeHTTP(responseRecorder, request)
+			result := responseRecorder.Result()
+
+			defer result.Body.Close()
+			resBody, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			if tt.wantBody == "" {
+				assert.Empty(t, resBody)
+				return
+			}
+			assert.JSONEq(t, tt.wantBody, string(resBody))
+		})
+	}
+}
+
 func TestHandlerUser_GetWithdrawals(t *testing.T) {
 	testServices := initTestServices(t)
+	testServices.mockStore.EXPECT().
+		GetUserVersion(gomock.Any(), gomock.Any()).
+		Return(int64(1), nil).AnyTimes()
 
 	withdraws := &[]internal.Withdraw{
 		{
 			ID:       uuid.MustParse("35e1cbd0-c3ba-44eb-8632-0d91c280dee6"),
 			CreateAt: time.Date(2023, 11, 10, 14, 00, 00, 000, time.Local),
-			Order:    140672056,
+			Order:    "140672056",
 			Sum:      12.64,
 			UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
 		},
@@ -459,6 +730,72 @@ func TestHandlerUser_GetWithdrawals(t *testing.T) {
 	}
 }
 
+func TestHandlerUser_GetReferral(t *testing.T) {
+	testServices := initTestServices(t)
+	userID := uuid.MustParse(testServices.userID1)
+	creditedAt := time.Date(2023, 11, 10, 14, 00, 00, 000, time.Local)
+
+	testServices.mockStore.EXPECT().
+		GetUser(gomock.Any(), userID).
+		Return(&internal.User{ID: userID, ReferralCode: "K7M2P9QA"}, nil).AnyTimes()
+	testServices.mockStore.EXPECT().
+		CountReferees(gomock.Any(), userID).
+		Return(2, nil).AnyTimes()
+	testServices.mockStore.EXPECT().
+		GetReferralCredits(gomock.Any(), userID).
+		Return(&[]internal.ReferralCredit{
+			{
+				ID:        uuid.MustParse("35e1cbd0-c3ba-44eb-8632-0d91c280dee6"),
+				CreateAt:  creditedAt,
+				UserID:    userID,
+				RefereeID: uuid.MustParse(testServices.userID2),
+				Role:      internal.ReferralRoleReferrer,
+				Order:     "4539088167512356",
+				Sum:       100,
+			},
+		}, nil).AnyTimes()
+
+	tests := []struct {
+		name       string
+		statusCode int
+		wantBody   string
+		userID     string
+	}{
+		{
+			name:       "GetReferral 500",
+			statusCode: 500,
+			userID:     "12345",
+		},
+		{
+			name:       "GetReferral 200",
+			statusCode: 200,
+			userID:     testServices.userID1,
+			wantBody: fmt.Sprintf(`{"code":"K7M2P9QA","invited":2,"earned":100,"credits":[
+				{"role":"REFERRER","order":"4539088167512356","sum":100,"credited_at":%q}]}`, creditedAt.Format(time.RFC3339)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set("user", tt.userID)
+			responseRecorder := httptest.NewRecorder()
+
+			testServices.handlerUser.GetReferral(responseRecorder, request)
+			result := responseRecorder.Result()
+
+			defer result.Body.Close()
+			resBody, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			if len(resBody) != 0 {
+				assert.JSONEq(t, tt.wantBody, string(resBody))
+			}
+		})
+	}
+}
+
 func TestHandlerUser_Login(t *testing.T) {
 	testServices := initTestServices(t)
 
@@ -482,18 +819,18 @@ func TestHandlerUser_Login(t *testing.T) {
 		wantCookie  *http.Cookie
 	}{
 		{
-			name:        "User Login 400",
+			name:        "User Login 415",
 			contentType: "text",
-			statusCode:  400,
+			statusCode:  415,
 		},
 		{
-			name:        "User Login 500",
+			name:        "User Login 400",
 			contentType: "application/json",
-			statusCode:  500,
+			statusCode:  400,
 		},
 		{
 			name:        "User Login 200",
-			contentType: "application/json",
+			contentType: "application/json; charset=UTF-8",
 			statusCode:  200,
 			body: `{
 						"login": "TestUser1",
@@ -545,6 +882,10 @@ func TestHandlerUser_RegisterUser(t *testing.T) {
 		AddUser(gomock.Any(), &mock.MatchUser{User: &internal.User{Login: "TestUser2"}}).
 		Return(errors.ErrUserIsExist).AnyTimes()
 
+	testServices.mockStore.EXPECT().
+		FindUserByReferralCode(gomock.Any(), "K7M2P9QA").
+		Return(nil, errors.ErrUserNotFound).AnyTimes()
+
 	tests := []struct {
 		name        string
 		body        string
@@ -553,14 +894,26 @@ func TestHandlerUser_RegisterUser(t *testing.T) {
 		wantCookie  *http.Cookie
 	}{
 		{
-			name:        "RegisterUser 400",
+			name:        "RegisterUser 415",
 			contentType: "text",
+			statusCode:  415,
+		},
+		{
+			name:        "RegisterUser 400",
+			contentType: "application/json",
 			statusCode:  400,
 		},
 		{
-			name:        "RegisterUser 500",
+			name:        "RegisterUser 400 malformed",
 			contentType: "application/json",
-			statusCode:  500,
+			statusCode:  400,
+			body:        `{"login": "TestUser1", "password": `,
+		},
+		{
+			name:        "RegisterUser 413",
+			contentType: "application/json",
+			statusCode:  413,
+			body:        `{"login": "` + strings.Repeat("a", maxBodySize) + `"}`,
 		},
 		{
 			name:        "RegisterUser 200",
@@ -581,6 +934,16 @@ func TestHandlerUser_RegisterUser(t *testing.T) {
 						"password": "password"
 					}`,
 		},
+		{
+			name:        "RegisterUser 400 referral code",
+			contentType: "application/json",
+			statusCode:  400,
+			body: `{
+						"login": "TestUser1",
+						"password": "password",
+						"referral_code": "k7m2p9qa"
+					}`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -639,3 +1002,27 @@ func Test_writeSigned(t *testing.T) {
 		})
 	}
 }
+
+func TestHandlerUser_sessionCookie(t *testing.T) {
+	sign := []byte{116, 79, 253, 154, 106, 127, 165, 70, 139, 56, 218, 213, 105, 253, 76}
+	userID := "42f0558c-04f3-4e11-9ee1-6de717ca69e9"
+	tests := []struct {
+		name         string
+		secure       bool
+		wantSameSite http.SameSite
+	}{
+		{name: "plain HTTP", secure: false, wantSameSite: 0},
+		{name: "TLS", secure: true, wantSameSite: http.SameSiteStrictMode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hu := NewHandlerUser(nil, sign, tt.secure)
+			got := hu.sessionCookie(userID)
+			want := writeSigned(userID, sign)
+			assert.Equal(t, want.Value, got.Value)
+			assert.True(t, got.HttpOnly)
+			assert.Equal(t, tt.secure, got.Secure)
+			assert.Equal(t, tt.wantSameSite, got.SameSite)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+type HandlerWebhook struct {
+	ws *services.WebhookService
+}
+
+func NewHandlerWebhook(service *services.WebhookService) *HandlerWebhook {
+	return &HandlerWebhook{ws: service}
+}
+
+func (hw *HandlerWebhook) AddWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("user")
+	dto, ok := decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+	webhook, err := hw.ws.CreateWebhook(r.Context(), userID, dto)
+	if err != nil {
+		internal.Log.Error("add webhook", zap.Error(err))
+		writeWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, webhook)
+}
+
+func (hw *HandlerWebhook) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("user")
+	webhooks, err := hw.ws.GetWebhooks(r.Context(), userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(*webhooks) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, webhooks)
+}
+
+func (hw *HandlerWebhook) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("user")
+	webhook, err := hw.ws.GetWebhook(r.Context(), userID, chi.URLParam(r, "id"))
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+func (hw *HandlerWebhook) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("user")
+	dto, ok := decodeWebhook(w, r)
+	if !ok {
+		return
+	}
+	webhook, err := hw.ws.UpdateWebhook(r.Context(), userID, chi.URLParam(r, "id"), dto)
+	if err != nil {
+		internal.Log.Error("update webhook", zap.Error(err))
+		writeWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+func (hw *HandlerWebhook) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("user")
+	if err := hw.ws.DeleteWebhook(r.Context(), userID, chi.URLParam(r, "id")); err != nil {
+		internal.Log.Error("delete webhook", zap.Error(err))
+		writeWebhookError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (hw *HandlerWebhook) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("user")
+	deliveries, err := hw.ws.GetDeliveries(r.Context(), userID, chi.URLParam(r, "id"))
+	if err != nil {
+		writeWebhookError(w, err)
+		return
+	}
+	if len(*deliveries) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+func (hw *HandlerWebhook) SendTestEvent(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("user")
+	delivery, err := hw.ws.SendTestEvent(r.Context(), userID, chi.URLParam(r, "id"))
+	if err != nil {
+		internal.Log.Error("send test event", zap.Error(err))
+		writeWebhookError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, delivery)
+}
+
+func decodeWebhook(w http.ResponseWriter, r *http.Request) (internal.WebhookDto, bool) {
+	var dto internal.WebhookDto
+	internal.Log.Debug("decoding message")
+	if err := decodeJSON(w, r, &dto); err != nil {
+		internal.Logf.Errorf("cannot decode request JSON body %v", err)
+		writeRequestError(w, err)
+		return dto, false
+	}
+	return dto, true
+}
+
+func writeWebhookError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errors2.ErrWebhookNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errors2.ErrIllegalWebhook) || errors.Is(err, errors2.ErrWebhookLimit) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(value); err != nil {
+		internal.Log.Error("error encoding response", zap.Error(err))
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	mock "github.com/bonus2k/go-musthave-diploma-tpl/internal/mocks"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type stubSender struct{}
+
+func (s stubSender) Send(ctx context.Context, url string, headers map[string]string, body []byte) (int, error) {
+	return http.StatusOK, nil
+}
+
+func TestHandlerWebhook(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockStore := mock.NewMockStore(ctrl)
+	hw := NewHandlerWebhook(services.NewWebhookService(mockStore, stubSender{}))
+	router := chi.NewRouter()
+	router.Post("/", hw.AddWebhook)
+	router.Get("/", hw.GetWebhooks)
+	router.Get("/{id}", hw.GetWebhook)
+	router.Put("/{id}", hw.UpdateWebhook)
+	router.Delete("/{id}", hw.DeleteWebhook)
+
+	userID := uuid.MustParse("6e2a9d4e-2a0b-4e4b-9a55-8c6e1f0c6e21")
+	webhookID := uuid.MustParse("334b0360-8222-44fc-bf2e-77ced208f2cd")
+	unknownID := uuid.MustParse("c4d1e8a0-9f5a-4a8e-a7a1-0d2f0a5c3b11")
+	webhook := &internal.Webhook{
+		ID:         webhookID,
+		CreateAt:   time.Date(2023, 01, 01, 14, 00, 00, 000, time.UTC),
+		UserID:     userID,
+		URL:        "https://partner.example/hook",
+		Secret:     "secret",
+		EventTypes: "order.processed",
+		Active:     true,
+	}
+	mockStore.EXPECT().AddWebhook(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	mockStore.EXPECT().GetWebhooks(gomock.Any(), userID).Return(&[]internal.Webhook{}, nil)
+	mockStore.EXPECT().GetWebhook(gomock.Any(), userID, webhookID).Return(webhook, nil).Times(2)
+	mockStore.EXPECT().GetWebhook(gomock.Any(), userID, unknownID).Return(nil, errors2.ErrWebhookNotFound)
+	mockStore.EXPECT().UpdateWebhook(gomock.Any(), gomock.Any()).Return(nil)
+	mockStore.EXPECT().DeleteWebhook(gomock.Any(), userID, webhookID).Return(nil)
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		body        string
+		contentType string
+		statusCode  int
+		resBody     string
+	}{
+		{
+			name:        "AddWebhook 201",
+			method:      http.MethodPost,
+			target:      "/",
+			body:        `{"url":"https://partner.example/hook","event_types":["order.processed"]}`,
+			contentType: "application/json",
+			statusCode:  201,
+		},
+		{
+			name:        "AddWebhook 415",
+			method:      http.MethodPost,
+			target:      "/",
+			body:        `{"url":"https://partner.example/hook","event_types":["order.processed"]}`,
+			contentType: "text/plain",
+			statusCode:  415,
+		},
+		{
+			name:        "AddWebhook 422",
+			method:      http.MethodPost,
+			target:      "/",
+			body:        `{"url":"partner.example/hook","event_types":["order.processed"]}`,
+			contentType: "application/json",
+			statusCode:  422,
+		},
+		{
+			name:       "GetWebhooks 204",
+			method:     http.MethodGet,
+			target:     "/",
+			statusCode: 204,
+		},
+		{
+			name:       "GetWebhook 200",
+			method:     http.MethodGet,
+			target:     "/" + webhookID.String(),
+			statusCode: 200,
+			resBody: `{"id":"334b0360-8222-44fc-bf2e-77ced208f2cd","url":"https://partner.example/hook",
+				"event_types":["order.processed"],"active":true,"created_at":"2023-01-01T14:00:00Z"}`,
+		},
+		{
+			name:       "GetWebhook 404",
+			method:     http.MethodGet,
+			target:     "/" + unknownID.String(),
+			statusCode: 404,
+		},
+		{
+			name:       "GetWebhook 404 wrong id",
+			method:     http.MethodGet,
+			target:     "/webhook",
+			statusCode: 404,
+		},
+		{
+			name:        "UpdateWebhook 200",
+			method:      http.MethodPut,
+			target:      "/" + webhookID.String(),
+			body:        `{"url":"https://partner.example/hook","event_types":["order.invalid"],"active":false}`,
+			contentType: "application/json",
+			statusCode:  200,
+			resBody: `{"id":"334b0360-8222-44fc-bf2e-77ced208f2cd","url":"https://partner.example/hook",
+				"event_types":["order.invalid"],"active":false,"created_at":"2023-01-01T14:00:00Z"}`,
+		},
+		{
+			name:       "DeleteWebhook 204",
+			method:     http.MethodDelete,
+			target:     "/" + webhookID.String(),
+			statusCode: 204,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			request.Header.Set("user", userID.String())
+			if tt.contentType != "" {
+				request.Header.Set("Content-Type", tt.contentType)
+			}
+			responseRecorder := httptest.NewRecorder()
+			router.ServeHTTP(responseRecorder, request)
+			result := responseRecorder.Result()
+			defer result.Body.Close()
+			resBody, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			if tt.resBody != "" {
+				assert.JSONEq(t, tt.resBody, string(resBody))
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"net/http"
+	"strings"
+)
+
+const bearerPrefix = "Bearer "
+
+// AdminKey passes only requests of the operators which send adminKey in the
+// Authorization: Bearer header.
+func AdminKey(adminKey []byte) func(http.Handler) http.Handler {
+	key := adminKey
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			token, ok := strings.CutPrefix(header, bearerPrefix)
+			if !ok || subtle.ConstantTimeCompare([]byte(token), key) != 1 {
+				internal.Log.Error("admin key is wrong")
+				http.Error(w, "admin key is wrong", http.StatusUnauthorized)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package middlewares
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminKey(t *testing.T) {
+	key := []byte("admin-secret")
+
+	tests := []struct {
+		name          string
+		authorization string
+		statusCode    int
+	}{
+		{
+			name:          "key is correct",
+			authorization: "Bearer admin-secret",
+			statusCode:    http.StatusOK,
+		},
+		{
+			name:          "another key",
+			authorization: "Bearer another-secret",
+			statusCode:    http.StatusUnauthorized,
+		},
+		{
+			name:          "key without scheme",
+			authorization: "admin-secret",
+			statusCode:    http.StatusUnauthorized,
+		},
+		{
+			name:       "key is absent",
+			statusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			responseRecorder := httptest.NewRecorder()
+			AdminKey(key)(next).ServeHTTP(responseRecorder, request)
+			assert.Equal(t, tt.statusCode, responseRecorder.Code)
+		})
+	}
+}
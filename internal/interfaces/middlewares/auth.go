@@ -1,11 +1,8 @@
 package middlewares
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
-	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/auth"
 	"go.uber.org/zap"
 	"net/http"
 )
@@ -20,7 +17,7 @@ func Authentication(secretKey []byte) func(http.Handler) http.Handler {
 				http.Error(w, "cookie is wrong", http.StatusUnauthorized)
 				return
 			}
-			r.Header.Add("user", userID)
+			r.Header.Set("user", userID)
 			h.ServeHTTP(w, r)
 		})
 	}
@@ -31,25 +28,5 @@ func readSigned(r *http.Request, secretKey []byte) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	signedValue, err := base64.URLEncoding.DecodeString(cookie.Value)
-	if err != nil {
-		return "", errors2.ErrInvalidValue
-	}
-	if len(signedValue) < sha256.Size {
-		return "", errors2.ErrInvalidValue
-	}
-
-	signature := signedValue[:sha256.Size]
-	value := signedValue[sha256.Size:]
-
-	mac := hmac.New(sha256.New, secretKey)
-	mac.Write([]byte(cookie.Name))
-	mac.Write(value)
-	expectedSignature := mac.Sum(nil)
-
-	if !hmac.Equal([]byte(signature), expectedSignature) {
-		return "", errors2.ErrInvalidValue
-	}
-
-	return string(value), nil
+	return auth.ReadSigned(cookie.Name, cookie.Value, secretKey)
 }
@@ -1,6 +1,8 @@
 package middlewares
 
 import (
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/auth"
+	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -77,3 +79,20 @@ func Test_readSigned(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthentication_ReplacesUserHeader(t *testing.T) {
+	sign := []byte{116, 79, 253, 154, 106, 127, 165, 70, 139, 56, 218, 213, 105, 253, 76}
+	var users []string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		users = r.Header.Values("user")
+	})
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("user", "98dcfb07-e16f-4e53-9a28-d2a2e4eed027")
+	request.AddCookie(&http.Cookie{Name: "gophermart", Value: auth.Sign("gophermart", "98dcfb07-e16f-4e53-9a28-d2a2e4eed026", sign)})
+	recorder := httptest.NewRecorder()
+
+	Authentication(sign)(next).ServeHTTP(recorder, request)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, []string{"98dcfb07-e16f-4e53-9a28-d2a2e4eed026"}, users, "user of client must be replaced")
+}
@@ -0,0 +1,156 @@
+package middlewares
+
+import (
+	"bytes"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_negotiateEncoding(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{name: "nothing is accepted", header: "", want: ""},
+		{name: "gzip", header: "gzip", want: encodingGzip},
+		{name: "preference of server", header: "gzip, deflate, br, zstd", want: encodingZstd},
+		{name: "q-values", header: "zstd;q=0.5, br;q=0.8, gzip", want: encodingGzip},
+		{name: "refused encoding", header: "zstd;q=0, br;q=0", want: ""},
+		{name: "any encoding", header: "*", want: encodingZstd},
+		{name: "any encoding except refused", header: "*, zstd;q=0", want: encodingBrotli},
+		{name: "unknown encoding", header: "deflate, identity", want: ""},
+		{name: "case and spaces", header: " GZIP ; q=0.9 ", want: encodingGzip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, negotiateEncoding(tt.header))
+		})
+	}
+}
+
+func decode(t *testing.T, encoding string, body []byte) string {
+	var reader io.Reader
+	var err error
+	switch encoding {
+	case encodingGzip:
+		reader, err = gzip.NewReader(bytes.NewReader(body))
+	case encodingZstd:
+		reader, err = zstd.NewReader(bytes.NewReader(body))
+	case encodingBrotli:
+		reader = brotli.NewReader(bytes.NewReader(body))
+	default:
+		return string(body)
+	}
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(decoded)
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"number":"12345678903","status":"PROCESSED"},`, 50)
+
+	tests := []struct {
+		name         string
+		accept       string
+		method       string
+		contentType  string
+		statusCode   int
+		body         string
+		wantEncoding string
+	}{
+		{name: "gzip", accept: "gzip", body: large, wantEncoding: encodingGzip},
+		{name: "zstd", accept: "zstd", body: large, wantEncoding: encodingZstd},
+		{name: "brotli", accept: "br", body: large, wantEncoding: encodingBrotli},
+		{name: "small body", accept: "gzip", body: `{"current":500}`},
+		{name: "not accepted", body: large},
+		{name: "head request", accept: "gzip", method: http.MethodHead},
+		{name: "event stream", accept: "gzip", contentType: "text/event-stream", body: large},
+		{name: "no content", accept: "gzip", statusCode: http.StatusNoContent},
+		{name: "error status", accept: "gzip", statusCode: http.StatusConflict, body: large, wantEncoding: encodingGzip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				if tt.statusCode != 0 {
+					w.WriteHeader(tt.statusCode)
+				}
+				_, _ = io.WriteString(w, tt.body)
+			})
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			request := httptest.NewRequest(method, "/", nil)
+			request.Header.Set("Accept-Encoding", tt.accept)
+			recorder := httptest.NewRecorder()
+
+			Compress(1024)(next).ServeHTTP(recorder, request)
+			result := recorder.Result()
+			defer result.Body.Close()
+
+			wantStatus := tt.statusCode
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			assert.Equal(t, wantStatus, result.StatusCode)
+			assert.Equal(t, tt.wantEncoding, result.Header.Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", result.Header.Get("Vary"))
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.body, decode(t, tt.wantEncoding, body))
+		})
+	}
+}
+
+func TestCompress_Flush(t *testing.T) {
+	chunk := strings.Repeat("date,operation,order,amount,balance\n", 40)
+	flushed := make(chan string, 2)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, chunk)
+		w.(http.Flusher).Flush()
+		flushed <- w.Header().Get("Content-Encoding")
+		_, _ = io.WriteString(w, chunk)
+	})
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+
+	Compress(1024)(next).ServeHTTP(recorder, request)
+	result := recorder.Result()
+	defer result.Body.Close()
+
+	assert.Equal(t, encodingGzip, <-flushed)
+	assert.True(t, recorder.Flushed)
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	assert.Equal(t, chunk+chunk, decode(t, encodingGzip, body))
+}
+
+func TestCompress_FlushSmall(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "retry: 3000\n\n")
+		w.(http.Flusher).Flush()
+		_, _ = io.WriteString(w, strings.Repeat("data: {}\n\n", 200))
+	})
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Accept-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+
+	Compress(1024)(next).ServeHTTP(recorder, request)
+
+	assert.Empty(t, recorder.Header().Get("Content-Encoding"))
+	assert.Equal(t, "retry: 3000\n\n"+strings.Repeat("data: {}\n\n", 200), recorder.Body.String())
+}
@@ -0,0 +1,79 @@
+package middlewares
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/andybalholm/brotli"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Decompress inflates the request body encoded by gzip, zstd or brotli before the handler
+// reads it. The body inflated over maxSize bytes is refused with 413, the broken one with 400.
+func Decompress(maxSize int64) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			if encoding == "" || encoding == encodingIdentity {
+				h.ServeHTTP(w, r)
+				return
+			}
+			reader, err := newDecoder(encoding, r.Body)
+			if err != nil {
+				internal.Log.Error("can't decode body", zap.String("encoding", encoding), zap.Error(err))
+				if _, ok := err.(unsupportedEncodingError); ok {
+					w.Header().Set("Accept-Encoding", strings.Join(encodings, ", "))
+					http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+					return
+				}
+				http.Error(w, "body can't be decoded", http.StatusBadRequest)
+				return
+			}
+			body, err := io.ReadAll(io.LimitReader(reader, maxSize+1))
+			reader.Close()
+			if err != nil {
+				internal.Log.Error("can't decode body", zap.String("encoding", encoding), zap.Error(err))
+				http.Error(w, "body can't be decoded", http.StatusBadRequest)
+				return
+			}
+			if int64(len(body)) > maxSize {
+				http.Error(w, fmt.Sprintf("decoded body is larger than %d bytes", maxSize), http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Header.Del("Content-Encoding")
+			r.Header.Set("Content-Length", strconv.Itoa(len(body)))
+			r.ContentLength = int64(len(body))
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+type unsupportedEncodingError string
+
+func (e unsupportedEncodingError) Error() string {
+	return fmt.Sprintf("content encoding %q isn't supported", string(e))
+}
+
+func newDecoder(encoding string, body io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case encodingGzip:
+		return gzip.NewReader(body)
+	case encodingZstd:
+		decoder, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case encodingBrotli:
+		return io.NopCloser(brotli.NewReader(body)), nil
+	default:
+		return nil, unsupportedEncodingError(encoding)
+	}
+}
@@ -0,0 +1,87 @@
+package middlewares
+
+import (
+	"bytes"
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func encode(t *testing.T, encoding string, body string) []byte {
+	var buf bytes.Buffer
+	var writer io.WriteCloser
+	switch encoding {
+	case encodingGzip:
+		writer = gzip.NewWriter(&buf)
+	case encodingZstd:
+		e, err := zstd.NewWriter(&buf)
+		require.NoError(t, err)
+		writer = e
+	case encodingBrotli:
+		writer = brotli.NewWriter(&buf)
+	default:
+		return []byte(body)
+	}
+	_, err := io.WriteString(writer, body)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	batch := `["12345678903","9278923470"]`
+
+	tests := []struct {
+		name       string
+		encoding   string
+		body       []byte
+		statusCode int
+		wantBody   string
+	}{
+		{name: "gzip", encoding: encodingGzip, body: encode(t, encodingGzip, batch), statusCode: http.StatusOK, wantBody: batch},
+		{name: "zstd", encoding: encodingZstd, body: encode(t, encodingZstd, batch), statusCode: http.StatusOK, wantBody: batch},
+		{name: "brotli", encoding: encodingBrotli, body: encode(t, encodingBrotli, batch), statusCode: http.StatusOK, wantBody: batch},
+		{name: "not encoded", body: []byte(batch), statusCode: http.StatusOK, wantBody: batch},
+		{name: "identity", encoding: encodingIdentity, body: []byte(batch), statusCode: http.StatusOK, wantBody: batch},
+		{name: "larger than limit", encoding: encodingGzip, body: encode(t, encodingGzip, strings.Repeat("0", 1025)), statusCode: http.StatusRequestEntityTooLarge},
+		{name: "limit", encoding: encodingGzip, body: encode(t, encodingGzip, strings.Repeat("0", 1024)), statusCode: http.StatusOK, wantBody: strings.Repeat("0", 1024)},
+		{name: "broken body", encoding: encodingGzip, body: []byte(batch), statusCode: http.StatusBadRequest},
+		{name: "truncated body", encoding: encodingGzip, body: encode(t, encodingGzip, batch)[:20], statusCode: http.StatusBadRequest},
+		{name: "unsupported encoding", encoding: "deflate", body: []byte(batch), statusCode: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBody string
+			var gotEncoding string
+			var gotLength int64
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				gotBody = string(b)
+				gotEncoding = r.Header.Get("Content-Encoding")
+				gotLength = r.ContentLength
+			})
+			request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			request.Header.Set("Content-Encoding", tt.encoding)
+			recorder := httptest.NewRecorder()
+
+			Decompress(1024)(next).ServeHTTP(recorder, request)
+
+			assert.Equal(t, tt.statusCode, recorder.Code)
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+			assert.Equal(t, tt.wantBody, gotBody)
+			assert.Equal(t, int64(len(tt.wantBody)), gotLength)
+			if tt.encoding != encodingIdentity {
+				assert.Empty(t, gotEncoding)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"go.uber.org/zap"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimiter takes a token from the bucket of key, e.g. services.MemoryRateLimiter.
+type RateLimiter interface {
+	Take(ctx context.Context, key string, limit internal.RateLimit) (*internal.RateDecision, error)
+}
+
+// KeyGlobal keys one bucket for all requests.
+func KeyGlobal(*http.Request) string {
+	return "all"
+}
+
+// KeyByUser keys the bucket by the user set by Authentication.
+func KeyByUser(r *http.Request) string {
+	return "user:" + r.Header.Get("user")
+}
+
+// KeyByIP keys the bucket by the address of the client, it's meant for the anonymous routes.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// RateLimit passes the request when the bucket of the group and the key has a token and
+// answers 429 otherwise. The state of the bucket is sent in the RateLimit-* headers. The
+// request passes when the limiter fails, so the limiter isn't a single point of failure.
+func RateLimit(limiter RateLimiter, group string, limit internal.RateLimit, key func(r *http.Request) string) func(http.Handler) http.Handler {
+	policy := fmt.Sprintf("%d;w=%d", limit.Limit, int64(math.Ceil(limit.Period.Seconds())))
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			decision, err := limiter.Take(r.Context(), group+":"+key(r), limit)
+			if err != nil {
+				internal.Log.Error("rate limiter is failed", zap.String("group", group), zap.Error(err))
+				h.ServeHTTP(w, r)
+				return
+			}
+			header := w.Header()
+			header.Set("RateLimit-Policy", policy)
+			header.Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+			header.Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(decision.Reset), 10))
+			if !decision.Allowed {
+				header.Set("Retry-After", strconv.FormatInt(ceilSeconds(decision.RetryAfter), 10))
+				http.Error(w, "too many requests", http.StatusTooManyRequests)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
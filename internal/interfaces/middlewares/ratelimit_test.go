@@ -0,0 +1,93 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type stubLimiter struct {
+	keys     []string
+	decision *internal.RateDecision
+	err      error
+}
+
+func (l *stubLimiter) Take(_ context.Context, key string, _ internal.RateLimit) (*internal.RateDecision, error) {
+	l.keys = append(l.keys, key)
+	return l.decision, l.err
+}
+
+func TestRateLimit(t *testing.T) {
+	limit := internal.RateLimit{Limit: 60, Period: time.Minute}
+
+	tests := []struct {
+		name        string
+		decision    *internal.RateDecision
+		err         error
+		statusCode  int
+		wantHeaders map[string]string
+	}{
+		{
+			name:       "allowed",
+			decision:   &internal.RateDecision{Allowed: true, Limit: 60, Remaining: 59, Reset: 1500 * time.Millisecond},
+			statusCode: http.StatusOK,
+			wantHeaders: map[string]string{
+				"RateLimit-Policy":    "60;w=60",
+				"RateLimit-Limit":     "60",
+				"RateLimit-Remaining": "59",
+				"RateLimit-Reset":     "2",
+				"Retry-After":         "",
+			},
+		},
+		{
+			name:       "limited",
+			decision:   &internal.RateDecision{Limit: 60, Reset: time.Minute, RetryAfter: 200 * time.Millisecond},
+			statusCode: http.StatusTooManyRequests,
+			wantHeaders: map[string]string{
+				"RateLimit-Remaining": "0",
+				"RateLimit-Reset":     "60",
+				"Retry-After":         "1",
+			},
+		},
+		{
+			name:        "limiter is failed",
+			err:         errors.New("db is down"),
+			statusCode:  http.StatusOK,
+			wantHeaders: map[string]string{"RateLimit-Limit": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := &stubLimiter{decision: tt.decision, err: tt.err}
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			request := httptest.NewRequest(http.MethodPost, "/", nil)
+			request.Header.Set("user", "98dcfb07-e16f-4e53-9a28-d2a2e4eed026")
+			recorder := httptest.NewRecorder()
+
+			RateLimit(limiter, "orders", limit, KeyByUser)(next).ServeHTTP(recorder, request)
+
+			assert.Equal(t, tt.statusCode, recorder.Code)
+			assert.Equal(t, []string{"orders:user:98dcfb07-e16f-4e53-9a28-d2a2e4eed026"}, limiter.keys)
+			for name, value := range tt.wantHeaders {
+				assert.Equal(t, value, recorder.Header().Get(name), name)
+			}
+		})
+	}
+}
+
+func TestKeyByIP(t *testing.T) {
+	request := httptest.NewRequest(http.MethodPost, "/", nil)
+	request.RemoteAddr = "192.168.1.10:53211"
+	request.Header.Set("user", "98dcfb07-e16f-4e53-9a28-d2a2e4eed026")
+	assert.Equal(t, "ip:192.168.1.10", KeyByIP(request))
+
+	request.RemoteAddr = "[2001:db8::1]:53211"
+	assert.Equal(t, "ip:2001:db8::1", KeyByIP(request))
+}
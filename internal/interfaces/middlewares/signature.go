@@ -0,0 +1,54 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+)
+
+const (
+	HeaderSignature   = "X-Signature"
+	maxSignedBodySize = 1 << 20
+)
+
+// Signature passes only requests which body is signed by HMAC-SHA256 with secretKey,
+// the hex encoded signature is expected in the X-Signature header.
+func Signature(secretKey []byte) func(http.Handler) http.Handler {
+	secret := secretKey
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBodySize))
+			if err != nil {
+				internal.Log.Error("can't get body", zap.Error(err))
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if err = checkSignature(body, r.Header.Get(HeaderSignature), secret); err != nil {
+				internal.Log.Error("signature is wrong", zap.Error(err))
+				http.Error(w, "signature is wrong", http.StatusUnauthorized)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func checkSignature(body []byte, signature string, secretKey []byte) error {
+	sign, err := hex.DecodeString(signature)
+	if err != nil || len(sign) != sha256.Size {
+		return errors2.ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, secretKey)
+	mac.Write(body)
+	if !hmac.Equal(sign, mac.Sum(nil)) {
+		return errors2.ErrInvalidSignature
+	}
+	return nil
+}
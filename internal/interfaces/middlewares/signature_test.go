@@ -0,0 +1,64 @@
+package middlewares
+
+import (
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/auth"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSignature(t *testing.T) {
+	secret := []byte("accrual-secret")
+	body := `{"order":"4539088167512356","status":"PROCESSED","accrual":500}`
+
+	tests := []struct {
+		name       string
+		signature  string
+		statusCode int
+	}{
+		{
+			name:       "signature is correct",
+			signature:  auth.SignBody([]byte(body), secret),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "signature of another key",
+			signature:  auth.SignBody([]byte(body), []byte("another-secret")),
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "signature is not hex",
+			signature:  "signature",
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "signature is absent",
+			statusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotBody string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				gotBody = string(b)
+			})
+			request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			request.Header.Set(HeaderSignature, tt.signature)
+			responseRecorder := httptest.NewRecorder()
+
+			Signature(secret)(next).ServeHTTP(responseRecorder, request)
+			result := responseRecorder.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			if tt.statusCode == http.StatusOK {
+				assert.Equal(t, body, gotBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package rpc
+
+import (
+	"context"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/auth"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tokenName     = "gophermart-grpc"
+	authorization = "authorization"
+	bearer        = "Bearer "
+	// tokenTTL is the lifetime of the token, it's the same as of the cookie of the HTTP API.
+	tokenTTL = 1 * time.Hour
+)
+
+type userKey struct{}
+
+var publicMethods = map[string]bool{
+	"/gophermart.v1.Gophermart/Register": true,
+	"/gophermart.v1.Gophermart/Login":    true,
+}
+
+// Authentication puts the user of the token into the context of the call,
+// only Register and Login can be called without the token.
+func Authentication(secretKey []byte) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if publicMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		userID, err := readToken(ctx, secretKey)
+		if err != nil {
+			internal.Log.Error("token is wrong", zap.String("method", info.FullMethod), zap.Error(err))
+			return nil, status.Error(codes.Unauthenticated, "token is wrong")
+		}
+		return handler(context.WithValue(ctx, userKey{}, userID), req)
+	}
+}
+
+func readToken(ctx context.Context, secretKey []byte) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(authorization)
+	if len(values) != 1 || !strings.HasPrefix(values[0], bearer) {
+		return "", errors2.ErrMissingToken
+	}
+	value, err := auth.ReadSigned(tokenName, strings.TrimPrefix(values[0], bearer), secretKey)
+	if err != nil {
+		return "", err
+	}
+	userID, exp, ok := strings.Cut(value, ".")
+	if !ok {
+		return "", errors2.ErrInvalidValue
+	}
+	expiresAt, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return "", errors2.ErrInvalidValue
+	}
+	if !time.Now().Before(time.Unix(expiresAt, 0)) {
+		return "", errors2.ErrTokenExpired
+	}
+	return userID, nil
+}
+
+// signToken signs the user with the time of expiration of the token in unix seconds.
+func signToken(userID string, expiresAt time.Time, secretKey []byte) string {
+	return auth.Sign(tokenName, userID+"."+strconv.FormatInt(expiresAt.Unix(), 10), secretKey)
+}
+
+func userFromContext(ctx context.Context) string {
+	userID, _ := ctx.Value(userKey{}).(string)
+	return userID
+}
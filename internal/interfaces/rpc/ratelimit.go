@@ -0,0 +1,80 @@
+package rpc
+
+import (
+	"context"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/handlers"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/rpc/pb"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"math"
+	"net"
+	"strconv"
+)
+
+const headerRetryAfter = "retry-after"
+
+var orderMethods = map[string]bool{
+	pb.Gophermart_AddOrder_FullMethodName: true,
+}
+
+// RateLimit limits the calls by the groups of the HTTP API: every call is counted in the
+// global group, Register and Login by the address of the client, other methods by the
+// user and AddOrder in the orders group in addition. It runs after Authentication, the
+// call over the limit fails with ResourceExhausted and retry-after in the header. The
+// call passes when the limiter fails, as it does in the HTTP API.
+func RateLimit(limits handlers.RateLimits) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if limits.Limiter == nil {
+			return handler(ctx, req)
+		}
+		type bucket struct {
+			group string
+			limit internal.RateLimit
+			key   string
+		}
+		buckets := []bucket{{group: "global", limit: limits.Global, key: "all"}}
+		if publicMethods[info.FullMethod] {
+			buckets = append(buckets, bucket{group: "auth", limit: limits.Auth, key: "ip:" + peerHost(ctx)})
+		} else {
+			userKey := "user:" + userFromContext(ctx)
+			buckets = append(buckets, bucket{group: "api", limit: limits.API, key: userKey})
+			if orderMethods[info.FullMethod] {
+				buckets = append(buckets, bucket{group: "orders", limit: limits.Orders, key: userKey})
+			}
+		}
+
+		for _, b := range buckets {
+			if b.limit.Limit == 0 {
+				continue
+			}
+			decision, err := limits.Limiter.Take(ctx, b.group+":"+b.key, b.limit)
+			if err != nil {
+				internal.Log.Error("rate limiter is failed", zap.String("group", b.group), zap.Error(err))
+				continue
+			}
+			if !decision.Allowed {
+				retryAfter := int64(math.Ceil(decision.RetryAfter.Seconds()))
+				_ = grpc.SetHeader(ctx, metadata.Pairs(headerRetryAfter, strconv.FormatInt(retryAfter, 10)))
+				return nil, status.Error(codes.ResourceExhausted, "too many requests")
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+func peerHost(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
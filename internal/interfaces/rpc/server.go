@@ -0,0 +1,146 @@
+// Package rpc serves the user API over gRPC for the internal services.
+package rpc
+
+import (
+	"context"
+	"errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/handlers"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/rpc/pb"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/ordernumber"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+type ServerUser struct {
+	pb.UnimplementedGophermartServer
+	us     *services.UserService
+	secret []byte
+}
+
+func NewServerUser(service *services.UserService, secretKey []byte) *ServerUser {
+	return &ServerUser{us: service, secret: secretKey}
+}
+
+// NewServer returns the gRPC server with the user API, the authentication by token and
+// the rate limits of the HTTP API.
+func NewServer(su *ServerUser, limits handlers.RateLimits, opts ...grpc.ServerOption) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(Authentication(su.secret), RateLimit(limits)))
+	server := grpc.NewServer(opts...)
+	pb.RegisterGophermartServer(server, su)
+	return server
+}
+
+func (su *ServerUser) Register(ctx context.Context, req *pb.Credentials) (*pb.Token, error) {
+	newUser, err := su.us.CreateNewUser(ctx, &internal.UserDto{Login: req.GetLogin(), Pass: req.GetPassword()})
+	if err != nil {
+		internal.Log.Error("user hasn't been created", zap.Error(err))
+		if errors.Is(err, errors2.ErrIllegalUserArgument) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, errors2.ErrUserIsExist) {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "user hasn't been created")
+	}
+	return &pb.Token{Token: signToken(newUser.ID.String(), time.Now().Add(tokenTTL), su.secret)}, nil
+}
+
+func (su *ServerUser) Login(ctx context.Context, req *pb.Credentials) (*pb.Token, error) {
+	userID, err := su.us.LoginUser(ctx, internal.UserDto{Login: req.GetLogin(), Pass: req.GetPassword()})
+	if err != nil {
+		internal.Log.Error("authorization fault", zap.Error(err))
+		if errors.Is(err, errors2.ErrWrongAuth) || errors.Is(err, errors2.ErrUserNotFound) {
+			return nil, status.Error(codes.Unauthenticated, errors2.ErrWrongAuth.Error())
+		}
+		return nil, status.Error(codes.Internal, "authorization fault")
+	}
+	return &pb.Token{Token: signToken(userID.String(), time.Now().Add(tokenTTL), su.secret)}, nil
+}
+
+func (su *ServerUser) AddOrder(ctx context.Context, req *pb.AddOrderRequest) (*pb.AddOrderResponse, error) {
+	err := su.us.AddOrder(ctx, userFromContext(ctx), ordernumber.DefaultSource, req.GetNumber())
+	if err != nil {
+		internal.Log.Error("add order", zap.Error(err))
+		if errors.Is(err, errors2.ErrOrderIsExistThisUser) {
+			return &pb.AddOrderResponse{Accepted: false}, nil
+		}
+		if errors.Is(err, errors2.ErrOrderIsExistAnotherUser) {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		if errors.Is(err, errors2.ErrIllegalOrder) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "order hasn't been added")
+	}
+	return &pb.AddOrderResponse{Accepted: true}, nil
+}
+
+func (su *ServerUser) ListOrders(ctx context.Context, _ *emptypb.Empty) (*pb.ListOrdersResponse, error) {
+	orders, err := su.us.GetOrders(ctx, userFromContext(ctx))
+	if err != nil {
+		internal.Log.Error("get orders", zap.Error(err))
+		return nil, status.Error(codes.Internal, "can't get orders")
+	}
+	resp := &pb.ListOrdersResponse{Orders: make([]*pb.Order, 0, len(*orders))}
+	for _, order := range *orders {
+		resp.Orders = append(resp.Orders, &pb.Order{
+			Number:     order.Number,
+			Status:     order.Status,
+			Accrual:    float64(order.Accrual),
+			UploadedAt: timestamppb.New(order.Upload),
+		})
+	}
+	return resp, nil
+}
+
+func (su *ServerUser) GetBalance(ctx context.Context, _ *emptypb.Empty) (*pb.Balance, error) {
+	balance, err := su.us.GetBalance(ctx, userFromContext(ctx))
+	if err != nil {
+		internal.Log.Error("get balance", zap.Error(err))
+		return nil, status.Error(codes.Internal, "can't get balance")
+	}
+	return &pb.Balance{Current: float64(balance.Current), Withdrawn: float64(balance.Withdrawn)}, nil
+}
+
+func (su *ServerUser) Withdraw(ctx context.Context, req *pb.WithdrawRequest) (*emptypb.Empty, error) {
+	dto := internal.WithdrawDto{Order: req.GetOrder(), Sum: float32(req.GetSum())}
+	if err := su.us.AddWithdraw(ctx, dto, userFromContext(ctx), ordernumber.DefaultSource); err != nil {
+		internal.Log.Error("add withdraw", zap.Error(err))
+		if errors.Is(err, errors2.ErrNotEnoughAmount) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if errors.Is(err, errors2.ErrWithdrawalLimit) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		if errors.Is(err, errors2.ErrIllegalOrder) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "withdraw hasn't been added")
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (su *ServerUser) ListWithdrawals(ctx context.Context, _ *emptypb.Empty) (*pb.ListWithdrawalsResponse, error) {
+	withdrawals, err := su.us.GetWithdrawals(ctx, userFromContext(ctx))
+	if err != nil {
+		internal.Log.Error("get withdrawals", zap.Error(err))
+		return nil, status.Error(codes.Internal, "can't get withdrawals")
+	}
+	resp := &pb.ListWithdrawalsResponse{Withdrawals: make([]*pb.Withdrawal, 0, len(*withdrawals))}
+	for _, withdraw := range *withdrawals {
+		resp.Withdrawals = append(resp.Withdrawals, &pb.Withdrawal{
+			Order:       withdraw.Order,
+			Sum:         float64(withdraw.Sum),
+			ProcessedAt: timestamppb.New(withdraw.CreateAt),
+		})
+	}
+	return resp, nil
+}
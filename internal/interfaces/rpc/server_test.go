@@ -0,0 +1,328 @@
+package rpc
+
+import (
+	"context"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/auth"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/handlers"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/rpc/pb"
+	mock "github.com/bonus2k/go-musthave-diploma-tpl/internal/mocks"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/ordernumber"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/services"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func init() {
+	err := internal.InitLogger("info")
+	if err != nil {
+		log.Printf("err Init logger %v", err)
+		os.Exit(1)
+	}
+}
+
+type testData struct {
+	mockStore *mock.MockStore
+	client    pb.GophermartClient
+	userID1   string
+	token1    string
+	sign      []byte
+}
+
+func initTestServer(t *testing.T) *testData {
+	return initLimitedTestServer(t, handlers.RateLimits{})
+}
+
+func initLimitedTestServer(t *testing.T, limits handlers.RateLimits) *testData {
+	sign := []byte{116, 79, 253, 154, 106, 127, 165, 70, 139, 56, 218, 213, 105, 253, 76}
+	ctrl := gomock.NewController(t)
+	mockStore := mock.NewMockStore(ctrl)
+	server := NewServer(NewServerUser(services.NewUserService(mockStore, ordernumber.DefaultSources(), nil, nil), sign), limits)
+
+	listener := bufconn.Listen(1024 * 1024)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return &testData{
+		mockStore: mockStore,
+		client:    pb.NewGophermartClient(conn),
+		userID1:   "98dcfb07-e16f-4e53-9a28-d2a2e4eed026",
+		token1:    signToken("98dcfb07-e16f-4e53-9a28-d2a2e4eed026", time.Now().Add(tokenTTL), sign),
+		sign:      sign,
+	}
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), authorization, bearer+token)
+}
+
+func TestServerUser_Authentication(t *testing.T) {
+	testServer := initTestServer(t)
+	testServer.mockStore.EXPECT().GetWithdrawals(gomock.Any(), gomock.Any()).Return(&[]internal.Withdraw{}, nil)
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want codes.Code
+	}{
+		{name: "without token", ctx: context.Background(), want: codes.Unauthenticated},
+		{name: "without bearer", ctx: metadata.AppendToOutgoingContext(context.Background(), authorization, testServer.token1), want: codes.Unauthenticated},
+		{name: "wrong signature", ctx: withToken(signToken(testServer.userID1, time.Now().Add(tokenTTL), []byte("another"))), want: codes.Unauthenticated},
+		{name: "expired token", ctx: withToken(signToken(testServer.userID1, time.Now().Add(-time.Second), testServer.sign)), want: codes.Unauthenticated},
+		{name: "token without expiration", ctx: withToken(auth.Sign(tokenName, testServer.userID1, testServer.sign)), want: codes.Unauthenticated},
+		{name: "cookie as token", ctx: withToken(auth.Sign("gophermart", testServer.userID1, testServer.sign)), want: codes.Unauthenticated},
+		{name: "cookie name with expiration", ctx: withToken(auth.Sign("gophermart", testServer.userID1+"."+strconv.FormatInt(time.Now().Add(tokenTTL).Unix(), 10), testServer.sign)), want: codes.Unauthenticated},
+		{name: "signed token", ctx: withToken(testServer.token1), want: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := testServer.client.ListWithdrawals(tt.ctx, &emptypb.Empty{})
+			assert.Equal(t, tt.want, status.Code(err))
+		})
+	}
+}
+
+func TestReadToken_Expired(t *testing.T) {
+	sign := []byte("secret")
+	token := signToken("98dcfb07-e16f-4e53-9a28-d2a2e4eed026", time.Now().Add(-time.Minute), sign)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(authorization, bearer+token))
+	_, err := readToken(ctx, sign)
+	assert.ErrorIs(t, err, errors2.ErrTokenExpired)
+}
+
+func TestServerUser_Register(t *testing.T) {
+	testServer := initTestServer(t)
+	testServer.mockStore.EXPECT().AddUser(gomock.Any(), gomock.Any()).Return(errors2.ErrUserIsExist)
+	testServer.mockStore.EXPECT().AddUser(gomock.Any(), gomock.Any()).Return(nil)
+
+	tests := []struct {
+		name string
+		req  *pb.Credentials
+		want codes.Code
+	}{
+		{name: "illegal user", req: &pb.Credentials{Login: "TestUser1"}, want: codes.InvalidArgument},
+		{name: "user is exist", req: &pb.Credentials{Login: "TestUser1", Password: "Password"}, want: codes.AlreadyExists},
+		{name: "user is created", req: &pb.Credentials{Login: "TestUser2", Password: "Password"}, want: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := testServer.client.Register(context.Background(), tt.req)
+			require.Equal(t, tt.want, status.Code(err))
+			if err == nil {
+				assert.NotEmpty(t, token.GetToken())
+			}
+		})
+	}
+}
+
+func TestServerUser_Login(t *testing.T) {
+	testServer := initTestServer(t)
+	user := &internal.User{
+		ID:       uuid.MustParse(testServer.userID1),
+		Login:    "TestUser1",
+		Password: "1bf92ee0af9687162f7f9c861a1d2cbfdaf2e3ab5ec70335e0d68f5455b54d6dfd631dd94175d250",
+	}
+	testServer.mockStore.EXPECT().FindUserByLogin(gomock.Any(), "TestUser1").Return(user, nil).AnyTimes()
+	testServer.mockStore.EXPECT().FindUserByLogin(gomock.Any(), "Unknown").Return(nil, errors2.ErrUserNotFound)
+
+	tests := []struct {
+		name     string
+		req      *pb.Credentials
+		want     codes.Code
+		wantUser string
+	}{
+		{name: "user is logged", req: &pb.Credentials{Login: "TestUser1", Password: "Password"}, want: codes.OK, wantUser: testServer.userID1},
+		{name: "wrong password", req: &pb.Credentials{Login: "TestUser1", Password: "password"}, want: codes.Unauthenticated},
+		{name: "user not found", req: &pb.Credentials{Login: "Unknown", Password: "Password"}, want: codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := testServer.client.Login(context.Background(), tt.req)
+			require.Equal(t, tt.want, status.Code(err))
+			if err != nil {
+				return
+			}
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(authorization, bearer+token.GetToken()))
+			userID, err := readToken(ctx, testServer.sign)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantUser, userID)
+		})
+	}
+}
+
+func TestServerUser_AddOrder(t *testing.T) {
+	testServer := initTestServer(t)
+	testServer.mockStore.EXPECT().AddOrder(gomock.Any(), gomock.Any()).Return(nil, nil)
+	testServer.mockStore.EXPECT().AddOrder(gomock.Any(), gomock.Any()).Return(nil, errors2.ErrOrderIsExistThisUser)
+	testServer.mockStore.EXPECT().AddOrder(gomock.Any(), gomock.Any()).Return(nil, errors2.ErrOrderIsExistAnotherUser)
+
+	tests := []struct {
+		name         string
+		number       string
+		want         codes.Code
+		wantAccepted bool
+	}{
+		{name: "illegal number", number: "12345", want: codes.InvalidArgument},
+		{name: "order is accepted", number: "12345678903", want: codes.OK, wantAccepted: true},
+		{name: "order of the user", number: "12345678903", want: codes.OK},
+		{name: "order of another user", number: "12345678903", want: codes.AlreadyExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := testServer.client.AddOrder(withToken(testServer.token1), &pb.AddOrderRequest{Number: tt.number})
+			require.Equal(t, tt.want, status.Code(err))
+			assert.Equal(t, tt.wantAccepted, resp.GetAccepted())
+		})
+	}
+}
+
+func TestServerUser_ListOrders(t *testing.T) {
+	testServer := initTestServer(t)
+	upload := time.Date(2023, 01, 01, 14, 00, 00, 000, time.UTC)
+	testServer.mockStore.EXPECT().GetOrders(gomock.Any(), uuid.MustParse(testServer.userID1)).Return(&[]internal.Order{
+		{Number: "12345678903", Status: internal.OrderStatusProcessed, Accrual: 500, CreateAt: upload},
+		{Number: "9278923470", Status: internal.OrderStatusNew, CreateAt: upload},
+	}, nil)
+
+	resp, err := testServer.client.ListOrders(withToken(testServer.token1), &emptypb.Empty{})
+	require.NoError(t, err)
+	require.Len(t, resp.GetOrders(), 2)
+	assert.Equal(t, "12345678903", resp.GetOrders()[0].GetNumber())
+	assert.Equal(t, string(internal.OrderStatusProcessed), resp.GetOrders()[0].GetStatus())
+	assert.Equal(t, float64(500), resp.GetOrders()[0].GetAccrual())
+	assert.Equal(t, upload, resp.GetOrders()[0].GetUploadedAt().AsTime())
+	assert.Equal(t, "9278923470", resp.GetOrders()[1].GetNumber())
+}
+
+func TestServerUser_GetBalance(t *testing.T) {
+	testServer := initTestServer(t)
+	userID := uuid.MustParse(testServer.userID1)
+	testServer.mockStore.EXPECT().GetWithdrawals(gomock.Any(), userID).Return(&[]internal.Withdraw{{Sum: 100}, {Sum: 50.5}}, nil)
+	testServer.mockStore.EXPECT().GetUser(gomock.Any(), userID).Return(&internal.User{ID: userID, Bill: 349.5}, nil)
+
+	balance, err := testServer.client.GetBalance(withToken(testServer.token1), &emptypb.Empty{})
+	require.NoError(t, err)
+	assert.Equal(t, 349.5, balance.GetCurrent())
+	assert.Equal(t, 150.5, balance.GetWithdrawn())
+}
+
+func TestServerUser_Withdraw(t *testing.T) {
+	testServer := initTestServer(t)
+	testServer.mockStore.EXPECT().SaveWithdrawal(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+	testServer.mockStore.EXPECT().SaveWithdrawal(gomock.Any(), gomock.Any(), gomock.Any()).Return(errors2.ErrNotEnoughAmount)
+
+	tests := []struct {
+		name string
+		req  *pb.WithdrawRequest
+		want codes.Code
+	}{
+		{name: "illegal order", req: &pb.WithdrawRequest{Order: "12345", Sum: 100}, want: codes.InvalidArgument},
+		{name: "withdraw is added", req: &pb.WithdrawRequest{Order: "2377225624", Sum: 100}, want: codes.OK},
+		{name: "not enough amount", req: &pb.WithdrawRequest{Order: "2377225624", Sum: 1000}, want: codes.FailedPrecondition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := testServer.client.Withdraw(withToken(testServer.token1), tt.req)
+			assert.Equal(t, tt.want, status.Code(err))
+		})
+	}
+}
+
+func TestServerUser_ListWithdrawals(t *testing.T) {
+	testServer := initTestServer(t)
+	processed := time.Date(2023, 01, 01, 14, 00, 00, 000, time.UTC)
+	testServer.mockStore.EXPECT().GetWithdrawals(gomock.Any(), uuid.MustParse(testServer.userID1)).Return(&[]internal.Withdraw{
+		{Order: "2377225624", Sum: 500, CreateAt: processed},
+	}, nil)
+
+	resp, err := testServer.client.ListWithdrawals(withToken(testServer.token1), &emptypb.Empty{})
+	require.NoError(t, err)
+	require.Len(t, resp.GetWithdrawals(), 1)
+	assert.Equal(t, "2377225624", resp.GetWithdrawals()[0].GetOrder())
+	assert.Equal(t, float64(500), resp.GetWithdrawals()[0].GetSum())
+	assert.Equal(t, processed, resp.GetWithdrawals()[0].GetProcessedAt().AsTime())
+}
+
+func TestServerUser_RateLimits(t *testing.T) {
+	testServer := initLimitedTestServer(t, handlers.RateLimits{
+		Limiter: services.NewMemoryRateLimiter(),
+		Global:  internal.RateLimit{Limit: 100, Period: time.Hour},
+		Auth:    internal.RateLimit{Limit: 1, Period: time.Hour},
+		Orders:  internal.RateLimit{Limit: 1, Period: time.Hour},
+		API:     internal.RateLimit{Limit: 3, Period: time.Hour},
+	})
+	testServer.mockStore.EXPECT().FindUserByLogin(gomock.Any(), "Unknown").Return(nil, errors2.ErrUserNotFound)
+	testServer.mockStore.EXPECT().AddOrder(gomock.Any(), gomock.Any()).Return(nil, nil)
+	testServer.mockStore.EXPECT().GetWithdrawals(gomock.Any(), gomock.Any()).Return(&[]internal.Withdraw{}, nil)
+
+	login := func() error {
+		_, err := testServer.client.Login(context.Background(), &pb.Credentials{Login: "Unknown", Password: "Password"})
+		return err
+	}
+	addOrder := func() error {
+		_, err := testServer.client.AddOrder(withToken(testServer.token1), &pb.AddOrderRequest{Number: "12345678903"})
+		return err
+	}
+	listWithdrawals := func() error {
+		_, err := testServer.client.ListWithdrawals(withToken(testServer.token1), &emptypb.Empty{})
+		return err
+	}
+	tests := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{name: "login", call: login, want: codes.Unauthenticated},
+		{name: "login again from the address", call: login, want: codes.ResourceExhausted},
+		{name: "add order", call: addOrder, want: codes.OK},
+		{name: "add order again", call: addOrder, want: codes.ResourceExhausted},
+		{name: "list withdrawals", call: listWithdrawals, want: codes.OK},
+		{name: "api limit is spent", call: listWithdrawals, want: codes.ResourceExhausted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, status.Code(tt.call()))
+		})
+	}
+}
+
+func TestServerUser_GlobalRateLimit(t *testing.T) {
+	testServer := initLimitedTestServer(t, handlers.RateLimits{
+		Limiter: services.NewMemoryRateLimiter(),
+		Global:  internal.RateLimit{Limit: 1, Period: time.Hour},
+	})
+	testServer.mockStore.EXPECT().FindUserByLogin(gomock.Any(), "Unknown").Return(nil, errors2.ErrUserNotFound)
+
+	_, err := testServer.client.Login(context.Background(), &pb.Credentials{Login: "Unknown", Password: "Password"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	var header metadata.MD
+	_, err = testServer.client.ListWithdrawals(withToken(testServer.token1), &emptypb.Empty{}, grpc.Header(&header))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err), "global limit is shared by all calls")
+	assert.NotEmpty(t, header.Get(headerRetryAfter))
+}
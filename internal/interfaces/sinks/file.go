@@ -0,0 +1,43 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"os"
+	"sync"
+)
+
+// FileSink appends events to the file as JSON lines.
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileSink(path string) *FileSink {
+	return &FileSink{path: path}
+}
+
+func (fs *FileSink) Name() string {
+	return "file"
+}
+
+func (fs *FileSink) Send(ctx context.Context, event *internal.OutboxEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("can't marshal event %w", err)
+	}
+
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	file, err := os.OpenFile(fs.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("can't open file of events %w", err)
+	}
+	if _, err = file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("can't write event to file %w", err)
+	}
+	return file.Close()
+}
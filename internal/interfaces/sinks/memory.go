@@ -0,0 +1,47 @@
+package sinks
+
+import (
+	"context"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"sync"
+)
+
+// MemorySink keeps events in memory, it is intended for tests.
+type MemorySink struct {
+	mu     sync.Mutex
+	events []internal.OutboxEvent
+	err    error
+}
+
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+func (ms *MemorySink) Name() string {
+	return "memory"
+}
+
+func (ms *MemorySink) Send(ctx context.Context, event *internal.OutboxEvent) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.err != nil {
+		return ms.err
+	}
+	ms.events = append(ms.events, *event)
+	return nil
+}
+
+// Fail makes the following sends return err, nil restores delivery.
+func (ms *MemorySink) Fail(err error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.err = err
+}
+
+func (ms *MemorySink) Events() []internal.OutboxEvent {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	events := make([]internal.OutboxEvent, len(ms.events))
+	copy(events, ms.events)
+	return events
+}
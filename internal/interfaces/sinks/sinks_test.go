@@ -0,0 +1,105 @@
+package sinks
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/go-resty/resty/v2"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testEvent() *internal.OutboxEvent {
+	return &internal.OutboxEvent{
+		ID:       uuid.MustParse("3e23bb5c-5cd6-4ca9-afa5-8d498576a080"),
+		CreateAt: time.Date(2023, 01, 01, 14, 00, 00, 000, time.UTC),
+		Type:     internal.EventOrderProcessed,
+		UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
+		Payload:  json.RawMessage(`{"order":"4539088167512356","status":"PROCESSED","accrual":100}`),
+		Attempts: 3,
+	}
+}
+
+const testEventJSON = `{
+	"id":"3e23bb5c-5cd6-4ca9-afa5-8d498576a080",
+	"created_at":"2023-01-01T14:00:00Z",
+	"type":"order.processed",
+	"user_id":"98dcfb07-e16f-4e53-9a28-d2a2e4eed026",
+	"payload":{"order":"4539088167512356","status":"PROCESSED","accrual":100}
+}`
+
+func TestWebhookSink_Send(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		wantErr    bool
+	}{
+		{
+			name:       "webhook accepted event",
+			statusCode: http.StatusNoContent,
+			wantErr:    false,
+		},
+		{
+			name:       "webhook is failed",
+			statusCode: http.StatusBadGateway,
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			var idempotencyKey string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ = io.ReadAll(r.Body)
+				idempotencyKey = r.Header.Get("Idempotency-Key")
+				w.WriteHeader(tt.statusCode)
+			}))
+			defer server.Close()
+
+			sink := NewWebhookSink(resty.New(), server.URL)
+			err := sink.Send(context.Background(), testEvent())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.JSONEq(t, testEventJSON, string(body))
+			assert.Equal(t, "3e23bb5c-5cd6-4ca9-afa5-8d498576a080", idempotencyKey)
+		})
+	}
+}
+
+func TestFileSink_Send(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink := NewFileSink(path)
+
+	require.NoError(t, sink.Send(context.Background(), testEvent()))
+	require.NoError(t, sink.Send(context.Background(), testEvent()))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	var lines int
+	for scanner.Scan() {
+		lines++
+		assert.JSONEq(t, testEventJSON, scanner.Text())
+	}
+	assert.Equal(t, 2, lines)
+}
+
+func TestMemorySink_Send(t *testing.T) {
+	sink := NewMemorySink()
+	sink.Fail(io.ErrUnexpectedEOF)
+	assert.ErrorIs(t, sink.Send(context.Background(), testEvent()), io.ErrUnexpectedEOF)
+	sink.Fail(nil)
+	assert.NoError(t, sink.Send(context.Background(), testEvent()))
+	assert.Len(t, sink.Events(), 1)
+}
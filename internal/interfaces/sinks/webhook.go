@@ -0,0 +1,37 @@
+package sinks
+
+import (
+	"context"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/go-resty/resty/v2"
+)
+
+type WebhookSink struct {
+	client *resty.Client
+	url    string
+}
+
+func NewWebhookSink(client *resty.Client, url string) *WebhookSink {
+	return &WebhookSink{client: client, url: url}
+}
+
+func (ws *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (ws *WebhookSink) Send(ctx context.Context, event *internal.OutboxEvent) error {
+	response, err := ws.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetHeader("Idempotency-Key", event.ID.String()).
+		SetBody(event).
+		Post(ws.url)
+	if err != nil {
+		return err
+	}
+	if response.IsError() {
+		return fmt.Errorf("webhook responded %s", response.Status())
+	}
+	return nil
+}
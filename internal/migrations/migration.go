@@ -3,6 +3,7 @@ package migrations
 import (
 	"context"
 	"database/sql"
+	"embed"
 	"errors"
 	"fmt"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
@@ -10,53 +11,140 @@ import (
 	"github.com/golang-migrate/migrate/v4"
 	mpgx "github.com/golang-migrate/migrate/v4/database/pgx/v5"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"time"
 )
 
-func Start(connect string, migrationsPath string) error {
-	dataBase, err := sql.Open("pgx", connect)
-	if err != nil {
-		return fmt.Errorf("can't open connection to db %w", err)
-	}
+//go:embed sql/*.sql
+var embedded embed.FS
 
-	defer func() {
-		if dataBase != nil {
-			_ = dataBase.Close()
-		}
-	}()
+type Migrator struct {
+	m *migrate.Migrate
+}
 
-	f := func() error { return establishConnection(dataBase) }
-	if err = errors2.RetryAfterError(f); err != nil {
-		return fmt.Errorf("can't connected to db %w", err)
+// Start applies all embedded migrations to the database.
+func Start(connect string) error {
+	migrator, err := NewMigrator(connect)
+	if err != nil {
+		return err
 	}
+	defer migrator.Close()
 
-	if err = migrateSQL(dataBase, migrationsPath); err != nil {
+	if err = migrator.Up(); err != nil {
 		return err
 	}
 	internal.Log.Info("migration successfully finished")
 	return nil
 }
 
-func establishConnection(db *sql.DB) error {
-	ctx, cancelFunc := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancelFunc()
-	return db.PingContext(ctx)
-}
+// StartFromPath applies migrations located by migrationsPath, e.g. file://testdata/migration.
+func StartFromPath(connect string, migrationsPath string) error {
+	dataBase, err := openDB(connect)
+	if err != nil {
+		return err
+	}
+	defer dataBase.Close()
 
-func migrateSQL(db *sql.DB, migrationsPath string) error {
-	driver, err := mpgx.WithInstance(db, &mpgx.Config{})
+	driver, err := mpgx.WithInstance(dataBase, &mpgx.Config{})
 	if err != nil {
 		return err
 	}
-	m, err := migrate.NewWithDatabaseInstance(
-		migrationsPath,
-		"pgx", driver)
+	m, err := migrate.NewWithDatabaseInstance(migrationsPath, "pgx", driver)
 	if err != nil {
 		return err
 	}
 	if err = m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
 		return err
 	}
+	internal.Log.Info("migration successfully finished")
+	return nil
+}
+
+// NewMigrator returns Migrator over the migrations embedded in the binary.
+func NewMigrator(connect string) (*Migrator, error) {
+	dataBase, err := openDB(connect)
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := iofs.New(embedded, "sql")
+	if err != nil {
+		_ = dataBase.Close()
+		return nil, fmt.Errorf("can't read embedded migrations %w", err)
+	}
+	driver, err := mpgx.WithInstance(dataBase, &mpgx.Config{})
+	if err != nil {
+		_ = dataBase.Close()
+		return nil, err
+	}
+	m, err := migrate.NewWithInstance("iofs", source, "pgx", driver)
+	if err != nil {
+		_ = dataBase.Close()
+		return nil, err
+	}
+	return &Migrator{m: m}, nil
+}
+
+func (mg *Migrator) Up() error {
+	return ignoreNoChange(mg.m.Up())
+}
+
+func (mg *Migrator) Down() error {
+	return ignoreNoChange(mg.m.Down())
+}
+
+func (mg *Migrator) Steps(n int) error {
+	return ignoreNoChange(mg.m.Steps(n))
+}
+
+func (mg *Migrator) Goto(version uint) error {
+	return ignoreNoChange(mg.m.Migrate(version))
+}
+
+func (mg *Migrator) Force(version int) error {
+	return mg.m.Force(version)
+}
+
+func (mg *Migrator) Version() (version uint, dirty bool, err error) {
+	version, dirty, err = mg.m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+func (mg *Migrator) Close() error {
+	srcErr, dbErr := mg.m.Close()
+	if srcErr != nil {
+		return srcErr
+	}
+	return dbErr
+}
+
+func openDB(connect string) (*sql.DB, error) {
+	dataBase, err := sql.Open("pgx", connect)
+	if err != nil {
+		return nil, fmt.Errorf("can't open connection to db %w", err)
+	}
+
+	f := func() error { return establishConnection(dataBase) }
+	if err = errors2.RetryAfterError(f); err != nil {
+		_ = dataBase.Close()
+		return nil, fmt.Errorf("can't connected to db %w", err)
+	}
+	return dataBase, nil
+}
+
+func establishConnection(db *sql.DB) error {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancelFunc()
+	return db.PingContext(ctx)
+}
+
+func ignoreNoChange(err error) error {
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,4 @@
+ALTER TABLE orders
+    ADD COLUMN credited_at TIMESTAMPTZ;
+
+UPDATE orders SET credited_at = COALESCE(update_at, create_at) WHERE status = 'PROCESSED';
@@ -0,0 +1,21 @@
+CREATE TABLE order_status_history
+(
+    id BIGSERIAL PRIMARY KEY,
+    order_id UUID NOT NULL,
+    create_at TIMESTAMPTZ NOT NULL,
+    from_status VARCHAR(15) NOT NULL DEFAULT '',
+    status VARCHAR(15) NOT NULL,
+    source VARCHAR(15) NOT NULL,
+    CONSTRAINT fk_order
+        FOREIGN KEY(order_id)
+            REFERENCES orders(id)
+            ON DELETE CASCADE
+);
+
+CREATE INDEX index_idx_order_status_history ON order_status_history (order_id, id);
+
+INSERT INTO order_status_history (order_id, create_at, status, source)
+    SELECT id, create_at, 'NEW', 'UPLOAD' FROM orders;
+
+INSERT INTO order_status_history (order_id, create_at, from_status, status, source)
+    SELECT id, COALESCE(update_at, create_at), 'NEW', status, update_source FROM orders WHERE status != 'NEW';
@@ -0,0 +1,4 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS poll_count,
+    DROP COLUMN IF EXISTS checked_at,
+    DROP COLUMN IF EXISTS next_check_at;
@@ -0,0 +1,4 @@
+ALTER TABLE orders
+    ADD COLUMN poll_count INT NOT NULL DEFAULT 0,
+    ADD COLUMN checked_at TIMESTAMPTZ,
+    ADD COLUMN next_check_at TIMESTAMPTZ;
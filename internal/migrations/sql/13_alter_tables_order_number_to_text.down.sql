@@ -0,0 +1,25 @@
+-- The numbers are cast back to BIGINT, which is possible only while all of them are numbers of digits
+-- which fit BIGINT. The numbers with letters and dashes can't be kept, the migration is irreversible then:
+-- delete or rename such orders and withdrawals by hand before rolling it back.
+DO
+$$
+    BEGIN
+        IF EXISTS(SELECT 1
+                  FROM orders
+                  WHERE CASE WHEN number ~ '^[0-9]{1,19}$' THEN number::NUMERIC > 9223372036854775807 ELSE TRUE END)
+            OR EXISTS(SELECT 1
+                      FROM withdrawals
+                      WHERE CASE
+                                WHEN order_num ~ '^[0-9]{1,19}$' THEN order_num::NUMERIC > 9223372036854775807
+                                ELSE TRUE END) THEN
+            RAISE EXCEPTION 'orders or withdrawals have numbers which do not fit BIGINT, the migration 13 is irreversible'
+                USING HINT = 'delete or rename the orders and withdrawals with letters, dashes or too many digits';
+        END IF;
+    END
+$$;
+
+ALTER TABLE orders
+    ALTER COLUMN number TYPE BIGINT USING number::BIGINT;
+
+ALTER TABLE withdrawals
+    ALTER COLUMN order_num TYPE BIGINT USING order_num::BIGINT;
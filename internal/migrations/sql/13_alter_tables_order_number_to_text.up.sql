@@ -0,0 +1,5 @@
+ALTER TABLE orders
+    ALTER COLUMN number TYPE VARCHAR(64) USING number::TEXT;
+
+ALTER TABLE withdrawals
+    ALTER COLUMN order_num TYPE VARCHAR(64) USING order_num::TEXT;
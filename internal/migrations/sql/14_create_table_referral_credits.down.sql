@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS referral_credits;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS referred_by,
+    DROP COLUMN IF EXISTS referral_code;
@@ -0,0 +1,50 @@
+ALTER TABLE users
+    ADD COLUMN referral_code VARCHAR(16) UNIQUE,
+    ADD COLUMN referred_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- The codes of the existing users are drawn from the alphabet of the service, the code taken
+-- by another user is drawn again, so the backfill doesn't fail on the unique constraint.
+DO
+$$
+    DECLARE
+        next_id   UUID;
+        next_code TEXT;
+    BEGIN
+        FOR next_id IN SELECT id FROM users
+            LOOP
+                LOOP
+                    next_code := '';
+                    FOR i IN 1..8
+                        LOOP
+                            next_code := next_code ||
+                                         substr('ABCDEFGHJKLMNPQRSTUVWXYZ23456789', 1 + floor(random() * 32)::INT, 1);
+                        END LOOP;
+                    EXIT WHEN NOT EXISTS(SELECT 1 FROM users WHERE referral_code = next_code);
+                END LOOP;
+                UPDATE users SET referral_code = next_code WHERE id = next_id;
+            END LOOP;
+    END
+$$;
+
+ALTER TABLE users
+    ALTER COLUMN referral_code SET NOT NULL;
+
+CREATE INDEX index_idx_users_referred_by ON users (referred_by);
+
+CREATE TABLE referral_credits
+(
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    create_at TIMESTAMPTZ NOT NULL,
+    user_id UUID NOT NULL,
+    referee_id UUID NOT NULL,
+    role VARCHAR(15) NOT NULL,
+    order_num VARCHAR(64) NOT NULL,
+    sum DECIMAL NOT NULL,
+    UNIQUE (referee_id, role),
+    CONSTRAINT fk_customer
+        FOREIGN KEY(user_id)
+            REFERENCES users(id)
+            ON DELETE CASCADE
+);
+
+CREATE INDEX index_idx_referral_credits ON referral_credits (user_id, create_at);
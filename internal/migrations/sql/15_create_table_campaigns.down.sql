@@ -0,0 +1,5 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS campaign_id,
+    DROP COLUMN IF EXISTS campaign_bonus;
+
+DROP TABLE IF EXISTS campaigns;
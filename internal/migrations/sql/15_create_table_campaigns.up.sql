@@ -0,0 +1,19 @@
+CREATE TABLE campaigns
+(
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    create_at TIMESTAMPTZ NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    multiplier DECIMAL NOT NULL,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    weekdays VARCHAR(50) NOT NULL DEFAULT '',
+    new_user_days INTEGER NOT NULL DEFAULT 0,
+    min_accrual DECIMAL NOT NULL DEFAULT 0,
+    CHECK (starts_at < ends_at)
+);
+
+CREATE INDEX index_idx_campaigns ON campaigns (starts_at, ends_at);
+
+ALTER TABLE orders
+    ADD COLUMN campaign_bonus DECIMAL NOT NULL DEFAULT 0,
+    ADD COLUMN campaign_id UUID REFERENCES campaigns(id) ON DELETE SET NULL;
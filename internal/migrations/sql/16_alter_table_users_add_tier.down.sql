@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS index_idx_orders_credited_at;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS tier_updated_at,
+    DROP COLUMN IF EXISTS tier_accrual,
+    DROP COLUMN IF EXISTS tier;
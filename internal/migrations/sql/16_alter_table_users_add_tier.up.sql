@@ -0,0 +1,6 @@
+ALTER TABLE users
+    ADD COLUMN tier VARCHAR(15) NOT NULL DEFAULT 'BRONZE',
+    ADD COLUMN tier_accrual DECIMAL NOT NULL DEFAULT 0,
+    ADD COLUMN tier_updated_at TIMESTAMPTZ;
+
+CREATE INDEX index_idx_orders_credited_at ON orders (user_id, credited_at);
@@ -0,0 +1,23 @@
+DROP INDEX IF EXISTS index_idx_user_events_create_at;
+
+ALTER TABLE user_events
+    DROP CONSTRAINT user_events_pkey;
+
+WITH numbered AS (SELECT user_id, id, row_number() OVER (ORDER BY create_at, user_id, id) AS global_id
+                  FROM user_events)
+UPDATE user_events
+SET id = numbered.global_id
+FROM numbered
+WHERE user_events.user_id = numbered.user_id
+  AND user_events.id = numbered.id;
+
+CREATE SEQUENCE user_events_id_seq OWNED BY user_events.id;
+SELECT setval('user_events_id_seq', COALESCE((SELECT MAX(id) FROM user_events), 0) + 1, false);
+
+ALTER TABLE user_events
+    ALTER COLUMN id SET DEFAULT nextval('user_events_id_seq'),
+    ADD PRIMARY KEY (id);
+
+CREATE INDEX index_idx_user_events ON user_events (user_id, id);
+
+DROP TABLE IF EXISTS user_event_ids;
@@ -0,0 +1,18 @@
+CREATE TABLE user_event_ids
+(
+    user_id UUID PRIMARY KEY,
+    last_id BIGINT NOT NULL
+);
+
+INSERT INTO user_event_ids (user_id, last_id)
+SELECT user_id, MAX(id) FROM user_events GROUP BY user_id;
+
+ALTER TABLE user_events
+    ALTER COLUMN id DROP DEFAULT,
+    DROP CONSTRAINT user_events_pkey,
+    ADD PRIMARY KEY (user_id, id);
+
+DROP SEQUENCE IF EXISTS user_events_id_seq;
+DROP INDEX IF EXISTS index_idx_user_events;
+
+CREATE INDEX index_idx_user_events_create_at ON user_events (create_at);
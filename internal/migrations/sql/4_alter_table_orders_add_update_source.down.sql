@@ -0,0 +1,3 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS update_source,
+    DROP COLUMN IF EXISTS update_at;
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE orders
+    ADD COLUMN update_source VARCHAR(15) NOT NULL DEFAULT '',
+    ADD COLUMN update_at TIMESTAMPTZ;
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS outbox_attempts;
+DROP TABLE IF EXISTS outbox;
\ No newline at end of file
@@ -0,0 +1,30 @@
+CREATE TABLE outbox
+(
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    create_at TIMESTAMPTZ NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    user_id UUID NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(15) NOT NULL DEFAULT 'PENDING',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    delivered_at TIMESTAMPTZ
+);
+
+CREATE INDEX index_idx_outbox ON outbox (status, next_attempt_at);
+
+CREATE TABLE outbox_attempts
+(
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    event_id UUID NOT NULL,
+    attempt_at TIMESTAMPTZ NOT NULL,
+    sink VARCHAR(50) NOT NULL,
+    error TEXT NOT NULL DEFAULT '',
+    CONSTRAINT fk_outbox
+        FOREIGN KEY(event_id)
+            REFERENCES outbox(id)
+            ON DELETE CASCADE
+);
+
+CREATE INDEX index_idx_outbox_attempts ON outbox_attempts (event_id);
@@ -0,0 +1,39 @@
+CREATE TABLE webhooks
+(
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    create_at TIMESTAMPTZ NOT NULL,
+    user_id UUID NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    secret VARCHAR(64) NOT NULL,
+    event_types VARCHAR(255) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    CONSTRAINT fk_customer
+        FOREIGN KEY(user_id)
+            REFERENCES users(id)
+            ON DELETE CASCADE
+);
+
+CREATE INDEX index_idx_webhooks ON webhooks (user_id);
+
+CREATE TABLE webhook_deliveries
+(
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    create_at TIMESTAMPTZ NOT NULL,
+    webhook_id UUID NOT NULL,
+    event_id UUID NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(15) NOT NULL DEFAULT 'PENDING',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    response_code INTEGER NOT NULL DEFAULT 0,
+    delivered_at TIMESTAMPTZ,
+    CONSTRAINT fk_webhook
+        FOREIGN KEY(webhook_id)
+            REFERENCES webhooks(id)
+            ON DELETE CASCADE,
+    CONSTRAINT unique_webhook_event UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX index_idx_webhook_deliveries ON webhook_deliveries (status, next_attempt_at);
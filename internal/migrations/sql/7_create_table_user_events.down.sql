@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS trigger_notify_user_event ON user_events;
+DROP FUNCTION IF EXISTS notify_user_event;
+DROP TABLE IF EXISTS user_events;
\ No newline at end of file
@@ -0,0 +1,24 @@
+CREATE TABLE user_events
+(
+    id BIGSERIAL PRIMARY KEY,
+    create_at TIMESTAMPTZ NOT NULL,
+    user_id UUID NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL
+);
+
+CREATE INDEX index_idx_user_events ON user_events (user_id, id);
+
+CREATE FUNCTION notify_user_event() RETURNS TRIGGER AS
+$$
+BEGIN
+    PERFORM pg_notify('user_events', NEW.user_id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_notify_user_event
+    AFTER INSERT
+    ON user_events
+    FOR EACH ROW
+EXECUTE FUNCTION notify_user_event();
@@ -0,0 +1,9 @@
+CREATE TABLE rate_limits
+(
+    key VARCHAR(255) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    allowed BOOLEAN NOT NULL,
+    update_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX index_idx_rate_limits ON rate_limits (update_at);
@@ -7,8 +7,10 @@ package mock
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	internal "github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	repositories "github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
 	gomock "github.com/golang/mock/gomock"
 	uuid "github.com/google/uuid"
 )
@@ -36,6 +38,20 @@ func (m *MockStore) EXPECT() *MockStoreMockRecorder {
 	return m.recorder
 }
 
+// AddCampaign mocks base method.
+func (m *MockStore) AddCampaign(ctx context.Context, campaign *internal.Campaign) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddCampaign", ctx, campaign)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddCampaign indicates an expected call of AddCampaign.
+func (mr *MockStoreMockRecorder) AddCampaign(ctx, campaign interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddCampaign", reflect.TypeOf((*MockStore)(nil).AddCampaign), ctx, campaign)
+}
+
 // AddOrder mocks base method.
 func (m *MockStore) AddOrder(ctx context.Context, order *internal.Order) (*internal.Order, error) {
 	m.ctrl.T.Helper()
@@ -51,6 +67,21 @@ func (mr *MockStoreMockRecorder) AddOrder(ctx, order interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddOrder", reflect.TypeOf((*MockStore)(nil).AddOrder), ctx, order)
 }
 
+// AddOrders mocks base method.
+func (m *MockStore) AddOrders(ctx context.Context, orders *[]internal.Order) (*[]internal.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddOrders", ctx, orders)
+	ret0, _ := ret[0].(*[]internal.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddOrders indicates an expected call of AddOrders.
+func (mr *MockStoreMockRecorder) AddOrders(ctx, orders interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddOrders", reflect.TypeOf((*MockStore)(nil).AddOrders), ctx, orders)
+}
+
 // AddUser mocks base method.
 func (m *MockStore) AddUser(ctx context.Context, user *internal.User) error {
 	m.ctrl.T.Helper()
@@ -65,6 +96,48 @@ func (mr *MockStoreMockRecorder) AddUser(ctx, user interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddUser", reflect.TypeOf((*MockStore)(nil).AddUser), ctx, user)
 }
 
+// AddWebhook mocks base method.
+func (m *MockStore) AddWebhook(ctx context.Context, webhook *internal.Webhook, limit int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddWebhook", ctx, webhook, limit)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddWebhook indicates an expected call of AddWebhook.
+func (mr *MockStoreMockRecorder) AddWebhook(ctx, webhook, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddWebhook", reflect.TypeOf((*MockStore)(nil).AddWebhook), ctx, webhook, limit)
+}
+
+// AddWebhookDeliveries mocks base method.
+func (m *MockStore) AddWebhookDeliveries(ctx context.Context, event *internal.OutboxEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddWebhookDeliveries", ctx, event)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddWebhookDeliveries indicates an expected call of AddWebhookDeliveries.
+func (mr *MockStoreMockRecorder) AddWebhookDeliveries(ctx, event interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddWebhookDeliveries", reflect.TypeOf((*MockStore)(nil).AddWebhookDeliveries), ctx, event)
+}
+
+// AddWebhookDelivery mocks base method.
+func (m *MockStore) AddWebhookDelivery(ctx context.Context, delivery *internal.WebhookDelivery) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddWebhookDelivery", ctx, delivery)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddWebhookDelivery indicates an expected call of AddWebhookDelivery.
+func (mr *MockStoreMockRecorder) AddWebhookDelivery(ctx, delivery interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddWebhookDelivery", reflect.TypeOf((*MockStore)(nil).AddWebhookDelivery), ctx, delivery)
+}
+
 // CheckConnection mocks base method.
 func (m *MockStore) CheckConnection() error {
 	m.ctrl.T.Helper()
@@ -79,6 +152,109 @@ func (mr *MockStoreMockRecorder) CheckConnection() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckConnection", reflect.TypeOf((*MockStore)(nil).CheckConnection))
 }
 
+// ClaimOutboxEvents mocks base method.
+func (m *MockStore) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) (*[]internal.OutboxEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimOutboxEvents", ctx, limit, lease)
+	ret0, _ := ret[0].(*[]internal.OutboxEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimOutboxEvents indicates an expected call of ClaimOutboxEvents.
+func (mr *MockStoreMockRecorder) ClaimOutboxEvents(ctx, limit, lease interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimOutboxEvents", reflect.TypeOf((*MockStore)(nil).ClaimOutboxEvents), ctx, limit, lease)
+}
+
+// ClaimWebhookDeliveries mocks base method.
+func (m *MockStore) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) (*[]internal.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimWebhookDeliveries", ctx, limit, lease)
+	ret0, _ := ret[0].(*[]internal.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimWebhookDeliveries indicates an expected call of ClaimWebhookDeliveries.
+func (mr *MockStoreMockRecorder) ClaimWebhookDeliveries(ctx, limit, lease interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimWebhookDeliveries", reflect.TypeOf((*MockStore)(nil).ClaimWebhookDeliveries), ctx, limit, lease)
+}
+
+// CountReferees mocks base method.
+func (m *MockStore) CountReferees(ctx context.Context, referrerID uuid.UUID) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountReferees", ctx, referrerID)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountReferees indicates an expected call of CountReferees.
+func (mr *MockStoreMockRecorder) CountReferees(ctx, referrerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountReferees", reflect.TypeOf((*MockStore)(nil).CountReferees), ctx, referrerID)
+}
+
+// DeleteCampaign mocks base method.
+func (m *MockStore) DeleteCampaign(ctx context.Context, id uuid.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCampaign", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCampaign indicates an expected call of DeleteCampaign.
+func (mr *MockStoreMockRecorder) DeleteCampaign(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCampaign", reflect.TypeOf((*MockStore)(nil).DeleteCampaign), ctx, id)
+}
+
+// DeleteRateBuckets mocks base method.
+func (m *MockStore) DeleteRateBuckets(ctx context.Context, idle time.Duration) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteRateBuckets", ctx, idle)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteRateBuckets indicates an expected call of DeleteRateBuckets.
+func (mr *MockStoreMockRecorder) DeleteRateBuckets(ctx, idle interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRateBuckets", reflect.TypeOf((*MockStore)(nil).DeleteRateBuckets), ctx, idle)
+}
+
+// DeleteUserEvents mocks base method.
+func (m *MockStore) DeleteUserEvents(ctx context.Context, before time.Time) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUserEvents", ctx, before)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteUserEvents indicates an expected call of DeleteUserEvents.
+func (mr *MockStoreMockRecorder) DeleteUserEvents(ctx, before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserEvents", reflect.TypeOf((*MockStore)(nil).DeleteUserEvents), ctx, before)
+}
+
+// DeleteWebhook mocks base method.
+func (m *MockStore) DeleteWebhook(ctx context.Context, userID, id uuid.UUID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhook", ctx, userID, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWebhook indicates an expected call of DeleteWebhook.
+func (mr *MockStoreMockRecorder) DeleteWebhook(ctx, userID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhook", reflect.TypeOf((*MockStore)(nil).DeleteWebhook), ctx, userID, id)
+}
+
 // FindUserByLogin mocks base method.
 func (m *MockStore) FindUserByLogin(ctx context.Context, login string) (*internal.User, error) {
 	m.ctrl.T.Helper()
@@ -94,6 +270,141 @@ func (mr *MockStoreMockRecorder) FindUserByLogin(ctx, login interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUserByLogin", reflect.TypeOf((*MockStore)(nil).FindUserByLogin), ctx, login)
 }
 
+// FindUserByReferralCode mocks base method.
+func (m *MockStore) FindUserByReferralCode(ctx context.Context, code string) (*internal.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindUserByReferralCode", ctx, code)
+	ret0, _ := ret[0].(*internal.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindUserByReferralCode indicates an expected call of FindUserByReferralCode.
+func (mr *MockStoreMockRecorder) FindUserByReferralCode(ctx, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindUserByReferralCode", reflect.TypeOf((*MockStore)(nil).FindUserByReferralCode), ctx, code)
+}
+
+// GetActiveCampaigns mocks base method.
+func (m *MockStore) GetActiveCampaigns(ctx context.Context, at time.Time) (*[]internal.Campaign, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetActiveCampaigns", ctx, at)
+	ret0, _ := ret[0].(*[]internal.Campaign)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetActiveCampaigns indicates an expected call of GetActiveCampaigns.
+func (mr *MockStoreMockRecorder) GetActiveCampaigns(ctx, at interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetActiveCampaigns", reflect.TypeOf((*MockStore)(nil).GetActiveCampaigns), ctx, at)
+}
+
+// GetCampaign mocks base method.
+func (m *MockStore) GetCampaign(ctx context.Context, id uuid.UUID) (*internal.Campaign, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCampaign", ctx, id)
+	ret0, _ := ret[0].(*internal.Campaign)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCampaign indicates an expected call of GetCampaign.
+func (mr *MockStoreMockRecorder) GetCampaign(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCampaign", reflect.TypeOf((*MockStore)(nil).GetCampaign), ctx, id)
+}
+
+// GetCampaigns mocks base method.
+func (m *MockStore) GetCampaigns(ctx context.Context) (*[]internal.Campaign, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCampaigns", ctx)
+	ret0, _ := ret[0].(*[]internal.Campaign)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCampaigns indicates an expected call of GetCampaigns.
+func (mr *MockStoreMockRecorder) GetCampaigns(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCampaigns", reflect.TypeOf((*MockStore)(nil).GetCampaigns), ctx)
+}
+
+// GetDeadLetters mocks base method.
+func (m *MockStore) GetDeadLetters(ctx context.Context) (*[]internal.OutboxEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeadLetters", ctx)
+	ret0, _ := ret[0].(*[]internal.OutboxEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeadLetters indicates an expected call of GetDeadLetters.
+func (mr *MockStoreMockRecorder) GetDeadLetters(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeadLetters", reflect.TypeOf((*MockStore)(nil).GetDeadLetters), ctx)
+}
+
+// GetLastUserEventID mocks base method.
+func (m *MockStore) GetLastUserEventID(ctx context.Context, userID uuid.UUID) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastUserEventID", ctx, userID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLastUserEventID indicates an expected call of GetLastUserEventID.
+func (mr *MockStoreMockRecorder) GetLastUserEventID(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastUserEventID", reflect.TypeOf((*MockStore)(nil).GetLastUserEventID), ctx, userID)
+}
+
+// GetOrder mocks base method.
+func (m *MockStore) GetOrder(ctx context.Context, number string) (*internal.Order, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrder", ctx, number)
+	ret0, _ := ret[0].(*internal.Order)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrder indicates an expected call of GetOrder.
+func (mr *MockStoreMockRecorder) GetOrder(ctx, number interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrder", reflect.TypeOf((*MockStore)(nil).GetOrder), ctx, number)
+}
+
+// GetOrderHistory mocks base method.
+func (m *MockStore) GetOrderHistory(ctx context.Context, orderID uuid.UUID) (*[]internal.OrderStatusChange, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrderHistory", ctx, orderID)
+	ret0, _ := ret[0].(*[]internal.OrderStatusChange)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrderHistory indicates an expected call of GetOrderHistory.
+func (mr *MockStoreMockRecorder) GetOrderHistory(ctx, orderID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderHistory", reflect.TypeOf((*MockStore)(nil).GetOrderHistory), ctx, orderID)
+}
+
+// GetOrderWithdrawals mocks base method.
+func (m *MockStore) GetOrderWithdrawals(ctx context.Context, userID uuid.UUID, number string) (*[]internal.Withdraw, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrderWithdrawals", ctx, userID, number)
+	ret0, _ := ret[0].(*[]internal.Withdraw)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrderWithdrawals indicates an expected call of GetOrderWithdrawals.
+func (mr *MockStoreMockRecorder) GetOrderWithdrawals(ctx, userID, number interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrderWithdrawals", reflect.TypeOf((*MockStore)(nil).GetOrderWithdrawals), ctx, userID, number)
+}
+
 // GetOrders mocks base method.
 func (m *MockStore) GetOrders(ctx context.Context, userID uuid.UUID) (*[]internal.Order, error) {
 	m.ctrl.T.Helper()
@@ -124,6 +435,50 @@ func (mr *MockStoreMockRecorder) GetOrdersNotProcessed(ctx interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrdersNotProcessed", reflect.TypeOf((*MockStore)(nil).GetOrdersNotProcessed), ctx)
 }
 
+// GetReferralCredits mocks base method.
+func (m *MockStore) GetReferralCredits(ctx context.Context, userID uuid.UUID) (*[]internal.ReferralCredit, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReferralCredits", ctx, userID)
+	ret0, _ := ret[0].(*[]internal.ReferralCredit)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReferralCredits indicates an expected call of GetReferralCredits.
+func (mr *MockStoreMockRecorder) GetReferralCredits(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReferralCredits", reflect.TypeOf((*MockStore)(nil).GetReferralCredits), ctx, userID)
+}
+
+// GetStatement mocks base method.
+func (m *MockStore) GetStatement(ctx context.Context, userID uuid.UUID, from, to time.Time, fn func(*internal.StatementEntry) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStatement", ctx, userID, from, to, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetStatement indicates an expected call of GetStatement.
+func (mr *MockStoreMockRecorder) GetStatement(ctx, userID, from, to, fn interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStatement", reflect.TypeOf((*MockStore)(nil).GetStatement), ctx, userID, from, to, fn)
+}
+
+// GetTierAccruals mocks base method.
+func (m *MockStore) GetTierAccruals(ctx context.Context, since time.Time) (*[]internal.TierAccrual, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTierAccruals", ctx, since)
+	ret0, _ := ret[0].(*[]internal.TierAccrual)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTierAccruals indicates an expected call of GetTierAccruals.
+func (mr *MockStoreMockRecorder) GetTierAccruals(ctx, since interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTierAccruals", reflect.TypeOf((*MockStore)(nil).GetTierAccruals), ctx, since)
+}
+
 // GetUser mocks base method.
 func (m *MockStore) GetUser(ctx context.Context, id uuid.UUID) (*internal.User, error) {
 	m.ctrl.T.Helper()
@@ -139,6 +494,81 @@ func (mr *MockStoreMockRecorder) GetUser(ctx, id interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockStore)(nil).GetUser), ctx, id)
 }
 
+// GetUserEvents mocks base method.
+func (m *MockStore) GetUserEvents(ctx context.Context, userID uuid.UUID, afterID int64, limit int) (*[]internal.UserEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserEvents", ctx, userID, afterID, limit)
+	ret0, _ := ret[0].(*[]internal.UserEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserEvents indicates an expected call of GetUserEvents.
+func (mr *MockStoreMockRecorder) GetUserEvents(ctx, userID, afterID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserEvents", reflect.TypeOf((*MockStore)(nil).GetUserEvents), ctx, userID, afterID, limit)
+}
+
+// GetUserVersion mocks base method.
+func (m *MockStore) GetUserVersion(ctx context.Context, id uuid.UUID) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserVersion", ctx, id)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserVersion indicates an expected call of GetUserVersion.
+func (mr *MockStoreMockRecorder) GetUserVersion(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserVersion", reflect.TypeOf((*MockStore)(nil).GetUserVersion), ctx, id)
+}
+
+// GetWebhook mocks base method.
+func (m *MockStore) GetWebhook(ctx context.Context, userID, id uuid.UUID) (*internal.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhook", ctx, userID, id)
+	ret0, _ := ret[0].(*internal.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhook indicates an expected call of GetWebhook.
+func (mr *MockStoreMockRecorder) GetWebhook(ctx, userID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhook", reflect.TypeOf((*MockStore)(nil).GetWebhook), ctx, userID, id)
+}
+
+// GetWebhookDeliveries mocks base method.
+func (m *MockStore) GetWebhookDeliveries(ctx context.Context, userID, webhookID uuid.UUID, limit int) (*[]internal.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhookDeliveries", ctx, userID, webhookID, limit)
+	ret0, _ := ret[0].(*[]internal.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhookDeliveries indicates an expected call of GetWebhookDeliveries.
+func (mr *MockStoreMockRecorder) GetWebhookDeliveries(ctx, userID, webhookID, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhookDeliveries", reflect.TypeOf((*MockStore)(nil).GetWebhookDeliveries), ctx, userID, webhookID, limit)
+}
+
+// GetWebhooks mocks base method.
+func (m *MockStore) GetWebhooks(ctx context.Context, userID uuid.UUID) (*[]internal.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhooks", ctx, userID)
+	ret0, _ := ret[0].(*[]internal.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhooks indicates an expected call of GetWebhooks.
+func (mr *MockStoreMockRecorder) GetWebhooks(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhooks", reflect.TypeOf((*MockStore)(nil).GetWebhooks), ctx, userID)
+}
+
 // GetWithdrawals mocks base method.
 func (m *MockStore) GetWithdrawals(ctx context.Context, userID uuid.UUID) (*[]internal.Withdraw, error) {
 	m.ctrl.T.Helper()
@@ -154,30 +584,129 @@ func (mr *MockStoreMockRecorder) GetWithdrawals(ctx, userID interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWithdrawals", reflect.TypeOf((*MockStore)(nil).GetWithdrawals), ctx, userID)
 }
 
+// ListenUserEvents mocks base method.
+func (m *MockStore) ListenUserEvents(ctx context.Context, notify func(uuid.UUID)) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListenUserEvents", ctx, notify)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ListenUserEvents indicates an expected call of ListenUserEvents.
+func (mr *MockStoreMockRecorder) ListenUserEvents(ctx, notify interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListenUserEvents", reflect.TypeOf((*MockStore)(nil).ListenUserEvents), ctx, notify)
+}
+
+// SaveOrderCheck mocks base method.
+func (m *MockStore) SaveOrderCheck(ctx context.Context, number string, checkedAt, nextCheckAt time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveOrderCheck", ctx, number, checkedAt, nextCheckAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveOrderCheck indicates an expected call of SaveOrderCheck.
+func (mr *MockStoreMockRecorder) SaveOrderCheck(ctx, number, checkedAt, nextCheckAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveOrderCheck", reflect.TypeOf((*MockStore)(nil).SaveOrderCheck), ctx, number, checkedAt, nextCheckAt)
+}
+
+// SaveOutboxDelivery mocks base method.
+func (m *MockStore) SaveOutboxDelivery(ctx context.Context, event *internal.OutboxEvent, attempts *[]internal.OutboxAttempt) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveOutboxDelivery", ctx, event, attempts)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveOutboxDelivery indicates an expected call of SaveOutboxDelivery.
+func (mr *MockStoreMockRecorder) SaveOutboxDelivery(ctx, event, attempts interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveOutboxDelivery", reflect.TypeOf((*MockStore)(nil).SaveOutboxDelivery), ctx, event, attempts)
+}
+
+// SaveWebhookDelivery mocks base method.
+func (m *MockStore) SaveWebhookDelivery(ctx context.Context, delivery *internal.WebhookDelivery) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveWebhookDelivery", ctx, delivery)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveWebhookDelivery indicates an expected call of SaveWebhookDelivery.
+func (mr *MockStoreMockRecorder) SaveWebhookDelivery(ctx, delivery interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveWebhookDelivery", reflect.TypeOf((*MockStore)(nil).SaveWebhookDelivery), ctx, delivery)
+}
+
 // SaveWithdrawal mocks base method.
-func (m *MockStore) SaveWithdrawal(ctx context.Context, withdrawal *internal.Withdraw) error {
+func (m *MockStore) SaveWithdrawal(ctx context.Context, withdrawal *internal.Withdraw, rules repositories.WithdrawalRules) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SaveWithdrawal", ctx, withdrawal)
+	ret := m.ctrl.Call(m, "SaveWithdrawal", ctx, withdrawal, rules)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // SaveWithdrawal indicates an expected call of SaveWithdrawal.
-func (mr *MockStoreMockRecorder) SaveWithdrawal(ctx, withdrawal interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) SaveWithdrawal(ctx, withdrawal, rules interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveWithdrawal", reflect.TypeOf((*MockStore)(nil).SaveWithdrawal), ctx, withdrawal, rules)
+}
+
+// TakeRateToken mocks base method.
+func (m *MockStore) TakeRateToken(ctx context.Context, key string, limit internal.RateLimit) (*internal.RateBucket, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TakeRateToken", ctx, key, limit)
+	ret0, _ := ret[0].(*internal.RateBucket)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TakeRateToken indicates an expected call of TakeRateToken.
+func (mr *MockStoreMockRecorder) TakeRateToken(ctx, key, limit interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveWithdrawal", reflect.TypeOf((*MockStore)(nil).SaveWithdrawal), ctx, withdrawal)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TakeRateToken", reflect.TypeOf((*MockStore)(nil).TakeRateToken), ctx, key, limit)
 }
 
 // UpdateOrder mocks base method.
-func (m *MockStore) UpdateOrder(ctx context.Context, order *internal.Order) error {
+func (m *MockStore) UpdateOrder(ctx context.Context, order *internal.Order, referral repositories.ReferralRules, campaign repositories.CampaignRules) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateOrder", ctx, order)
+	ret := m.ctrl.Call(m, "UpdateOrder", ctx, order, referral, campaign)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateOrder indicates an expected call of UpdateOrder.
-func (mr *MockStoreMockRecorder) UpdateOrder(ctx, order interface{}) *gomock.Call {
+func (mr *MockStoreMockRecorder) UpdateOrder(ctx, order, referral, campaign interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrder", reflect.TypeOf((*MockStore)(nil).UpdateOrder), ctx, order, referral, campaign)
+}
+
+// UpdateTier mocks base method.
+func (m *MockStore) UpdateTier(ctx context.Context, change *internal.TierChange) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateTier", ctx, change)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateTier indicates an expected call of UpdateTier.
+func (mr *MockStoreMockRecorder) UpdateTier(ctx, change interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTier", reflect.TypeOf((*MockStore)(nil).UpdateTier), ctx, change)
+}
+
+// UpdateWebhook mocks base method.
+func (m *MockStore) UpdateWebhook(ctx context.Context, webhook *internal.Webhook) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateWebhook", ctx, webhook)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateWebhook indicates an expected call of UpdateWebhook.
+func (mr *MockStoreMockRecorder) UpdateWebhook(ctx, webhook interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOrder", reflect.TypeOf((*MockStore)(nil).UpdateOrder), ctx, order)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateWebhook", reflect.TypeOf((*MockStore)(nil).UpdateWebhook), ctx, webhook)
 }
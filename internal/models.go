@@ -7,26 +7,46 @@ import (
 )
 
 type User struct {
-	ID       uuid.UUID `db:"id"`
-	CreateAt time.Time `db:"create_at"`
-	Login    string    `db:"login"`
-	Password string    `db:"password"`
-	Bill     float32   `db:"bill"`
+	ID            uuid.UUID  `db:"id"`
+	CreateAt      time.Time  `db:"create_at"`
+	Login         string     `db:"login"`
+	Password      string     `db:"password"`
+	Bill          float32    `db:"bill"`
+	Version       int64      `db:"version"`
+	ReferralCode  string     `db:"referral_code"`
+	ReferredBy    *uuid.UUID `db:"referred_by"`
+	Tier          Tier       `db:"tier"`
+	TierAccrual   float32    `db:"tier_accrual"`
+	TierUpdatedAt *time.Time `db:"tier_updated_at"`
 }
 
 type Order struct {
-	ID       uuid.UUID   `db:"id"`
-	CreateAt time.Time   `db:"create_at"`
-	Number   int64       `db:"number"`
-	Accrual  float32     `db:"accrual"`
-	Status   OrderStatus `db:"status"`
-	UserID   uuid.UUID   `db:"user_id"`
+	ID            uuid.UUID    `db:"id"`
+	CreateAt      time.Time    `db:"create_at"`
+	Number        string       `db:"number"`
+	Accrual       float32      `db:"accrual"`
+	Status        OrderStatus  `db:"status"`
+	UserID        uuid.UUID    `db:"user_id"`
+	UpdateSource  UpdateSource `db:"update_source"`
+	UpdateAt      *time.Time   `db:"update_at"`
+	CreditedAt    *time.Time   `db:"credited_at"`
+	PollCount     int          `db:"poll_count"`
+	CheckedAt     *time.Time   `db:"checked_at"`
+	NextCheckAt   *time.Time   `db:"next_check_at"`
+	CampaignBonus float32      `db:"campaign_bonus"`
+	CampaignID    *uuid.UUID   `db:"campaign_id"`
+}
+
+// BaseAccrual is the accrual of the order decided by the accrual system, Accrual is credited
+// to the bill with CampaignBonus added by the campaign CampaignID.
+func (o *Order) BaseAccrual() float32 {
+	return o.Accrual - o.CampaignBonus
 }
 
 type Withdraw struct {
 	ID       uuid.UUID `db:"id"`
 	CreateAt time.Time `db:"create_at"`
-	Order    int64     `db:"order_num"`
+	Order    string    `db:"order_num"`
 	Sum      float32   `db:"sum"`
 	UserID   uuid.UUID `db:"user_id"`
 }
@@ -41,16 +61,94 @@ const (
 	OrderStatusRegistered OrderStatus = "REGISTERED"
 )
 
+// orderTransitions are the statuses the order can move to from its status,
+// the final statuses INVALID and PROCESSED have none.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusNew:        {OrderStatusProcessing, OrderStatusInvalid, OrderStatusProcessed},
+	OrderStatusProcessing: {OrderStatusInvalid, OrderStatusProcessed},
+}
+
+// IsFinal reports whether the status of the order can't be changed anymore.
+func (s OrderStatus) IsFinal() bool {
+	return len(orderTransitions[s]) == 0
+}
+
+// CanMoveTo reports whether the order can move from s to next, staying in the same
+// status isn't a transition.
+func (s OrderStatus) CanMoveTo(next OrderStatus) bool {
+	for _, status := range orderTransitions[s] {
+		if status == next {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateSource is the way the accrual state of an order has been received.
+type UpdateSource string
+
+const (
+	UpdateSourcePoll     UpdateSource = "POLL"
+	UpdateSourceCallback UpdateSource = "CALLBACK"
+	UpdateSourceUpload   UpdateSource = "UPLOAD"
+)
+
+// OrderStatusChange is the entry of the history of the order, the upload of the order
+// is the change to NEW with empty FromStatus.
+type OrderStatusChange struct {
+	ID         int64        `db:"id"`
+	OrderID    uuid.UUID    `db:"order_id"`
+	CreateAt   time.Time    `db:"create_at"`
+	FromStatus OrderStatus  `db:"from_status"`
+	Status     OrderStatus  `db:"status"`
+	Source     UpdateSource `db:"source"`
+}
+
+// ReferralRole is the party of the referral the bonus is credited to.
+type ReferralRole string
+
+const (
+	ReferralRoleReferrer ReferralRole = "REFERRER"
+	ReferralRoleReferee  ReferralRole = "REFEREE"
+)
+
+// ReferralCredit is the bonus credited to the bill of the user for the referral, Order is
+// the processed order of the referee which the bonus is credited for.
+type ReferralCredit struct {
+	ID        uuid.UUID    `db:"id"`
+	CreateAt  time.Time    `db:"create_at"`
+	UserID    uuid.UUID    `db:"user_id"`
+	RefereeID uuid.UUID    `db:"referee_id"`
+	Role      ReferralRole `db:"role"`
+	Order     string       `db:"order_num"`
+	Sum       float32      `db:"sum"`
+}
+
+// Referral is the state the rules of the referral program decide by: the referee with his
+// processed order and the referrer with the bonuses credited to him as referrer.
+type Referral struct {
+	Referrer        User
+	Referee         User
+	Order           Order
+	ReferrerCredits []ReferralCredit
+}
+
 type UserDto struct {
-	Login string `json:"login"`
-	Pass  string `json:"password"`
+	Login        string `json:"login"`
+	Pass         string `json:"password"`
+	ReferralCode string `json:"referral_code,omitempty"`
 }
 
+// OrderDto is the order of the user, Accrual is the sum credited to the bill. The accrual
+// of the order with the campaign bonus is split into BaseAccrual decided by the accrual
+// system and CampaignBonus.
 type OrderDto struct {
-	Number  string    `json:"number"`
-	Status  string    `json:"status"`
-	Accrual float32   `json:"accrual"`
-	Upload  time.Time `json:"uploaded_at"`
+	Number        string    `json:"number"`
+	Status        string    `json:"status"`
+	Accrual       float32   `json:"accrual"`
+	BaseAccrual   float32   `json:"base_accrual,omitempty"`
+	CampaignBonus float32   `json:"campaign_bonus,omitempty"`
+	Upload        time.Time `json:"uploaded_at"`
 }
 
 func (t *OrderDto) MarshalJSON() ([]byte, error) {
@@ -64,6 +162,94 @@ func (t *OrderDto) MarshalJSON() ([]byte, error) {
 	})
 }
 
+type OrderStatusChangeDto struct {
+	From     string    `json:"from,omitempty"`
+	Status   string    `json:"status"`
+	Source   string    `json:"source"`
+	CreateAt time.Time `json:"changed_at"`
+}
+
+func (t *OrderStatusChangeDto) MarshalJSON() ([]byte, error) {
+	type Alias OrderStatusChangeDto
+	return json.Marshal(&struct {
+		*Alias
+		CreateAt string `json:"changed_at"`
+	}{
+		Alias:    (*Alias)(t),
+		CreateAt: t.CreateAt.Format(time.RFC3339),
+	})
+}
+
+// OrderDetailDto is the order with the history of its statuses, the checks of its accrual
+// and the withdrawals paid for it. NextCheckAt is empty for the order with final status.
+type OrderDetailDto struct {
+	Number        string                 `json:"number"`
+	Status        string                 `json:"status"`
+	Accrual       float32                `json:"accrual"`
+	BaseAccrual   float32                `json:"base_accrual,omitempty"`
+	CampaignBonus float32                `json:"campaign_bonus,omitempty"`
+	Campaign      string                 `json:"campaign,omitempty"`
+	Upload        time.Time              `json:"uploaded_at"`
+	History       []OrderStatusChangeDto `json:"history"`
+	PollCount     int                    `json:"poll_count"`
+	CheckedAt     *time.Time             `json:"checked_at,omitempty"`
+	NextCheckAt   *time.Time             `json:"next_check_at,omitempty"`
+	Withdrawals   []WithdrawDto          `json:"withdrawals"`
+}
+
+func (t *OrderDetailDto) MarshalJSON() ([]byte, error) {
+	type Alias OrderDetailDto
+	return json.Marshal(&struct {
+		*Alias
+		Upload string `json:"uploaded_at"`
+	}{
+		Alias:  (*Alias)(t),
+		Upload: t.Upload.Format(time.RFC3339),
+	})
+}
+
+type ReferralCreditDto struct {
+	Role     string    `json:"role"`
+	Order    string    `json:"order"`
+	Sum      float32   `json:"sum"`
+	CreateAt time.Time `json:"credited_at"`
+}
+
+func (t *ReferralCreditDto) MarshalJSON() ([]byte, error) {
+	type Alias ReferralCreditDto
+	return json.Marshal(&struct {
+		*Alias
+		CreateAt string `json:"credited_at"`
+	}{
+		Alias:    (*Alias)(t),
+		CreateAt: t.CreateAt.Format(time.RFC3339),
+	})
+}
+
+// ReferralDto is the referral code of the user with the number of users invited by it and
+// the bonuses credited to the user both as referrer and as referee.
+type ReferralDto struct {
+	Code    string              `json:"code"`
+	Invited int                 `json:"invited"`
+	Earned  float32             `json:"earned"`
+	Credits []ReferralCreditDto `json:"credits"`
+}
+
+// BatchOrderResult is the outcome of one number of the batch upload.
+type BatchOrderResult string
+
+const (
+	BatchOrderAccepted      BatchOrderResult = "ACCEPTED"
+	BatchOrderUploaded      BatchOrderResult = "ALREADY_UPLOADED"
+	BatchOrderAnotherUser   BatchOrderResult = "UPLOADED_BY_ANOTHER_USER"
+	BatchOrderIllegalNumber BatchOrderResult = "INVALID_NUMBER"
+)
+
+type BatchOrderDto struct {
+	Number string           `json:"number"`
+	Result BatchOrderResult `json:"result"`
+}
+
 type AccrualDto struct {
 	Order   string  `json:"order"`
 	Status  string  `json:"status"`
@@ -91,3 +277,280 @@ func (t *WithdrawDto) MarshalJSON() ([]byte, error) {
 		CreateAt: t.CreateAt.Format(time.RFC3339),
 	})
 }
+
+type StatementOperation string
+
+const (
+	StatementAccrual    StatementOperation = "ACCRUAL"
+	StatementWithdrawal StatementOperation = "WITHDRAWAL"
+	StatementReferral   StatementOperation = "REFERRAL"
+)
+
+// StatementEntry is the accrual or the withdrawal with the balance after it,
+// Amount of the withdrawal is negative.
+type StatementEntry struct {
+	Date      time.Time          `db:"at"`
+	Operation StatementOperation `db:"operation"`
+	Order     string             `db:"order_num"`
+	Amount    float32            `db:"amount"`
+	Balance   float32            `db:"balance"`
+}
+
+type StatementDto struct {
+	Date      time.Time `json:"date"`
+	Operation string    `json:"operation"`
+	Order     string    `json:"order"`
+	Amount    float32   `json:"amount"`
+	Balance   float32   `json:"balance"`
+}
+
+func (t *StatementDto) MarshalJSON() ([]byte, error) {
+	type Alias StatementDto
+	return json.Marshal(&struct {
+		*Alias
+		Date string `json:"date"`
+	}{
+		Alias: (*Alias)(t),
+		Date:  t.Date.Format(time.RFC3339),
+	})
+}
+
+type EventType string
+
+const (
+	EventOrderProcessed   EventType = "order.processed"
+	EventOrderInvalid     EventType = "order.invalid"
+	EventWithdrawal       EventType = "balance.withdrawn"
+	EventReferralCredited EventType = "referral.credited"
+	EventTierChanged      EventType = "tier.changed"
+)
+
+type OutboxStatus string
+
+const (
+	OutboxStatusPending   OutboxStatus = "PENDING"
+	OutboxStatusDelivered OutboxStatus = "DELIVERED"
+	OutboxStatusDead      OutboxStatus = "DEAD"
+)
+
+// OutboxEvent is written in the same transaction as the change it describes
+// and delivered to the sinks at least once.
+type OutboxEvent struct {
+	ID            uuid.UUID       `db:"id" json:"id"`
+	CreateAt      time.Time       `db:"create_at" json:"created_at"`
+	Type          EventType       `db:"event_type" json:"type"`
+	UserID        uuid.UUID       `db:"user_id" json:"user_id"`
+	Payload       json.RawMessage `db:"payload" json:"payload"`
+	Status        OutboxStatus    `db:"status" json:"-"`
+	Attempts      int             `db:"attempts" json:"-"`
+	NextAttemptAt time.Time       `db:"next_attempt_at" json:"-"`
+	LastError     string          `db:"last_error" json:"-"`
+	DeliveredAt   *time.Time      `db:"delivered_at" json:"-"`
+}
+
+type OutboxAttempt struct {
+	ID        uuid.UUID `db:"id"`
+	EventID   uuid.UUID `db:"event_id"`
+	AttemptAt time.Time `db:"attempt_at"`
+	Sink      string    `db:"sink"`
+	Error     string    `db:"error"`
+}
+
+type OrderEventDto struct {
+	Order   string  `json:"order"`
+	Status  string  `json:"status"`
+	Accrual float32 `json:"accrual"`
+}
+
+type WithdrawalEventDto struct {
+	Order string  `json:"order"`
+	Sum   float32 `json:"sum"`
+}
+
+type ReferralEventDto struct {
+	Role  string  `json:"role"`
+	Order string  `json:"order"`
+	Sum   float32 `json:"sum"`
+}
+
+type TierEventDto struct {
+	From    string  `json:"from"`
+	To      string  `json:"to"`
+	Accrual float32 `json:"accrual"`
+}
+
+const EventWebhookTest EventType = "webhook.test"
+
+// Webhook is the subscription of the user to events of his orders and balance,
+// EventTypes is the comma separated list of EventType.
+type Webhook struct {
+	ID         uuid.UUID `db:"id"`
+	CreateAt   time.Time `db:"create_at"`
+	UserID     uuid.UUID `db:"user_id"`
+	URL        string    `db:"url"`
+	Secret     string    `db:"secret"`
+	EventTypes string    `db:"event_types"`
+	Active     bool      `db:"active"`
+}
+
+// WebhookDelivery is the entry of the delivery log of a webhook, URL and Secret
+// are filled only for the claimed deliveries.
+type WebhookDelivery struct {
+	ID            uuid.UUID       `db:"id"`
+	CreateAt      time.Time       `db:"create_at"`
+	WebhookID     uuid.UUID       `db:"webhook_id"`
+	EventID       uuid.UUID       `db:"event_id"`
+	EventType     EventType       `db:"event_type"`
+	Payload       json.RawMessage `db:"payload"`
+	Status        OutboxStatus    `db:"status"`
+	Attempts      int             `db:"attempts"`
+	NextAttemptAt time.Time       `db:"next_attempt_at"`
+	LastError     string          `db:"last_error"`
+	ResponseCode  int             `db:"response_code"`
+	DeliveredAt   *time.Time      `db:"delivered_at"`
+	URL           string          `db:"url"`
+	Secret        string          `db:"secret"`
+}
+
+type WebhookDto struct {
+	ID         string    `json:"id,omitempty"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Active     *bool     `json:"active,omitempty"`
+	Secret     string    `json:"secret,omitempty"`
+	CreateAt   time.Time `json:"created_at"`
+}
+
+type WebhookDeliveryDto struct {
+	ID           string     `json:"id"`
+	EventID      string     `json:"event_id"`
+	EventType    string     `json:"event_type"`
+	Status       string     `json:"status"`
+	Attempts     int        `json:"attempts"`
+	ResponseCode int        `json:"response_code,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+	CreateAt     time.Time  `json:"created_at"`
+	NextAttempt  *time.Time `json:"next_attempt_at,omitempty"`
+	DeliveredAt  *time.Time `json:"delivered_at,omitempty"`
+}
+
+// WebhookEventDto is the body of the request sent to the webhook.
+type WebhookEventDto struct {
+	ID       string          `json:"id"`
+	Type     string          `json:"type"`
+	CreateAt time.Time       `json:"created_at"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+const (
+	EventOrderStatus    EventType = "order.status"
+	EventBalanceChanged EventType = "balance.changed"
+)
+
+// UserEvent is the entry of the log of changes streamed to the user, ID grows
+// monotonically so the stream can be resumed after it.
+type UserEvent struct {
+	ID       int64           `db:"id"`
+	CreateAt time.Time       `db:"create_at"`
+	UserID   uuid.UUID       `db:"user_id"`
+	Type     EventType       `db:"event_type"`
+	Payload  json.RawMessage `db:"payload"`
+}
+
+// Campaign multiplies the accrual of the orders uploaded from StartsAt till EndsAt by
+// Multiplier. Weekdays are the comma separated days of the week the order must be uploaded
+// on, e.g. "SAT,SUN", NewUserDays is the age of the account of the user at the upload and
+// MinAccrual is the least accrual of the order, the empty and zero conditions aren't checked.
+type Campaign struct {
+	ID          uuid.UUID `db:"id"`
+	CreateAt    time.Time `db:"create_at"`
+	Name        string    `db:"name"`
+	Multiplier  float32   `db:"multiplier"`
+	StartsAt    time.Time `db:"starts_at"`
+	EndsAt      time.Time `db:"ends_at"`
+	Weekdays    string    `db:"weekdays"`
+	NewUserDays int       `db:"new_user_days"`
+	MinAccrual  float32   `db:"min_accrual"`
+}
+
+type CampaignDto struct {
+	ID          string    `json:"id,omitempty"`
+	Name        string    `json:"name"`
+	Multiplier  float32   `json:"multiplier"`
+	StartsAt    time.Time `json:"starts_at"`
+	EndsAt      time.Time `json:"ends_at"`
+	Weekdays    []string  `json:"weekdays,omitempty"`
+	NewUserDays int       `json:"new_user_days,omitempty"`
+	MinAccrual  float32   `json:"min_accrual,omitempty"`
+	CreateAt    time.Time `json:"created_at"`
+}
+
+// RateLimit is the token bucket of Limit tokens which is refilled completely in Period.
+type RateLimit struct {
+	Limit  int
+	Period time.Duration
+}
+
+// Rate is the number of tokens added to the bucket per second.
+func (l RateLimit) Rate() float64 {
+	return float64(l.Limit) / l.Period.Seconds()
+}
+
+// RateBucket is the state of the bucket after the request has tried to take a token.
+type RateBucket struct {
+	Tokens  float64 `db:"tokens"`
+	Allowed bool    `db:"allowed"`
+}
+
+// RateDecision is the answer of the limiter to the request, Reset is the time till the
+// bucket is full and RetryAfter is the time till the next token if the request isn't allowed.
+type RateDecision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Tier is the loyalty tier of the user decided by the points accrued in the last 12 months.
+type Tier string
+
+const (
+	TierBronze Tier = "BRONZE"
+	TierSilver Tier = "SILVER"
+	TierGold   Tier = "GOLD"
+)
+
+// TierAccrual is the points accrued to the user in the last 12 months, Tier and TierAccrual
+// are saved by the last recomputation.
+type TierAccrual struct {
+	UserID      uuid.UUID `db:"user_id"`
+	Tier        Tier      `db:"tier"`
+	TierAccrual float32   `db:"tier_accrual"`
+	Accrual     float32   `db:"accrual"`
+}
+
+// TierChange moves the user from the tier From to the tier To with Accrual points
+// accrued in the last 12 months.
+type TierChange struct {
+	UserID   uuid.UUID
+	CreateAt time.Time
+	From     Tier
+	To       Tier
+	Accrual  float32
+}
+
+// ProfileDto shows the tier of the user and the progress to the next tier, NextTier and
+// ToNextTier are omitted for the top tier and WithdrawalLimit for the tier without the limit.
+type ProfileDto struct {
+	Login            string     `json:"login"`
+	CreateAt         time.Time  `json:"registered_at"`
+	Tier             string     `json:"tier"`
+	TierAccrual      float32    `json:"tier_accrual"`
+	NextTier         string     `json:"next_tier,omitempty"`
+	ToNextTier       float32    `json:"to_next_tier,omitempty"`
+	CampaignFactor   float32    `json:"campaign_factor"`
+	WithdrawalLimit  float32    `json:"withdrawal_limit,omitempty"`
+	WithdrawalPeriod string     `json:"withdrawal_period,omitempty"`
+	TierUpdatedAt    *time.Time `json:"tier_updated_at,omitempty"`
+}
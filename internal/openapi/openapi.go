@@ -0,0 +1,10 @@
+// Package openapi holds the OpenAPI 3 description of the HTTP API of the service,
+// it must be changed together with the routes of handlers.UserRouter.
+package openapi
+
+import (
+	_ "embed"
+)
+
+//go:embed openapi.json
+var Spec []byte
@@ -0,0 +1,120 @@
+// Package ordernumber normalizes the numbers of orders and validates them by the rules
+// of the source the order comes from.
+package ordernumber
+
+import (
+	"fmt"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"strings"
+	"unicode"
+)
+
+// MaxLength is the size of the column of the number of the order.
+const MaxLength = 64
+
+// Validator checks the normalized number of the order.
+type Validator interface {
+	Validate(number string) error
+}
+
+// Normalize removes the whitespaces of the number and upper cases its letters. The normalized
+// number consists of latin letters, digits and dashes and isn't longer than MaxLength. The leading
+// zeros of the number of digits are removed, "0042" and "42" were one order while the numbers were
+// stored as BIGINT and they stay one order.
+func Normalize(number string) (string, error) {
+	normalized := strings.ToUpper(strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, number))
+	if normalized == "" || len(normalized) > MaxLength {
+		return "", fmt.Errorf("number %q has length out of 1..%d, %w", number, MaxLength, errors2.ErrIllegalOrder)
+	}
+	for _, r := range normalized {
+		if !(r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r == '-') {
+			return "", fmt.Errorf("number %q has illegal symbol %q, %w", number, r, errors2.ErrIllegalOrder)
+		}
+	}
+	if isDigits(normalized) {
+		if trimmed := strings.TrimLeft(normalized, "0"); trimmed != "" {
+			return trimmed, nil
+		}
+		return "0", nil
+	}
+	return normalized, nil
+}
+
+func isDigits(number string) bool {
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Luhn accepts the number of digits with the valid check digit of the Luhn algorithm,
+// the number of any length is checked without parsing it to an integer.
+type Luhn struct{}
+
+func (Luhn) Validate(number string) error {
+	var sum int
+	for i := 0; i < len(number); i++ {
+		digit := number[len(number)-1-i]
+		if digit < '0' || digit > '9' {
+			return fmt.Errorf("number %s isn't a number of digits, %w", number, errors2.ErrIllegalOrder)
+		}
+		cur := int(digit - '0')
+		if i%2 == 1 {
+			cur = cur * 2
+			if cur > 9 {
+				cur = cur - 9
+			}
+		}
+		sum += cur
+	}
+	if number == "" || sum%10 != 0 {
+		return fmt.Errorf("number %s fails the Luhn check, %w", number, errors2.ErrIllegalOrder)
+	}
+	return nil
+}
+
+// Length accepts the number with the length in [Min, Max].
+type Length struct {
+	Min int
+	Max int
+}
+
+func (l Length) Validate(number string) error {
+	if len(number) < l.Min || len(number) > l.Max {
+		return fmt.Errorf("number %s has length out of %d..%d, %w", number, l.Min, l.Max, errors2.ErrIllegalOrder)
+	}
+	return nil
+}
+
+// Prefix accepts the number which starts with one of Prefixes.
+type Prefix struct {
+	Prefixes []string
+}
+
+func (p Prefix) Validate(number string) error {
+	for _, prefix := range p.Prefixes {
+		if strings.HasPrefix(number, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("number %s has no prefix of %s, %w", number, strings.Join(p.Prefixes, ", "), errors2.ErrIllegalOrder)
+}
+
+// Rules accepts the number which is accepted by all its validators.
+type Rules []Validator
+
+func (r Rules) Validate(number string) error {
+	for _, validator := range r {
+		if err := validator.Validate(number); err != nil {
+			return err
+		}
+	}
+	return nil
+}
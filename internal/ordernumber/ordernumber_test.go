@@ -0,0 +1,121 @@
+package ordernumber
+
+import (
+	"errors"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		number  string
+		want    string
+		wantErr bool
+	}{
+		{name: "digits", number: "4539088167512356", want: "4539088167512356"},
+		{name: "spaces_and_lower_case", number: " mp-ab 1234\t56 ", want: "MP-AB123456"},
+		{name: "leading_zeros", number: "00 4539088167512356", want: "4539088167512356"},
+		{name: "zeros", number: "000", want: "0"},
+		{name: "leading_zeros_of_letters", number: "007-AB", want: "007-AB"},
+		{name: "empty", number: "  ", wantErr: true},
+		{name: "illegal_symbol", number: "12_34", wantErr: true},
+		{name: "not_latin", number: "12Ж4", wantErr: true},
+		{name: "too_long", number: string(make([]byte, MaxLength+1)), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.number)
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, errors2.ErrIllegalOrder), "Normalize(%q) error = %v", tt.number, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLuhn_Validate(t *testing.T) {
+	orders := map[string]bool{
+		"1":                      false,
+		"1234567890":             false,
+		"4539088167512356":       true,
+		"3536137811022331":       true,
+		"112345678912345":        false,
+		"140672056":              true,
+		"10000000000000":         false,
+		"12345678901234567894":   true,
+		"4539088167512356000000": true,
+		"MP-4539088167512356":    false,
+		"":                       false,
+	}
+	for number, want := range orders {
+		err := Luhn{}.Validate(number)
+		if (err == nil) != want {
+			t.Errorf("Luhn.Validate(%q) = %v, want valid %v", number, err, want)
+		}
+	}
+}
+
+func TestRules_Validate(t *testing.T) {
+	rules := Rules{Prefix{Prefixes: []string{"MP-", "WB-"}}, Length{Min: 6, Max: 10}}
+	orders := map[string]bool{
+		"MP-123":      true,
+		"WB-1234567":  true,
+		"MP-1":        false,
+		"MP-12345678": false,
+		"XX-123":      false,
+	}
+	for number, want := range orders {
+		err := rules.Validate(number)
+		if (err == nil) != want {
+			t.Errorf("Rules.Validate(%q) = %v, want valid %v", number, err, want)
+		}
+		if err != nil {
+			assert.True(t, errors.Is(err, errors2.ErrIllegalOrder))
+		}
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	sources, err := ParseSources(" marketplace = prefix:mp-|wb- , length:6-40 ; partner=luhn,length:12-24")
+	assert.NoError(t, err)
+	assert.Len(t, sources, 3)
+	assert.Equal(t, Rules{Luhn{}}, sources[DefaultSource])
+	assert.Equal(t, Rules{Prefix{Prefixes: []string{"MP-", "WB-"}}, Length{Min: 6, Max: 40}}, sources["marketplace"])
+	assert.Equal(t, Rules{Luhn{}, Length{Min: 12, Max: 24}}, sources["partner"])
+
+	sources, err = ParseSources("")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultSources(), sources)
+
+	sources, err = ParseSources("default=length:1-64")
+	assert.NoError(t, err)
+	assert.Equal(t, Rules{Length{Min: 1, Max: 64}}, sources[DefaultSource])
+
+	for _, config := range []string{"=luhn", "src", "src=crc", "src=length:6", "src=length:a-b", "src=length:10-6", "src=length:1-65", "src=prefix:|"} {
+		_, err := ParseSources(config)
+		assert.Error(t, err, "ParseSources(%q)", config)
+	}
+}
+
+func TestSources_Validate(t *testing.T) {
+	sources, err := ParseSources("marketplace=prefix:MP-,length:8-40")
+	assert.NoError(t, err)
+
+	got, err := sources.Validate("", " 4539 0881 6751 2356 ")
+	assert.NoError(t, err)
+	assert.Equal(t, "4539088167512356", got)
+
+	got, err = sources.Validate("marketplace", "mp-ab12345678901234567890")
+	assert.NoError(t, err)
+	assert.Equal(t, "MP-AB12345678901234567890", got)
+
+	_, err = sources.Validate(DefaultSource, "MP-AB12345678901234567890")
+	assert.True(t, errors.Is(err, errors2.ErrIllegalOrder))
+
+	_, err = sources.Validate("partner", "4539088167512356")
+	assert.True(t, errors.Is(err, errors2.ErrUnknownOrderSource))
+}
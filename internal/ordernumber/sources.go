@@ -0,0 +1,121 @@
+package ordernumber
+
+import (
+	"fmt"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"strconv"
+	"strings"
+)
+
+// DefaultSource is the source of the order uploaded without the source.
+const DefaultSource = "default"
+
+// Sources are the rules of the numbers of orders by the name of their source.
+type Sources map[string]Validator
+
+// DefaultSources accepts the numbers of the default source by the Luhn algorithm.
+func DefaultSources() Sources {
+	return Sources{DefaultSource: Rules{Luhn{}}}
+}
+
+// Validator returns the rules of source, the empty source is DefaultSource.
+func (s Sources) Validator(source string) (Validator, error) {
+	if source == "" {
+		source = DefaultSource
+	}
+	validator, ok := s[source]
+	if !ok {
+		return nil, fmt.Errorf("source %q, %w", source, errors2.ErrUnknownOrderSource)
+	}
+	return validator, nil
+}
+
+// Validate normalizes the number and checks it by the rules of source.
+func (s Sources) Validate(source string, number string) (string, error) {
+	validator, err := s.Validator(source)
+	if err != nil {
+		return "", err
+	}
+	normalized, err := Normalize(number)
+	if err != nil {
+		return "", err
+	}
+	if err := validator.Validate(normalized); err != nil {
+		return "", err
+	}
+	return normalized, nil
+}
+
+// ParseSources parses the rules of the sources in the format
+// `source=rule,rule;source=rule`, where the rule is `luhn`, `length:min-max` or
+// `prefix:A|B`. The default source keeps the Luhn rule unless it is configured.
+func ParseSources(config string) (Sources, error) {
+	sources := DefaultSources()
+	for _, part := range strings.Split(config, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, rules, ok := strings.Cut(part, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("source %q has no name", part)
+		}
+		validator, err := parseRules(rules)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", name, err)
+		}
+		sources[name] = validator
+	}
+	return sources, nil
+}
+
+func parseRules(config string) (Rules, error) {
+	rules := make(Rules, 0)
+	for _, rule := range strings.Split(config, ",") {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), ":")
+		switch name {
+		case "luhn":
+			rules = append(rules, Luhn{})
+		case "length":
+			length, err := parseLength(arg)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, length)
+		case "prefix":
+			prefixes := make([]string, 0)
+			for _, prefix := range strings.Split(arg, "|") {
+				if prefix = strings.ToUpper(strings.TrimSpace(prefix)); prefix != "" {
+					prefixes = append(prefixes, prefix)
+				}
+			}
+			if len(prefixes) == 0 {
+				return nil, fmt.Errorf("rule %q has no prefixes", rule)
+			}
+			rules = append(rules, Prefix{Prefixes: prefixes})
+		default:
+			return nil, fmt.Errorf("unknown rule %q", rule)
+		}
+	}
+	return rules, nil
+}
+
+func parseLength(arg string) (Length, error) {
+	from, to, ok := strings.Cut(arg, "-")
+	if !ok {
+		return Length{}, fmt.Errorf("length %q isn't min-max", arg)
+	}
+	minLength, err := strconv.Atoi(strings.TrimSpace(from))
+	if err != nil {
+		return Length{}, fmt.Errorf("length %q isn't min-max", arg)
+	}
+	maxLength, err := strconv.Atoi(strings.TrimSpace(to))
+	if err != nil {
+		return Length{}, fmt.Errorf("length %q isn't min-max", arg)
+	}
+	if minLength < 1 || minLength > maxLength || maxLength > MaxLength {
+		return Length{}, fmt.Errorf("length %q is out of 1..%d", arg, MaxLength)
+	}
+	return Length{Min: minLength, Max: maxLength}, nil
+}
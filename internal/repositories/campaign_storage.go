@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const selectActiveCampaigns = `SELECT * FROM campaigns WHERE starts_at <= $1 AND ends_at > $1 ORDER BY starts_at, create_at`
+
+func (store *StoreImpl) AddCampaign(ctx context.Context, campaign *internal.Campaign) error {
+	_, err := store.db.NamedExecContext(ctx,
+		`INSERT INTO campaigns (id, create_at, name, multiplier, starts_at, ends_at, weekdays, new_user_days, min_accrual)
+			VALUES (:id, :create_at, :name, :multiplier, :starts_at, :ends_at, :weekdays, :new_user_days, :min_accrual)`,
+		campaign)
+	if err != nil {
+		return fmt.Errorf("can't save campaign to db %w", err)
+	}
+	return nil
+}
+
+func (store *StoreImpl) GetCampaigns(ctx context.Context) (*[]internal.Campaign, error) {
+	var campaigns []internal.Campaign
+	err := store.db.SelectContext(ctx, &campaigns, `SELECT * FROM campaigns ORDER BY starts_at, create_at`)
+	if err != nil {
+		return nil, fmt.Errorf("can't get campaigns from db %w", err)
+	}
+	return &campaigns, nil
+}
+
+func (store *StoreImpl) GetCampaign(ctx context.Context, id uuid.UUID) (*internal.Campaign, error) {
+	var campaign internal.Campaign
+	err := store.db.GetContext(ctx, &campaign, `SELECT * FROM campaigns WHERE id = $1`, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors2.ErrCampaignNotFound
+		}
+		return nil, fmt.Errorf("can't get campaign from db %w", err)
+	}
+	return &campaign, nil
+}
+
+// DeleteCampaign deletes the campaign, the orders keep the bonuses credited by it.
+func (store *StoreImpl) DeleteCampaign(ctx context.Context, id uuid.UUID) error {
+	result, err := store.db.ExecContext(ctx, `DELETE FROM campaigns WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("can't delete campaign from db %w", err)
+	}
+	return checkAffected(result, errors2.ErrCampaignNotFound)
+}
+
+// GetActiveCampaigns returns the campaigns whose period includes at.
+func (store *StoreImpl) GetActiveCampaigns(ctx context.Context, at time.Time) (*[]internal.Campaign, error) {
+	var campaigns []internal.Campaign
+	err := store.db.SelectContext(ctx, &campaigns, selectActiveCampaigns, at)
+	if err != nil {
+		return nil, fmt.Errorf("can't get campaigns from db %w", err)
+	}
+	return &campaigns, nil
+}
+
+// applyCampaign returns the order with the bonus of the campaign decided by rules for the locked
+// order and user, the campaigns are active at the upload of the order.
+func applyCampaign(ctx context.Context, tx *sqlx.Tx, current *internal.Order, order *internal.Order, rules CampaignRules) (*internal.Order, error) {
+	var user internal.User
+	err := tx.GetContext(ctx, &user, `SELECT * FROM users WHERE id = $1 FOR UPDATE`, current.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("can't get user from db %w", err)
+	}
+	var campaigns []internal.Campaign
+	err = tx.SelectContext(ctx, &campaigns, selectActiveCampaigns, current.CreateAt)
+	if err != nil {
+		return nil, fmt.Errorf("can't get campaigns from db %w", err)
+	}
+	processed := *current
+	processed.Status = order.Status
+	processed.Accrual = order.Accrual
+	campaign, bonus := rules(&processed, &user, campaigns)
+	if campaign == nil || bonus <= 0 {
+		return order, nil
+	}
+	applied := *order
+	applied.Accrual += bonus
+	applied.CampaignBonus = bonus
+	applied.CampaignID = &campaign.ID
+	return &applied, nil
+}
@@ -0,0 +1,11 @@
+package repositories_test
+
+import (
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories/storetest"
+	"testing"
+)
+
+func TestStore_Conformance(t *testing.T) {
+	storetest.Run(t, repositories.NewTestStore)
+}
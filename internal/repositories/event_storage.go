@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// userEventsChannel is notified by the trigger of user_events with the id of the user.
+const userEventsChannel = "user_events"
+
+// GetUserEvents returns the events of the user after afterID. The ids are numbered per user
+// in the order of commit, see addUserEvent, so the stream resumed after afterID has no gaps.
+func (store *StoreImpl) GetUserEvents(ctx context.Context, userID uuid.UUID, afterID int64, limit int) (*[]internal.UserEvent, error) {
+	var events []internal.UserEvent
+	err := store.db.SelectContext(ctx, &events,
+		`SELECT * FROM user_events WHERE user_id = $1 AND id > $2 ORDER BY id LIMIT $3`,
+		userID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't get user events from db %w", err)
+	}
+	return &events, nil
+}
+
+func (store *StoreImpl) GetLastUserEventID(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var id int64
+	err := store.db.GetContext(ctx, &id,
+		`SELECT COALESCE((SELECT last_id FROM user_event_ids WHERE user_id = $1), 0)`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("can't get last user event from db %w", err)
+	}
+	return id, nil
+}
+
+// DeleteUserEvents deletes the events written before and returns their count, the ids of
+// the deleted events aren't used again.
+func (store *StoreImpl) DeleteUserEvents(ctx context.Context, before time.Time) (int64, error) {
+	result, err := store.db.ExecContext(ctx, `DELETE FROM user_events WHERE create_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("can't delete user events from db %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("can't delete user events from db %w", err)
+	}
+	return deleted, nil
+}
+
+// ListenUserEvents calls notify with the user of every event written by any replica
+// until ctx is done. The listening connection is taken out of the pool for that time.
+func (store *StoreImpl) ListenUserEvents(ctx context.Context, notify func(userID uuid.UUID)) error {
+	conn, err := store.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("can't get connection to db %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		pgxConn := driverConn.(*stdlib.Conn).Conn()
+		if _, err := pgxConn.Exec(ctx, "LISTEN "+userEventsChannel); err != nil {
+			return fmt.Errorf("can't listen %s %w", userEventsChannel, err)
+		}
+		for {
+			notification, err := pgxConn.WaitForNotification(ctx)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("can't wait notification %w", err)
+			}
+			userID, err := uuid.Parse(notification.Payload)
+			if err != nil {
+				internal.Logf.Errorf("wrong payload of %s notification %s", userEventsChannel, notification.Payload)
+				continue
+			}
+			notify(userID)
+		}
+	})
+}
+
+// addUserEvent takes the next id of the user from user_event_ids. The row of the user stays
+// locked till the end of tx, so the events of one user are committed in the order of their
+// ids and the reader never skips an id which is committed later.
+func addUserEvent(ctx context.Context, tx *sqlx.Tx, eventType internal.EventType, userID uuid.UUID, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("can't marshal user event %s %w", eventType, err)
+	}
+	var id int64
+	err = tx.GetContext(ctx, &id,
+		`INSERT INTO user_event_ids (user_id, last_id) VALUES ($1, 1)
+			ON CONFLICT (user_id) DO UPDATE SET last_id = user_event_ids.last_id + 1 RETURNING last_id`,
+		userID)
+	if err != nil {
+		return fmt.Errorf("can't get id of user event %s %w", eventType, err)
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO user_events (id, create_at, user_id, event_type, payload) VALUES ($1, $2, $3, $4, $5)`,
+		id, time.Now(), userID, eventType, string(data))
+	if err != nil {
+		return fmt.Errorf("can't save user event %s %w", eventType, err)
+	}
+	return nil
+}
+
+// addBalanceEvent writes the balance of the user as it is seen by the transaction.
+func addBalanceEvent(ctx context.Context, tx *sqlx.Tx, userID uuid.UUID) error {
+	var balance internal.Balance
+	err := tx.QueryRowxContext(ctx,
+		`SELECT bill, COALESCE((SELECT SUM(sum) FROM withdrawals WHERE user_id = $1), 0) FROM users WHERE id = $1`,
+		userID).Scan(&balance.Current, &balance.Withdrawn)
+	if err != nil {
+		return fmt.Errorf("can't get balance from db %w", err)
+	}
+	return addUserEvent(ctx, tx, internal.EventBalanceChanged, userID, balance)
+}
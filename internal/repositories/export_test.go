@@ -0,0 +1,13 @@
+package repositories
+
+import "testing"
+
+// NewTestStore returns the store of the test database without any data.
+func NewTestStore(t *testing.T) Store {
+	db, err := container.InitData()
+	if err != nil {
+		t.Skipf("err init data %v", err)
+	}
+	db.MustExec(`TRUNCATE users, orders, withdrawals, outbox, webhooks, user_events, user_event_ids, rate_limits, referral_credits, campaigns RESTART IDENTITY CASCADE`)
+	return NewStore(db)
+}
@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/google/uuid"
+	"sort"
+	"time"
+)
+
+func (store *Store) AddCampaign(ctx context.Context, campaign *internal.Campaign) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if !campaign.StartsAt.Before(campaign.EndsAt) {
+		return fmt.Errorf("can't save campaign, it ends before start")
+	}
+	if store.findCampaign(campaign.ID) != nil {
+		return fmt.Errorf("can't save campaign, id %s is exist", campaign.ID)
+	}
+	saved := *campaign
+	store.campaigns = append(store.campaigns, &saved)
+	return nil
+}
+
+func (store *Store) GetCampaigns(ctx context.Context) (*[]internal.Campaign, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.selectCampaigns(func(campaign *internal.Campaign) bool { return true }), nil
+}
+
+func (store *Store) GetCampaign(ctx context.Context, id uuid.UUID) (*internal.Campaign, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	campaign := store.findCampaign(id)
+	if campaign == nil {
+		return nil, errors2.ErrCampaignNotFound
+	}
+	found := *campaign
+	return &found, nil
+}
+
+// DeleteCampaign deletes the campaign, the orders keep the bonuses credited by it.
+func (store *Store) DeleteCampaign(ctx context.Context, id uuid.UUID) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.findCampaign(id) == nil {
+		return errors2.ErrCampaignNotFound
+	}
+	campaigns := store.campaigns[:0]
+	for _, campaign := range store.campaigns {
+		if campaign.ID != id {
+			campaigns = append(campaigns, campaign)
+		}
+	}
+	store.campaigns = campaigns
+	for _, order := range store.orders {
+		if order.CampaignID != nil && *order.CampaignID == id {
+			order.CampaignID = nil
+		}
+	}
+	return nil
+}
+
+// GetActiveCampaigns returns the campaigns whose period includes at.
+func (store *Store) GetActiveCampaigns(ctx context.Context, at time.Time) (*[]internal.Campaign, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.activeCampaigns(at), nil
+}
+
+func (store *Store) activeCampaigns(at time.Time) *[]internal.Campaign {
+	return store.selectCampaigns(func(campaign *internal.Campaign) bool {
+		return !campaign.StartsAt.After(at) && campaign.EndsAt.After(at)
+	})
+}
+
+// applyCampaign returns the order with the bonus of the campaign decided by rules, the campaigns
+// are active at the upload of the order.
+func (store *Store) applyCampaign(current *internal.Order, order *internal.Order, rules repositories.CampaignRules) *internal.Order {
+	processed := *current
+	processed.Status = order.Status
+	processed.Accrual = order.Accrual
+	user := *store.users[current.UserID]
+	campaign, bonus := rules(&processed, &user, *store.activeCampaigns(current.CreateAt))
+	if campaign == nil || bonus <= 0 {
+		return order
+	}
+	applied := *order
+	applied.Accrual += bonus
+	applied.CampaignBonus = bonus
+	applied.CampaignID = &campaign.ID
+	return &applied
+}
+
+func (store *Store) findCampaign(id uuid.UUID) *internal.Campaign {
+	for _, campaign := range store.campaigns {
+		if campaign.ID == id {
+			return campaign
+		}
+	}
+	return nil
+}
+
+func (store *Store) selectCampaigns(match func(campaign *internal.Campaign) bool) *[]internal.Campaign {
+	campaigns := make([]internal.Campaign, 0)
+	for _, campaign := range store.campaigns {
+		if match(campaign) {
+			campaigns = append(campaigns, *campaign)
+		}
+	}
+	sort.SliceStable(campaigns, func(i, j int) bool {
+		if !campaigns[i].StartsAt.Equal(campaigns[j].StartsAt) {
+			return campaigns[i].StartsAt.Before(campaigns[j].StartsAt)
+		}
+		return campaigns[i].CreateAt.Before(campaigns[j].CreateAt)
+	})
+	return &campaigns
+}
@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/google/uuid"
+	"time"
+)
+
+func (store *Store) GetUserEvents(ctx context.Context, userID uuid.UUID, afterID int64, limit int) (*[]internal.UserEvent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	events := make([]internal.UserEvent, 0)
+	for _, event := range store.userEvents {
+		if len(events) >= limit {
+			break
+		}
+		if event.UserID == userID && event.ID > afterID {
+			events = append(events, event)
+		}
+	}
+	return &events, nil
+}
+
+func (store *Store) GetLastUserEventID(ctx context.Context, userID uuid.UUID) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.eventIDs[userID], nil
+}
+
+func (store *Store) DeleteUserEvents(ctx context.Context, before time.Time) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	kept := make([]internal.UserEvent, 0, len(store.userEvents))
+	for _, event := range store.userEvents {
+		if !event.CreateAt.Before(before) {
+			kept = append(kept, event)
+		}
+	}
+	deleted := int64(len(store.userEvents) - len(kept))
+	store.userEvents = kept
+	return deleted, nil
+}
+
+// ListenUserEvents calls notify with the user of every written event until ctx is done.
+func (store *Store) ListenUserEvents(ctx context.Context, notify func(userID uuid.UUID)) error {
+	store.mu.Lock()
+	store.listenerID++
+	id := store.listenerID
+	store.listeners[id] = notify
+	store.mu.Unlock()
+
+	<-ctx.Done()
+	store.mu.Lock()
+	delete(store.listeners, id)
+	store.mu.Unlock()
+	return nil
+}
+
+// addUserEvent appends the event with the next id of the user to the log, the listeners
+// are notified asynchronously since they read the log under the lock held by the caller.
+func (store *Store) addUserEvent(eventType internal.EventType, userID uuid.UUID, payload any) {
+	data, _ := json.Marshal(payload)
+	store.eventIDs[userID]++
+	store.userEvents = append(store.userEvents, internal.UserEvent{
+		ID:       store.eventIDs[userID],
+		CreateAt: time.Now(),
+		UserID:   userID,
+		Type:     eventType,
+		Payload:  data,
+	})
+	for _, notify := range store.listeners {
+		go notify(userID)
+	}
+}
+
+// addBalanceEvent writes the current balance of the user.
+func (store *Store) addBalanceEvent(userID uuid.UUID) {
+	balance := internal.Balance{Current: store.users[userID].Bill}
+	for _, withdrawal := range store.withdrawals {
+		if withdrawal.UserID == userID {
+			balance.Withdrawn += withdrawal.Sum
+		}
+	}
+	store.addUserEvent(internal.EventBalanceChanged, userID, balance)
+}
@@ -0,0 +1,48 @@
+package memory
+
+import (
+	"context"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"math"
+	"time"
+)
+
+type rateBucket struct {
+	tokens   float64
+	updateAt time.Time
+}
+
+// TakeRateToken refills the bucket of key and takes a token from it if there is one.
+func (store *Store) TakeRateToken(ctx context.Context, key string, limit internal.RateLimit) (*internal.RateBucket, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	now := time.Now()
+	bucket, ok := store.rateBuckets[key]
+	if !ok {
+		store.rateBuckets[key] = &rateBucket{tokens: float64(limit.Limit) - 1, updateAt: now}
+		return &internal.RateBucket{Tokens: float64(limit.Limit) - 1, Allowed: true}, nil
+	}
+	elapsed := math.Max(now.Sub(bucket.updateAt).Seconds(), 0)
+	tokens := math.Min(float64(limit.Limit), bucket.tokens+elapsed*limit.Rate())
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+	bucket.tokens = tokens
+	bucket.updateAt = now
+	return &internal.RateBucket{Tokens: tokens, Allowed: allowed}, nil
+}
+
+// DeleteRateBuckets deletes the buckets untouched for idle, they are full already.
+func (store *Store) DeleteRateBuckets(ctx context.Context, idle time.Duration) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var deleted int64
+	for key, bucket := range store.rateBuckets {
+		if bucket.updateAt.Before(time.Now().Add(-idle)) {
+			delete(store.rateBuckets, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/google/uuid"
+	"sort"
+)
+
+func (store *Store) FindUserByReferralCode(ctx context.Context, code string) (*internal.User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	id, ok := store.codes[code]
+	if !ok {
+		return nil, errors2.ErrUserNotFound
+	}
+	user := *store.users[id]
+	return &user, nil
+}
+
+// referral returns the referral of the referee to check with the order, nil if there is nothing to credit.
+func (store *Store) referral(refereeID uuid.UUID, order *internal.Order) *internal.Referral {
+	referee := store.users[refereeID]
+	if referee.ReferredBy == nil {
+		return nil
+	}
+	referrer, ok := store.users[*referee.ReferredBy]
+	if !ok || referrer.ID == referee.ID {
+		return nil
+	}
+	for _, credit := range store.credits {
+		if credit.RefereeID == referee.ID {
+			return nil
+		}
+	}
+	referral := &internal.Referral{Referrer: *referrer, Referee: *referee, Order: *order}
+	for _, credit := range store.credits {
+		if credit.UserID == referrer.ID && credit.Role == internal.ReferralRoleReferrer {
+			referral.ReferrerCredits = append(referral.ReferrerCredits, *credit)
+		}
+	}
+	return referral
+}
+
+// creditReferral adds the bonuses decided by the rules to the bills of the users.
+func (store *Store) creditReferral(decided *[]internal.ReferralCredit) {
+	for _, credit := range *decided {
+		saved := credit
+		store.credits = append(store.credits, &saved)
+		user := store.users[credit.UserID]
+		user.Bill += credit.Sum
+		user.Version++
+		payload := internal.ReferralEventDto{Role: string(credit.Role), Order: credit.Order, Sum: credit.Sum}
+		store.addOutboxEvent(internal.EventReferralCredited, user.ID, payload)
+		store.addBalanceEvent(user.ID)
+		internal.Logf.Infof("referral bonus %v is credited to %s %s for order %s",
+			credit.Sum, credit.Role, credit.UserID, credit.Order)
+	}
+}
+
+func (store *Store) GetReferralCredits(ctx context.Context, userID uuid.UUID) (*[]internal.ReferralCredit, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	credits := make([]internal.ReferralCredit, 0)
+	for _, credit := range store.credits {
+		if credit.UserID == userID {
+			credits = append(credits, *credit)
+		}
+	}
+	sort.SliceStable(credits, func(i, j int) bool { return credits[i].CreateAt.After(credits[j].CreateAt) })
+	return &credits, nil
+}
+
+func (store *Store) CountReferees(ctx context.Context, referrerID uuid.UUID) (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var count int
+	for _, user := range store.users {
+		if user.ReferredBy != nil && *user.ReferredBy == referrerID {
+			count++
+		}
+	}
+	return count, nil
+}
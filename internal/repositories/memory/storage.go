@@ -0,0 +1,534 @@
+// Package memory is the store which keeps the data in memory of the process. It has the
+// semantics of the Postgres store and is used by tests and for local development.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/google/uuid"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store guards all data with one mutex, so every method is applied atomically
+// like the transaction of the Postgres store.
+type Store struct {
+	mu          sync.Mutex
+	users       map[uuid.UUID]*internal.User
+	logins      map[string]uuid.UUID
+	codes       map[string]uuid.UUID
+	orders      []*internal.Order
+	numbers     map[string]*internal.Order
+	history     []internal.OrderStatusChange
+	withdrawals []*internal.Withdraw
+	credits     []*internal.ReferralCredit
+	campaigns   []*internal.Campaign
+	outbox      []*internal.OutboxEvent
+	attempts    []internal.OutboxAttempt
+	webhooks    []*internal.Webhook
+	deliveries  []*internal.WebhookDelivery
+	userEvents  []internal.UserEvent
+	eventIDs    map[uuid.UUID]int64
+	listeners   map[int]func(userID uuid.UUID)
+	listenerID  int
+	rateBuckets map[string]*rateBucket
+}
+
+func NewStore() repositories.Store {
+	return &Store{
+		users:       make(map[uuid.UUID]*internal.User),
+		logins:      make(map[string]uuid.UUID),
+		codes:       make(map[string]uuid.UUID),
+		numbers:     make(map[string]*internal.Order),
+		eventIDs:    make(map[uuid.UUID]int64),
+		listeners:   make(map[int]func(userID uuid.UUID)),
+		rateBuckets: make(map[string]*rateBucket),
+	}
+}
+
+func (store *Store) CheckConnection() error {
+	return nil
+}
+
+func (store *Store) AddUser(ctx context.Context, user *internal.User) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.logins[user.Login]; ok {
+		return errors2.ErrUserIsExist
+	}
+	if _, ok := store.users[user.ID]; ok {
+		return fmt.Errorf("can't save user, id %s is exist", user.ID)
+	}
+	if _, ok := store.codes[user.ReferralCode]; ok {
+		return fmt.Errorf("can't save user, referral code %s is exist", user.ReferralCode)
+	}
+	saved := *user
+	if saved.Tier == "" {
+		saved.Tier = internal.TierBronze
+	}
+	store.users[user.ID] = &saved
+	store.logins[user.Login] = user.ID
+	store.codes[user.ReferralCode] = user.ID
+	return nil
+}
+
+func (store *Store) FindUserByLogin(ctx context.Context, login string) (*internal.User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	id, ok := store.logins[login]
+	if !ok {
+		return nil, errors2.ErrUserNotFound
+	}
+	user := *store.users[id]
+	return &user, nil
+}
+
+func (store *Store) GetUser(ctx context.Context, id uuid.UUID) (*internal.User, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	user, ok := store.users[id]
+	if !ok {
+		return nil, fmt.Errorf("can't get user %w", errors2.ErrUserNotFound)
+	}
+	found := *user
+	return &found, nil
+}
+
+func (store *Store) GetUserVersion(ctx context.Context, id uuid.UUID) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	user, ok := store.users[id]
+	if !ok {
+		return 0, errors2.ErrUserNotFound
+	}
+	return user.Version, nil
+}
+
+func (store *Store) AddOrder(ctx context.Context, order *internal.Order) (*internal.Order, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	user, ok := store.users[order.UserID]
+	if !ok {
+		return nil, fmt.Errorf("can't add order %w", errors2.ErrUserNotFound)
+	}
+	if exist, ok := store.numbers[order.Number]; ok {
+		if exist.UserID == order.UserID {
+			return nil, errors2.ErrOrderIsExistThisUser
+		}
+		return nil, errors2.ErrOrderIsExistAnotherUser
+	}
+	store.insertOrder(order)
+	user.Version++
+	return order, nil
+}
+
+// AddOrders saves the orders of the batch together, the batch with an order of the
+// unknown user isn't saved at all.
+func (store *Store) AddOrders(ctx context.Context, orders *[]internal.Order) (*[]internal.Order, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for i := range *orders {
+		if _, ok := store.users[(*orders)[i].UserID]; !ok {
+			return nil, fmt.Errorf("can't add order %w", errors2.ErrUserNotFound)
+		}
+	}
+	existOrders := make([]internal.Order, 0)
+	var added bool
+	for i := range *orders {
+		if exist, ok := store.numbers[(*orders)[i].Number]; ok {
+			existOrders = append(existOrders, *exist)
+			continue
+		}
+		store.insertOrder(&(*orders)[i])
+		added = true
+	}
+	if added {
+		store.users[(*orders)[0].UserID].Version++
+	}
+	return &existOrders, nil
+}
+
+// insertOrder saves the copy of the order with the first entry of its history,
+// the state of the accrual isn't taken from it.
+func (store *Store) insertOrder(order *internal.Order) {
+	saved := *order
+	saved.UpdateSource = ""
+	saved.UpdateAt = nil
+	saved.CreditedAt = nil
+	saved.PollCount = 0
+	saved.CheckedAt = nil
+	saved.NextCheckAt = nil
+	store.orders = append(store.orders, &saved)
+	store.numbers[saved.Number] = &saved
+	store.addStatusChange(saved.ID, saved.CreateAt, "", saved.Status, internal.UpdateSourceUpload)
+}
+
+func (store *Store) SaveOrderCheck(ctx context.Context, number string, checkedAt time.Time, nextCheckAt time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	order, ok := store.numbers[number]
+	if !ok {
+		return nil
+	}
+	order.PollCount++
+	order.CheckedAt = &checkedAt
+	order.NextCheckAt = &nextCheckAt
+	return nil
+}
+
+func (store *Store) addStatusChange(orderID uuid.UUID, at time.Time,
+	from internal.OrderStatus, to internal.OrderStatus, source internal.UpdateSource) {
+	store.history = append(store.history, internal.OrderStatusChange{
+		ID:         int64(len(store.history) + 1),
+		OrderID:    orderID,
+		CreateAt:   at,
+		FromStatus: from,
+		Status:     to,
+		Source:     source,
+	})
+}
+
+func (store *Store) GetOrder(ctx context.Context, number string) (*internal.Order, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	order, ok := store.numbers[number]
+	if !ok {
+		return nil, errors2.ErrOrderNotFound
+	}
+	found := *order
+	return &found, nil
+}
+
+func (store *Store) GetOrderHistory(ctx context.Context, orderID uuid.UUID) (*[]internal.OrderStatusChange, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	history := make([]internal.OrderStatusChange, 0)
+	for _, change := range store.history {
+		if change.OrderID == orderID {
+			history = append(history, change)
+		}
+	}
+	return &history, nil
+}
+
+func (store *Store) GetOrders(ctx context.Context, userID uuid.UUID) (*[]internal.Order, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	orders := make([]internal.Order, 0)
+	for _, order := range store.orders {
+		if order.UserID == userID {
+			orders = append(orders, *order)
+		}
+	}
+	sort.SliceStable(orders, func(i, j int) bool { return orders[i].CreateAt.After(orders[j].CreateAt) })
+	return &orders, nil
+}
+
+func (store *Store) GetOrdersNotProcessed(ctx context.Context) (*[]internal.Order, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	orders := make([]internal.Order, 0)
+	for _, order := range store.orders {
+		if !order.Status.IsFinal() {
+			orders = append(orders, *order)
+		}
+	}
+	return &orders, nil
+}
+
+var orderEventTypes = map[internal.OrderStatus]internal.EventType{
+	internal.OrderStatusProcessed: internal.EventOrderProcessed,
+	internal.OrderStatusInvalid:   internal.EventOrderInvalid,
+}
+
+// UpdateOrder changes the state of the order only while it isn't final and only by the
+// allowed transitions of its status, so a repeated PROCESSED state doesn't credit the bill
+// of the user twice. The credited order is marked with CreditedAt, the transition is
+// written to the history of the order. The state which isn't changed isn't saved, so the
+// version of the user stays the same. The referral of the user is credited by referral
+// with the order, the bonus of the campaign is added by campaign, nil applies nothing.
+func (store *Store) UpdateOrder(ctx context.Context, order *internal.Order, referral repositories.ReferralRules,
+	campaign repositories.CampaignRules) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	current, ok := store.numbers[order.Number]
+	if !ok || current.Status.IsFinal() {
+		internal.Logf.Debugf("order %s isn't found or has final status", order.Number)
+		return nil
+	}
+	if current.Status == order.Status && current.Accrual == order.Accrual {
+		internal.Logf.Debugf("order %s isn't changed", order.Number)
+		return nil
+	}
+	if current.Status != order.Status && !current.Status.CanMoveTo(order.Status) {
+		internal.Logf.Debugf("order %s can't move from %s to %s", order.Number, current.Status, order.Status)
+		return nil
+	}
+	if order.Status == internal.OrderStatusProcessed && campaign != nil {
+		order = store.applyCampaign(current, order, campaign)
+	}
+	if order.CampaignID != nil && store.findCampaign(*order.CampaignID) == nil {
+		return fmt.Errorf("can't update order %s %w", order.Number, errors2.ErrCampaignNotFound)
+	}
+	user := store.users[current.UserID]
+	previous := current.Status
+	now := time.Now()
+	credits := &[]internal.ReferralCredit{}
+	if order.Status == internal.OrderStatusProcessed && current.CreditedAt == nil && referral != nil {
+		credited := *current
+		credited.Status = order.Status
+		credited.Accrual = order.Accrual
+		credited.CreditedAt = &now
+		if decided := store.referral(user.ID, &credited); decided != nil {
+			var err error
+			credits, err = referral(decided)
+			if errors.Is(err, errors2.ErrReferralRefused) {
+				internal.Logf.Infof("referral of user %s is refused: %v", user.ID, err)
+				credits = &[]internal.ReferralCredit{}
+			} else if err != nil {
+				return fmt.Errorf("can't credit referral of order %s %w", order.Number, err)
+			}
+		}
+	}
+	current.Status = order.Status
+	current.Accrual = order.Accrual
+	current.CampaignBonus = order.CampaignBonus
+	current.CampaignID = nil
+	if order.CampaignID != nil {
+		campaignID := *order.CampaignID
+		current.CampaignID = &campaignID
+	}
+	current.UpdateSource = order.UpdateSource
+	current.UpdateAt = &now
+	user.Version++
+
+	payload := internal.OrderEventDto{
+		Order:   order.Number,
+		Status:  string(order.Status),
+		Accrual: order.Accrual,
+	}
+	if previous != order.Status {
+		store.addStatusChange(current.ID, now, previous, order.Status, order.UpdateSource)
+		store.addUserEvent(internal.EventOrderStatus, user.ID, payload)
+	}
+	if order.Status == internal.OrderStatusProcessed && current.CreditedAt == nil {
+		current.CreditedAt = &now
+		user.Bill += order.Accrual
+		store.addBalanceEvent(user.ID)
+		store.creditReferral(credits)
+	}
+	if eventType, ok := orderEventTypes[order.Status]; ok {
+		store.addOutboxEvent(eventType, user.ID, payload)
+	}
+	return nil
+}
+
+// SaveWithdrawal withdraws the sum from the bill of the user, the bill and rules are checked
+// under the lock of the store, nil checks nothing.
+func (store *Store) SaveWithdrawal(ctx context.Context, withdrawal *internal.Withdraw, rules repositories.WithdrawalRules) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	user, ok := store.users[withdrawal.UserID]
+	if !ok {
+		return fmt.Errorf("can't get user %w", errors2.ErrUserNotFound)
+	}
+	if user.Bill < withdrawal.Sum {
+		return errors2.ErrNotEnoughAmount
+	}
+	if rules != nil {
+		locked := *user
+		err := rules(&locked, func(since time.Time) (float32, error) {
+			var withdrawn float32
+			for _, exist := range store.withdrawals {
+				if exist.UserID == user.ID && exist.CreateAt.After(since) {
+					withdrawn += exist.Sum
+				}
+			}
+			return withdrawn, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, exist := range store.withdrawals {
+		if exist.Order == withdrawal.Order {
+			return fmt.Errorf("can't save withdrawal, order %s is exist", withdrawal.Order)
+		}
+	}
+	saved := *withdrawal
+	store.withdrawals = append(store.withdrawals, &saved)
+	user.Bill -= withdrawal.Sum
+	user.Version++
+	payload := internal.WithdrawalEventDto{Order: withdrawal.Order, Sum: withdrawal.Sum}
+	store.addOutboxEvent(internal.EventWithdrawal, user.ID, payload)
+	store.addBalanceEvent(user.ID)
+	return nil
+}
+
+func (store *Store) GetWithdrawals(ctx context.Context, userID uuid.UUID) (*[]internal.Withdraw, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	withdrawals := make([]internal.Withdraw, 0)
+	for _, withdrawal := range store.withdrawals {
+		if withdrawal.UserID == userID {
+			withdrawals = append(withdrawals, *withdrawal)
+		}
+	}
+	sort.SliceStable(withdrawals, func(i, j int) bool {
+		return withdrawals[i].CreateAt.After(withdrawals[j].CreateAt)
+	})
+	return &withdrawals, nil
+}
+
+func (store *Store) GetOrderWithdrawals(ctx context.Context, userID uuid.UUID, number string) (*[]internal.Withdraw, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	withdrawals := make([]internal.Withdraw, 0)
+	for _, withdrawal := range store.withdrawals {
+		if withdrawal.UserID == userID && withdrawal.Order == number {
+			withdrawals = append(withdrawals, *withdrawal)
+		}
+	}
+	sort.SliceStable(withdrawals, func(i, j int) bool {
+		return withdrawals[i].CreateAt.Before(withdrawals[j].CreateAt)
+	})
+	return &withdrawals, nil
+}
+
+// GetStatement calls fn for every accrual, referral bonus and withdrawal of the user in
+// [from, to) in chronological order, the running balance is counted from the first operation of the user.
+// The entries are collected first, so fn is called without the lock.
+func (store *Store) GetStatement(ctx context.Context, userID uuid.UUID, from time.Time, to time.Time,
+	fn func(entry *internal.StatementEntry) error) error {
+	store.mu.Lock()
+	operations := make([]internal.StatementEntry, 0)
+	for _, order := range store.orders {
+		if order.UserID != userID || order.Status != internal.OrderStatusProcessed {
+			continue
+		}
+		at := order.CreateAt
+		if order.UpdateAt != nil {
+			at = *order.UpdateAt
+		}
+		operations = append(operations, internal.StatementEntry{
+			Date: at, Operation: internal.StatementAccrual, Order: order.Number, Amount: order.Accrual,
+		})
+	}
+	for _, withdrawal := range store.withdrawals {
+		if withdrawal.UserID != userID {
+			continue
+		}
+		operations = append(operations, internal.StatementEntry{
+			Date: withdrawal.CreateAt, Operation: internal.StatementWithdrawal, Order: withdrawal.Order, Amount: -withdrawal.Sum,
+		})
+	}
+	for _, credit := range store.credits {
+		if credit.UserID != userID {
+			continue
+		}
+		operations = append(operations, internal.StatementEntry{
+			Date: credit.CreateAt, Operation: internal.StatementReferral, Order: credit.Order, Amount: credit.Sum,
+		})
+	}
+	store.mu.Unlock()
+
+	sort.Slice(operations, func(i, j int) bool {
+		a, b := operations[i], operations[j]
+		if !a.Date.Equal(b.Date) {
+			return a.Date.Before(b.Date)
+		}
+		if a.Operation != b.Operation {
+			return a.Operation < b.Operation
+		}
+		return a.Order < b.Order
+	})
+	var balance float32
+	for i := range operations {
+		balance += operations[i].Amount
+		operations[i].Balance = balance
+		if operations[i].Date.Before(from) || !operations[i].Date.Before(to) {
+			continue
+		}
+		if err := fn(&operations[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *Store) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) (*[]internal.OutboxEvent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	now := time.Now()
+	due := make([]*internal.OutboxEvent, 0)
+	for _, event := range store.outbox {
+		if event.Status == internal.OutboxStatusPending && !event.NextAttemptAt.After(now) {
+			due = append(due, event)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	events := make([]internal.OutboxEvent, 0)
+	for i := 0; i < len(due) && i < limit; i++ {
+		due[i].NextAttemptAt = now.Add(lease)
+		events = append(events, *due[i])
+	}
+	return &events, nil
+}
+
+func (store *Store) SaveOutboxDelivery(ctx context.Context, event *internal.OutboxEvent, attempts *[]internal.OutboxAttempt) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var current *internal.OutboxEvent
+	for _, exist := range store.outbox {
+		if exist.ID == event.ID {
+			current = exist
+			break
+		}
+	}
+	if current == nil {
+		if len(*attempts) > 0 {
+			return fmt.Errorf("can't save outbox attempt, event %s isn't found", event.ID)
+		}
+		return nil
+	}
+	current.Status = event.Status
+	current.Attempts = event.Attempts
+	current.NextAttemptAt = event.NextAttemptAt
+	current.LastError = event.LastError
+	current.DeliveredAt = event.DeliveredAt
+	store.attempts = append(store.attempts, *attempts...)
+	return nil
+}
+
+func (store *Store) GetDeadLetters(ctx context.Context) (*[]internal.OutboxEvent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	events := make([]internal.OutboxEvent, 0)
+	for _, event := range store.outbox {
+		if event.Status == internal.OutboxStatusDead {
+			events = append(events, *event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].CreateAt.Before(events[j].CreateAt) })
+	return &events, nil
+}
+
+func (store *Store) addOutboxEvent(eventType internal.EventType, userID uuid.UUID, payload any) {
+	data, _ := json.Marshal(payload)
+	now := time.Now()
+	store.outbox = append(store.outbox, &internal.OutboxEvent{
+		ID:            uuid.New(),
+		CreateAt:      now,
+		Type:          eventType,
+		UserID:        userID,
+		Payload:       data,
+		Status:        internal.OutboxStatusPending,
+		NextAttemptAt: now,
+	})
+}
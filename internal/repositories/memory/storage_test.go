@@ -0,0 +1,24 @@
+package memory
+
+import (
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories/storetest"
+	"log"
+	"os"
+	"testing"
+)
+
+func init() {
+	err := internal.InitLogger("info")
+	if err != nil {
+		log.Printf("err Init logger %v", err)
+		os.Exit(1)
+	}
+}
+
+func TestStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) repositories.Store {
+		return NewStore()
+	})
+}
@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"context"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"sort"
+	"time"
+)
+
+func (store *Store) GetTierAccruals(ctx context.Context, since time.Time) (*[]internal.TierAccrual, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	accruals := make([]internal.TierAccrual, 0, len(store.users))
+	for _, user := range store.users {
+		accrual := internal.TierAccrual{UserID: user.ID, Tier: user.Tier, TierAccrual: user.TierAccrual}
+		for _, order := range store.orders {
+			if order.UserID == user.ID && order.Status == internal.OrderStatusProcessed &&
+				order.CreditedAt != nil && !order.CreditedAt.Before(since) {
+				accrual.Accrual += order.Accrual
+			}
+		}
+		accruals = append(accruals, accrual)
+	}
+	sort.Slice(accruals, func(i, j int) bool { return accruals[i].UserID.String() < accruals[j].UserID.String() })
+	return &accruals, nil
+}
+
+// UpdateTier saves the tier of the user only while the user has the tier From.
+func (store *Store) UpdateTier(ctx context.Context, change *internal.TierChange) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	user, ok := store.users[change.UserID]
+	if !ok || user.Tier != change.From {
+		return nil
+	}
+	updatedAt := change.CreateAt
+	user.Tier = change.To
+	user.TierAccrual = change.Accrual
+	user.TierUpdatedAt = &updatedAt
+	if change.From != change.To {
+		payload := internal.TierEventDto{From: string(change.From), To: string(change.To), Accrual: change.Accrual}
+		store.addOutboxEvent(internal.EventTierChanged, user.ID, payload)
+	}
+	return nil
+}
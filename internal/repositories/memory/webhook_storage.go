@@ -0,0 +1,231 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/google/uuid"
+	"sort"
+	"strings"
+	"time"
+)
+
+func (store *Store) AddWebhook(ctx context.Context, webhook *internal.Webhook, limit int) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if _, ok := store.users[webhook.UserID]; !ok {
+		return fmt.Errorf("can't save webhook %w", errors2.ErrUserNotFound)
+	}
+	count := 0
+	for _, w := range store.webhooks {
+		if w.UserID == webhook.UserID {
+			count++
+		}
+	}
+	if count >= limit {
+		return errors2.ErrWebhookLimit
+	}
+	saved := *webhook
+	store.webhooks = append(store.webhooks, &saved)
+	return nil
+}
+
+func (store *Store) GetWebhooks(ctx context.Context, userID uuid.UUID) (*[]internal.Webhook, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	webhooks := make([]internal.Webhook, 0)
+	for _, webhook := range store.webhooks {
+		if webhook.UserID == userID {
+			webhooks = append(webhooks, *webhook)
+		}
+	}
+	sort.SliceStable(webhooks, func(i, j int) bool { return webhooks[i].CreateAt.Before(webhooks[j].CreateAt) })
+	return &webhooks, nil
+}
+
+func (store *Store) GetWebhook(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*internal.Webhook, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	webhook := store.findWebhook(userID, id)
+	if webhook == nil {
+		return nil, errors2.ErrWebhookNotFound
+	}
+	found := *webhook
+	return &found, nil
+}
+
+func (store *Store) UpdateWebhook(ctx context.Context, webhook *internal.Webhook) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	current := store.findWebhook(webhook.UserID, webhook.ID)
+	if current == nil {
+		return errors2.ErrWebhookNotFound
+	}
+	current.URL = webhook.URL
+	current.EventTypes = webhook.EventTypes
+	current.Active = webhook.Active
+	return nil
+}
+
+// DeleteWebhook deletes the webhook together with its deliveries.
+func (store *Store) DeleteWebhook(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.findWebhook(userID, id) == nil {
+		return errors2.ErrWebhookNotFound
+	}
+	webhooks := store.webhooks[:0]
+	for _, webhook := range store.webhooks {
+		if webhook.ID != id {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	store.webhooks = webhooks
+	deliveries := store.deliveries[:0]
+	for _, delivery := range store.deliveries {
+		if delivery.WebhookID != id {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	store.deliveries = deliveries
+	return nil
+}
+
+func (store *Store) findWebhook(userID uuid.UUID, id uuid.UUID) *internal.Webhook {
+	for _, webhook := range store.webhooks {
+		if webhook.ID == id && webhook.UserID == userID {
+			return webhook
+		}
+	}
+	return nil
+}
+
+func (store *Store) findDelivery(webhookID uuid.UUID, eventID uuid.UUID) *internal.WebhookDelivery {
+	for _, delivery := range store.deliveries {
+		if delivery.WebhookID == webhookID && delivery.EventID == eventID {
+			return delivery
+		}
+	}
+	return nil
+}
+
+// AddWebhookDeliveries enqueues the event for every active webhook of the user subscribed to it,
+// the event which is already enqueued is skipped.
+func (store *Store) AddWebhookDeliveries(ctx context.Context, event *internal.OutboxEvent) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	now := time.Now()
+	for _, webhook := range store.webhooks {
+		if webhook.UserID != event.UserID || !webhook.Active || store.findDelivery(webhook.ID, event.ID) != nil {
+			continue
+		}
+		for _, eventType := range strings.Split(webhook.EventTypes, ",") {
+			if eventType != string(event.Type) {
+				continue
+			}
+			store.deliveries = append(store.deliveries, &internal.WebhookDelivery{
+				ID:            uuid.New(),
+				CreateAt:      now,
+				WebhookID:     webhook.ID,
+				EventID:       event.ID,
+				EventType:     event.Type,
+				Payload:       event.Payload,
+				Status:        internal.OutboxStatusPending,
+				NextAttemptAt: now,
+			})
+			break
+		}
+	}
+	return nil
+}
+
+func (store *Store) AddWebhookDelivery(ctx context.Context, delivery *internal.WebhookDelivery) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	var found bool
+	for _, webhook := range store.webhooks {
+		found = found || webhook.ID == delivery.WebhookID
+	}
+	if !found {
+		return fmt.Errorf("can't save webhook delivery %w", errors2.ErrWebhookNotFound)
+	}
+	if store.findDelivery(delivery.WebhookID, delivery.EventID) != nil {
+		return fmt.Errorf("can't save webhook delivery, event %s is enqueued already", delivery.EventID)
+	}
+	store.deliveries = append(store.deliveries, &internal.WebhookDelivery{
+		ID:            delivery.ID,
+		CreateAt:      delivery.CreateAt,
+		WebhookID:     delivery.WebhookID,
+		EventID:       delivery.EventID,
+		EventType:     delivery.EventType,
+		Payload:       delivery.Payload,
+		Status:        internal.OutboxStatusPending,
+		NextAttemptAt: delivery.NextAttemptAt,
+	})
+	return nil
+}
+
+// ClaimWebhookDeliveries returns pending deliveries which are due together with URL and secret
+// of their webhooks and hides them from other dispatchers for lease.
+func (store *Store) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) (*[]internal.WebhookDelivery, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	now := time.Now()
+	due := make([]*internal.WebhookDelivery, 0)
+	for _, delivery := range store.deliveries {
+		if delivery.Status == internal.OutboxStatusPending && !delivery.NextAttemptAt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	deliveries := make([]internal.WebhookDelivery, 0)
+	for i := 0; i < len(due) && i < limit; i++ {
+		due[i].NextAttemptAt = now.Add(lease)
+		claimed := *due[i]
+		for _, webhook := range store.webhooks {
+			if webhook.ID == claimed.WebhookID {
+				claimed.URL = webhook.URL
+				claimed.Secret = webhook.Secret
+			}
+		}
+		deliveries = append(deliveries, claimed)
+	}
+	return &deliveries, nil
+}
+
+func (store *Store) SaveWebhookDelivery(ctx context.Context, delivery *internal.WebhookDelivery) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for _, current := range store.deliveries {
+		if current.ID != delivery.ID {
+			continue
+		}
+		current.Status = delivery.Status
+		current.Attempts = delivery.Attempts
+		current.NextAttemptAt = delivery.NextAttemptAt
+		current.LastError = delivery.LastError
+		current.ResponseCode = delivery.ResponseCode
+		current.DeliveredAt = delivery.DeliveredAt
+	}
+	return nil
+}
+
+func (store *Store) GetWebhookDeliveries(ctx context.Context, userID uuid.UUID, webhookID uuid.UUID, limit int) (*[]internal.WebhookDelivery, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	deliveries := make([]internal.WebhookDelivery, 0)
+	if store.findWebhook(userID, webhookID) == nil {
+		return &deliveries, nil
+	}
+	for _, delivery := range store.deliveries {
+		if delivery.WebhookID == webhookID {
+			deliveries = append(deliveries, *delivery)
+		}
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool { return deliveries[i].CreateAt.After(deliveries[j].CreateAt) })
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return &deliveries, nil
+}
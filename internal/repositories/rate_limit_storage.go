@@ -0,0 +1,40 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"time"
+)
+
+// refillRateBucket is the number of tokens in the bucket before the request takes one.
+const refillRateBucket = `LEAST($2::DOUBLE PRECISION,
+	r.tokens + GREATEST(EXTRACT(EPOCH FROM now() - r.update_at), 0) * $3::DOUBLE PRECISION)`
+
+// TakeRateToken refills the bucket of key and takes a token from it if there is one, in one
+// statement so the replicas sharing the bucket don't take the same token.
+func (store *StoreImpl) TakeRateToken(ctx context.Context, key string, limit internal.RateLimit) (*internal.RateBucket, error) {
+	var bucket internal.RateBucket
+	err := store.db.GetContext(ctx, &bucket,
+		`INSERT INTO rate_limits AS r (key, tokens, allowed, update_at) VALUES ($1, $2::DOUBLE PRECISION - 1, TRUE, now())
+			ON CONFLICT (key) DO UPDATE SET
+				tokens = CASE WHEN `+refillRateBucket+` >= 1 THEN `+refillRateBucket+` - 1 ELSE `+refillRateBucket+` END,
+				allowed = `+refillRateBucket+` >= 1,
+				update_at = now()
+			RETURNING tokens, allowed`,
+		key, limit.Limit, limit.Rate())
+	if err != nil {
+		return nil, fmt.Errorf("can't take rate token from db %w", err)
+	}
+	return &bucket, nil
+}
+
+// DeleteRateBuckets deletes the buckets untouched for idle, they are full already.
+func (store *StoreImpl) DeleteRateBuckets(ctx context.Context, idle time.Duration) (int64, error) {
+	result, err := store.db.ExecContext(ctx, `DELETE FROM rate_limits WHERE update_at < now() - make_interval(secs => $1)`,
+		idle.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("can't delete rate buckets from db %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,116 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+func (store *StoreImpl) FindUserByReferralCode(ctx context.Context, code string) (*internal.User, error) {
+	var user internal.User
+	err := store.db.GetContext(ctx, &user, `SELECT * FROM users WHERE referral_code = $1`, code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors2.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't get user from db, %w", err)
+	}
+	return &user, nil
+}
+
+// creditReferral credits the referral of the referee for the order, the refused referral is checked again with the next order.
+func creditReferral(ctx context.Context, tx *sqlx.Tx, refereeID uuid.UUID, orderID uuid.UUID, rules ReferralRules) (*[]internal.ReferralCredit, error) {
+	credits := make([]internal.ReferralCredit, 0)
+	var users []internal.User
+	err := tx.SelectContext(ctx, &users,
+		`SELECT * FROM users WHERE id = $1 OR id = (SELECT referred_by FROM users WHERE id = $1) ORDER BY id FOR UPDATE`,
+		refereeID)
+	if err != nil {
+		return nil, fmt.Errorf("can't get users from db %w", err)
+	}
+	referral := &internal.Referral{}
+	for _, user := range users {
+		if user.ID == refereeID {
+			referral.Referee = user
+		} else {
+			referral.Referrer = user
+		}
+	}
+	if referral.Referee.ReferredBy == nil || referral.Referrer.ID != *referral.Referee.ReferredBy {
+		return &credits, nil
+	}
+
+	var credited bool
+	err = tx.GetContext(ctx, &credited, `SELECT EXISTS (SELECT 1 FROM referral_credits WHERE referee_id = $1)`, refereeID)
+	if err != nil {
+		return nil, fmt.Errorf("can't get referral credits from db %w", err)
+	}
+	if credited {
+		return &credits, nil
+	}
+	err = tx.GetContext(ctx, &referral.Order, `SELECT * FROM orders WHERE id = $1`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("can't get order from db %w", err)
+	}
+	err = tx.SelectContext(ctx, &referral.ReferrerCredits,
+		`SELECT * FROM referral_credits WHERE user_id = $1 AND role = $2 ORDER BY create_at`,
+		referral.Referrer.ID, internal.ReferralRoleReferrer)
+	if err != nil {
+		return nil, fmt.Errorf("can't get referral credits from db %w", err)
+	}
+
+	decided, err := rules(referral)
+	if errors.Is(err, errors2.ErrReferralRefused) {
+		internal.Logf.Infof("referral of user %s is refused: %v", refereeID, err)
+		return &credits, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, credit := range *decided {
+		_, err = tx.NamedExecContext(ctx,
+			`INSERT INTO referral_credits (id, create_at, user_id, referee_id, role, order_num, sum)
+				VALUES (:id, :create_at, :user_id, :referee_id, :role, :order_num, :sum)`,
+			credit)
+		if err != nil {
+			return nil, fmt.Errorf("can't save referral credit to db %w", err)
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE users SET bill = bill + $1, version = version + 1 WHERE id = $2`,
+			credit.Sum, credit.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("can't update user bill at db %w", err)
+		}
+		payload := internal.ReferralEventDto{Role: string(credit.Role), Order: credit.Order, Sum: credit.Sum}
+		if err = addOutboxEvent(ctx, tx, internal.EventReferralCredited, credit.UserID, payload); err != nil {
+			return nil, err
+		}
+		if err = addBalanceEvent(ctx, tx, credit.UserID); err != nil {
+			return nil, err
+		}
+	}
+	return decided, nil
+}
+
+func (store *StoreImpl) GetReferralCredits(ctx context.Context, userID uuid.UUID) (*[]internal.ReferralCredit, error) {
+	var credits []internal.ReferralCredit
+	err := store.db.SelectContext(ctx, &credits,
+		`SELECT * FROM referral_credits WHERE user_id = $1 ORDER BY create_at DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("can't get referral credits from db %w", err)
+	}
+	return &credits, nil
+}
+
+func (store *StoreImpl) CountReferees(ctx context.Context, referrerID uuid.UUID) (int, error) {
+	var count int
+	err := store.db.GetContext(ctx, &count, `SELECT count(*) FROM users WHERE referred_by = $1`, referrerID)
+	if err != nil {
+		return 0, fmt.Errorf("can't count referees from db %w", err)
+	}
+	return count, nil
+}
@@ -3,6 +3,7 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
@@ -39,7 +40,8 @@ func (store *StoreImpl) AddUser(ctx context.Context, user *internal.User) error
 		return errors2.ErrUserIsExist
 	}
 	_, err = store.db.NamedExecContext(ctx,
-		`INSERT INTO users (id, create_at, login, password, bill) VALUES (:id, :create_at, :login, :password, :bill)`,
+		`INSERT INTO users (id, create_at, login, password, bill, referral_code, referred_by)
+			VALUES (:id, :create_at, :login, :password, :bill, :referral_code, :referred_by)`,
 		user)
 	if err != nil {
 		return fmt.Errorf("can't save user to db %w", err)
@@ -59,10 +61,17 @@ func (store *StoreImpl) FindUserByLogin(ctx context.Context, login string) (*int
 	return &user, nil
 }
 
+// AddOrder saves the order with the first entry of its history and bumps the version
+// of the user in one statement.
 func (store *StoreImpl) AddOrder(ctx context.Context, order *internal.Order) (*internal.Order, error) {
 	_, err := store.db.NamedExecContext(ctx,
-		`INSERT INTO orders (id, create_at, number, accrual, status, user_id) 
-			VALUES (:id, :create_at, :number, :accrual, :status, :user_id)`,
+		`WITH inserted AS (
+			INSERT INTO orders (id, create_at, number, accrual, status, user_id)
+				VALUES (:id, :create_at, :number, :accrual, :status, :user_id) RETURNING id, create_at, status, user_id
+		), history AS (
+			INSERT INTO order_status_history (order_id, create_at, status, source)
+				SELECT id, create_at, status, '`+string(internal.UpdateSourceUpload)+`' FROM inserted
+		) UPDATE users SET version = version + 1 WHERE id IN (SELECT user_id FROM inserted)`,
 		order)
 	if err == nil {
 		return order, nil
@@ -90,6 +99,56 @@ func (store *StoreImpl) AddOrder(ctx context.Context, order *internal.Order) (*i
 	return nil, fmt.Errorf("can't add order from db %w", err)
 }
 
+// AddOrders saves the orders in one transaction and returns the orders which already
+// exist with the same number, with the user who uploaded them.
+func (store *StoreImpl) AddOrders(ctx context.Context, orders *[]internal.Order) (*[]internal.Order, error) {
+	tx, err := store.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("can't begin transaction %w", err)
+	}
+	defer tx.Rollback()
+
+	existOrders := make([]internal.Order, 0)
+	var added bool
+	for i := range *orders {
+		result, err := tx.NamedExecContext(ctx,
+			`INSERT INTO orders (id, create_at, number, accrual, status, user_id)
+				VALUES (:id, :create_at, :number, :accrual, :status, :user_id) ON CONFLICT (number) DO NOTHING`,
+			(*orders)[i])
+		if err != nil {
+			return nil, fmt.Errorf("can't add order to db %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("can't add order to db %w", err)
+		}
+		if affected > 0 {
+			order := &(*orders)[i]
+			err = addStatusChange(ctx, tx, order.ID, order.CreateAt, "", order.Status, internal.UpdateSourceUpload)
+			if err != nil {
+				return nil, err
+			}
+			added = true
+			continue
+		}
+		var existOrder internal.Order
+		err = tx.GetContext(ctx, &existOrder, `SELECT * FROM orders WHERE number = $1`, (*orders)[i].Number)
+		if err != nil {
+			return nil, fmt.Errorf("can't get order from db %w", err)
+		}
+		existOrders = append(existOrders, existOrder)
+	}
+	if added {
+		if err = bumpUserVersion(ctx, tx, (*orders)[0].UserID); err != nil {
+			return nil, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("can't commit transaction %w", err)
+	}
+	return &existOrders, nil
+}
+
 func (store *StoreImpl) GetOrders(ctx context.Context, userID uuid.UUID) (*[]internal.Order, error) {
 	var orders []internal.Order
 	err := store.db.SelectContext(ctx, &orders,
@@ -112,58 +171,226 @@ func (store *StoreImpl) GetOrdersNotProcessed(ctx context.Context) (*[]internal.
 	return &orders, nil
 }
 
-func (store *StoreImpl) UpdateOrder(ctx context.Context, order *internal.Order) error {
-	tx := store.db.MustBeginTx(ctx, nil)
-	defer tx.Commit()
-	if order.Status == internal.OrderStatusProcessed {
-		var user internal.User
-		err := tx.GetContext(ctx, &user,
-			`SELECT u.id, u.bill FROM users AS u INNER JOIN orders AS s ON u.id = s.user_id WHERE s.number=$1`,
-			order.Number)
+// UpdateOrder applies the allowed transition of the order and credits the bill once, referral and campaign may be nil.
+func (store *StoreImpl) UpdateOrder(ctx context.Context, order *internal.Order, referral ReferralRules, campaign CampaignRules) error {
+	tx, err := store.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction %w", err)
+	}
+	defer tx.Rollback()
+
+	var current internal.Order
+	err = tx.GetContext(ctx, &current,
+		`SELECT * FROM orders WHERE number = $1 AND status != $2 AND status != $3 FOR UPDATE`,
+		order.Number, internal.OrderStatusInvalid, internal.OrderStatusProcessed)
+	if errors.Is(err, sql.ErrNoRows) {
+		internal.Logf.Debugf("order %s isn't found or has final status", order.Number)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("can't get order from db %w", err)
+	}
+	if current.Status == order.Status && current.Accrual == order.Accrual {
+		internal.Logf.Debugf("order %s isn't changed", order.Number)
+		return nil
+	}
+	if current.Status != order.Status && !current.Status.CanMoveTo(order.Status) {
+		internal.Logf.Debugf("order %s can't move from %s to %s", order.Number, current.Status, order.Status)
+		return nil
+	}
+	if order.Status == internal.OrderStatusProcessed && campaign != nil {
+		if order, err = applyCampaign(ctx, tx, &current, order, campaign); err != nil {
+			return err
+		}
+	}
+	userID := current.UserID
+	now := time.Now()
+	result, err := tx.ExecContext(ctx,
+		`UPDATE orders SET status = $1, accrual = $2, update_source = $3, update_at = $4, campaign_bonus = $7, campaign_id = $8
+			WHERE id = $5 AND status = $6`,
+		order.Status, order.Accrual, order.UpdateSource, now, current.ID, current.Status, order.CampaignBonus, order.CampaignID)
+	if err != nil {
+		return fmt.Errorf("can't update order from db %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't update order from db %w", err)
+	}
+	if affected == 0 {
+		internal.Logf.Debugf("order %s has changed status already", order.Number)
+		return nil
+	}
+	if current.Status != order.Status {
+		err = addStatusChange(ctx, tx, current.ID, now, current.Status, order.Status, order.UpdateSource)
 		if err != nil {
-			err = tx.Rollback()
-			return fmt.Errorf("can't get bill from db %w", err)
+			return err
 		}
-		sumBill := user.Bill + order.Accrual
-		_, err = tx.ExecContext(ctx, `UPDATE users SET bill = $1 WHERE id = $2`, sumBill, user.ID)
+	}
+	if err = bumpUserVersion(ctx, tx, userID); err != nil {
+		return err
+	}
+
+	payload := internal.OrderEventDto{
+		Order:   order.Number,
+		Status:  string(order.Status),
+		Accrual: order.Accrual,
+	}
+	if current.Status != order.Status {
+		if err = addUserEvent(ctx, tx, internal.EventOrderStatus, userID, payload); err != nil {
+			return err
+		}
+	}
+	credits := &[]internal.ReferralCredit{}
+	if order.Status == internal.OrderStatusProcessed {
+		credited, err := creditOrder(ctx, tx, current.ID, now)
 		if err != nil {
-			err = tx.Rollback()
-			return fmt.Errorf("can't update bill from db %w", err)
+			return err
+		}
+		if credited {
+			if err = addBalanceEvent(ctx, tx, userID); err != nil {
+				return err
+			}
 		}
+		if credited && referral != nil {
+			if credits, err = creditReferral(ctx, tx, userID, current.ID, referral); err != nil {
+				return fmt.Errorf("can't credit referral of order %s %w", order.Number, err)
+			}
+		}
+	}
+	if eventType, ok := orderEventTypes[order.Status]; ok {
+		if err = addOutboxEvent(ctx, tx, eventType, userID, payload); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("can't commit transaction %w", err)
+	}
+	for _, credit := range *credits {
+		internal.Logf.Infof("referral bonus %v is credited to %s %s for order %s",
+			credit.Sum, credit.Role, credit.UserID, credit.Order)
+	}
+	return nil
+}
+
+func (store *StoreImpl) GetOrder(ctx context.Context, number string) (*internal.Order, error) {
+	var order internal.Order
+	err := store.db.GetContext(ctx, &order, `SELECT * FROM orders WHERE number = $1`, number)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errors2.ErrOrderNotFound
 	}
-	_, err := tx.ExecContext(ctx, `UPDATE orders SET status = $1, accrual=$2 WHERE number = $3`,
-		order.Status, order.Accrual, order.Number)
 	if err != nil {
-		err = tx.Rollback()
-		return fmt.Errorf("can't update order from db %w", err)
+		return nil, fmt.Errorf("can't get order from db %w", err)
+	}
+	return &order, nil
+}
+
+func (store *StoreImpl) GetOrderHistory(ctx context.Context, orderID uuid.UUID) (*[]internal.OrderStatusChange, error) {
+	var history []internal.OrderStatusChange
+	err := store.db.SelectContext(ctx, &history,
+		`SELECT * FROM order_status_history WHERE order_id = $1 ORDER BY id`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("can't get history of order from db %w", err)
+	}
+	return &history, nil
+}
+
+// SaveOrderCheck counts the check of the accrual of the order, the check doesn't change
+// the version of the user.
+func (store *StoreImpl) SaveOrderCheck(ctx context.Context, number string, checkedAt time.Time, nextCheckAt time.Time) error {
+	_, err := store.db.ExecContext(ctx,
+		`UPDATE orders SET poll_count = poll_count + 1, checked_at = $2, next_check_at = $3 WHERE number = $1`,
+		number, checkedAt, nextCheckAt)
+	if err != nil {
+		return fmt.Errorf("can't save check of order to db %w", err)
 	}
 	return nil
 }
 
-func (store *StoreImpl) SaveWithdrawal(ctx context.Context, withdrawal *internal.Withdraw) error {
-	tx := store.db.MustBeginTx(ctx, nil)
-	defer tx.Commit()
+func addStatusChange(ctx context.Context, tx *sqlx.Tx, orderID uuid.UUID, at time.Time,
+	from internal.OrderStatus, to internal.OrderStatus, source internal.UpdateSource) error {
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO order_status_history (order_id, create_at, from_status, status, source) VALUES ($1, $2, $3, $4, $5)`,
+		orderID, at, from, to, source)
+	if err != nil {
+		return fmt.Errorf("can't save history of order to db %w", err)
+	}
+	return nil
+}
+
+// creditOrder adds the accrual of the order to the bill of its user and marks the order
+// with credited_at, the marked order isn't credited again.
+func creditOrder(ctx context.Context, tx *sqlx.Tx, orderID uuid.UUID, now time.Time) (bool, error) {
+	result, err := tx.ExecContext(ctx,
+		`WITH credited AS (
+			UPDATE orders SET credited_at = $1 WHERE id = $2 AND credited_at IS NULL RETURNING user_id, accrual
+		) UPDATE users SET bill = bill + COALESCE(credited.accrual, 0) FROM credited WHERE users.id = credited.user_id`,
+		now, orderID)
+	if err != nil {
+		return false, fmt.Errorf("can't update bill from db %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("can't update bill from db %w", err)
+	}
+	return affected > 0, nil
+}
+
+// SaveWithdrawal locks the row of the user till the end of the transaction, so the
+// parallel withdrawals check the balance and rules one by one and can't overdraw the
+// balance or exceed the limit of rules, nil checks nothing.
+func (store *StoreImpl) SaveWithdrawal(ctx context.Context, withdrawal *internal.Withdraw, rules WithdrawalRules) error {
+	tx, err := store.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction %w", err)
+	}
+	defer tx.Rollback()
+
 	var user internal.User
-	err := tx.GetContext(ctx, &user, `SELECT * FROM users WHERE id=$1`, withdrawal.UserID)
+	err = tx.GetContext(ctx, &user, `SELECT * FROM users WHERE id=$1 FOR UPDATE`, withdrawal.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("can't get user from db %w", errors2.ErrUserNotFound)
+	}
 	if err != nil {
-		err = tx.Rollback()
 		return fmt.Errorf("can't get user from db %w", err)
 	}
 	if user.Bill < withdrawal.Sum {
 		return errors2.ErrNotEnoughAmount
 	}
+	if rules != nil {
+		err = rules(&user, func(since time.Time) (float32, error) {
+			var withdrawn float32
+			err := tx.GetContext(ctx, &withdrawn,
+				`SELECT COALESCE(SUM(sum), 0) FROM withdrawals WHERE user_id = $1 AND create_at > $2`,
+				withdrawal.UserID, since)
+			if err != nil {
+				return 0, fmt.Errorf("can't get withdrawals from db %w", err)
+			}
+			return withdrawn, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
 	_, err = tx.NamedExecContext(ctx, `INSERT INTO withdrawals (id, create_at, order_num, sum, user_id) 
 											VALUES (:id, :create_at, :order_num, :sum, :user_id)`, withdrawal)
 	if err != nil {
-		err = tx.Rollback()
 		return fmt.Errorf("can't save withdrawal to db %w", err)
 	}
 	sumBill := user.Bill - withdrawal.Sum
-	_, err = tx.ExecContext(ctx, `UPDATE users SET bill = $1 WHERE id = $2`, sumBill, withdrawal.UserID)
+	_, err = tx.ExecContext(ctx, `UPDATE users SET bill = $1, version = version + 1 WHERE id = $2`, sumBill, withdrawal.UserID)
 	if err != nil {
-		err = tx.Rollback()
 		return fmt.Errorf("can't update user bill at db %w", err)
 	}
+	payload := internal.WithdrawalEventDto{Order: withdrawal.Order, Sum: withdrawal.Sum}
+	if err = addOutboxEvent(ctx, tx, internal.EventWithdrawal, withdrawal.UserID, payload); err != nil {
+		return err
+	}
+	if err = addBalanceEvent(ctx, tx, withdrawal.UserID); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("can't commit transaction %w", err)
+	}
 	return nil
 }
 
@@ -177,6 +404,78 @@ func (store *StoreImpl) GetWithdrawals(ctx context.Context, userID uuid.UUID) (*
 	return &withdrawals, nil
 }
 
+func (store *StoreImpl) GetOrderWithdrawals(ctx context.Context, userID uuid.UUID, number string) (*[]internal.Withdraw, error) {
+	var withdrawals []internal.Withdraw
+	err := store.db.SelectContext(ctx, &withdrawals,
+		`SELECT * FROM withdrawals WHERE user_id = $1 AND order_num = $2 ORDER BY create_at`, userID, number)
+	if err != nil {
+		return nil, fmt.Errorf("can't get withdrawals from db %w", err)
+	}
+	return &withdrawals, nil
+}
+
+// GetStatement calls fn for every accrual, referral bonus and withdrawal of the user in
+// [from, to) in chronological order. The rows are read with a cursor, the running balance is counted
+// from the first operation of the user.
+func (store *StoreImpl) GetStatement(ctx context.Context, userID uuid.UUID, from time.Time, to time.Time,
+	fn func(entry *internal.StatementEntry) error) error {
+	rows, err := store.db.QueryxContext(ctx,
+		`SELECT * FROM (
+			SELECT at, operation, order_num, amount,
+				SUM(amount) OVER (ORDER BY at, operation, order_num COLLATE "C" ROWS UNBOUNDED PRECEDING) AS balance
+			FROM (
+				SELECT COALESCE(update_at, create_at) AS at, $2::TEXT AS operation, number AS order_num, COALESCE(accrual, 0) AS amount
+					FROM orders WHERE user_id = $1 AND status = $3
+				UNION ALL
+				SELECT create_at, $4::TEXT, order_num, -COALESCE(sum, 0) FROM withdrawals WHERE user_id = $1
+				UNION ALL
+				SELECT create_at, $7::TEXT, order_num, sum FROM referral_credits WHERE user_id = $1
+			) operations
+		) statement WHERE at >= $5 AND at < $6 ORDER BY at, operation, order_num COLLATE "C"`,
+		userID, internal.StatementAccrual, internal.OrderStatusProcessed, internal.StatementWithdrawal, from, to,
+		internal.StatementReferral)
+	if err != nil {
+		return fmt.Errorf("can't get statement from db %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry internal.StatementEntry
+		if err = rows.StructScan(&entry); err != nil {
+			return fmt.Errorf("can't read statement from db %w", err)
+		}
+		if err = fn(&entry); err != nil {
+			return err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("can't read statement from db %w", err)
+	}
+	return nil
+}
+
+// GetUserVersion returns the version of the account of the user, it's bumped by every
+// change of the orders, the bill and the withdrawals of the user.
+func (store *StoreImpl) GetUserVersion(ctx context.Context, id uuid.UUID) (int64, error) {
+	var version int64
+	err := store.db.GetContext(ctx, &version, `SELECT version FROM users WHERE id=$1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, errors2.ErrUserNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("can't get version of user from db %w", err)
+	}
+	return version, nil
+}
+
+func bumpUserVersion(ctx context.Context, tx *sqlx.Tx, userID uuid.UUID) error {
+	_, err := tx.ExecContext(ctx, `UPDATE users SET version = version + 1 WHERE id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("can't update version of user at db %w", err)
+	}
+	return nil
+}
+
 func (store *StoreImpl) GetUser(ctx context.Context, id uuid.UUID) (*internal.User, error) {
 	var user internal.User
 	err := store.db.GetContext(ctx, &user, `SELECT * FROM users WHERE id=$1`, id)
@@ -186,15 +485,135 @@ func (store *StoreImpl) GetUser(ctx context.Context, id uuid.UUID) (*internal.Us
 	return &user, nil
 }
 
+// ClaimOutboxEvents returns pending events which are due and hides them from
+// other dispatchers for lease, so replicas don't deliver the same event at once.
+func (store *StoreImpl) ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) (*[]internal.OutboxEvent, error) {
+	var events []internal.OutboxEvent
+	err := store.db.SelectContext(ctx, &events,
+		`UPDATE outbox SET next_attempt_at = $1 WHERE id IN (
+			SELECT id FROM outbox WHERE status = $2 AND next_attempt_at <= $3
+			ORDER BY next_attempt_at LIMIT $4 FOR UPDATE SKIP LOCKED) RETURNING *`,
+		time.Now().Add(lease), internal.OutboxStatusPending, time.Now(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't claim outbox events from db %w", err)
+	}
+	return &events, nil
+}
+
+// SaveOutboxDelivery stores the result of the delivery of the event together with its attempts.
+func (store *StoreImpl) SaveOutboxDelivery(ctx context.Context, event *internal.OutboxEvent, attempts *[]internal.OutboxAttempt) error {
+	tx, err := store.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.NamedExecContext(ctx,
+		`UPDATE outbox SET status = :status, attempts = :attempts, next_attempt_at = :next_attempt_at,
+			last_error = :last_error, delivered_at = :delivered_at WHERE id = :id`,
+		event)
+	if err != nil {
+		return fmt.Errorf("can't update outbox event at db %w", err)
+	}
+	for _, attempt := range *attempts {
+		_, err = tx.NamedExecContext(ctx,
+			`INSERT INTO outbox_attempts (id, event_id, attempt_at, sink, error)
+				VALUES (:id, :event_id, :attempt_at, :sink, :error)`,
+			attempt)
+		if err != nil {
+			return fmt.Errorf("can't save outbox attempt to db %w", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("can't commit transaction %w", err)
+	}
+	return nil
+}
+
+func (store *StoreImpl) GetDeadLetters(ctx context.Context) (*[]internal.OutboxEvent, error) {
+	var events []internal.OutboxEvent
+	err := store.db.SelectContext(ctx, &events,
+		`SELECT * FROM outbox WHERE status = $1 ORDER BY create_at`, internal.OutboxStatusDead)
+	if err != nil {
+		return nil, fmt.Errorf("can't get dead letters from db %w", err)
+	}
+	return &events, nil
+}
+
+var orderEventTypes = map[internal.OrderStatus]internal.EventType{
+	internal.OrderStatusProcessed: internal.EventOrderProcessed,
+	internal.OrderStatusInvalid:   internal.EventOrderInvalid,
+}
+
+func addOutboxEvent(ctx context.Context, tx *sqlx.Tx, eventType internal.EventType, userID uuid.UUID, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("can't marshal event %s %w", eventType, err)
+	}
+	now := time.Now()
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO outbox (id, create_at, event_type, user_id, payload, next_attempt_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		uuid.New(), now, eventType, userID, string(data), now)
+	if err != nil {
+		return fmt.Errorf("can't save event %s to outbox %w", eventType, err)
+	}
+	return nil
+}
+
+// ReferralRules decides the bonuses of the referral, the refused referral is errors.ErrReferralRefused.
+type ReferralRules func(referral *internal.Referral) (*[]internal.ReferralCredit, error)
+
+// CampaignRules decides the campaign and its bonus for the processed order of the user, nil applies none.
+type CampaignRules func(order *internal.Order, user *internal.User, campaigns []internal.Campaign) (*internal.Campaign, float32)
+
+// WithdrawalRules checks the withdrawal of the user, withdrawn returns the sum withdrawn by the user after since.
+type WithdrawalRules func(user *internal.User, withdrawn func(since time.Time) (float32, error)) error
+
 type Store interface {
 	CheckConnection() error
 	AddUser(ctx context.Context, user *internal.User) error
 	FindUserByLogin(ctx context.Context, login string) (*internal.User, error)
 	AddOrder(ctx context.Context, order *internal.Order) (*internal.Order, error)
+	AddOrders(ctx context.Context, orders *[]internal.Order) (*[]internal.Order, error)
 	GetOrders(ctx context.Context, userID uuid.UUID) (*[]internal.Order, error)
 	GetOrdersNotProcessed(ctx context.Context) (*[]internal.Order, error)
-	UpdateOrder(ctx context.Context, order *internal.Order) error
-	SaveWithdrawal(ctx context.Context, withdrawal *internal.Withdraw) error
+	GetOrder(ctx context.Context, number string) (*internal.Order, error)
+	GetOrderHistory(ctx context.Context, orderID uuid.UUID) (*[]internal.OrderStatusChange, error)
+	SaveOrderCheck(ctx context.Context, number string, checkedAt time.Time, nextCheckAt time.Time) error
+	UpdateOrder(ctx context.Context, order *internal.Order, referral ReferralRules, campaign CampaignRules) error
+	SaveWithdrawal(ctx context.Context, withdrawal *internal.Withdraw, rules WithdrawalRules) error
 	GetWithdrawals(ctx context.Context, userID uuid.UUID) (*[]internal.Withdraw, error)
+	GetOrderWithdrawals(ctx context.Context, userID uuid.UUID, number string) (*[]internal.Withdraw, error)
 	GetUser(ctx context.Context, id uuid.UUID) (*internal.User, error)
+	GetUserVersion(ctx context.Context, id uuid.UUID) (int64, error)
+	GetStatement(ctx context.Context, userID uuid.UUID, from time.Time, to time.Time, fn func(entry *internal.StatementEntry) error) error
+	ClaimOutboxEvents(ctx context.Context, limit int, lease time.Duration) (*[]internal.OutboxEvent, error)
+	SaveOutboxDelivery(ctx context.Context, event *internal.OutboxEvent, attempts *[]internal.OutboxAttempt) error
+	GetDeadLetters(ctx context.Context) (*[]internal.OutboxEvent, error)
+	AddWebhook(ctx context.Context, webhook *internal.Webhook, limit int) error
+	GetWebhooks(ctx context.Context, userID uuid.UUID) (*[]internal.Webhook, error)
+	GetWebhook(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*internal.Webhook, error)
+	UpdateWebhook(ctx context.Context, webhook *internal.Webhook) error
+	DeleteWebhook(ctx context.Context, userID uuid.UUID, id uuid.UUID) error
+	AddWebhookDeliveries(ctx context.Context, event *internal.OutboxEvent) error
+	AddWebhookDelivery(ctx context.Context, delivery *internal.WebhookDelivery) error
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) (*[]internal.WebhookDelivery, error)
+	SaveWebhookDelivery(ctx context.Context, delivery *internal.WebhookDelivery) error
+	GetWebhookDeliveries(ctx context.Context, userID uuid.UUID, webhookID uuid.UUID, limit int) (*[]internal.WebhookDelivery, error)
+	GetUserEvents(ctx context.Context, userID uuid.UUID, afterID int64, limit int) (*[]internal.UserEvent, error)
+	GetLastUserEventID(ctx context.Context, userID uuid.UUID) (int64, error)
+	DeleteUserEvents(ctx context.Context, before time.Time) (int64, error)
+	ListenUserEvents(ctx context.Context, notify func(userID uuid.UUID)) error
+	TakeRateToken(ctx context.Context, key string, limit internal.RateLimit) (*internal.RateBucket, error)
+	DeleteRateBuckets(ctx context.Context, idle time.Duration) (int64, error)
+	FindUserByReferralCode(ctx context.Context, code string) (*internal.User, error)
+	GetReferralCredits(ctx context.Context, userID uuid.UUID) (*[]internal.ReferralCredit, error)
+	CountReferees(ctx context.Context, referrerID uuid.UUID) (int, error)
+	AddCampaign(ctx context.Context, campaign *internal.Campaign) error
+	GetCampaigns(ctx context.Context) (*[]internal.Campaign, error)
+	GetCampaign(ctx context.Context, id uuid.UUID) (*internal.Campaign, error)
+	DeleteCampaign(ctx context.Context, id uuid.UUID) error
+	GetActiveCampaigns(ctx context.Context, at time.Time) (*[]internal.Campaign, error)
+	GetTierAccruals(ctx context.Context, since time.Time) (*[]internal.TierAccrual, error)
+	UpdateTier(ctx context.Context, change *internal.TierChange) error
 }
@@ -3,6 +3,7 @@ package repositories
 import (
 	"context"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories/testdata"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
@@ -102,7 +103,7 @@ func TestStore_AddOrder(t *testing.T) {
 				order: &internal.Order{
 					ID:       uuid.New(),
 					CreateAt: time.Now(),
-					Number:   123456789,
+					Number:   "123456789",
 					Accrual:  1.1,
 					Status:   internal.OrderStatusNew,
 					UserID:   uuid.New()},
@@ -118,7 +119,7 @@ func TestStore_AddOrder(t *testing.T) {
 				order: &internal.Order{
 					ID:       uuid.New(),
 					CreateAt: time.Now(),
-					Number:   4539088167512356,
+					Number:   "4539088167512356",
 					Accrual:  1.1,
 					Status:   internal.OrderStatusNew,
 					UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026")},
@@ -134,7 +135,7 @@ func TestStore_AddOrder(t *testing.T) {
 				order: &internal.Order{
 					ID:       uuid.New(),
 					CreateAt: time.Now(),
-					Number:   4539088167512356,
+					Number:   "4539088167512356",
 					Accrual:  1.1,
 					Status:   internal.OrderStatusNew,
 					UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed027")},
@@ -150,7 +151,7 @@ func TestStore_AddOrder(t *testing.T) {
 				order: &internal.Order{
 					ID:       uuid.MustParse("3e23bb5c-5cd6-4ca9-afa5-8d498576a080"),
 					CreateAt: time.Now(),
-					Number:   6011223604226714,
+					Number:   "6011223604226714",
 					Accrual:  1.1,
 					Status:   internal.OrderStatusProcessed,
 					UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed027")},
@@ -158,7 +159,7 @@ func TestStore_AddOrder(t *testing.T) {
 			want: &internal.Order{
 				ID:       uuid.MustParse("3e23bb5c-5cd6-4ca9-afa5-8d498576a080"),
 				CreateAt: time.Now(),
-				Number:   6011223604226714,
+				Number:   "6011223604226714",
 				Accrual:  1.1,
 				Status:   internal.OrderStatusProcessed,
 				UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed027")},
@@ -208,10 +209,11 @@ func TestStore_AddUser(t *testing.T) {
 			args: args{
 				ctx: context.Background(),
 				user: &internal.User{
-					ID:       uuid.New(),
-					CreateAt: time.Now(),
-					Login:    "TestUser3",
-					Password: "password",
+					ID:           uuid.New(),
+					CreateAt:     time.Now(),
+					Login:        "TestUser3",
+					Password:     "password",
+					ReferralCode: "TESTUSR3",
 				},
 			},
 			wantErr:    false,
@@ -222,10 +224,11 @@ func TestStore_AddUser(t *testing.T) {
 			args: args{
 				ctx: context.Background(),
 				user: &internal.User{
-					ID:       uuid.New(),
-					CreateAt: time.Now(),
-					Login:    "TestUser1",
-					Password: "password",
+					ID:           uuid.New(),
+					CreateAt:     time.Now(),
+					Login:        "TestUser1",
+					Password:     "password",
+					ReferralCode: "TESTUSR4",
 				},
 			},
 			wantErr:    true,
@@ -321,11 +324,12 @@ func TestStore_FindUserByLogin(t *testing.T) {
 				login: "TestUser1",
 			},
 			want: &internal.User{
-				ID:       uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
-				CreateAt: time.Date(2023, 01, 01, 14, 00, 00, 000, time.UTC),
-				Login:    "TestUser1",
-				Password: "password",
-				Bill:     0,
+				ID:           uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
+				CreateAt:     time.Date(2023, 01, 01, 14, 00, 00, 000, time.UTC),
+				Login:        "TestUser1",
+				Password:     "password",
+				Bill:         0,
+				ReferralCode: "TESTUSR1",
 			},
 			wantErr:    false,
 			wantErrMsg: "",
@@ -471,11 +475,12 @@ func TestStore_GetUser(t *testing.T) {
 				id:  uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed027"),
 			},
 			want: &internal.User{
-				ID:       uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed027"),
-				CreateAt: time.Date(2023, 01, 01, 14, 00, 00, 000, time.UTC),
-				Login:    "TestUser2",
-				Password: "password",
-				Bill:     100,
+				ID:           uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed027"),
+				CreateAt:     time.Date(2023, 01, 01, 14, 00, 00, 000, time.UTC),
+				Login:        "TestUser2",
+				Password:     "password",
+				Bill:         100,
+				ReferralCode: "TESTUSR2",
 			},
 			wantErr: false,
 		},
@@ -532,21 +537,21 @@ func TestStore_GetWithdrawals(t *testing.T) {
 				{
 					ID:       uuid.MustParse("35e1cbd0-c3ba-44eb-8632-0d91c280dee6"),
 					CreateAt: time.Date(2023, 11, 10, 14, 00, 00, 000, time.Local),
-					Order:    140672056,
+					Order:    "140672056",
 					Sum:      12.64,
 					UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
 				},
 				{
 					ID:       uuid.MustParse("35e1cbd0-c3ba-44eb-8632-0d91c280dee7"),
 					CreateAt: time.Date(2023, 12, 10, 14, 00, 00, 000, time.Local),
-					Order:    140672057,
+					Order:    "140672057",
 					Sum:      27.385,
 					UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
 				},
 				{
 					ID:       uuid.MustParse("35e1cbd0-c3ba-44eb-8632-0d91c280dee8"),
 					CreateAt: time.Date(2023, 11, 11, 14, 00, 00, 000, time.Local),
-					Order:    140672058,
+					Order:    "140672058",
 					Sum:      0.11111111,
 					UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
 				},
@@ -618,7 +623,7 @@ func TestStore_SaveWithdrawal(t *testing.T) {
 				withdrawal: &internal.Withdraw{
 					ID:       uuid.New(),
 					CreateAt: time.Now(),
-					Order:    123456,
+					Order:    "123456",
 					Sum:      99,
 					UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed027"),
 				},
@@ -633,7 +638,7 @@ func TestStore_SaveWithdrawal(t *testing.T) {
 				withdrawal: &internal.Withdraw{
 					ID:       uuid.New(),
 					CreateAt: time.Now(),
-					Order:    123456,
+					Order:    "123456",
 					Sum:      0.00000001,
 					UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
 				},
@@ -647,7 +652,7 @@ func TestStore_SaveWithdrawal(t *testing.T) {
 			store := &StoreImpl{
 				db: db,
 			}
-			err := store.SaveWithdrawal(tt.args.ctx, tt.args.withdrawal)
+			err := store.SaveWithdrawal(tt.args.ctx, tt.args.withdrawal, nil)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("SaveWithdrawal() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -680,7 +685,7 @@ func TestStore_UpdateOrder(t *testing.T) {
 				order: &internal.Order{
 					ID:       uuid.New(),
 					CreateAt: time.Now(),
-					Number:   3536137811022331,
+					Number:   "3536137811022331",
 					Accrual:  100,
 					Status:   internal.OrderStatusProcessing,
 					UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
@@ -696,7 +701,7 @@ func TestStore_UpdateOrder(t *testing.T) {
 				order: &internal.Order{
 					ID:       uuid.New(),
 					CreateAt: time.Now(),
-					Number:   3536137811022331,
+					Number:   "3536137811022331",
 					Accrual:  99.111,
 					Status:   internal.OrderStatusProcessed,
 					UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
@@ -705,13 +710,30 @@ func TestStore_UpdateOrder(t *testing.T) {
 			wantErr:  false,
 			userBill: 99.111,
 		},
+		{
+			name: "add_order_processed_repeated",
+			args: args{
+				ctx: context.Background(),
+				order: &internal.Order{
+					ID:           uuid.New(),
+					CreateAt:     time.Now(),
+					Number:       "3536137811022331",
+					Accrual:      99.111,
+					Status:       internal.OrderStatusProcessed,
+					UserID:       uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
+					UpdateSource: internal.UpdateSourceCallback,
+				},
+			},
+			wantErr:  false,
+			userBill: 99.111,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			store := &StoreImpl{
 				db: db,
 			}
-			if err := store.UpdateOrder(tt.args.ctx, tt.args.order); (err != nil) != tt.wantErr {
+			if err := store.UpdateOrder(tt.args.ctx, tt.args.order, nil, nil); (err != nil) != tt.wantErr {
 				t.Errorf("UpdateOrder() error = %v, wantErr %v", err, tt.wantErr)
 			}
 			user, err := store.GetUser(tt.args.ctx, tt.args.order.UserID)
@@ -720,3 +742,326 @@ func TestStore_UpdateOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestStore_OutboxEvents(t *testing.T) {
+	db, err := container.InitData()
+	if err != nil {
+		t.Skipf("TestStore_OutboxEvents %v", err)
+	}
+	ctx := context.Background()
+	store := &StoreImpl{
+		db: db,
+	}
+	userID := uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026")
+
+	err = store.UpdateOrder(ctx, &internal.Order{Number: "3536137811022331", Accrual: 10, Status: internal.OrderStatusProcessed}, nil, nil)
+	assert.NoErrorf(t, err, "UpdateOrder() error = %v", err)
+	err = store.UpdateOrder(ctx, &internal.Order{Number: "3536137811022331", Accrual: 10, Status: internal.OrderStatusProcessed}, nil, nil)
+	assert.NoErrorf(t, err, "UpdateOrder() error = %v", err)
+
+	events, err := store.ClaimOutboxEvents(ctx, 10, time.Minute)
+	assert.NoErrorf(t, err, "ClaimOutboxEvents() error = %v", err)
+	if assert.Len(t, *events, 1, "repeated update must not write event") {
+		event := (*events)[0]
+		assert.Equal(t, internal.EventOrderProcessed, event.Type)
+		assert.Equal(t, userID, event.UserID)
+		assert.JSONEq(t, `{"order":"3536137811022331","status":"PROCESSED","accrual":10}`, string(event.Payload))
+
+		claimed, err := store.ClaimOutboxEvents(ctx, 10, time.Minute)
+		assert.NoErrorf(t, err, "ClaimOutboxEvents() error = %v", err)
+		assert.Len(t, *claimed, 0, "claimed event must be hidden for lease")
+
+		event.Status = internal.OutboxStatusDead
+		event.Attempts = 10
+		event.LastError = "connection refused"
+		attempts := []internal.OutboxAttempt{
+			{ID: uuid.New(), EventID: event.ID, AttemptAt: time.Now(), Sink: "webhook", Error: "connection refused"},
+		}
+		err = store.SaveOutboxDelivery(ctx, &event, &attempts)
+		assert.NoErrorf(t, err, "SaveOutboxDelivery() error = %v", err)
+
+		dead, err := store.GetDeadLetters(ctx)
+		assert.NoErrorf(t, err, "GetDeadLetters() error = %v", err)
+		assert.Len(t, *dead, 1)
+	}
+
+	err = store.SaveWithdrawal(ctx, &internal.Withdraw{ID: uuid.New(), CreateAt: time.Now(), Order: "2377225624", Sum: 5, UserID: userID}, nil)
+	assert.NoErrorf(t, err, "SaveWithdrawal() error = %v", err)
+	events, err = store.ClaimOutboxEvents(ctx, 10, time.Minute)
+	assert.NoErrorf(t, err, "ClaimOutboxEvents() error = %v", err)
+	if assert.Len(t, *events, 1) {
+		assert.Equal(t, internal.EventWithdrawal, (*events)[0].Type)
+	}
+}
+
+func TestStore_Webhooks(t *testing.T) {
+	db, err := container.InitData()
+	if err != nil {
+		t.Skipf("TestStore_Webhooks %v", err)
+	}
+	ctx := context.Background()
+	store := &StoreImpl{
+		db: db,
+	}
+	userID := uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026")
+	webhook := &internal.Webhook{
+		ID:         uuid.New(),
+		CreateAt:   time.Now(),
+		UserID:     userID,
+		URL:        "https://partner.example/hook",
+		Secret:     "secret",
+		EventTypes: "order.processed,balance.withdrawn",
+		Active:     true,
+	}
+	err = store.AddWebhook(ctx, webhook, 10)
+	assert.NoErrorf(t, err, "AddWebhook() error = %v", err)
+
+	_, err = store.GetWebhook(ctx, uuid.New(), webhook.ID)
+	assert.ErrorIs(t, err, errors2.ErrWebhookNotFound, "webhook of other user must be hidden")
+	err = store.DeleteWebhook(ctx, uuid.New(), webhook.ID)
+	assert.ErrorIs(t, err, errors2.ErrWebhookNotFound)
+
+	event := &internal.OutboxEvent{ID: uuid.New(), CreateAt: time.Now(), Type: internal.EventOrderInvalid, UserID: userID, Payload: []byte(`{}`)}
+	err = store.AddWebhookDeliveries(ctx, event)
+	assert.NoErrorf(t, err, "AddWebhookDeliveries() error = %v", err)
+	event = &internal.OutboxEvent{ID: uuid.New(), CreateAt: time.Now(), Type: internal.EventOrderProcessed, UserID: userID, Payload: []byte(`{}`)}
+	err = store.AddWebhookDeliveries(ctx, event)
+	assert.NoErrorf(t, err, "AddWebhookDeliveries() error = %v", err)
+	err = store.AddWebhookDeliveries(ctx, event)
+	assert.NoErrorf(t, err, "repeated AddWebhookDeliveries() error = %v", err)
+
+	deliveries, err := store.ClaimWebhookDeliveries(ctx, 10, time.Minute)
+	assert.NoErrorf(t, err, "ClaimWebhookDeliveries() error = %v", err)
+	if assert.Len(t, *deliveries, 1, "delivery is created once for subscribed event") {
+		delivery := (*deliveries)[0]
+		assert.Equal(t, event.ID, delivery.EventID)
+		assert.Equal(t, webhook.URL, delivery.URL)
+		assert.Equal(t, webhook.Secret, delivery.Secret)
+
+		now := time.Now()
+		delivery.Status = internal.OutboxStatusDelivered
+		delivery.Attempts = 1
+		delivery.ResponseCode = 200
+		delivery.DeliveredAt = &now
+		err = store.SaveWebhookDelivery(ctx, &delivery)
+		assert.NoErrorf(t, err, "SaveWebhookDelivery() error = %v", err)
+	}
+
+	log, err := store.GetWebhookDeliveries(ctx, userID, webhook.ID, 10)
+	assert.NoErrorf(t, err, "GetWebhookDeliveries() error = %v", err)
+	if assert.Len(t, *log, 1) {
+		assert.Equal(t, internal.OutboxStatusDelivered, (*log)[0].Status)
+	}
+
+	err = store.DeleteWebhook(ctx, userID, webhook.ID)
+	assert.NoErrorf(t, err, "DeleteWebhook() error = %v", err)
+	webhooks, err := store.GetWebhooks(ctx, userID)
+	assert.NoErrorf(t, err, "GetWebhooks() error = %v", err)
+	assert.Len(t, *webhooks, 0)
+}
+
+func TestStore_UserEvents(t *testing.T) {
+	db, err := container.InitData()
+	if err != nil {
+		t.Skipf("TestStore_UserEvents %v", err)
+	}
+	ctx := context.Background()
+	store := &StoreImpl{
+		db: db,
+	}
+	userID := uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026")
+
+	err = store.UpdateOrder(ctx, &internal.Order{Number: "3536137811022331", Status: internal.OrderStatusProcessing}, nil, nil)
+	assert.NoErrorf(t, err, "UpdateOrder() error = %v", err)
+	err = store.UpdateOrder(ctx, &internal.Order{Number: "3536137811022331", Status: internal.OrderStatusProcessing}, nil, nil)
+	assert.NoErrorf(t, err, "UpdateOrder() error = %v", err)
+	err = store.UpdateOrder(ctx, &internal.Order{Number: "3536137811022331", Accrual: 10, Status: internal.OrderStatusProcessed}, nil, nil)
+	assert.NoErrorf(t, err, "UpdateOrder() error = %v", err)
+
+	events, err := store.GetUserEvents(ctx, userID, 0, 10)
+	assert.NoErrorf(t, err, "GetUserEvents() error = %v", err)
+	if assert.Len(t, *events, 3, "unchanged status must not write event") {
+		assert.Equal(t, internal.EventOrderStatus, (*events)[0].Type)
+		assert.JSONEq(t, `{"order":"3536137811022331","status":"PROCESSING","accrual":0}`, string((*events)[0].Payload))
+		assert.Equal(t, internal.EventOrderStatus, (*events)[1].Type)
+		assert.Equal(t, internal.EventBalanceChanged, (*events)[2].Type)
+		assert.JSONEq(t, `{"current":10,"withdrawn":40.136112}`, string((*events)[2].Payload))
+	}
+
+	lastID, err := store.GetLastUserEventID(ctx, userID)
+	assert.NoErrorf(t, err, "GetLastUserEventID() error = %v", err)
+	events, err = store.GetUserEvents(ctx, userID, lastID-1, 10)
+	assert.NoErrorf(t, err, "GetUserEvents() error = %v", err)
+	assert.Len(t, *events, 1)
+
+	notified := make(chan uuid.UUID, 1)
+	listenCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	listened := make(chan error)
+	go func() {
+		listened <- store.ListenUserEvents(listenCtx, func(userID uuid.UUID) {
+			notified <- userID
+		})
+	}()
+	assert.Eventually(t, func() bool {
+		err = store.SaveWithdrawal(ctx, &internal.Withdraw{ID: uuid.New(), CreateAt: time.Now(), Order: "2377225624", Sum: 0.01, UserID: userID}, nil)
+		assert.NoErrorf(t, err, "SaveWithdrawal() error = %v", err)
+		select {
+		case id := <-notified:
+			return id == userID
+		case <-time.After(100 * time.Millisecond):
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	assert.NoError(t, <-listened)
+}
+
+func TestStore_AddOrders(t *testing.T) {
+	db, err := container.InitData()
+	if err != nil {
+		t.Skipf("TestStore_AddOrders %v", err)
+	}
+	ctx := context.Background()
+	store := &StoreImpl{
+		db: db,
+	}
+	userID := uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed027")
+	orders := []internal.Order{
+		{ID: uuid.New(), CreateAt: time.Now(), Number: "79927398713", Status: internal.OrderStatusNew, UserID: userID},
+		{ID: uuid.New(), CreateAt: time.Now(), Number: "4539088167512356", Status: internal.OrderStatusNew, UserID: userID},
+	}
+	existOrders, err := store.AddOrders(ctx, &orders)
+	assert.NoErrorf(t, err, "AddOrders() error = %v", err)
+	if assert.Len(t, *existOrders, 1) {
+		assert.Equal(t, int64(4539088167512356), (*existOrders)[0].Number)
+		assert.Equal(t, uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"), (*existOrders)[0].UserID)
+	}
+
+	saved, err := store.GetOrders(ctx, userID)
+	assert.NoErrorf(t, err, "GetOrders() error = %v", err)
+	if assert.Len(t, *saved, 1) {
+		assert.Equal(t, int64(79927398713), (*saved)[0].Number)
+	}
+}
+
+func TestStore_GetStatement(t *testing.T) {
+	db, err := container.InitData()
+	if err != nil {
+		t.Skipf("TestStore_GetStatement %v", err)
+	}
+	ctx := context.Background()
+	store := &StoreImpl{
+		db: db,
+	}
+	userID := uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026")
+
+	entries := make([]internal.StatementEntry, 0)
+	err = store.GetStatement(ctx, userID,
+		time.Date(2023, 11, 10, 0, 0, 0, 0, time.UTC), time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC),
+		func(entry *internal.StatementEntry) error {
+			entries = append(entries, *entry)
+			return nil
+		})
+	assert.NoErrorf(t, err, "GetStatement() error = %v", err)
+	if assert.Len(t, entries, 2, "operations before from and after to must be skipped") {
+		assert.Equal(t, internal.StatementWithdrawal, entries[0].Operation)
+		assert.Equal(t, int64(140672056), entries[0].Order)
+		assert.Equal(t, float32(-12.64), entries[0].Amount)
+		assert.Equal(t, float32(100-12.64), entries[0].Balance, "balance counts the accrual before from")
+		assert.Equal(t, int64(140672058), entries[1].Order)
+	}
+}
+
+func TestStore_UserVersion(t *testing.T) {
+	db, err := container.InitData()
+	if err != nil {
+		t.Skipf("TestStore_UserVersion %v", err)
+	}
+	ctx := context.Background()
+	store := &StoreImpl{
+		db: db,
+	}
+	userID := uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed027")
+	assertVersion := func(want int64, msg string) {
+		version, err := store.GetUserVersion(ctx, userID)
+		assert.NoErrorf(t, err, "GetUserVersion() error = %v", err)
+		assert.Equal(t, want, version, msg)
+	}
+	assertVersion(0, "initial version")
+
+	_, err = store.AddOrder(ctx, &internal.Order{ID: uuid.New(), CreateAt: time.Now(), Number: "79927398713", Status: internal.OrderStatusNew, UserID: userID})
+	assert.NoErrorf(t, err, "AddOrder() error = %v", err)
+	assertVersion(1, "added order")
+	_, err = store.AddOrder(ctx, &internal.Order{ID: uuid.New(), CreateAt: time.Now(), Number: "79927398713", Status: internal.OrderStatusNew, UserID: userID})
+	assert.ErrorIs(t, err, errors2.ErrOrderIsExistThisUser)
+	assertVersion(1, "existing order")
+
+	_, err = store.AddOrders(ctx, &[]internal.Order{
+		{ID: uuid.New(), CreateAt: time.Now(), Number: "12345678903", Status: internal.OrderStatusNew, UserID: userID},
+		{ID: uuid.New(), CreateAt: time.Now(), Number: "79927398713", Status: internal.OrderStatusNew, UserID: userID},
+	})
+	assert.NoErrorf(t, err, "AddOrders() error = %v", err)
+	assertVersion(2, "batch is bumped once")
+	_, err = store.AddOrders(ctx, &[]internal.Order{
+		{ID: uuid.New(), CreateAt: time.Now(), Number: "12345678903", Status: internal.OrderStatusNew, UserID: userID},
+	})
+	assert.NoErrorf(t, err, "AddOrders() error = %v", err)
+	assertVersion(2, "batch of existing orders")
+
+	err = store.UpdateOrder(ctx, &internal.Order{Number: "79927398713", Status: internal.OrderStatusProcessing}, nil, nil)
+	assert.NoErrorf(t, err, "UpdateOrder() error = %v", err)
+	assertVersion(3, "updated order")
+
+	err = store.SaveWithdrawal(ctx, &internal.Withdraw{ID: uuid.New(), CreateAt: time.Now(), Order: "2377225624", Sum: 10, UserID: userID}, nil)
+	assert.NoErrorf(t, err, "SaveWithdrawal() error = %v", err)
+	assertVersion(4, "withdrawal")
+	err = store.SaveWithdrawal(ctx, &internal.Withdraw{ID: uuid.New(), CreateAt: time.Now(), Order: "2377225624", Sum: 1000, UserID: userID}, nil)
+	assert.ErrorIs(t, err, errors2.ErrNotEnoughAmount)
+	assertVersion(4, "refused withdrawal")
+
+	_, err = store.GetUserVersion(ctx, uuid.New())
+	assert.ErrorIs(t, err, errors2.ErrUserNotFound)
+}
+
+func TestStore_RateLimits(t *testing.T) {
+	db, err := container.InitData()
+	if err != nil {
+		t.Skipf("TestStore_RateLimits %v", err)
+	}
+	ctx := context.Background()
+	store := &StoreImpl{
+		db: db,
+	}
+	limit := internal.RateLimit{Limit: 2, Period: time.Hour}
+
+	bucket, err := store.TakeRateToken(ctx, "orders:user:1", limit)
+	assert.NoErrorf(t, err, "TakeRateToken() error = %v", err)
+	assert.True(t, bucket.Allowed)
+	assert.InDelta(t, 1, bucket.Tokens, 0.01)
+	bucket, err = store.TakeRateToken(ctx, "orders:user:1", limit)
+	assert.NoErrorf(t, err, "TakeRateToken() error = %v", err)
+	assert.True(t, bucket.Allowed)
+	assert.InDelta(t, 0, bucket.Tokens, 0.01)
+	bucket, err = store.TakeRateToken(ctx, "orders:user:1", limit)
+	assert.NoErrorf(t, err, "TakeRateToken() error = %v", err)
+	assert.False(t, bucket.Allowed, "bucket is empty")
+	assert.InDelta(t, 0, bucket.Tokens, 0.01, "refused request doesn't take token")
+
+	bucket, err = store.TakeRateToken(ctx, "orders:user:2", limit)
+	assert.NoErrorf(t, err, "TakeRateToken() error = %v", err)
+	assert.True(t, bucket.Allowed, "another key has own bucket")
+
+	_, err = db.ExecContext(ctx, `UPDATE rate_limits SET update_at = update_at - INTERVAL '30 minutes' WHERE key = 'orders:user:1'`)
+	assert.NoError(t, err)
+	bucket, err = store.TakeRateToken(ctx, "orders:user:1", limit)
+	assert.NoErrorf(t, err, "TakeRateToken() error = %v", err)
+	assert.True(t, bucket.Allowed, "bucket is refilled")
+	assert.InDelta(t, 0, bucket.Tokens, 0.01)
+
+	_, err = db.ExecContext(ctx, `UPDATE rate_limits SET update_at = update_at - INTERVAL '2 hours' WHERE key = 'orders:user:2'`)
+	assert.NoError(t, err)
+	deleted, err := store.DeleteRateBuckets(ctx, time.Hour)
+	assert.NoErrorf(t, err, "DeleteRateBuckets() error = %v", err)
+	assert.Equal(t, int64(1), deleted)
+}
@@ -0,0 +1,132 @@
+package storetest
+
+import (
+	"context"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func newCampaign(name string, startsAt time.Time, endsAt time.Time) *internal.Campaign {
+	return &internal.Campaign{
+		ID:         uuid.New(),
+		CreateAt:   now(),
+		Name:       name,
+		Multiplier: 2,
+		StartsAt:   startsAt,
+		EndsAt:     endsAt,
+	}
+}
+
+func campaignNames(campaigns *[]internal.Campaign) []string {
+	names := make([]string, 0, len(*campaigns))
+	for _, campaign := range *campaigns {
+		names = append(names, campaign.Name)
+	}
+	return names
+}
+
+func testCampaigns(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	start := now()
+	november := newCampaign("november", start, start.Add(30*24*time.Hour))
+	november.Weekdays = "SAT,SUN"
+	november.NewUserDays = 30
+	november.MinAccrual = 10.5
+	november.Multiplier = 1.5
+	weekend := newCampaign("weekend", start.Add(3*24*time.Hour), start.Add(5*24*time.Hour))
+	for _, campaign := range []*internal.Campaign{weekend, november} {
+		require.NoError(t, store.AddCampaign(ctx, campaign))
+	}
+	assert.Error(t, store.AddCampaign(ctx, newCampaign("reversed", start, start.Add(-time.Hour))), "campaign ends before start")
+
+	found, err := store.GetCampaign(ctx, november.ID)
+	require.NoError(t, err)
+	assert.Equal(t, november.Name, found.Name)
+	assert.Equal(t, november.Multiplier, found.Multiplier)
+	assert.True(t, november.StartsAt.Equal(found.StartsAt))
+	assert.True(t, november.EndsAt.Equal(found.EndsAt))
+	assert.Equal(t, november.Weekdays, found.Weekdays)
+	assert.Equal(t, november.NewUserDays, found.NewUserDays)
+	assert.Equal(t, november.MinAccrual, found.MinAccrual)
+	_, err = store.GetCampaign(ctx, uuid.New())
+	assert.ErrorIs(t, err, errors2.ErrCampaignNotFound)
+
+	campaigns, err := store.GetCampaigns(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"november", "weekend"}, campaignNames(campaigns))
+
+	for _, tt := range []struct {
+		at   time.Time
+		want []string
+	}{
+		{at: start.Add(-time.Second), want: []string{}},
+		{at: start, want: []string{"november"}},
+		{at: start.Add(4 * 24 * time.Hour), want: []string{"november", "weekend"}},
+		{at: start.Add(5 * 24 * time.Hour), want: []string{"november"}},
+		{at: start.Add(30 * 24 * time.Hour), want: []string{}},
+	} {
+		active, err := store.GetActiveCampaigns(ctx, tt.at)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, campaignNames(active), "campaigns at %v", tt.at)
+	}
+
+	require.NoError(t, store.DeleteCampaign(ctx, weekend.ID))
+	assert.ErrorIs(t, store.DeleteCampaign(ctx, weekend.ID), errors2.ErrCampaignNotFound)
+	campaigns, err = store.GetCampaigns(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"november"}, campaignNames(campaigns))
+}
+
+// testCampaignBonus credits the accrual with the campaign bonus once, the order keeps
+// the bonus when the campaign is deleted.
+func testCampaignBonus(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 0)
+	campaign := newCampaign("double", now().Add(-time.Hour), now().Add(time.Hour))
+	require.NoError(t, store.AddCampaign(ctx, campaign))
+	_, err := store.AddOrder(ctx, newOrder(user.ID, "4539088167512356", now()))
+	require.NoError(t, err)
+
+	var calls int
+	rules := func(order *internal.Order, owner *internal.User, campaigns []internal.Campaign) (*internal.Campaign, float32) {
+		calls++
+		assert.Equal(t, float32(100), order.Accrual)
+		assert.Equal(t, user.ID, owner.ID)
+		require.Len(t, campaigns, 1)
+		return &campaigns[0], order.Accrual
+	}
+	processed := &internal.Order{Number: "4539088167512356", Status: internal.OrderStatusProcessed, Accrual: 100}
+	require.NoError(t, store.UpdateOrder(ctx, processed, nil, rules))
+	require.NoError(t, store.UpdateOrder(ctx, processed, nil, rules))
+	assert.Equal(t, 1, calls, "processed order isn't updated")
+	assert.Equal(t, float32(100), processed.Accrual, "order of the caller isn't changed")
+	assert.Equal(t, float32(200), bill(t, store, user.ID))
+
+	order, err := store.GetOrder(ctx, "4539088167512356")
+	require.NoError(t, err)
+	assert.Equal(t, float32(200), order.Accrual)
+	assert.Equal(t, float32(100), order.CampaignBonus)
+	assert.Equal(t, float32(100), order.BaseAccrual())
+	require.NotNil(t, order.CampaignID)
+	assert.Equal(t, campaign.ID, *order.CampaignID)
+
+	require.NoError(t, store.DeleteCampaign(ctx, campaign.ID))
+	orders, err := store.GetOrders(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, *orders, 1)
+	assert.Equal(t, float32(100), (*orders)[0].CampaignBonus)
+	assert.Nil(t, (*orders)[0].CampaignID)
+
+	_, err = store.AddOrder(ctx, newOrder(user.ID, "79927398713", now()))
+	require.NoError(t, err)
+	err = store.UpdateOrder(ctx, &internal.Order{Number: "79927398713", Status: internal.OrderStatusProcessed,
+		Accrual: 20, CampaignBonus: 10, CampaignID: &campaign.ID}, nil, nil)
+	assert.Error(t, err, "campaign is deleted")
+	assert.Equal(t, float32(200), bill(t, store, user.ID))
+}
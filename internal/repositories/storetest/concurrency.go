@@ -0,0 +1,212 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// parallel calls fn count times at once and returns the errors of the calls.
+func parallel(count int, fn func(i int) error) []error {
+	errs := make([]error, count)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = fn(i)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return errs
+}
+
+// testConcurrentWithdrawals races the withdrawals on one balance, only the withdrawals
+// covered by the balance are saved and the balance never becomes negative.
+func testConcurrentWithdrawals(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 100)
+
+	errs := parallel(10, func(i int) error {
+		return store.SaveWithdrawal(ctx, &internal.Withdraw{
+			ID: uuid.New(), CreateAt: now(), Order: strconv.Itoa(1000 + i), Sum: 30, UserID: user.ID,
+		}, nil)
+	})
+	var saved int
+	for _, err := range errs {
+		if err == nil {
+			saved++
+			continue
+		}
+		assert.ErrorIs(t, err, errors2.ErrNotEnoughAmount)
+	}
+	assert.Equal(t, 3, saved)
+	assert.Equal(t, float32(10), bill(t, store, user.ID))
+	withdrawals, err := store.GetWithdrawals(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Len(t, *withdrawals, 3)
+}
+
+// testConcurrentWithdrawalLimit races the withdrawals checked by the limit of rules, the
+// rules see the withdrawals of the period saved by the other calls, so the limit isn't exceeded.
+func testConcurrentWithdrawalLimit(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 1000)
+	require.NoError(t, store.SaveWithdrawal(ctx, &internal.Withdraw{
+		ID: uuid.New(), CreateAt: now().Add(-2 * time.Hour), Order: "999", Sum: 50, UserID: user.ID,
+	}, nil))
+	rules := func(_ *internal.User, withdrawn func(since time.Time) (float32, error)) error {
+		sum, err := withdrawn(now().Add(-time.Hour))
+		if err != nil {
+			return err
+		}
+		if sum+30 > 100 {
+			return errors2.ErrWithdrawalLimit
+		}
+		return nil
+	}
+
+	errs := parallel(10, func(i int) error {
+		return store.SaveWithdrawal(ctx, &internal.Withdraw{
+			ID: uuid.New(), CreateAt: now(), Order: strconv.Itoa(1000 + i), Sum: 30, UserID: user.ID,
+		}, rules)
+	})
+	var saved int
+	for _, err := range errs {
+		if err == nil {
+			saved++
+			continue
+		}
+		assert.ErrorIs(t, err, errors2.ErrWithdrawalLimit)
+	}
+	assert.Equal(t, 3, saved, "withdrawal before the period isn't counted")
+	assert.Equal(t, float32(860), bill(t, store, user.ID))
+	withdrawals, err := store.GetWithdrawals(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Len(t, *withdrawals, 4)
+}
+
+// testWithdrawalStress runs many withdrawals of different sums on one balance in several
+// rounds, the saved withdrawals never exceed the balance and match the bill left.
+func testWithdrawalStress(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	const rounds, workers = 5, 50
+	for round := 0; round < rounds; round++ {
+		user := addUser(t, store, 500)
+		errs := parallel(workers, func(i int) error {
+			return store.SaveWithdrawal(ctx, &internal.Withdraw{
+				ID: uuid.New(), CreateAt: now(), Order: strconv.Itoa(round*workers + i + 1), Sum: float32(i%7 + 10), UserID: user.ID,
+			}, nil)
+		})
+		var withdrawn float32
+		for i, err := range errs {
+			if err == nil {
+				withdrawn += float32(i%7 + 10)
+				continue
+			}
+			require.ErrorIs(t, err, errors2.ErrNotEnoughAmount)
+		}
+		left := bill(t, store, user.ID)
+		assert.GreaterOrEqual(t, left, float32(0), "round %d", round)
+		assert.Less(t, left, float32(16), "round %d, withdrawals are refused only for lack of amount", round)
+		assert.Equal(t, 500-withdrawn, left, "round %d", round)
+
+		withdrawals, err := store.GetWithdrawals(ctx, user.ID)
+		require.NoError(t, err)
+		var saved float32
+		for _, withdrawal := range *withdrawals {
+			saved += withdrawal.Sum
+		}
+		assert.Equal(t, withdrawn, saved, "round %d", round)
+	}
+}
+
+// testConcurrentDuplicateOrder uploads the same number by two users at once, only one of
+// them gets it and the other one is told the order belongs to another user.
+func testConcurrentDuplicateOrder(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	users := []*internal.User{addUser(t, store, 0), addUser(t, store, 0)}
+
+	for round := int64(0); round < 5; round++ {
+		number := strconv.FormatInt(79927398713+round*10, 10)
+		errs := parallel(2, func(i int) error {
+			_, err := store.AddOrder(ctx, newOrder(users[i].ID, number, now()))
+			return err
+		})
+		var added int
+		for _, err := range errs {
+			if err == nil {
+				added++
+				continue
+			}
+			assert.ErrorIs(t, err, errors2.ErrOrderIsExistAnotherUser)
+		}
+		assert.Equal(t, 1, added, "number %s", number)
+	}
+
+	var total int
+	for _, user := range users {
+		orders, err := store.GetOrders(ctx, user.ID)
+		require.NoError(t, err)
+		total += len(*orders)
+	}
+	assert.Equal(t, 5, total)
+}
+
+// testConcurrentUpdateOrder delivers the same PROCESSED state many times at once,
+// the bill is credited and the events are written once.
+func testConcurrentUpdateOrder(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 0)
+	_, err := store.AddOrder(ctx, newOrder(user.ID, "12345678903", now()))
+	require.NoError(t, err)
+
+	errs := parallel(10, func(i int) error {
+		return store.UpdateOrder(ctx, &internal.Order{
+			Number: "12345678903", Status: internal.OrderStatusProcessed, Accrual: 100, UpdateSource: internal.UpdateSourceCallback,
+		}, nil, nil)
+	})
+	require.NoError(t, errors.Join(errs...))
+	assert.Equal(t, float32(100), bill(t, store, user.ID))
+
+	events, err := store.GetUserEvents(ctx, user.ID, 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []internal.EventType{internal.EventOrderStatus, internal.EventBalanceChanged}, eventTypes(events))
+	assert.Len(t, outboxEvents(t, store, user.ID), 1)
+}
+
+// testConcurrentCreditReferral races the processed orders of one referee, the bonuses of the
+// referral are credited once.
+func testConcurrentCreditReferral(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	referrer := addUser(t, store, 0)
+	referee := addReferee(t, store, referrer)
+	orderNumbers := []string{"12345678903", "79927398713", "4539088167512356", "3536137811022331"}
+	for _, number := range orderNumbers {
+		_, err := store.AddOrder(ctx, newOrder(referee.ID, number, now()))
+		require.NoError(t, err)
+	}
+
+	rules := &referralRules{}
+	errs := parallel(len(orderNumbers), func(i int) error {
+		return store.UpdateOrder(ctx, &internal.Order{Number: orderNumbers[i], Status: internal.OrderStatusProcessed, Accrual: 10}, rules.credits, nil)
+	})
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), rules.calls.Load())
+	assert.Equal(t, float32(100), bill(t, store, referrer.ID))
+	assert.Equal(t, float32(90), bill(t, store, referee.ID))
+}
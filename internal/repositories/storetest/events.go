@@ -0,0 +1,348 @@
+package storetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func eventTypes(events *[]internal.UserEvent) []internal.EventType {
+	result := make([]internal.EventType, 0, len(*events))
+	for _, event := range *events {
+		result = append(result, event.Type)
+	}
+	return result
+}
+
+// outboxEvents claims the pending events and returns the ones of the user.
+func outboxEvents(t *testing.T, store repositories.Store, userID uuid.UUID) []internal.OutboxEvent {
+	t.Helper()
+	claimed, err := store.ClaimOutboxEvents(context.Background(), 100, time.Minute)
+	require.NoError(t, err)
+	events := make([]internal.OutboxEvent, 0)
+	for _, event := range *claimed {
+		if event.UserID == userID {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func testUserEvents(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 10)
+	other := addUser(t, store, 0)
+	_, err := store.AddOrder(ctx, newOrder(user.ID, "12345678903", now()))
+	require.NoError(t, err)
+
+	last, err := store.GetLastUserEventID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), last)
+
+	require.NoError(t, store.UpdateOrder(ctx, &internal.Order{Number: "12345678903", Status: internal.OrderStatusProcessing}, nil, nil))
+	require.NoError(t, store.UpdateOrder(ctx, &internal.Order{Number: "12345678903", Status: internal.OrderStatusProcessing}, nil, nil))
+	require.NoError(t, store.UpdateOrder(ctx, &internal.Order{Number: "12345678903", Status: internal.OrderStatusProcessed, Accrual: 20}, nil, nil))
+	require.NoError(t, store.SaveWithdrawal(ctx, &internal.Withdraw{ID: uuid.New(), CreateAt: now(), Order: "2377225624", Sum: 5, UserID: user.ID}, nil))
+
+	events, err := store.GetUserEvents(ctx, user.ID, 0, 100)
+	require.NoError(t, err)
+	require.Equal(t, []internal.EventType{
+		internal.EventOrderStatus, internal.EventOrderStatus, internal.EventBalanceChanged, internal.EventBalanceChanged,
+	}, eventTypes(events), "repeated status isn't written")
+	for i := 1; i < len(*events); i++ {
+		assert.Greater(t, (*events)[i].ID, (*events)[i-1].ID)
+	}
+
+	var status internal.OrderEventDto
+	require.NoError(t, json.Unmarshal((*events)[1].Payload, &status))
+	assert.Equal(t, internal.OrderEventDto{Order: "12345678903", Status: "PROCESSED", Accrual: 20}, status)
+	var balance internal.Balance
+	require.NoError(t, json.Unmarshal((*events)[3].Payload, &balance))
+	assert.Equal(t, internal.Balance{Current: 25, Withdrawn: 5}, balance)
+
+	after, err := store.GetUserEvents(ctx, user.ID, (*events)[0].ID, 2)
+	require.NoError(t, err)
+	require.Len(t, *after, 2)
+	assert.Equal(t, (*events)[1].ID, (*after)[0].ID)
+
+	last, err = store.GetLastUserEventID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, (*events)[3].ID, last)
+	otherEvents, err := store.GetUserEvents(ctx, other.ID, 0, 100)
+	require.NoError(t, err)
+	assert.Empty(t, *otherEvents)
+}
+
+// testUserEventIDs checks the ids of the events are numbered per user without gaps when
+// the events are written at once, and aren't used again after the events are deleted.
+func testUserEventIDs(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 1000)
+	other := addUser(t, store, 100)
+	require.NoError(t, store.SaveWithdrawal(ctx, &internal.Withdraw{ID: uuid.New(), CreateAt: now(), Order: "2377225624", Sum: 1, UserID: other.ID}, nil))
+
+	const count = 20
+	errs := parallel(count, func(i int) error {
+		return store.SaveWithdrawal(ctx, &internal.Withdraw{
+			ID: uuid.New(), CreateAt: now(), Order: strconv.Itoa(1000 + i), Sum: 1, UserID: user.ID,
+		}, nil)
+	})
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+	events, err := store.GetUserEvents(ctx, user.ID, 0, 100)
+	require.NoError(t, err)
+	require.Len(t, *events, count)
+	for i, event := range *events {
+		assert.Equal(t, int64(i+1), event.ID, "ids of the user have no gaps")
+	}
+	otherEvents, err := store.GetUserEvents(ctx, other.ID, 0, 100)
+	require.NoError(t, err)
+	require.Len(t, *otherEvents, 1)
+	assert.Equal(t, int64(1), (*otherEvents)[0].ID, "ids are numbered per user")
+
+	deleted, err := store.DeleteUserEvents(ctx, now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), deleted, "new events are kept")
+	deleted, err = store.DeleteUserEvents(ctx, now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(count+1), deleted)
+	events, err = store.GetUserEvents(ctx, user.ID, 0, 100)
+	require.NoError(t, err)
+	assert.Empty(t, *events)
+
+	last, err := store.GetLastUserEventID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(count), last, "last id is kept after the events are deleted")
+	require.NoError(t, store.SaveWithdrawal(ctx, &internal.Withdraw{ID: uuid.New(), CreateAt: now(), Order: "2377225632", Sum: 1, UserID: user.ID}, nil))
+	events, err = store.GetUserEvents(ctx, user.ID, last, 100)
+	require.NoError(t, err)
+	require.Len(t, *events, 1)
+	assert.Equal(t, int64(count+1), (*events)[0].ID, "deleted ids aren't used again")
+}
+
+// testListenUserEvents writes the events until the listener is notified, since the
+// listener may start to listen after the first of them.
+func testListenUserEvents(t *testing.T, store repositories.Store) {
+	ctx, cancel := context.WithCancel(context.Background())
+	user := addUser(t, store, 0)
+
+	var mu sync.Mutex
+	notified := make(map[uuid.UUID]bool)
+	done := make(chan error)
+	go func() {
+		done <- store.ListenUserEvents(ctx, func(userID uuid.UUID) {
+			mu.Lock()
+			defer mu.Unlock()
+			notified[userID] = true
+		})
+	}()
+
+	number := int64(79927398713)
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		ok := notified[user.ID]
+		mu.Unlock()
+		if ok {
+			return true
+		}
+		number += 10
+		_, err := store.AddOrder(context.Background(), newOrder(user.ID, strconv.FormatInt(number, 10), now()))
+		assert.NoError(t, err)
+		err = store.UpdateOrder(context.Background(), &internal.Order{Number: strconv.FormatInt(number, 10), Status: internal.OrderStatusInvalid}, nil, nil)
+		assert.NoError(t, err)
+		return false
+	}, 5*time.Second, 50*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("ListenUserEvents isn't stopped by ctx")
+	}
+}
+
+func testOutbox(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 100)
+	_, err := store.AddOrder(ctx, newOrder(user.ID, "12345678903", now()))
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateOrder(ctx, &internal.Order{Number: "12345678903", Status: internal.OrderStatusProcessing}, nil, nil))
+	require.NoError(t, store.UpdateOrder(ctx, &internal.Order{Number: "12345678903", Status: internal.OrderStatusProcessed, Accrual: 10}, nil, nil))
+	require.NoError(t, store.SaveWithdrawal(ctx, &internal.Withdraw{ID: uuid.New(), CreateAt: now(), Order: "2377225624", Sum: 5, UserID: user.ID}, nil))
+
+	events := outboxEvents(t, store, user.ID)
+	require.Len(t, events, 2, "PROCESSING isn't written to outbox")
+	types := map[internal.EventType]internal.OutboxEvent{}
+	for _, event := range events {
+		assert.Equal(t, internal.OutboxStatusPending, event.Status)
+		assert.True(t, event.NextAttemptAt.After(time.Now()), "claimed event is leased")
+		types[event.Type] = event
+	}
+	require.Contains(t, types, internal.EventOrderProcessed)
+	require.Contains(t, types, internal.EventWithdrawal)
+	var withdrawal internal.WithdrawalEventDto
+	require.NoError(t, json.Unmarshal(types[internal.EventWithdrawal].Payload, &withdrawal))
+	assert.Equal(t, internal.WithdrawalEventDto{Order: "2377225624", Sum: 5}, withdrawal)
+
+	assert.Empty(t, outboxEvents(t, store, user.ID), "leased events aren't claimed again")
+
+	dead := types[internal.EventOrderProcessed]
+	dead.Status = internal.OutboxStatusDead
+	dead.Attempts = 10
+	dead.LastError = "connection refused"
+	attempts := []internal.OutboxAttempt{{ID: uuid.New(), EventID: dead.ID, AttemptAt: now(), Sink: "webhook", Error: "connection refused"}}
+	require.NoError(t, store.SaveOutboxDelivery(ctx, &dead, &attempts))
+
+	retry := types[internal.EventWithdrawal]
+	retry.Attempts = 1
+	retry.NextAttemptAt = now().Add(-time.Second)
+	require.NoError(t, store.SaveOutboxDelivery(ctx, &retry, &[]internal.OutboxAttempt{}))
+
+	deadLetters, err := store.GetDeadLetters(ctx)
+	require.NoError(t, err)
+	require.Len(t, *deadLetters, 1)
+	assert.Equal(t, dead.ID, (*deadLetters)[0].ID)
+	assert.Equal(t, 10, (*deadLetters)[0].Attempts)
+	assert.Equal(t, "connection refused", (*deadLetters)[0].LastError)
+
+	claimed := outboxEvents(t, store, user.ID)
+	require.Len(t, claimed, 1, "event is claimed again after its retry time")
+	assert.Equal(t, retry.ID, claimed[0].ID)
+	assert.Equal(t, 1, claimed[0].Attempts)
+
+	delivered := claimed[0]
+	deliveredAt := now()
+	delivered.Status = internal.OutboxStatusDelivered
+	delivered.NextAttemptAt = now().Add(-time.Second)
+	delivered.DeliveredAt = &deliveredAt
+	require.NoError(t, store.SaveOutboxDelivery(ctx, &delivered, &[]internal.OutboxAttempt{}))
+	assert.Empty(t, outboxEvents(t, store, user.ID), "delivered event isn't claimed")
+}
+
+func testRateLimits(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	limit := internal.RateLimit{Limit: 2, Period: time.Hour}
+
+	for i, want := range []struct {
+		allowed bool
+		tokens  float64
+	}{{true, 1}, {true, 0}, {false, 0}} {
+		bucket, err := store.TakeRateToken(ctx, "ip:1", limit)
+		require.NoError(t, err)
+		assert.Equal(t, want.allowed, bucket.Allowed, "request %d", i)
+		assert.InDelta(t, want.tokens, bucket.Tokens, 0.01, "request %d", i)
+	}
+	bucket, err := store.TakeRateToken(ctx, "ip:2", limit)
+	require.NoError(t, err)
+	assert.True(t, bucket.Allowed, "buckets are separated by key")
+
+	deleted, err := store.DeleteRateBuckets(ctx, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), deleted)
+	time.Sleep(50 * time.Millisecond)
+	deleted, err = store.DeleteRateBuckets(ctx, time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	bucket, err = store.TakeRateToken(ctx, "ip:1", limit)
+	require.NoError(t, err)
+	assert.True(t, bucket.Allowed, "deleted bucket is full")
+	assert.InDelta(t, 1, bucket.Tokens, 0.01)
+}
+
+func testUserVersion(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 100)
+	version := func() int64 {
+		t.Helper()
+		v, err := store.GetUserVersion(ctx, user.ID)
+		require.NoError(t, err)
+		return v
+	}
+	assert.Equal(t, int64(0), version())
+
+	_, err := store.AddOrder(ctx, newOrder(user.ID, "12345678903", now()))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version())
+
+	batch := []internal.Order{*newOrder(user.ID, "79927398713", now()), *newOrder(user.ID, "4561261212345467", now())}
+	_, err = store.AddOrders(ctx, &batch)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version(), "batch bumps the version once")
+	_, err = store.AddOrders(ctx, &batch)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version(), "batch of known orders doesn't bump the version")
+
+	require.NoError(t, store.UpdateOrder(ctx, &internal.Order{Number: "79927398713", Status: internal.OrderStatusProcessing}, nil, nil))
+	assert.Equal(t, int64(3), version())
+	require.NoError(t, store.UpdateOrder(ctx, &internal.Order{Number: "79927398713", Status: internal.OrderStatusProcessing}, nil, nil))
+	assert.Equal(t, int64(3), version(), "repeated identical state doesn't bump the version")
+
+	require.NoError(t, store.UpdateOrder(ctx, &internal.Order{Number: "12345678903", Status: internal.OrderStatusInvalid}, nil, nil))
+	assert.Equal(t, int64(4), version())
+	require.NoError(t, store.UpdateOrder(ctx, &internal.Order{Number: "12345678903", Status: internal.OrderStatusProcessed}, nil, nil))
+	assert.Equal(t, int64(4), version(), "final order isn't changed")
+
+	require.NoError(t, store.SaveWithdrawal(ctx, &internal.Withdraw{ID: uuid.New(), CreateAt: now(), Order: "2377225624", Sum: 10, UserID: user.ID}, nil))
+	assert.Equal(t, int64(5), version())
+	err = store.SaveWithdrawal(ctx, &internal.Withdraw{ID: uuid.New(), CreateAt: now(), Order: "2377225632", Sum: 1000, UserID: user.ID}, nil)
+	assert.ErrorIs(t, err, errors2.ErrNotEnoughAmount)
+	assert.Equal(t, int64(5), version())
+
+	_, err = store.GetUserVersion(ctx, uuid.New())
+	assert.ErrorIs(t, err, errors2.ErrUserNotFound)
+}
+
+func testStatement(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 100)
+	start := now()
+	require.NoError(t, store.SaveWithdrawal(ctx, &internal.Withdraw{
+		ID: uuid.New(), CreateAt: start.Add(-2 * time.Hour), Order: "2377225624", Sum: 10, UserID: user.ID,
+	}, nil))
+	_, err := store.AddOrder(ctx, newOrder(user.ID, "12345678903", start.Add(-3*time.Hour)))
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateOrder(ctx, &internal.Order{Number: "12345678903", Status: internal.OrderStatusProcessed, Accrual: 50}, nil, nil))
+	_, err = store.AddOrder(ctx, newOrder(user.ID, "79927398713", start))
+	require.NoError(t, err)
+	require.NoError(t, store.SaveWithdrawal(ctx, &internal.Withdraw{
+		ID: uuid.New(), CreateAt: start.Add(time.Hour), Order: "2377225632", Sum: 20, UserID: user.ID,
+	}, nil))
+
+	var entries []internal.StatementEntry
+	err = store.GetStatement(ctx, user.ID, start.Add(-time.Hour), start.Add(2*time.Hour), func(entry *internal.StatementEntry) error {
+		entries = append(entries, *entry)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, 2, "withdrawal before the period and not processed order are skipped")
+	assert.Equal(t, internal.StatementAccrual, entries[0].Operation)
+	assert.Equal(t, "12345678903", entries[0].Order)
+	assert.Equal(t, float32(50), entries[0].Amount)
+	assert.Equal(t, float32(40), entries[0].Balance, "balance is counted from the first operation")
+	assert.Equal(t, internal.StatementWithdrawal, entries[1].Operation)
+	assert.Equal(t, float32(-20), entries[1].Amount)
+	assert.Equal(t, float32(20), entries[1].Balance)
+	assert.True(t, entries[1].Date.Equal(start.Add(time.Hour)))
+
+	errStop := errors.New("stop")
+	var calls int
+	err = store.GetStatement(ctx, user.ID, start.Add(-time.Hour), start.Add(2*time.Hour), func(entry *internal.StatementEntry) error {
+		calls++
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, 1, calls)
+}
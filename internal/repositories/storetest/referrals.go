@@ -0,0 +1,227 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func referralCode() string {
+	return strings.ToUpper(strings.ReplaceAll(uuid.NewString(), "-", "")[:12])
+}
+
+// addReferee adds the user registered with the referral code of the referrer.
+func addReferee(t *testing.T, store repositories.Store, referrer *internal.User) *internal.User {
+	t.Helper()
+	user := &internal.User{
+		ID:           uuid.New(),
+		CreateAt:     now(),
+		Login:        "referee-" + uuid.NewString(),
+		Password:     "password",
+		ReferralCode: referralCode(),
+		ReferredBy:   &referrer.ID,
+	}
+	require.NoError(t, store.AddUser(context.Background(), user))
+	return user
+}
+
+// processOrder adds the order of the user and moves it to PROCESSED with accrual, the referral
+// of the user is credited by referral.
+func processOrder(t *testing.T, store repositories.Store, userID uuid.UUID, number string, accrual float32,
+	referral repositories.ReferralRules) {
+	t.Helper()
+	ctx := context.Background()
+	_, err := store.AddOrder(ctx, newOrder(userID, number, now()))
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateOrder(ctx, &internal.Order{Number: number, Status: internal.OrderStatusProcessed, Accrual: accrual}, referral, nil))
+}
+
+// referralRules credits 100 to the referrer and 50 to the referee and counts its calls.
+type referralRules struct {
+	calls    atomic.Int32
+	referral internal.Referral
+}
+
+func (r *referralRules) credits(referral *internal.Referral) (*[]internal.ReferralCredit, error) {
+	r.calls.Add(1)
+	r.referral = *referral
+	return &[]internal.ReferralCredit{
+		{ID: uuid.New(), CreateAt: now(), UserID: referral.Referrer.ID, RefereeID: referral.Referee.ID,
+			Role: internal.ReferralRoleReferrer, Order: referral.Order.Number, Sum: 100},
+		{ID: uuid.New(), CreateAt: now(), UserID: referral.Referee.ID, RefereeID: referral.Referee.ID,
+			Role: internal.ReferralRoleReferee, Order: referral.Order.Number, Sum: 50},
+	}, nil
+}
+
+func testReferralCodes(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	referrer := addUser(t, store, 0)
+	referee := addReferee(t, store, referrer)
+	addReferee(t, store, referrer)
+
+	found, err := store.FindUserByReferralCode(ctx, referrer.ReferralCode)
+	require.NoError(t, err)
+	assert.Equal(t, referrer.ID, found.ID)
+	assert.Nil(t, found.ReferredBy)
+
+	found, err = store.FindUserByReferralCode(ctx, referee.ReferralCode)
+	require.NoError(t, err)
+	require.NotNil(t, found.ReferredBy)
+	assert.Equal(t, referrer.ID, *found.ReferredBy)
+
+	_, err = store.FindUserByReferralCode(ctx, referralCode())
+	assert.ErrorIs(t, err, errors2.ErrUserNotFound)
+
+	err = store.AddUser(ctx, &internal.User{ID: uuid.New(), CreateAt: now(), Login: "user-" + uuid.NewString(),
+		Password: "password", ReferralCode: referrer.ReferralCode})
+	assert.Error(t, err, "referral code is unique")
+
+	count, err := store.CountReferees(ctx, referrer.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	count, err = store.CountReferees(ctx, referee.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+// testCreditReferral credits the referral once with the processed order of the
+// referee, the bonuses are added to the bills and are traced in the statement and the events.
+func testCreditReferral(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	referrer := addUser(t, store, 0)
+	referee := addReferee(t, store, referrer)
+	rules := &referralRules{}
+
+	_, err := store.AddOrder(ctx, newOrder(referee.ID, "12345678903", now()))
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateOrder(ctx, &internal.Order{Number: "12345678903", Status: internal.OrderStatusProcessing}, rules.credits, nil))
+	assert.Equal(t, int32(0), rules.calls.Load(), "order isn't processed")
+
+	version, err := store.GetUserVersion(ctx, referrer.ID)
+	require.NoError(t, err)
+	processed := &internal.Order{Number: "12345678903", Status: internal.OrderStatusProcessed, Accrual: 10}
+	require.NoError(t, store.UpdateOrder(ctx, processed, rules.credits, nil))
+	assert.Equal(t, int32(1), rules.calls.Load())
+	assert.Equal(t, referrer.ID, rules.referral.Referrer.ID)
+	assert.Equal(t, referee.ID, rules.referral.Referee.ID)
+	assert.Equal(t, "12345678903", rules.referral.Order.Number)
+	assert.Equal(t, float32(10), rules.referral.Order.Accrual)
+	assert.Empty(t, rules.referral.ReferrerCredits)
+	assert.Equal(t, float32(100), bill(t, store, referrer.ID))
+	assert.Equal(t, float32(60), bill(t, store, referee.ID))
+	next, err := store.GetUserVersion(ctx, referrer.ID)
+	require.NoError(t, err)
+	assert.Greater(t, next, version)
+
+	require.NoError(t, store.UpdateOrder(ctx, processed, rules.credits, nil))
+	processOrder(t, store, referee.ID, "79927398713", 20, rules.credits)
+	assert.Equal(t, int32(1), rules.calls.Load(), "referral is credited once")
+	assert.Equal(t, float32(100), bill(t, store, referrer.ID))
+	assert.Equal(t, float32(80), bill(t, store, referee.ID))
+
+	referrerCredits, err := store.GetReferralCredits(ctx, referrer.ID)
+	require.NoError(t, err)
+	require.Len(t, *referrerCredits, 1)
+	assert.Equal(t, internal.ReferralRoleReferrer, (*referrerCredits)[0].Role)
+	assert.Equal(t, referee.ID, (*referrerCredits)[0].RefereeID)
+	assert.Equal(t, "12345678903", (*referrerCredits)[0].Order)
+	assert.Equal(t, float32(100), (*referrerCredits)[0].Sum)
+	refereeCredits, err := store.GetReferralCredits(ctx, referee.ID)
+	require.NoError(t, err)
+	require.Len(t, *refereeCredits, 1)
+	assert.Equal(t, internal.ReferralRoleReferee, (*refereeCredits)[0].Role)
+
+	var entries []internal.StatementEntry
+	err = store.GetStatement(ctx, referrer.ID, now().Add(-time.Hour), now().Add(time.Hour), func(entry *internal.StatementEntry) error {
+		entries = append(entries, *entry)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, internal.StatementReferral, entries[0].Operation)
+	assert.Equal(t, "12345678903", entries[0].Order)
+	assert.Equal(t, float32(100), entries[0].Amount)
+	assert.Equal(t, float32(100), entries[0].Balance)
+
+	events, err := store.GetUserEvents(ctx, referrer.ID, 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []internal.EventType{internal.EventBalanceChanged}, eventTypes(events))
+	outbox := outboxEvents(t, store, referrer.ID)
+	require.Len(t, outbox, 1)
+	assert.Equal(t, internal.EventReferralCredited, outbox[0].Type)
+	assert.JSONEq(t, `{"role":"REFERRER","order":"12345678903","sum":100}`, string(outbox[0].Payload))
+}
+
+// testCreditReferralRefused doesn't credit the referral refused by the rules and the user
+// who hasn't been referred, the order is credited anyway and the refused referral is checked
+// again with the next processed order. The rules see the bonuses credited to the referrer already.
+func testCreditReferralRefused(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	referrer := addUser(t, store, 0)
+	user := addUser(t, store, 0)
+	rules := &referralRules{}
+	processOrder(t, store, user.ID, "12345678903", 10, rules.credits)
+	assert.Equal(t, int32(0), rules.calls.Load(), "user isn't referred")
+
+	refused := addReferee(t, store, referrer)
+	processOrder(t, store, refused.ID, "79927398713", 10, func(referral *internal.Referral) (*[]internal.ReferralCredit, error) {
+		return nil, fmt.Errorf("limit, %w", errors2.ErrReferralRefused)
+	})
+	assert.Equal(t, float32(0), bill(t, store, referrer.ID))
+	assert.Equal(t, float32(10), bill(t, store, refused.ID))
+	refusedCredits, err := store.GetReferralCredits(ctx, refused.ID)
+	require.NoError(t, err)
+	assert.Empty(t, *refusedCredits)
+
+	processOrder(t, store, refused.ID, "4026843483168683", 10, rules.credits)
+	assert.Equal(t, "4026843483168683", rules.referral.Order.Number, "refused referral is checked with the next order")
+	assert.Equal(t, float32(70), bill(t, store, refused.ID))
+
+	for i, number := range []string{"4539088167512356", "3536137811022331"} {
+		referee := addReferee(t, store, referrer)
+		processOrder(t, store, referee.ID, number, 10, rules.credits)
+		assert.Len(t, rules.referral.ReferrerCredits, i+1)
+	}
+	assert.Equal(t, float32(300), bill(t, store, referrer.ID))
+}
+
+// testCreditReferralFailed rolls back the credit of the order when the rules fail, so the
+// order isn't credited without its referral and the next update credits both.
+func testCreditReferralFailed(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	referrer := addUser(t, store, 0)
+	referee := addReferee(t, store, referrer)
+	_, err := store.AddOrder(ctx, newOrder(referee.ID, "12345678903", now()))
+	require.NoError(t, err)
+	version, err := store.GetUserVersion(ctx, referee.ID)
+	require.NoError(t, err)
+
+	processed := &internal.Order{Number: "12345678903", Status: internal.OrderStatusProcessed, Accrual: 10}
+	err = store.UpdateOrder(ctx, processed, func(referral *internal.Referral) (*[]internal.ReferralCredit, error) {
+		return nil, errors.New("rules are failed")
+	}, nil)
+	require.Error(t, err)
+	order, err := store.GetOrder(ctx, "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, internal.OrderStatusNew, order.Status)
+	assert.Nil(t, order.CreditedAt)
+	assert.Equal(t, float32(0), bill(t, store, referee.ID))
+	next, err := store.GetUserVersion(ctx, referee.ID)
+	require.NoError(t, err)
+	assert.Equal(t, version, next)
+
+	rules := &referralRules{}
+	require.NoError(t, store.UpdateOrder(ctx, processed, rules.credits, nil))
+	assert.Equal(t, float32(100), bill(t, store, referrer.ID))
+	assert.Equal(t, float32(60), bill(t, store, referee.ID))
+}
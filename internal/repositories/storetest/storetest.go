@@ -0,0 +1,451 @@
+// Package storetest is the conformance suite of repositories.Store, every implementation
+// of the store runs it to prove it has the semantics expected by the services.
+package storetest
+
+import (
+	"context"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// Factory returns the empty store, it's called for every test of the suite.
+type Factory func(t *testing.T) repositories.Store
+
+// Run runs the suite against the stores returned by newStore. The suite covers every
+// method of repositories.Store, a new method of the store needs a test here.
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store repositories.Store)
+	}{
+		{name: "CheckConnection", test: testCheckConnection},
+		{name: "Users", test: testUsers},
+		{name: "UserVersion", test: testUserVersion},
+		{name: "AddOrder", test: testAddOrder},
+		{name: "AddOrders", test: testAddOrders},
+		{name: "UpdateOrder", test: testUpdateOrder},
+		{name: "UpdateOrderIdempotent", test: testUpdateOrderIdempotent},
+		{name: "GetOrder", test: testGetOrder},
+		{name: "TextOrderNumbers", test: testTextOrderNumbers},
+		{name: "OrderHistory", test: testOrderHistory},
+		{name: "OrderChecks", test: testOrderChecks},
+		{name: "OrderWithdrawals", test: testOrderWithdrawals},
+		{name: "SaveWithdrawal", test: testSaveWithdrawal},
+		{name: "Statement", test: testStatement},
+		{name: "Outbox", test: testOutbox},
+		{name: "Webhooks", test: testWebhooks},
+		{name: "WebhookDeliveries", test: testWebhookDeliveries},
+		{name: "UserEvents", test: testUserEvents},
+		{name: "UserEventIDs", test: testUserEventIDs},
+		{name: "ListenUserEvents", test: testListenUserEvents},
+		{name: "RateLimits", test: testRateLimits},
+		{name: "ConcurrentWithdrawals", test: testConcurrentWithdrawals},
+		{name: "ConcurrentWithdrawalLimit", test: testConcurrentWithdrawalLimit},
+		{name: "WithdrawalStress", test: testWithdrawalStress},
+		{name: "ConcurrentDuplicateOrder", test: testConcurrentDuplicateOrder},
+		{name: "ConcurrentUpdateOrder", test: testConcurrentUpdateOrder},
+		{name: "ReferralCodes", test: testReferralCodes},
+		{name: "CreditReferral", test: testCreditReferral},
+		{name: "CreditReferralRefused", test: testCreditReferralRefused},
+		{name: "CreditReferralFailed", test: testCreditReferralFailed},
+		{name: "ConcurrentCreditReferral", test: testConcurrentCreditReferral},
+		{name: "Campaigns", test: testCampaigns},
+		{name: "CampaignBonus", test: testCampaignBonus},
+		{name: "Tiers", test: testTiers},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStore(t))
+		})
+	}
+}
+
+// now is truncated to the precision of the timestamps of Postgres.
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+func addUser(t *testing.T, store repositories.Store, bill float32) *internal.User {
+	t.Helper()
+	user := &internal.User{
+		ID:           uuid.New(),
+		CreateAt:     now(),
+		Login:        "user-" + uuid.NewString(),
+		Password:     "password",
+		Bill:         bill,
+		ReferralCode: referralCode(),
+	}
+	require.NoError(t, store.AddUser(context.Background(), user))
+	return user
+}
+
+func newOrder(userID uuid.UUID, number string, createAt time.Time) *internal.Order {
+	return &internal.Order{
+		ID:       uuid.New(),
+		CreateAt: createAt,
+		Number:   number,
+		Status:   internal.OrderStatusNew,
+		UserID:   userID,
+	}
+}
+
+func numbers(orders *[]internal.Order) []string {
+	result := make([]string, 0, len(*orders))
+	for _, order := range *orders {
+		result = append(result, order.Number)
+	}
+	return result
+}
+
+func bill(t *testing.T, store repositories.Store, userID uuid.UUID) float32 {
+	t.Helper()
+	user, err := store.GetUser(context.Background(), userID)
+	require.NoError(t, err)
+	return user.Bill
+}
+
+func testCheckConnection(t *testing.T, store repositories.Store) {
+	assert.NoError(t, store.CheckConnection())
+}
+
+func testUsers(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 10)
+
+	err := store.AddUser(ctx, &internal.User{ID: uuid.New(), CreateAt: now(), Login: user.Login, Password: "other",
+		ReferralCode: referralCode()})
+	assert.ErrorIs(t, err, errors2.ErrUserIsExist)
+
+	found, err := store.FindUserByLogin(ctx, user.Login)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, found.ID)
+	assert.Equal(t, user.Password, found.Password)
+	assert.Equal(t, user.Bill, found.Bill)
+
+	_, err = store.FindUserByLogin(ctx, "unknown")
+	assert.ErrorIs(t, err, errors2.ErrUserNotFound)
+
+	got, err := store.GetUser(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.Login, got.Login)
+	assert.True(t, user.CreateAt.Equal(got.CreateAt))
+
+	_, err = store.GetUser(ctx, uuid.New())
+	assert.Error(t, err)
+}
+
+func testAddOrder(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user1 := addUser(t, store, 0)
+	user2 := addUser(t, store, 0)
+	start := now()
+
+	order := newOrder(user1.ID, "12345678903", start)
+	added, err := store.AddOrder(ctx, order)
+	require.NoError(t, err)
+	assert.Equal(t, order.Number, added.Number)
+
+	_, err = store.AddOrder(ctx, newOrder(user1.ID, order.Number, start))
+	assert.ErrorIs(t, err, errors2.ErrOrderIsExistThisUser)
+	_, err = store.AddOrder(ctx, newOrder(user2.ID, order.Number, start))
+	assert.ErrorIs(t, err, errors2.ErrOrderIsExistAnotherUser)
+	_, err = store.AddOrder(ctx, newOrder(uuid.New(), "79927398713", start))
+	assert.Error(t, err, "order of unknown user")
+
+	_, err = store.AddOrder(ctx, newOrder(user1.ID, "4561261212345467", start.Add(time.Second)))
+	require.NoError(t, err)
+	orders, err := store.GetOrders(ctx, user1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"4561261212345467", "12345678903"}, numbers(orders), "newest order first")
+	orders, err = store.GetOrders(ctx, user2.ID)
+	require.NoError(t, err)
+	assert.Empty(t, *orders)
+}
+
+func testAddOrders(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user1 := addUser(t, store, 0)
+	user2 := addUser(t, store, 0)
+	_, err := store.AddOrder(ctx, newOrder(user2.ID, "12345678903", now()))
+	require.NoError(t, err)
+
+	batch := []internal.Order{
+		*newOrder(user1.ID, "79927398713", now()),
+		*newOrder(user1.ID, "12345678903", now()),
+		*newOrder(user1.ID, "79927398713", now()),
+	}
+	exist, err := store.AddOrders(ctx, &batch)
+	require.NoError(t, err)
+	require.Len(t, *exist, 2)
+	assert.Equal(t, user2.ID, (*exist)[0].UserID, "order of another user")
+	assert.Equal(t, user1.ID, (*exist)[1].UserID, "duplicate in the batch")
+
+	orders, err := store.GetOrders(ctx, user1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"79927398713"}, numbers(orders))
+
+	batch = []internal.Order{
+		*newOrder(user1.ID, "4561261212345467", now()),
+		*newOrder(uuid.New(), "4561261212345475", now()),
+	}
+	_, err = store.AddOrders(ctx, &batch)
+	assert.Error(t, err, "batch with unknown user")
+	orders, err = store.GetOrders(ctx, user1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"79927398713"}, numbers(orders), "failed batch isn't saved")
+}
+
+func testUpdateOrder(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 10)
+	_, err := store.AddOrder(ctx, newOrder(user.ID, "12345678903", now()))
+	require.NoError(t, err)
+
+	processing := &internal.Order{Number: "12345678903", Status: internal.OrderStatusProcessing, UpdateSource: internal.UpdateSourcePoll}
+	require.NoError(t, store.UpdateOrder(ctx, processing, nil, nil))
+	notProcessed, err := store.GetOrdersNotProcessed(ctx)
+	require.NoError(t, err)
+	require.Len(t, *notProcessed, 1)
+	assert.Equal(t, internal.OrderStatusProcessing, (*notProcessed)[0].Status)
+	assert.Nil(t, (*notProcessed)[0].CreditedAt)
+	assert.Equal(t, internal.UpdateSourcePoll, (*notProcessed)[0].UpdateSource)
+	assert.NotNil(t, (*notProcessed)[0].UpdateAt)
+
+	processed := &internal.Order{Number: "12345678903", Status: internal.OrderStatusProcessed, Accrual: 500.5, UpdateSource: internal.UpdateSourceCallback}
+	require.NoError(t, store.UpdateOrder(ctx, processed, nil, nil))
+	assert.Equal(t, float32(510.5), bill(t, store, user.ID))
+	notProcessed, err = store.GetOrdersNotProcessed(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, *notProcessed)
+
+	orders, err := store.GetOrders(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, *orders, 1)
+	assert.Equal(t, internal.OrderStatusProcessed, (*orders)[0].Status)
+	assert.Equal(t, float32(500.5), (*orders)[0].Accrual)
+
+	require.NoError(t, store.UpdateOrder(ctx, &internal.Order{Number: "79927398713", Status: internal.OrderStatusProcessed, Accrual: 1}, nil, nil),
+		"unknown order is skipped")
+}
+
+func testGetOrder(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 0)
+	order := newOrder(user.ID, "12345678903", now())
+	_, err := store.AddOrder(ctx, order)
+	require.NoError(t, err)
+
+	found, err := store.GetOrder(ctx, "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, order.ID, found.ID)
+	assert.Equal(t, user.ID, found.UserID)
+	assert.Equal(t, internal.OrderStatusNew, found.Status)
+	assert.True(t, order.CreateAt.Equal(found.CreateAt))
+
+	_, err = store.GetOrder(ctx, "79927398713")
+	assert.ErrorIs(t, err, errors2.ErrOrderNotFound)
+}
+
+// testTextOrderNumbers stores the alphanumeric numbers and the numbers longer than int64
+// as they are, the withdrawals are found by the same text number.
+func testTextOrderNumbers(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 100)
+	for _, number := range []string{"MP-AB12345678901234567890", "123456789012345678901234567894", "00012345"} {
+		_, err := store.AddOrder(ctx, newOrder(user.ID, number, now()))
+		require.NoError(t, err)
+
+		found, err := store.GetOrder(ctx, number)
+		require.NoError(t, err)
+		assert.Equal(t, number, found.Number)
+	}
+	_, err := store.GetOrder(ctx, "12345")
+	assert.ErrorIs(t, err, errors2.ErrOrderNotFound)
+
+	require.NoError(t, store.SaveWithdrawal(ctx, &internal.Withdraw{ID: uuid.New(), CreateAt: now(),
+		Order: "MP-AB12345678901234567890", Sum: 10, UserID: user.ID}, nil))
+	withdrawals, err := store.GetOrderWithdrawals(ctx, user.ID, "MP-AB12345678901234567890")
+	require.NoError(t, err)
+	require.Len(t, *withdrawals, 1)
+	assert.Equal(t, "MP-AB12345678901234567890", (*withdrawals)[0].Order)
+}
+
+// testOrderHistory moves the order by the allowed transitions only, the transition out of
+// the final status and the repeated status aren't written to the history.
+func testOrderHistory(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 0)
+	order := newOrder(user.ID, "12345678903", now())
+	_, err := store.AddOrder(ctx, order)
+	require.NoError(t, err)
+	batch := []internal.Order{*newOrder(user.ID, "79927398713", now())}
+	_, err = store.AddOrders(ctx, &batch)
+	require.NoError(t, err)
+
+	for _, update := range []internal.Order{
+		{Number: "12345678903", Status: internal.OrderStatusProcessing, UpdateSource: internal.UpdateSourcePoll},
+		{Number: "12345678903", Status: internal.OrderStatusProcessing, UpdateSource: internal.UpdateSourceCallback},
+		{Number: "12345678903", Status: internal.OrderStatusNew, UpdateSource: internal.UpdateSourcePoll},
+		{Number: "12345678903", Status: internal.OrderStatusProcessed, Accrual: 10, UpdateSource: internal.UpdateSourceCallback},
+		{Number: "12345678903", Status: internal.OrderStatusInvalid, UpdateSource: internal.UpdateSourcePoll},
+	} {
+		require.NoError(t, store.UpdateOrder(ctx, &update, nil, nil))
+	}
+	found, err := store.GetOrder(ctx, "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, internal.OrderStatusProcessed, found.Status)
+	assert.Equal(t, float32(10), bill(t, store, user.ID))
+
+	history, err := store.GetOrderHistory(ctx, order.ID)
+	require.NoError(t, err)
+	transitions := make([]string, 0)
+	for _, change := range *history {
+		assert.Equal(t, order.ID, change.OrderID)
+		transitions = append(transitions, string(change.FromStatus)+">"+string(change.Status)+":"+string(change.Source))
+	}
+	assert.Equal(t, []string{">NEW:UPLOAD", "NEW>PROCESSING:POLL", "PROCESSING>PROCESSED:CALLBACK"}, transitions)
+	assert.True(t, order.CreateAt.Equal((*history)[0].CreateAt))
+	assert.False(t, (*history)[2].CreateAt.Before((*history)[1].CreateAt))
+
+	history, err = store.GetOrderHistory(ctx, batch[0].ID)
+	require.NoError(t, err)
+	require.Len(t, *history, 1)
+	assert.Equal(t, internal.OrderStatusNew, (*history)[0].Status)
+	assert.Equal(t, internal.UpdateSourceUpload, (*history)[0].Source)
+
+	history, err = store.GetOrderHistory(ctx, uuid.New())
+	require.NoError(t, err)
+	assert.Empty(t, *history)
+}
+
+func testOrderChecks(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 0)
+	_, err := store.AddOrder(ctx, newOrder(user.ID, "12345678903", now()))
+	require.NoError(t, err)
+	version, err := store.GetUserVersion(ctx, user.ID)
+	require.NoError(t, err)
+
+	first := now()
+	require.NoError(t, store.SaveOrderCheck(ctx, "12345678903", first, first.Add(time.Minute)))
+	second := first.Add(time.Minute)
+	require.NoError(t, store.SaveOrderCheck(ctx, "12345678903", second, second.Add(time.Minute)))
+	require.NoError(t, store.SaveOrderCheck(ctx, "79927398713", second, second.Add(time.Minute)), "unknown order is skipped")
+
+	order, err := store.GetOrder(ctx, "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, 2, order.PollCount)
+	require.NotNil(t, order.CheckedAt)
+	assert.True(t, second.Equal(*order.CheckedAt))
+	require.NotNil(t, order.NextCheckAt)
+	assert.True(t, second.Add(time.Minute).Equal(*order.NextCheckAt))
+	checked, err := store.GetUserVersion(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, version, checked, "check doesn't change the version of the user")
+}
+
+func testOrderWithdrawals(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 100)
+	another := addUser(t, store, 100)
+	start := now()
+
+	require.NoError(t, store.SaveWithdrawal(ctx, &internal.Withdraw{ID: uuid.New(), CreateAt: start, Order: "2377225624", Sum: 10, UserID: user.ID}, nil))
+	require.NoError(t, store.SaveWithdrawal(ctx, &internal.Withdraw{ID: uuid.New(), CreateAt: start, Order: "2377225632", Sum: 20, UserID: user.ID}, nil))
+
+	withdrawals, err := store.GetOrderWithdrawals(ctx, user.ID, "2377225624")
+	require.NoError(t, err)
+	require.Len(t, *withdrawals, 1)
+	assert.Equal(t, float32(10), (*withdrawals)[0].Sum)
+
+	withdrawals, err = store.GetOrderWithdrawals(ctx, another.ID, "2377225624")
+	require.NoError(t, err)
+	assert.Empty(t, *withdrawals, "withdrawal of another user isn't returned")
+}
+
+func testSaveWithdrawal(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 100)
+	start := now()
+
+	first := &internal.Withdraw{ID: uuid.New(), CreateAt: start, Order: "2377225624", Sum: 60.5, UserID: user.ID}
+	require.NoError(t, store.SaveWithdrawal(ctx, first, nil))
+	assert.Equal(t, float32(39.5), bill(t, store, user.ID))
+
+	tooMuch := &internal.Withdraw{ID: uuid.New(), CreateAt: start, Order: "2377225632", Sum: 40, UserID: user.ID}
+	assert.ErrorIs(t, store.SaveWithdrawal(ctx, tooMuch, nil), errors2.ErrNotEnoughAmount)
+	assert.Equal(t, float32(39.5), bill(t, store, user.ID))
+
+	second := &internal.Withdraw{ID: uuid.New(), CreateAt: start.Add(time.Second), Order: "2377225640", Sum: 39.5, UserID: user.ID}
+	require.NoError(t, store.SaveWithdrawal(ctx, second, nil))
+	assert.Equal(t, float32(0), bill(t, store, user.ID))
+
+	unknown := &internal.Withdraw{ID: uuid.New(), CreateAt: start, Order: "2377225657", Sum: 1, UserID: uuid.New()}
+	assert.Error(t, store.SaveWithdrawal(ctx, unknown, nil))
+
+	refill := addUser(t, store, 50)
+	duplicate := &internal.Withdraw{ID: uuid.New(), CreateAt: start, Order: first.Order, Sum: 10, UserID: refill.ID}
+	assert.Error(t, store.SaveWithdrawal(ctx, duplicate, nil), "order of withdrawal is used already")
+	assert.Equal(t, float32(50), bill(t, store, refill.ID), "failed withdrawal is rolled back")
+	version, err := store.GetUserVersion(ctx, refill.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), version)
+
+	withdrawals, err := store.GetWithdrawals(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, *withdrawals, 2)
+	assert.Equal(t, second.Order, (*withdrawals)[0].Order, "newest withdrawal first")
+	assert.Equal(t, first.Order, (*withdrawals)[1].Order)
+	assert.Equal(t, first.Sum, (*withdrawals)[1].Sum)
+}
+
+// testUpdateOrderIdempotent repeats the final state of the order, the repeated
+// and the later states don't change the order, the bill and the events.
+func testUpdateOrderIdempotent(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 0)
+	_, err := store.AddOrder(ctx, newOrder(user.ID, "12345678903", now()))
+	require.NoError(t, err)
+
+	processed := &internal.Order{Number: "12345678903", Status: internal.OrderStatusProcessed, Accrual: 100, UpdateSource: internal.UpdateSourcePoll}
+	require.NoError(t, store.UpdateOrder(ctx, processed, nil, nil))
+	orders, err := store.GetOrders(ctx, user.ID)
+	require.NoError(t, err)
+	updateAt := (*orders)[0].UpdateAt
+	require.NotNil(t, updateAt)
+	creditedAt := (*orders)[0].CreditedAt
+	require.NotNil(t, creditedAt, "credited order is marked")
+	version, err := store.GetUserVersion(ctx, user.ID)
+	require.NoError(t, err)
+
+	for _, repeated := range []*internal.Order{
+		processed,
+		{Number: "12345678903", Status: internal.OrderStatusProcessed, Accrual: 200, UpdateSource: internal.UpdateSourceCallback},
+		{Number: "12345678903", Status: internal.OrderStatusInvalid, UpdateSource: internal.UpdateSourceCallback},
+	} {
+		require.NoError(t, store.UpdateOrder(ctx, repeated, nil, nil))
+	}
+
+	assert.Equal(t, float32(100), bill(t, store, user.ID))
+	orders, err = store.GetOrders(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, internal.OrderStatusProcessed, (*orders)[0].Status)
+	assert.Equal(t, float32(100), (*orders)[0].Accrual)
+	assert.Equal(t, internal.UpdateSourcePoll, (*orders)[0].UpdateSource)
+	assert.True(t, updateAt.Equal(*(*orders)[0].UpdateAt))
+	require.NotNil(t, (*orders)[0].CreditedAt)
+	assert.True(t, creditedAt.Equal(*(*orders)[0].CreditedAt))
+	got, err := store.GetUserVersion(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, version, got)
+	events, err := store.GetUserEvents(ctx, user.ID, 0, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []internal.EventType{internal.EventOrderStatus, internal.EventBalanceChanged}, eventTypes(events))
+	assert.Len(t, outboxEvents(t, store, user.ID), 1)
+}
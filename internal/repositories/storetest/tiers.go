@@ -0,0 +1,83 @@
+package storetest
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func tierAccruals(t *testing.T, store repositories.Store, since time.Time) map[uuid.UUID]internal.TierAccrual {
+	t.Helper()
+	accruals, err := store.GetTierAccruals(context.Background(), since)
+	require.NoError(t, err)
+	result := make(map[uuid.UUID]internal.TierAccrual)
+	for _, accrual := range *accruals {
+		result[accrual.UserID] = accrual
+	}
+	return result
+}
+
+func tierEvents(t *testing.T, store repositories.Store) []internal.TierEventDto {
+	t.Helper()
+	events, err := store.ClaimOutboxEvents(context.Background(), 100, time.Minute)
+	require.NoError(t, err)
+	result := make([]internal.TierEventDto, 0)
+	for _, event := range *events {
+		if event.Type != internal.EventTierChanged {
+			continue
+		}
+		var payload internal.TierEventDto
+		require.NoError(t, json.Unmarshal(event.Payload, &payload))
+		result = append(result, payload)
+	}
+	return result
+}
+
+func testTiers(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	active := addUser(t, store, 0)
+	idle := addUser(t, store, 0)
+	processOrder(t, store, active.ID, "4539088167512356", 600, nil)
+	processOrder(t, store, active.ID, "3536137811022331", 700.5, nil)
+	_, err := store.AddOrder(ctx, newOrder(active.ID, "79927398713", now()))
+	require.NoError(t, err)
+
+	accruals := tierAccruals(t, store, now().AddDate(-1, 0, 0))
+	require.Contains(t, accruals, active.ID)
+	require.Contains(t, accruals, idle.ID)
+	assert.Equal(t, float32(1300.5), accruals[active.ID].Accrual)
+	assert.Equal(t, internal.TierBronze, accruals[active.ID].Tier)
+	assert.Equal(t, float32(0), accruals[active.ID].TierAccrual)
+	assert.Equal(t, float32(0), accruals[idle.ID].Accrual)
+	assert.Equal(t, float32(0), tierAccruals(t, store, now().Add(time.Hour))[active.ID].Accrual, "orders credited before since")
+
+	at := now()
+	change := &internal.TierChange{UserID: active.ID, CreateAt: at, From: internal.TierBronze, To: internal.TierSilver, Accrual: 1300.5}
+	require.NoError(t, store.UpdateTier(ctx, change))
+	user, err := store.GetUser(ctx, active.ID)
+	require.NoError(t, err)
+	assert.Equal(t, internal.TierSilver, user.Tier)
+	assert.Equal(t, float32(1300.5), user.TierAccrual)
+	require.NotNil(t, user.TierUpdatedAt)
+	assert.True(t, at.Equal(*user.TierUpdatedAt))
+
+	require.NoError(t, store.UpdateTier(ctx, change), "tier is changed already")
+	require.NoError(t, store.UpdateTier(ctx,
+		&internal.TierChange{UserID: active.ID, CreateAt: now(), From: internal.TierSilver, To: internal.TierSilver, Accrual: 1400}))
+	user, err = store.GetUser(ctx, active.ID)
+	require.NoError(t, err)
+	assert.Equal(t, internal.TierSilver, user.Tier)
+	assert.Equal(t, float32(1400), user.TierAccrual)
+
+	assert.Equal(t, []internal.TierEventDto{{From: "BRONZE", To: "SILVER", Accrual: 1300.5}}, tierEvents(t, store))
+	user, err = store.GetUser(ctx, idle.ID)
+	require.NoError(t, err)
+	assert.Equal(t, internal.TierBronze, user.Tier)
+	assert.Nil(t, user.TierUpdatedAt)
+}
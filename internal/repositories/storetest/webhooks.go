@@ -0,0 +1,172 @@
+package storetest
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func addWebhook(t *testing.T, store repositories.Store, userID uuid.UUID, eventTypes string, active bool, createAt time.Time) *internal.Webhook {
+	t.Helper()
+	webhook := &internal.Webhook{
+		ID:         uuid.New(),
+		CreateAt:   createAt,
+		UserID:     userID,
+		URL:        "https://example.com/" + uuid.NewString(),
+		Secret:     "secret-" + uuid.NewString(),
+		EventTypes: eventTypes,
+		Active:     active,
+	}
+	require.NoError(t, store.AddWebhook(context.Background(), webhook, 10))
+	return webhook
+}
+
+func testWebhooks(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 0)
+	other := addUser(t, store, 0)
+	start := now()
+	first := addWebhook(t, store, user.ID, "order.processed,balance.withdrawn", true, start)
+	second := addWebhook(t, store, user.ID, "order.invalid", true, start.Add(time.Second))
+	addWebhook(t, store, other.ID, "order.processed", true, start)
+
+	err := store.AddWebhook(ctx, &internal.Webhook{ID: uuid.New(), CreateAt: start, UserID: uuid.New(), URL: "https://example.com",
+		Secret: "secret", EventTypes: "order.processed", Active: true}, 10)
+	assert.Error(t, err, "webhook of unknown user")
+	err = store.AddWebhook(ctx, &internal.Webhook{ID: uuid.New(), CreateAt: start, UserID: user.ID, URL: "https://example.com",
+		Secret: "secret", EventTypes: "order.processed", Active: true}, 2)
+	assert.ErrorIs(t, err, errors2.ErrWebhookLimit, "limit of webhooks of the user")
+
+	webhooks, err := store.GetWebhooks(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, *webhooks, 2)
+	assert.Equal(t, first.ID, (*webhooks)[0].ID, "oldest webhook first")
+	assert.Equal(t, second.ID, (*webhooks)[1].ID)
+
+	got, err := store.GetWebhook(ctx, user.ID, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, first.URL, got.URL)
+	assert.Equal(t, first.Secret, got.Secret)
+	assert.Equal(t, first.EventTypes, got.EventTypes)
+	assert.True(t, got.Active)
+	_, err = store.GetWebhook(ctx, other.ID, first.ID)
+	assert.ErrorIs(t, err, errors2.ErrWebhookNotFound, "webhook of another user")
+
+	updated := *first
+	updated.URL = "https://example.com/updated"
+	updated.Active = false
+	require.NoError(t, store.UpdateWebhook(ctx, &updated))
+	got, err = store.GetWebhook(ctx, user.ID, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/updated", got.URL)
+	assert.False(t, got.Active)
+	assert.Equal(t, first.Secret, got.Secret, "secret isn't changed")
+	updated.UserID = other.ID
+	assert.ErrorIs(t, store.UpdateWebhook(ctx, &updated), errors2.ErrWebhookNotFound)
+
+	assert.ErrorIs(t, store.DeleteWebhook(ctx, other.ID, second.ID), errors2.ErrWebhookNotFound)
+	require.NoError(t, store.DeleteWebhook(ctx, user.ID, second.ID))
+	_, err = store.GetWebhook(ctx, user.ID, second.ID)
+	assert.ErrorIs(t, err, errors2.ErrWebhookNotFound)
+	assert.ErrorIs(t, store.DeleteWebhook(ctx, user.ID, second.ID), errors2.ErrWebhookNotFound)
+}
+
+func testWebhookDeliveries(t *testing.T, store repositories.Store) {
+	ctx := context.Background()
+	user := addUser(t, store, 0)
+	other := addUser(t, store, 0)
+	subscribed := addWebhook(t, store, user.ID, "balance.withdrawn,order.processed", true, now())
+	inactive := addWebhook(t, store, user.ID, "order.processed", false, now())
+	unsubscribed := addWebhook(t, store, user.ID, "order.invalid", true, now())
+	otherWebhook := addWebhook(t, store, other.ID, "order.processed", true, now())
+
+	payload, err := json.Marshal(internal.OrderEventDto{Order: "12345678903", Status: "PROCESSED", Accrual: 10})
+	require.NoError(t, err)
+	event := &internal.OutboxEvent{ID: uuid.New(), CreateAt: now(), Type: internal.EventOrderProcessed, UserID: user.ID, Payload: payload}
+	require.NoError(t, store.AddWebhookDeliveries(ctx, event))
+	require.NoError(t, store.AddWebhookDeliveries(ctx, event), "enqueued event is skipped")
+
+	for _, webhook := range []*internal.Webhook{inactive, unsubscribed, otherWebhook} {
+		deliveries, err := store.GetWebhookDeliveries(ctx, webhook.UserID, webhook.ID, 10)
+		require.NoError(t, err)
+		assert.Empty(t, *deliveries, "webhook %s", webhook.EventTypes)
+	}
+	deliveries, err := store.GetWebhookDeliveries(ctx, user.ID, subscribed.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, *deliveries, 1)
+	assert.Equal(t, event.ID, (*deliveries)[0].EventID)
+	assert.Equal(t, internal.OutboxStatusPending, (*deliveries)[0].Status)
+
+	test := &internal.WebhookDelivery{ID: uuid.New(), CreateAt: now().Add(time.Second), WebhookID: subscribed.ID, EventID: uuid.New(),
+		EventType: internal.EventWebhookTest, Payload: json.RawMessage(`{}`), NextAttemptAt: now()}
+	require.NoError(t, store.AddWebhookDelivery(ctx, test))
+	duplicate := *test
+	duplicate.ID = uuid.New()
+	assert.Error(t, store.AddWebhookDelivery(ctx, &duplicate), "event is enqueued already")
+	unknown := *test
+	unknown.ID, unknown.WebhookID = uuid.New(), uuid.New()
+	assert.Error(t, store.AddWebhookDelivery(ctx, &unknown), "delivery of unknown webhook")
+
+	claimed, err := store.ClaimWebhookDeliveries(ctx, 100, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, *claimed, 2)
+	for _, delivery := range *claimed {
+		assert.Equal(t, subscribed.URL, delivery.URL)
+		assert.Equal(t, subscribed.Secret, delivery.Secret)
+		assert.True(t, delivery.NextAttemptAt.After(time.Now()), "claimed delivery is leased")
+	}
+	again, err := store.ClaimWebhookDeliveries(ctx, 100, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, *again, "leased deliveries aren't claimed again")
+
+	delivered := (*claimed)[0]
+	deliveredAt := now()
+	delivered.Status = internal.OutboxStatusDelivered
+	delivered.Attempts = 1
+	delivered.ResponseCode = 200
+	delivered.NextAttemptAt = now().Add(-time.Second)
+	delivered.DeliveredAt = &deliveredAt
+	require.NoError(t, store.SaveWebhookDelivery(ctx, &delivered))
+	failed := (*claimed)[1]
+	failed.Attempts = 1
+	failed.ResponseCode = 500
+	failed.LastError = "server error"
+	failed.NextAttemptAt = now().Add(-time.Second)
+	require.NoError(t, store.SaveWebhookDelivery(ctx, &failed))
+
+	again, err = store.ClaimWebhookDeliveries(ctx, 100, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, *again, 1, "failed delivery is claimed again after its retry time")
+	assert.Equal(t, failed.ID, (*again)[0].ID)
+	assert.Equal(t, "server error", (*again)[0].LastError)
+
+	deliveries, err = store.GetWebhookDeliveries(ctx, user.ID, subscribed.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, *deliveries, 2)
+	assert.Equal(t, test.ID, (*deliveries)[0].ID, "newest delivery first")
+	byID := map[uuid.UUID]internal.WebhookDelivery{}
+	for _, delivery := range *deliveries {
+		byID[delivery.ID] = delivery
+	}
+	assert.Equal(t, internal.OutboxStatusDelivered, byID[delivered.ID].Status)
+	assert.Equal(t, 200, byID[delivered.ID].ResponseCode)
+	assert.NotNil(t, byID[delivered.ID].DeliveredAt)
+	limited, err := store.GetWebhookDeliveries(ctx, user.ID, subscribed.ID, 1)
+	require.NoError(t, err)
+	assert.Len(t, *limited, 1)
+	foreign, err := store.GetWebhookDeliveries(ctx, other.ID, subscribed.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, *foreign, "deliveries of webhook of another user")
+
+	require.NoError(t, store.DeleteWebhook(ctx, user.ID, subscribed.ID))
+	claimed, err = store.ClaimWebhookDeliveries(ctx, 100, -time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, *claimed, "deliveries are deleted with the webhook")
+}
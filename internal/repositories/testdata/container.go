@@ -11,10 +11,7 @@ import (
 	"time"
 )
 
-const (
-	migrationsInitDB   = "file://testdata/migration/init_db"
-	migrationsInitData = "file://testdata/migration/init_data"
-)
+const migrationsInitData = "file://testdata/migration/init_data"
 
 type PostgresContainer struct {
 	testcontainers.Container
@@ -30,7 +27,7 @@ func (container *PostgresContainer) InitData() (*sqlx.DB, error) {
 	}
 	db.MustExec(`TRUNCATE public.schema_migrations RESTART IDENTITY CASCADE`)
 	log.Println("init data", container.getDSN())
-	err = migrations.Start(container.getDSN(), migrationsInitData)
+	err = migrations.StartFromPath(container.getDSN(), migrationsInitData)
 	if err != nil {
 		log.Printf("err migration db %v", err)
 		return nil, err
@@ -40,7 +37,7 @@ func (container *PostgresContainer) InitData() (*sqlx.DB, error) {
 
 func (container *PostgresContainer) InitDB(ctx context.Context) error {
 	log.Println("init db", container.getDSN())
-	if err := migrations.Start(container.getDSN(), migrationsInitDB); err != nil {
+	if err := migrations.Start(container.getDSN()); err != nil {
 		log.Printf("err migration db: %v", err)
 		return err
 	}
@@ -1,3 +1,10 @@
 TRUNCATE public.users RESTART IDENTITY CASCADE;
 TRUNCATE public.orders RESTART IDENTITY CASCADE;
-TRUNCATE public.withdrawals RESTART IDENTITY CASCADE;
\ No newline at end of file
+TRUNCATE public.withdrawals RESTART IDENTITY CASCADE;
+TRUNCATE public.outbox RESTART IDENTITY CASCADE;
+TRUNCATE public.webhooks RESTART IDENTITY CASCADE;
+TRUNCATE public.user_events RESTART IDENTITY CASCADE;
+TRUNCATE public.user_event_ids RESTART IDENTITY CASCADE;
+TRUNCATE public.rate_limits RESTART IDENTITY CASCADE;
+TRUNCATE public.referral_credits RESTART IDENTITY CASCADE;
+TRUNCATE public.campaigns RESTART IDENTITY CASCADE;
@@ -1,5 +1,5 @@
-INSERT INTO public.users (id,create_at,login,"password",bill) VALUES ('98dcfb07-e16f-4e53-9a28-d2a2e4eed026'::uuid,'2023-01-01 14:00:00.000','TestUser1','password', 0);
-INSERT INTO public.users (id,create_at,login,"password",bill) VALUES ('98dcfb07-e16f-4e53-9a28-d2a2e4eed027'::uuid,'2023-01-01 14:00:00.000','TestUser2','password', 100);
+INSERT INTO public.users (id,create_at,login,"password",bill,referral_code) VALUES ('98dcfb07-e16f-4e53-9a28-d2a2e4eed026'::uuid,'2023-01-01 14:00:00.000','TestUser1','password', 0, 'TESTUSR1');
+INSERT INTO public.users (id,create_at,login,"password",bill,referral_code) VALUES ('98dcfb07-e16f-4e53-9a28-d2a2e4eed027'::uuid,'2023-01-01 14:00:00.000','TestUser2','password', 100, 'TESTUSR2');
 
 INSERT INTO public.orders (id, create_at, "number", accrual, status, user_id) VALUES('334b0360-8222-44fc-bf2e-77ced208f2cd'::uuid, '2023-01-01 14:01:00.000', 4539088167512356, 100.0, 'PROCESSED', '98dcfb07-e16f-4e53-9a28-d2a2e4eed026'::uuid);
 INSERT INTO public.orders (id, create_at, "number", accrual, status, user_id) VALUES('334b0360-8222-44fc-bf2e-77ced208f2ce'::uuid, '2023-01-01 14:02:00.000', 3536137811022331, 0, 'NEW', '98dcfb07-e16f-4e53-9a28-d2a2e4eed026'::uuid);
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"time"
+)
+
+// GetTierAccruals returns the points accrued to every user by the orders credited since
+// the time, the user without such orders has the zero accrual.
+func (store *StoreImpl) GetTierAccruals(ctx context.Context, since time.Time) (*[]internal.TierAccrual, error) {
+	var accruals []internal.TierAccrual
+	err := store.db.SelectContext(ctx, &accruals,
+		`SELECT u.id AS user_id, u.tier, u.tier_accrual, COALESCE(SUM(o.accrual), 0) AS accrual
+			FROM users u LEFT JOIN orders o ON o.user_id = u.id AND o.status = $1 AND o.credited_at >= $2
+			GROUP BY u.id ORDER BY u.id`,
+		internal.OrderStatusProcessed, since)
+	if err != nil {
+		return nil, fmt.Errorf("can't get tier accruals from db %w", err)
+	}
+	return &accruals, nil
+}
+
+// UpdateTier saves the tier of the user with its accrual and writes the event of the change
+// to the outbox when the tier is changed. The tier is updated only while the user has
+// the tier From, so the change recomputed by several replicas is saved and sent once.
+func (store *StoreImpl) UpdateTier(ctx context.Context, change *internal.TierChange) error {
+	tx, err := store.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx,
+		`UPDATE users SET tier = $1, tier_accrual = $2, tier_updated_at = $3 WHERE id = $4 AND tier = $5`,
+		change.To, change.Accrual, change.CreateAt, change.UserID, change.From)
+	if err != nil {
+		return fmt.Errorf("can't update user tier at db %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get affected rows %w", err)
+	}
+	if affected == 0 {
+		internal.Logf.Debugf("tier of user %s isn't %s anymore", change.UserID, change.From)
+		return nil
+	}
+	if change.From != change.To {
+		payload := internal.TierEventDto{From: string(change.From), To: string(change.To), Accrual: change.Accrual}
+		if err = addOutboxEvent(ctx, tx, internal.EventTierChanged, change.UserID, payload); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("can't commit transaction %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+// AddWebhook saves the webhook unless the user already has limit webhooks, the user row
+// is locked so parallel requests can't exceed the limit.
+func (store *StoreImpl) AddWebhook(ctx context.Context, webhook *internal.Webhook, limit int) error {
+	tx, err := store.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("can't begin transaction %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID uuid.UUID
+	err = tx.GetContext(ctx, &userID, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, webhook.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("can't save webhook %w", errors2.ErrUserNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("can't get user from db %w", err)
+	}
+	var count int
+	if err = tx.GetContext(ctx, &count, `SELECT count(*) FROM webhooks WHERE user_id = $1`, webhook.UserID); err != nil {
+		return fmt.Errorf("can't count webhooks at db %w", err)
+	}
+	if count >= limit {
+		return errors2.ErrWebhookLimit
+	}
+	_, err = tx.NamedExecContext(ctx,
+		`INSERT INTO webhooks (id, create_at, user_id, url, secret, event_types, active)
+			VALUES (:id, :create_at, :user_id, :url, :secret, :event_types, :active)`,
+		webhook)
+	if err != nil {
+		return fmt.Errorf("can't save webhook to db %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("can't commit transaction %w", err)
+	}
+	return nil
+}
+
+func (store *StoreImpl) GetWebhooks(ctx context.Context, userID uuid.UUID) (*[]internal.Webhook, error) {
+	var webhooks []internal.Webhook
+	err := store.db.SelectContext(ctx, &webhooks,
+		`SELECT * FROM webhooks WHERE user_id = $1 ORDER BY create_at`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("can't get webhooks from db %w", err)
+	}
+	return &webhooks, nil
+}
+
+func (store *StoreImpl) GetWebhook(ctx context.Context, userID uuid.UUID, id uuid.UUID) (*internal.Webhook, error) {
+	var webhook internal.Webhook
+	err := store.db.GetContext(ctx, &webhook,
+		`SELECT * FROM webhooks WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errors2.ErrWebhookNotFound
+		}
+		return nil, fmt.Errorf("can't get webhook from db %w", err)
+	}
+	return &webhook, nil
+}
+
+func (store *StoreImpl) UpdateWebhook(ctx context.Context, webhook *internal.Webhook) error {
+	result, err := store.db.NamedExecContext(ctx,
+		`UPDATE webhooks SET url = :url, event_types = :event_types, active = :active
+			WHERE id = :id AND user_id = :user_id`,
+		webhook)
+	if err != nil {
+		return fmt.Errorf("can't update webhook at db %w", err)
+	}
+	return checkAffected(result, errors2.ErrWebhookNotFound)
+}
+
+func (store *StoreImpl) DeleteWebhook(ctx context.Context, userID uuid.UUID, id uuid.UUID) error {
+	result, err := store.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("can't delete webhook from db %w", err)
+	}
+	return checkAffected(result, errors2.ErrWebhookNotFound)
+}
+
+// AddWebhookDeliveries enqueues the event for every active webhook of the user subscribed to it,
+// the event which is already enqueued is skipped.
+func (store *StoreImpl) AddWebhookDeliveries(ctx context.Context, event *internal.OutboxEvent) error {
+	_, err := store.db.ExecContext(ctx,
+		`INSERT INTO webhook_deliveries (id, create_at, webhook_id, event_id, event_type, payload, next_attempt_at)
+			SELECT gen_random_uuid(), $1, id, $2, $3, $4, $1 FROM webhooks
+			WHERE user_id = $5 AND active AND $3 = ANY(string_to_array(event_types, ','))
+			ON CONFLICT (webhook_id, event_id) DO NOTHING`,
+		time.Now(), event.ID, event.Type, string(event.Payload), event.UserID)
+	if err != nil {
+		return fmt.Errorf("can't save webhook deliveries to db %w", err)
+	}
+	return nil
+}
+
+func (store *StoreImpl) AddWebhookDelivery(ctx context.Context, delivery *internal.WebhookDelivery) error {
+	_, err := store.db.ExecContext(ctx,
+		`INSERT INTO webhook_deliveries (id, create_at, webhook_id, event_id, event_type, payload, next_attempt_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		delivery.ID, delivery.CreateAt, delivery.WebhookID, delivery.EventID, delivery.EventType,
+		string(delivery.Payload), delivery.NextAttemptAt)
+	if err != nil {
+		return fmt.Errorf("can't save webhook delivery to db %w", err)
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries returns pending deliveries which are due together with URL and secret
+// of their webhooks and hides them from other replicas for lease.
+func (store *StoreImpl) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) (*[]internal.WebhookDelivery, error) {
+	var deliveries []internal.WebhookDelivery
+	err := store.db.SelectContext(ctx, &deliveries,
+		`WITH claimed AS (
+			UPDATE webhook_deliveries SET next_attempt_at = $1 WHERE id IN (
+				SELECT id FROM webhook_deliveries WHERE status = $2 AND next_attempt_at <= $3
+				ORDER BY next_attempt_at LIMIT $4 FOR UPDATE SKIP LOCKED)
+			RETURNING *)
+		SELECT c.*, w.url, w.secret FROM claimed AS c INNER JOIN webhooks AS w ON w.id = c.webhook_id`,
+		time.Now().Add(lease), internal.OutboxStatusPending, time.Now(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't claim webhook deliveries from db %w", err)
+	}
+	return &deliveries, nil
+}
+
+func (store *StoreImpl) SaveWebhookDelivery(ctx context.Context, delivery *internal.WebhookDelivery) error {
+	_, err := store.db.NamedExecContext(ctx,
+		`UPDATE webhook_deliveries SET status = :status, attempts = :attempts, next_attempt_at = :next_attempt_at,
+			last_error = :last_error, response_code = :response_code, delivered_at = :delivered_at WHERE id = :id`,
+		delivery)
+	if err != nil {
+		return fmt.Errorf("can't update webhook delivery at db %w", err)
+	}
+	return nil
+}
+
+func (store *StoreImpl) GetWebhookDeliveries(ctx context.Context, userID uuid.UUID, webhookID uuid.UUID, limit int) (*[]internal.WebhookDelivery, error) {
+	var deliveries []internal.WebhookDelivery
+	err := store.db.SelectContext(ctx, &deliveries,
+		`SELECT d.* FROM webhook_deliveries AS d INNER JOIN webhooks AS w ON w.id = d.webhook_id
+			WHERE d.webhook_id = $1 AND w.user_id = $2 ORDER BY d.create_at DESC LIMIT $3`,
+		webhookID, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("can't get webhook deliveries from db %w", err)
+	}
+	return &deliveries, nil
+}
+
+func checkAffected(result sql.Result, notFound error) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("can't get affected rows %w", err)
+	}
+	if affected == 0 {
+		return notFound
+	}
+	return nil
+}
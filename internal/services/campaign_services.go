@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/google/uuid"
+	"math"
+	"strings"
+	"time"
+)
+
+// MaxCampaignMultiplier keeps the mistyped multiplier from crediting the bills.
+const MaxCampaignMultiplier = 10
+
+var campaignWeekdays = map[string]time.Weekday{
+	"SUN": time.Sunday,
+	"MON": time.Monday,
+	"TUE": time.Tuesday,
+	"WED": time.Wednesday,
+	"THU": time.Thursday,
+	"FRI": time.Friday,
+	"SAT": time.Saturday,
+}
+
+// CampaignService manages the campaigns which multiply the accrual of the orders.
+type CampaignService struct {
+	db repositories.Store
+}
+
+func NewCampaignService(storage repositories.Store) *CampaignService {
+	return &CampaignService{db: storage}
+}
+
+func (cs *CampaignService) CreateCampaign(ctx context.Context, dto internal.CampaignDto) (*internal.CampaignDto, error) {
+	weekdays, err := validateCampaign(dto)
+	if err != nil {
+		return nil, err
+	}
+	campaign := &internal.Campaign{
+		ID:          uuid.New(),
+		CreateAt:    time.Now(),
+		Name:        strings.TrimSpace(dto.Name),
+		Multiplier:  dto.Multiplier,
+		StartsAt:    dto.StartsAt,
+		EndsAt:      dto.EndsAt,
+		Weekdays:    weekdays,
+		NewUserDays: dto.NewUserDays,
+		MinAccrual:  dto.MinAccrual,
+	}
+	if err = cs.db.AddCampaign(ctx, campaign); err != nil {
+		return nil, err
+	}
+	result := toCampaignDto(campaign)
+	return &result, nil
+}
+
+func (cs *CampaignService) GetCampaigns(ctx context.Context) (*[]internal.CampaignDto, error) {
+	campaigns, err := cs.db.GetCampaigns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dtos := make([]internal.CampaignDto, 0)
+	for i := range *campaigns {
+		dtos = append(dtos, toCampaignDto(&(*campaigns)[i]))
+	}
+	return &dtos, nil
+}
+
+func (cs *CampaignService) GetCampaign(ctx context.Context, id string) (*internal.CampaignDto, error) {
+	campaignID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, errors2.ErrCampaignNotFound
+	}
+	campaign, err := cs.db.GetCampaign(ctx, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	dto := toCampaignDto(campaign)
+	return &dto, nil
+}
+
+func (cs *CampaignService) DeleteCampaign(ctx context.Context, id string) error {
+	campaignID, err := uuid.Parse(id)
+	if err != nil {
+		return errors2.ErrCampaignNotFound
+	}
+	return cs.db.DeleteCampaign(ctx, campaignID)
+}
+
+// isCampaignEligible checks the conditions of the campaign for the order of the user,
+// the weekday is the day of the upload of the order in the time zone of the service.
+func isCampaignEligible(campaign *internal.Campaign, order *internal.Order, user *internal.User) bool {
+	if order.CreateAt.Before(campaign.StartsAt) || !order.CreateAt.Before(campaign.EndsAt) {
+		return false
+	}
+	if order.Accrual < campaign.MinAccrual {
+		return false
+	}
+	if campaign.NewUserDays > 0 && order.CreateAt.Sub(user.CreateAt) >= time.Duration(campaign.NewUserDays)*24*time.Hour {
+		return false
+	}
+	if campaign.Weekdays == "" {
+		return true
+	}
+	weekday := order.CreateAt.In(time.Local).Weekday()
+	for _, day := range strings.Split(campaign.Weekdays, ",") {
+		if campaignWeekdays[day] == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// campaignBonus returns the bonus added to the accrual by the multiplier and increased by
+// the factor of the tier of the user, it's rounded to hundredths like the accrual of the
+// accrual system.
+func campaignBonus(campaign *internal.Campaign, accrual float32, factor float32) float32 {
+	return float32(math.Round(float64(accrual)*float64(campaign.Multiplier-1)*float64(factor)*100) / 100)
+}
+
+// bestCampaign chooses the campaign with the largest bonus for the order of the user,
+// the campaigns don't add up. It's nil when the order isn't eligible for any campaign.
+func bestCampaign(campaigns []internal.Campaign, order *internal.Order, user *internal.User,
+	factor float32) (*internal.Campaign, float32) {
+	var best *internal.Campaign
+	var bonus float32
+	for i := range campaigns {
+		campaign := &campaigns[i]
+		if !isCampaignEligible(campaign, order, user) {
+			continue
+		}
+		if b := campaignBonus(campaign, order.Accrual, factor); best == nil || b > bonus {
+			best, bonus = campaign, b
+		}
+	}
+	return best, bonus
+}
+
+func validateCampaign(dto internal.CampaignDto) (string, error) {
+	if strings.TrimSpace(dto.Name) == "" {
+		return "", fmt.Errorf("name is empty %w", errors2.ErrIllegalCampaign)
+	}
+	if dto.Multiplier <= 1 || dto.Multiplier > MaxCampaignMultiplier {
+		return "", fmt.Errorf("multiplier %v isn't in (1, %d] %w", dto.Multiplier, MaxCampaignMultiplier, errors2.ErrIllegalCampaign)
+	}
+	if dto.StartsAt.IsZero() || !dto.StartsAt.Before(dto.EndsAt) {
+		return "", fmt.Errorf("period %v - %v %w", dto.StartsAt, dto.EndsAt, errors2.ErrIllegalCampaign)
+	}
+	if dto.NewUserDays < 0 || dto.MinAccrual < 0 {
+		return "", fmt.Errorf("new user days and min accrual can't be negative %w", errors2.ErrIllegalCampaign)
+	}
+	days := make([]string, 0, len(dto.Weekdays))
+	seen := make(map[string]bool)
+	for _, day := range dto.Weekdays {
+		day = strings.ToUpper(strings.TrimSpace(day))
+		if _, ok := campaignWeekdays[day]; !ok {
+			return "", fmt.Errorf("weekday %q %w", day, errors2.ErrIllegalCampaign)
+		}
+		if !seen[day] {
+			seen[day] = true
+			days = append(days, day)
+		}
+	}
+	return strings.Join(days, ","), nil
+}
+
+func toCampaignDto(campaign *internal.Campaign) internal.CampaignDto {
+	dto := internal.CampaignDto{
+		ID:          campaign.ID.String(),
+		Name:        campaign.Name,
+		Multiplier:  campaign.Multiplier,
+		StartsAt:    campaign.StartsAt,
+		EndsAt:      campaign.EndsAt,
+		NewUserDays: campaign.NewUserDays,
+		MinAccrual:  campaign.MinAccrual,
+		CreateAt:    campaign.CreateAt,
+	}
+	if campaign.Weekdays != "" {
+		dto.Weekdays = strings.Split(campaign.Weekdays, ",")
+	}
+	return dto
+}
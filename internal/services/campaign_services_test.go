@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/ordernumber"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCampaignService_CreateCampaign(t *testing.T) {
+	starts := time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)
+	ends := time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		dto     internal.CampaignDto
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "weekends",
+			dto:  internal.CampaignDto{Name: "Double weekends", Multiplier: 2, StartsAt: starts, EndsAt: ends, Weekdays: []string{"sat", " SUN", "SAT"}},
+			want: []string{"SAT", "SUN"},
+		},
+		{
+			name: "new users",
+			dto:  internal.CampaignDto{Name: "New users", Multiplier: 1.5, StartsAt: starts, EndsAt: ends, NewUserDays: 30},
+		},
+		{
+			name:    "without name",
+			dto:     internal.CampaignDto{Name: " ", Multiplier: 2, StartsAt: starts, EndsAt: ends},
+			wantErr: true,
+		},
+		{
+			name:    "multiplier is one",
+			dto:     internal.CampaignDto{Name: "Campaign", Multiplier: 1, StartsAt: starts, EndsAt: ends},
+			wantErr: true,
+		},
+		{
+			name:    "multiplier is too large",
+			dto:     internal.CampaignDto{Name: "Campaign", Multiplier: MaxCampaignMultiplier + 1, StartsAt: starts, EndsAt: ends},
+			wantErr: true,
+		},
+		{
+			name:    "ends before start",
+			dto:     internal.CampaignDto{Name: "Campaign", Multiplier: 2, StartsAt: ends, EndsAt: starts},
+			wantErr: true,
+		},
+		{
+			name:    "without start",
+			dto:     internal.CampaignDto{Name: "Campaign", Multiplier: 2, EndsAt: ends},
+			wantErr: true,
+		},
+		{
+			name:    "unknown weekday",
+			dto:     internal.CampaignDto{Name: "Campaign", Multiplier: 2, StartsAt: starts, EndsAt: ends, Weekdays: []string{"HOLIDAY"}},
+			wantErr: true,
+		},
+		{
+			name:    "negative min accrual",
+			dto:     internal.CampaignDto{Name: "Campaign", Multiplier: 2, StartsAt: starts, EndsAt: ends, MinAccrual: -1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := NewCampaignService(memory.NewStore())
+			got, err := cs.CreateCampaign(context.Background(), tt.dto)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, errors2.ErrIllegalCampaign)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.Weekdays)
+			saved, err := cs.GetCampaign(context.Background(), got.ID)
+			require.NoError(t, err)
+			assert.Equal(t, got, saved)
+		})
+	}
+}
+
+func Test_bestCampaign(t *testing.T) {
+	user := &internal.User{ID: uuid.New(), CreateAt: time.Date(2023, 11, 1, 12, 0, 0, 0, time.Local)}
+	// 2023-11-04 is Saturday.
+	saturday := time.Date(2023, 11, 4, 12, 0, 0, 0, time.Local)
+	monday := time.Date(2023, 11, 6, 12, 0, 0, 0, time.Local)
+	campaign := func(name string, multiplier float32, weekdays string, newUserDays int, minAccrual float32) internal.Campaign {
+		return internal.Campaign{
+			ID:          uuid.New(),
+			Name:        name,
+			Multiplier:  multiplier,
+			StartsAt:    time.Date(2023, 11, 1, 0, 0, 0, 0, time.Local),
+			EndsAt:      time.Date(2023, 12, 1, 0, 0, 0, 0, time.Local),
+			Weekdays:    weekdays,
+			NewUserDays: newUserDays,
+			MinAccrual:  minAccrual,
+		}
+	}
+	weekends := campaign("weekends", 2, "SAT,SUN", 0, 0)
+	newUsers := campaign("new users", 1.5, "", 3, 0)
+	large := campaign("large orders", 3, "", 0, 1000)
+	campaigns := []internal.Campaign{newUsers, weekends, large}
+
+	tests := []struct {
+		name      string
+		uploaded  time.Time
+		accrual   float32
+		factor    float32
+		want      string
+		wantBonus float32
+	}{
+		{name: "weekend beats new user", uploaded: saturday, accrual: 100.5, want: "weekends", wantBonus: 100.5},
+		{name: "new user on weekday", uploaded: time.Date(2023, 11, 3, 12, 0, 0, 0, time.Local), accrual: 10.01, want: "new users", wantBonus: 5.01},
+		{name: "old user on weekday", uploaded: monday, accrual: 100},
+		{name: "large order", uploaded: monday, accrual: 1000, want: "large orders", wantBonus: 2000},
+		{name: "factor of tier", uploaded: saturday, accrual: 100, factor: 1.25, want: "weekends", wantBonus: 125},
+		{name: "before campaigns", uploaded: time.Date(2023, 10, 28, 12, 0, 0, 0, time.Local), accrual: 100},
+		{name: "after campaigns", uploaded: time.Date(2023, 12, 2, 12, 0, 0, 0, time.Local), accrual: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &internal.Order{Number: "4539088167512356", CreateAt: tt.uploaded, Accrual: tt.accrual}
+			factor := tt.factor
+			if factor == 0 {
+				factor = 1
+			}
+			got, bonus := bestCampaign(campaigns, order, user, factor)
+			if tt.want == "" {
+				assert.Nil(t, got)
+				return
+			}
+			require.NotNil(t, got)
+			assert.Equal(t, tt.want, got.Name)
+			assert.Equal(t, tt.wantBonus, bonus)
+		})
+	}
+}
+
+// TestUserService_UpdateOrder_Campaign credits the accrual multiplied by the campaign active
+// at the upload of the order, the order shows the base accrual and the bonus.
+func TestUserService_UpdateOrder_Campaign(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	us := NewUserService(store, ordernumber.DefaultSources(), nil, nil)
+	cs := NewCampaignService(store)
+	user, err := us.CreateNewUser(ctx, &internal.UserDto{Login: "user", Pass: "password"})
+	require.NoError(t, err)
+	_, err = cs.CreateCampaign(ctx, internal.CampaignDto{Name: "Welcome", Multiplier: 1.5,
+		StartsAt: time.Now().Add(-time.Hour), EndsAt: time.Now().Add(time.Hour), NewUserDays: 30})
+	require.NoError(t, err)
+	require.NoError(t, us.AddOrder(ctx, user.ID.String(), "", "4539088167512356"))
+	require.NoError(t, us.AddOrder(ctx, user.ID.String(), "", "79927398713"))
+
+	accrual := &internal.AccrualDto{Order: "4539088167512356", Status: "PROCESSED", Accrual: 100}
+	for _, source := range []internal.UpdateSource{internal.UpdateSourcePoll, internal.UpdateSourceCallback} {
+		require.NoError(t, us.UpdateOrder(accrual, source))
+	}
+	require.NoError(t, us.UpdateOrder(&internal.AccrualDto{Order: "79927398713", Status: "INVALID"}, internal.UpdateSourcePoll))
+
+	balance, err := us.GetBalance(ctx, user.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, float32(150), balance.Current, "bonus is credited once")
+	order, err := us.GetOrder(ctx, user.ID.String(), "4539088167512356")
+	require.NoError(t, err)
+	assert.Equal(t, float32(150), order.Accrual)
+	assert.Equal(t, float32(100), order.BaseAccrual)
+	assert.Equal(t, float32(50), order.CampaignBonus)
+	assert.Equal(t, "Welcome", order.Campaign)
+	orders, err := us.GetOrders(ctx, user.ID.String())
+	require.NoError(t, err)
+	for _, o := range *orders {
+		if o.Number == "79927398713" {
+			assert.Zero(t, o.CampaignBonus)
+			assert.Zero(t, o.BaseAccrual)
+		} else {
+			assert.Equal(t, float32(50), o.CampaignBonus)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+const userEventsBatchSize = 100
+
+// Subscription is signalled when new events of the user may be in the store,
+// the signals are coalesced so the subscriber reads the events itself.
+type Subscription struct {
+	C      <-chan struct{}
+	UserID uuid.UUID
+	close  func()
+}
+
+func (s *Subscription) Close() {
+	s.close()
+}
+
+// EventBroker wakes up the subscribers of a user when any replica writes an event of the user.
+type EventBroker struct {
+	db          repositories.Store
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan struct{}]struct{}
+	backoff     time.Duration
+}
+
+func NewEventBroker(storage repositories.Store) *EventBroker {
+	return &EventBroker{
+		db:          storage,
+		subscribers: make(map[uuid.UUID]map[chan struct{}]struct{}),
+		backoff:     minRestartBackoff,
+	}
+}
+
+// Start listens the notifications of the store until ctx is done. After the connection
+// is lost all subscribers are woken up, as they could miss events meanwhile.
+func (b *EventBroker) Start(ctx context.Context) {
+	backoff := b.backoff
+	for {
+		started := time.Now()
+		err := b.db.ListenUserEvents(ctx, b.notify)
+		if ctx.Err() != nil {
+			return
+		}
+		internal.Log.Error("listen of user events is failed", zap.Error(err))
+		if time.Since(started) > maxRestartBackoff {
+			backoff = b.backoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		b.notifyAll()
+		backoff = backoff * 2
+		if backoff > maxRestartBackoff {
+			backoff = maxRestartBackoff
+		}
+	}
+}
+
+func (b *EventBroker) Subscribe(id string) (*Subscription, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan struct{}, 1)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[chan struct{}]struct{})
+	}
+	b.subscribers[userID][ch] = struct{}{}
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers[userID], ch)
+			if len(b.subscribers[userID]) == 0 {
+				delete(b.subscribers, userID)
+			}
+		})
+	}
+	return &Subscription{C: ch, UserID: userID, close: unsubscribe}, nil
+}
+
+// Events returns the events of the user written after afterID.
+func (b *EventBroker) Events(ctx context.Context, userID uuid.UUID, afterID int64) (*[]internal.UserEvent, error) {
+	return b.db.GetUserEvents(ctx, userID, afterID, userEventsBatchSize)
+}
+
+// LastEventID is the point to stream from when the user doesn't resume the stream.
+func (b *EventBroker) LastEventID(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return b.db.GetLastUserEventID(ctx, userID)
+}
+
+// Cleanup deletes the events older than retention on every tick until ctx is done,
+// the stream resumed after a deleted event continues from the oldest kept one.
+func (b *EventBroker) Cleanup(ctx context.Context, retention time.Duration, requestTime *time.Ticker) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-requestTime.C:
+		}
+		count, err := b.db.DeleteUserEvents(ctx, time.Now().Add(-retention))
+		if err != nil {
+			internal.Log.Error("error delete of old user events", zap.Error(err))
+			continue
+		}
+		internal.Logf.Debugf("%d old user events are deleted", count)
+	}
+}
+
+func (b *EventBroker) notify(userID uuid.UUID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers[userID] {
+		signal(ch)
+	}
+}
+
+func (b *EventBroker) notifyAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, subscribers := range b.subscribers {
+		for ch := range subscribers {
+			signal(ch)
+		}
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
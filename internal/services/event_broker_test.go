@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func signalled(s *Subscription) bool {
+	select {
+	case <-s.C:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestEventBroker_Subscribe(t *testing.T) {
+	broker := NewEventBroker(getStore(t))
+	userID := uuid.New()
+
+	first, err := broker.Subscribe(userID.String())
+	require.NoError(t, err)
+	second, err := broker.Subscribe(userID.String())
+	require.NoError(t, err)
+	other, err := broker.Subscribe(uuid.New().String())
+	require.NoError(t, err)
+
+	broker.notify(userID)
+	broker.notify(userID)
+	assert.True(t, signalled(first))
+	assert.False(t, signalled(first), "signals must be coalesced")
+	assert.True(t, signalled(second))
+	assert.False(t, signalled(other))
+
+	first.Close()
+	first.Close()
+	broker.notify(userID)
+	assert.False(t, signalled(first))
+	assert.True(t, signalled(second))
+
+	second.Close()
+	other.Close()
+	assert.Len(t, broker.subscribers, 0)
+
+	_, err = broker.Subscribe("user")
+	assert.Error(t, err)
+}
+
+func TestEventBroker_StartReconnect(t *testing.T) {
+	mockStore := getStore(t)
+	userID := uuid.New()
+	gomock.InOrder(
+		mockStore.EXPECT().ListenUserEvents(gomock.Any(), gomock.Any()).Return(errors.New("connection reset")),
+		mockStore.EXPECT().ListenUserEvents(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, notify func(userID uuid.UUID)) error {
+				<-ctx.Done()
+				return nil
+			}),
+	)
+
+	broker := NewEventBroker(mockStore)
+	broker.backoff = 10 * time.Millisecond
+	subscription, err := broker.Subscribe(userID.String())
+	require.NoError(t, err)
+	defer subscription.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		broker.Start(ctx)
+	}()
+
+	select {
+	case <-subscription.C:
+	case <-time.After(time.Second):
+		t.Error("subscriber must be woken up after reconnect")
+	}
+	cancel()
+	<-done
+}
+
+func TestEventBroker_Cleanup(t *testing.T) {
+	mockStore := getStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	mockStore.EXPECT().DeleteUserEvents(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, before time.Time) (int64, error) {
+		cancel()
+		assert.WithinDuration(t, time.Now().Add(-time.Hour), before, time.Second)
+		return 3, nil
+	})
+	broker := NewEventBroker(mockStore)
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		broker.Cleanup(ctx, time.Hour, ticker)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Cleanup() isn't stopped")
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"time"
+)
+
+const (
+	outboxBatchSize     = 100
+	outboxLease         = 1 * time.Minute
+	outboxMaxAttempts   = 10
+	outboxMinRetryDelay = 5 * time.Second
+	outboxMaxRetryDelay = 1 * time.Hour
+)
+
+// EventSink is the destination of outbox events, e.g. a webhook or a file.
+type EventSink interface {
+	Name() string
+	Send(ctx context.Context, event *internal.OutboxEvent) error
+}
+
+type OutboxDispatcher struct {
+	db          repositories.Store
+	sinks       []EventSink
+	maxAttempts int
+}
+
+func NewOutboxDispatcher(storage repositories.Store, sinks ...EventSink) *OutboxDispatcher {
+	return &OutboxDispatcher{db: storage, sinks: sinks, maxAttempts: outboxMaxAttempts}
+}
+
+// Start dispatches due events on every tick until ctx is done.
+func (d *OutboxDispatcher) Start(ctx context.Context, requestTime *time.Ticker) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-requestTime.C:
+		}
+		for {
+			count, err := d.Dispatch(ctx)
+			if err != nil {
+				internal.Log.Error("error dispatch of outbox", zap.Error(err))
+			}
+			if err != nil || count < outboxBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// Dispatch delivers one batch of due events to every sink and returns the size of the batch.
+// The event is retried with backoff until all sinks accept it, after maxAttempts it is dead.
+func (d *OutboxDispatcher) Dispatch(ctx context.Context) (int, error) {
+	events, err := d.db.ClaimOutboxEvents(ctx, outboxBatchSize, outboxLease)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range *events {
+		event := &(*events)[i]
+		attempts := d.deliver(ctx, event)
+		if err = d.db.SaveOutboxDelivery(ctx, event, &attempts); err != nil {
+			return i, err
+		}
+	}
+	return len(*events), nil
+}
+
+func (d *OutboxDispatcher) DeadLetters(ctx context.Context) (*[]internal.OutboxEvent, error) {
+	return d.db.GetDeadLetters(ctx)
+}
+
+func (d *OutboxDispatcher) deliver(ctx context.Context, event *internal.OutboxEvent) []internal.OutboxAttempt {
+	attempts := make([]internal.OutboxAttempt, 0, len(d.sinks))
+	var errs []error
+	for _, sink := range d.sinks {
+		attempt := internal.OutboxAttempt{ID: uuid.New(), EventID: event.ID, AttemptAt: time.Now(), Sink: sink.Name()}
+		if err := sink.Send(ctx, event); err != nil {
+			attempt.Error = err.Error()
+			errs = append(errs, fmt.Errorf("sink %s %w", sink.Name(), err))
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	event.Attempts++
+	if len(errs) == 0 {
+		now := time.Now()
+		event.Status = internal.OutboxStatusDelivered
+		event.DeliveredAt = &now
+		event.LastError = ""
+		return attempts
+	}
+
+	event.LastError = errors.Join(errs...).Error()
+	if event.Attempts >= d.maxAttempts {
+		internal.Logf.Errorf("event %s is dead after %d attempts: %s", event.ID, event.Attempts, event.LastError)
+		event.Status = internal.OutboxStatusDead
+		return attempts
+	}
+	event.NextAttemptAt = time.Now().Add(retryDelay(event.Attempts))
+	return attempts
+}
+
+func retryDelay(attempts int) time.Duration {
+	delay := outboxMinRetryDelay
+	for i := 1; i < attempts; i++ {
+		delay = delay * 2
+		if delay >= outboxMaxRetryDelay {
+			return outboxMaxRetryDelay
+		}
+	}
+	return delay
+}
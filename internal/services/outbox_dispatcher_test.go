@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/sinks"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func outboxEvents(attempts int) *[]internal.OutboxEvent {
+	return &[]internal.OutboxEvent{
+		{
+			ID:       uuid.MustParse("3e23bb5c-5cd6-4ca9-afa5-8d498576a080"),
+			CreateAt: time.Now(),
+			Type:     internal.EventOrderProcessed,
+			UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
+			Payload:  []byte(`{"order":"4539088167512356","status":"PROCESSED","accrual":100}`),
+			Status:   internal.OutboxStatusPending,
+			Attempts: attempts,
+		},
+	}
+}
+
+func TestOutboxDispatcher_Dispatch(t *testing.T) {
+	tests := []struct {
+		name         string
+		attempts     int
+		sinkErr      error
+		wantStatus   internal.OutboxStatus
+		wantAttempts int
+		wantError    string
+		wantEvents   int
+	}{
+		{
+			name:         "event_is_delivered",
+			attempts:     0,
+			wantStatus:   internal.OutboxStatusDelivered,
+			wantAttempts: 1,
+			wantEvents:   1,
+		},
+		{
+			name:         "event_is_retried",
+			attempts:     2,
+			sinkErr:      errors.New("connection refused"),
+			wantStatus:   internal.OutboxStatusPending,
+			wantAttempts: 3,
+			wantError:    "sink memory connection refused",
+		},
+		{
+			name:         "event_is_dead",
+			attempts:     outboxMaxAttempts - 1,
+			sinkErr:      errors.New("connection refused"),
+			wantStatus:   internal.OutboxStatusDead,
+			wantAttempts: outboxMaxAttempts,
+			wantError:    "sink memory connection refused",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := getStore(t)
+			sink := sinks.NewMemorySink()
+			sink.Fail(tt.sinkErr)
+
+			var saved internal.OutboxEvent
+			var savedAttempts []internal.OutboxAttempt
+			mockStore.EXPECT().ClaimOutboxEvents(gomock.Any(), outboxBatchSize, outboxLease).
+				Return(outboxEvents(tt.attempts), nil)
+			mockStore.EXPECT().SaveOutboxDelivery(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, event *internal.OutboxEvent, attempts *[]internal.OutboxAttempt) error {
+					saved = *event
+					savedAttempts = *attempts
+					return nil
+				})
+
+			dispatcher := NewOutboxDispatcher(mockStore, sink)
+			count, err := dispatcher.Dispatch(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, 1, count)
+
+			assert.Equal(t, tt.wantStatus, saved.Status)
+			assert.Equal(t, tt.wantAttempts, saved.Attempts)
+			assert.Equal(t, tt.wantError, saved.LastError)
+			assert.Len(t, sink.Events(), tt.wantEvents)
+			require.Len(t, savedAttempts, 1)
+			assert.Equal(t, "memory", savedAttempts[0].Sink)
+			if tt.wantStatus == internal.OutboxStatusPending {
+				assert.True(t, saved.NextAttemptAt.After(time.Now()))
+			}
+			if tt.wantStatus == internal.OutboxStatusDelivered {
+				assert.NotNil(t, saved.DeliveredAt)
+			}
+		})
+	}
+}
+
+func TestOutboxDispatcher_DispatchClaimIsFailed(t *testing.T) {
+	mockStore := getStore(t)
+	mockStore.EXPECT().ClaimOutboxEvents(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, errors.New("connection refused"))
+
+	dispatcher := NewOutboxDispatcher(mockStore, sinks.NewMemorySink())
+	_, err := dispatcher.Dispatch(context.Background())
+	assert.ErrorContains(t, err, "connection refused")
+}
+
+func Test_retryDelay(t *testing.T) {
+	assert.Equal(t, outboxMinRetryDelay, retryDelay(1))
+	assert.Equal(t, 4*outboxMinRetryDelay, retryDelay(3))
+	assert.Equal(t, outboxMaxRetryDelay, retryDelay(50))
+}
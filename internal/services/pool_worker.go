@@ -1,87 +1,390 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/clients"
 	"go.uber.org/zap"
+	"sync"
 	"time"
 )
 
-const timeoutErrTooManyRequests = 2 * time.Minute
+const (
+	timeoutErrTooManyRequests = 2 * time.Minute
+	stallTimeout              = 1 * time.Minute
+	checkStallInterval        = 10 * time.Second
+	minRestartBackoff         = 1 * time.Second
+	maxRestartBackoff         = 1 * time.Minute
+	sizeErrBuffer             = 100
+)
+
+type PoolState string
+
+const (
+	PoolStateStopped  PoolState = "STOPPED"
+	PoolStateRunning  PoolState = "RUNNING"
+	PoolStatePaused   PoolState = "PAUSED"
+	PoolStateDegraded PoolState = "DEGRADED"
+)
+
+type PoolStatus struct {
+	State       PoolState  `json:"state"`
+	Workers     int        `json:"workers"`
+	Stalled     int        `json:"stalled"`
+	Restarts    int        `json:"restarts"`
+	LastError   string     `json:"last_error,omitempty"`
+	PausedUntil *time.Time `json:"paused_until,omitempty"`
+}
+
+// AccrualProvider is the source of accrual states of orders, e.g. clients.ClientAccrual.
+type AccrualProvider interface {
+	CheckAccrual(number string) (*internal.AccrualDto, error)
+}
+
+type workerSlot struct {
+	generation int
+	order      string
+	busySince  time.Time
+	done       func()
+}
 
 type PoolWorker struct {
-	client      *clients.ClientAccrual
-	serviceUser *UserService
-	orderIn     chan string
-	Err         chan error
+	client       AccrualProvider
+	serviceUser  *UserService
+	pollInterval time.Duration
+	orderIn      chan string
+	Err          chan error
+
+	wg           sync.WaitGroup
+	mu           sync.Mutex
+	started      bool
+	slots        []*workerSlot
+	failing      map[string]bool
+	stalled      int
+	restarts     int
+	lastError    error
+	pausedUntil  time.Time
+	pauseTimeout time.Duration
+	stallTimeout time.Duration
+	checkStall   time.Duration
+	backoff      time.Duration
 }
 
-func NewPoolWorker(client *clients.ClientAccrual, serviceUser *UserService) *PoolWorker {
+// NewPoolWorker creates the pool which polls the accrual system every pollInterval,
+// the interval is used to schedule the next check of the order.
+func NewPoolWorker(client AccrualProvider, serviceUser *UserService, pollInterval time.Duration) *PoolWorker {
 	ordersIn := make(chan string, 10)
-	err := make(chan error)
-	return &PoolWorker{client: client, serviceUser: serviceUser, orderIn: ordersIn, Err: err}
+	err := make(chan error, sizeErrBuffer)
+	return &PoolWorker{
+		client:       client,
+		serviceUser:  serviceUser,
+		pollInterval: pollInterval,
+		orderIn:      ordersIn,
+		Err:          err,
+		failing:      make(map[string]bool),
+		pauseTimeout: timeoutErrTooManyRequests,
+		stallTimeout: stallTimeout,
+		checkStall:   checkStallInterval,
+		backoff:      minRestartBackoff,
+	}
 }
 
-func (p *PoolWorker) StarIntegration(countWorker int, requestTime *time.Ticker) {
+// StarIntegration runs countWorker workers and the poller of not processed orders
+// under supervision until ctx is done, then waits for them to finish.
+func (p *PoolWorker) StarIntegration(ctx context.Context, countWorker int, requestTime *time.Ticker) {
+	p.mu.Lock()
+	p.started = true
+	p.slots = make([]*workerSlot, countWorker)
+	for i := range p.slots {
+		p.slots[i] = &workerSlot{}
+	}
+	p.mu.Unlock()
 
-	pauses := make([]chan struct{}, 0)
 	for i := 0; i < countWorker; i++ {
-		name := i
-		pause := make(chan struct{})
-		p.worker(name, pause)
-		pauses = append(pauses, pause)
+		p.startWorker(ctx, i)
 	}
-
+	p.wg.Add(1)
 	go func() {
-		for range requestTime.C {
-			numbers, err := p.serviceUser.GetOrdersNotProcessed()
-			if err != nil {
-				internal.Log.Error("error start workers of integration")
-				break
-			}
-			for _, n := range numbers {
-				number := n
-				p.orderIn <- number
-			}
-		}
+		defer p.wg.Done()
+		p.supervise(ctx, "poller", func(ctx context.Context) error {
+			return p.poll(ctx, requestTime)
+		})
 	}()
 
-	for err := range p.Err {
-		internal.Log.Error("error integration", zap.Error(err))
-		if errors.Is(err, clients.ErrTooManyRequests) {
-			go func() {
-				for _, pause := range pauses {
-					ch := pause
-					ch <- struct{}{}
-				}
-			}()
+	stallTicker := time.NewTicker(p.checkStall)
+	defer stallTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			p.wg.Wait()
+			p.mu.Lock()
+			p.started = false
+			p.mu.Unlock()
+			return
+		case err := <-p.Err:
+			p.handleError(err)
+		case <-stallTicker.C:
+			p.checkStalled(ctx)
 		}
 	}
 }
 
-func (p *PoolWorker) worker(nameWorker int, pause chan struct{}) {
-	go func() {
-		defer close(pause)
-		for {
+func (p *PoolWorker) Status() PoolStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := PoolStatus{Workers: len(p.slots), Stalled: p.stalled, Restarts: p.restarts}
+	if p.lastError != nil {
+		status.LastError = p.lastError.Error()
+	}
+
+	var failing bool
+	for _, f := range p.failing {
+		failing = failing || f
+	}
+
+	switch {
+	case !p.started:
+		status.State = PoolStateStopped
+	case failing || status.Stalled > 0:
+		status.State = PoolStateDegraded
+	case time.Now().Before(p.pausedUntil):
+		status.State = PoolStatePaused
+		pausedUntil := p.pausedUntil
+		status.PausedUntil = &pausedUntil
+	default:
+		status.State = PoolStateRunning
+	}
+	return status
+}
+
+// supervise restarts loop with exponential backoff each time it fails or panics.
+func (p *PoolWorker) supervise(ctx context.Context, name string, loop func(ctx context.Context) error) {
+	backoff := p.backoff
+	for {
+		err := runRecovered(ctx, loop)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			return
+		}
+
+		internal.Log.Error("loop of integration is failed", zap.String("loop", name), zap.Error(err))
+		p.mu.Lock()
+		p.failing[name] = true
+		p.restarts++
+		p.lastError = fmt.Errorf("%s %w", name, err)
+		p.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		internal.Logf.Infof("restart %s after %v", name, backoff)
+		backoff = backoff * 2
+		if backoff > maxRestartBackoff {
+			backoff = maxRestartBackoff
+		}
+	}
+}
+
+func runRecovered(ctx context.Context, loop func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return loop(ctx)
+}
+
+func (p *PoolWorker) setFailing(name string, failing bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failing[name] = failing
+}
+
+func (p *PoolWorker) poll(ctx context.Context, requestTime *time.Ticker) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-requestTime.C:
+		}
+		if p.isPaused() {
+			continue
+		}
+
+		numbers, err := p.serviceUser.GetOrdersNotProcessed(ctx)
+		if err != nil {
+			return err
+		}
+		p.setFailing("poller", false)
+		for _, n := range numbers {
 			select {
-			case order := <-p.orderIn:
-				internal.Logf.Debugf("worker %d, order %s send request to accrual services", nameWorker, order)
-				accrual, err := p.client.CheckAccrual(order)
-				if err != nil {
-					p.Err <- fmt.Errorf("error worker %d %w", nameWorker, err)
-					break
-				}
-				internal.Logf.Debugf("worker %d, save %v in order", nameWorker, accrual)
-				err = p.serviceUser.UpdateOrder(accrual)
-				if err != nil {
-					p.Err <- fmt.Errorf("error worker %d %w", nameWorker, err)
-				}
-			case <-pause:
-				internal.Logf.Debugf("worker %d do pause", nameWorker)
-				time.Sleep(timeoutErrTooManyRequests)
+			case p.orderIn <- n:
+			case <-ctx.Done():
+				return nil
 			}
 		}
+	}
+}
+
+// startWorker starts a new generation of the worker in slot. The stalled generation
+// is released from the wait group so a hung request doesn't block shutdown.
+func (p *PoolWorker) startWorker(ctx context.Context, slot int) {
+	var once sync.Once
+	done := func() { once.Do(p.wg.Done) }
+	p.wg.Add(1)
+
+	p.mu.Lock()
+	p.slots[slot].generation++
+	p.slots[slot].done = done
+	generation := p.slots[slot].generation
+	p.mu.Unlock()
+
+	name := fmt.Sprintf("worker %d", slot)
+	go func() {
+		defer done()
+		p.supervise(ctx, name, func(ctx context.Context) error {
+			p.setFailing(name, false)
+			return p.worker(ctx, slot, generation)
+		})
 	}()
 }
+
+func (p *PoolWorker) worker(ctx context.Context, slot int, generation int) error {
+	for {
+		if !p.waitPause(ctx) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case order := <-p.orderIn:
+			if !p.waitPause(ctx) {
+				return nil
+			}
+			p.beginOrder(slot, order)
+			err := p.processOrder(slot, order)
+			if !p.endOrder(slot, generation) {
+				internal.Logf.Infof("worker %d of generation %d was replaced and finishes", slot, generation)
+				return nil
+			}
+			if errors.Is(err, clients.ErrTooManyRequests) {
+				p.pause()
+			}
+			if err != nil {
+				p.report(fmt.Errorf("error worker %d %w", slot, err))
+			}
+		}
+	}
+}
+
+func (p *PoolWorker) processOrder(slot int, order string) error {
+	internal.Logf.Debugf("worker %d, order %s send request to accrual services", slot, order)
+	accrual, err := p.client.CheckAccrual(order)
+	if err == nil || errors.Is(err, clients.ErrNoContent) {
+		now := time.Now()
+		if err := p.serviceUser.SaveOrderCheck(order, now, now.Add(p.pollInterval)); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	internal.Logf.Debugf("worker %d, save %v in order", slot, accrual)
+	return p.serviceUser.UpdateOrder(accrual, internal.UpdateSourcePoll)
+}
+
+func (p *PoolWorker) beginOrder(slot int, order string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.slots[slot].order = order
+	p.slots[slot].busySince = time.Now()
+}
+
+func (p *PoolWorker) endOrder(slot int, generation int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.slots[slot]
+	if s.generation != generation {
+		p.stalled--
+		return false
+	}
+	s.order = ""
+	s.busySince = time.Time{}
+	return true
+}
+
+// report never blocks the worker, the error is dropped when the buffer is full.
+func (p *PoolWorker) report(err error) {
+	select {
+	case p.Err <- err:
+	default:
+		internal.Log.Warn("error buffer of integration is full", zap.Error(err))
+	}
+}
+
+func (p *PoolWorker) handleError(err error) {
+	if errors.Is(err, clients.ErrNoContent) {
+		internal.Log.Debug("order isn't registered in accrual system", zap.Error(err))
+		return
+	}
+	internal.Log.Error("error integration", zap.Error(err))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastError = err
+}
+
+func (p *PoolWorker) pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pausedUntil = time.Now().Add(p.pauseTimeout)
+}
+
+// checkStalled replaces workers which process one order longer than stallTimeout.
+func (p *PoolWorker) checkStalled(ctx context.Context) {
+	p.mu.Lock()
+	stalled := make([]int, 0)
+	for i, slot := range p.slots {
+		if slot.busySince.IsZero() || time.Since(slot.busySince) < p.stallTimeout {
+			continue
+		}
+		internal.Logf.Errorf("worker %d is stalled on order %s since %v", i, slot.order, slot.busySince)
+		p.stalled++
+		slot.order = ""
+		slot.busySince = time.Time{}
+		slot.done()
+		stalled = append(stalled, i)
+	}
+	p.mu.Unlock()
+
+	for _, slot := range stalled {
+		p.startWorker(ctx, slot)
+	}
+}
+
+func (p *PoolWorker) isPaused() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return time.Now().Before(p.pausedUntil)
+}
+
+func (p *PoolWorker) waitPause(ctx context.Context) bool {
+	p.mu.Lock()
+	wait := time.Until(p.pausedUntil)
+	p.mu.Unlock()
+	if wait <= 0 {
+		return true
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(wait):
+		return true
+	}
+}
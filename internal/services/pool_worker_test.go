@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/clients"
+	mock "github.com/bonus2k/go-musthave-diploma-tpl/internal/mocks"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/ordernumber"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories/memory"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeAccrual struct {
+	mu      sync.Mutex
+	checked []string
+	block   map[string]chan struct{}
+	errs    map[string]error
+}
+
+func newFakeAccrual() *fakeAccrual {
+	return &fakeAccrual{block: make(map[string]chan struct{}), errs: make(map[string]error)}
+}
+
+func (f *fakeAccrual) CheckAccrual(number string) (*internal.AccrualDto, error) {
+	f.mu.Lock()
+	f.checked = append(f.checked, number)
+	block := f.block[number]
+	err := f.errs[number]
+	f.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &internal.AccrualDto{Order: number, Status: string(internal.OrderStatusProcessed), Accrual: 10}, nil
+}
+
+func (f *fakeAccrual) count(number string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var count int
+	for _, n := range f.checked {
+		if n == number {
+			count++
+		}
+	}
+	return count
+}
+
+func orders(numbers ...string) *[]internal.Order {
+	list := make([]internal.Order, 0)
+	for _, n := range numbers {
+		list = append(list, internal.Order{Number: n, Status: internal.OrderStatusNew})
+	}
+	return &list
+}
+
+func newTestPool(provider AccrualProvider, store *mock.MockStore) *PoolWorker {
+	store.EXPECT().SaveOrderCheck(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	pool := NewPoolWorker(provider, NewUserService(store, ordernumber.DefaultSources(), nil, nil), 5*time.Millisecond)
+	pool.backoff = 10 * time.Millisecond
+	pool.stallTimeout = 50 * time.Millisecond
+	pool.checkStall = 10 * time.Millisecond
+	pool.pauseTimeout = 200 * time.Millisecond
+	return pool
+}
+
+func startTestPool(t *testing.T, pool *PoolWorker, countWorker int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ticker := time.NewTicker(5 * time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pool.StarIntegration(ctx, countWorker, ticker)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		ticker.Stop()
+		<-done
+	})
+}
+
+func TestPoolWorker_EmptyListDoesNotStopPolling(t *testing.T) {
+	store := getStore(t)
+	provider := newFakeAccrual()
+	gomock.InOrder(
+		store.EXPECT().GetOrdersNotProcessed(gomock.Any()).Return(orders(), nil).Times(3),
+		store.EXPECT().GetOrdersNotProcessed(gomock.Any()).Return(orders("4539088167512356"), nil).AnyTimes(),
+	)
+	store.EXPECT().UpdateOrder(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	pool := newTestPool(provider, store)
+	startTestPool(t, pool, 2)
+
+	assert.Eventually(t, func() bool {
+		return provider.count("4539088167512356") > 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, PoolStateRunning, pool.Status().State)
+	assert.Equal(t, 0, pool.Status().Restarts)
+}
+
+func TestPoolWorker_RestartPollerAfterFailure(t *testing.T) {
+	store := getStore(t)
+	provider := newFakeAccrual()
+	release := make(chan struct{})
+	gomock.InOrder(
+		store.EXPECT().GetOrdersNotProcessed(gomock.Any()).Return(nil, errors.New("connection refused")).Times(2),
+		store.EXPECT().GetOrdersNotProcessed(gomock.Any()).DoAndReturn(
+			func(ctx context.Context) (*[]internal.Order, error) {
+				<-release
+				return orders("4539088167512356"), nil
+			}).Times(1),
+		store.EXPECT().GetOrdersNotProcessed(gomock.Any()).Return(orders("4539088167512356"), nil).AnyTimes(),
+	)
+	store.EXPECT().UpdateOrder(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	pool := newTestPool(provider, store)
+	startTestPool(t, pool, 1)
+
+	assert.Eventually(t, func() bool {
+		return pool.Status().Restarts == 2
+	}, time.Second, 5*time.Millisecond)
+	status := pool.Status()
+	assert.Equal(t, PoolStateDegraded, status.State)
+	assert.Contains(t, status.LastError, "connection refused")
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		return provider.count("4539088167512356") > 0 && pool.Status().State == PoolStateRunning
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestPoolWorker_PauseOnTooManyRequests(t *testing.T) {
+	store := getStore(t)
+	provider := newFakeAccrual()
+	provider.errs["4539088167512356"] = clients.ErrTooManyRequests
+	store.EXPECT().GetOrdersNotProcessed(gomock.Any()).Return(orders("4539088167512356"), nil).AnyTimes()
+
+	pool := newTestPool(provider, store)
+	startTestPool(t, pool, 1)
+
+	assert.Eventually(t, func() bool {
+		return pool.Status().State == PoolStatePaused
+	}, time.Second, 5*time.Millisecond)
+	checked := provider.count("4539088167512356")
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, checked, provider.count("4539088167512356"), "workers must not call accrual during pause")
+}
+
+func TestPoolWorker_ReplaceStalledWorker(t *testing.T) {
+	store := getStore(t)
+	provider := newFakeAccrual()
+	unblock := make(chan struct{})
+	provider.block["4539088167512356"] = unblock
+	gomock.InOrder(
+		store.EXPECT().GetOrdersNotProcessed(gomock.Any()).Return(orders("4539088167512356"), nil).Times(1),
+		store.EXPECT().GetOrdersNotProcessed(gomock.Any()).Return(orders("3536137811022331"), nil).AnyTimes(),
+	)
+	store.EXPECT().UpdateOrder(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	pool := newTestPool(provider, store)
+	startTestPool(t, pool, 1)
+
+	assert.Eventually(t, func() bool {
+		return pool.Status().Stalled == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, PoolStateDegraded, pool.Status().State)
+	assert.Eventually(t, func() bool {
+		return provider.count("3536137811022331") > 0
+	}, time.Second, 5*time.Millisecond, "replacement worker must process new orders")
+
+	close(unblock)
+	assert.Eventually(t, func() bool {
+		return pool.Status().Stalled == 0 && pool.Status().State == PoolStateRunning
+	}, time.Second, 5*time.Millisecond)
+}
+
+// TestPoolWorker_SaveOrderCheck counts the checks answered by the accrual system, the
+// rejected request isn't a check.
+func TestPoolWorker_SaveOrderCheck(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	us := NewUserService(store, ordernumber.DefaultSources(), nil, nil)
+	user, err := us.CreateNewUser(ctx, &internal.UserDto{Login: "user", Pass: "password"})
+	require.NoError(t, err)
+	for _, number := range []string{"4539088167512356", "3536137811022331", "79927398713"} {
+		require.NoError(t, us.AddOrder(ctx, user.ID.String(), "", number))
+	}
+	provider := newFakeAccrual()
+	provider.errs["3536137811022331"] = clients.ErrNoContent
+	provider.errs["79927398713"] = clients.ErrTooManyRequests
+	pool := NewPoolWorker(provider, us, time.Minute)
+
+	assert.NoError(t, pool.processOrder(0, "4539088167512356"))
+	assert.ErrorIs(t, pool.processOrder(0, "3536137811022331"), clients.ErrNoContent)
+	assert.ErrorIs(t, pool.processOrder(0, "3536137811022331"), clients.ErrNoContent)
+	assert.ErrorIs(t, pool.processOrder(0, "79927398713"), clients.ErrTooManyRequests)
+
+	tests := []struct {
+		number    string
+		pollCount int
+	}{
+		{number: "4539088167512356", pollCount: 1},
+		{number: "3536137811022331", pollCount: 2},
+		{number: "79927398713", pollCount: 0},
+	}
+	for _, tt := range tests {
+		order, err := store.GetOrder(ctx, tt.number)
+		require.NoError(t, err)
+		assert.Equal(t, tt.pollCount, order.PollCount, "order %s", tt.number)
+		if tt.pollCount == 0 {
+			assert.Nil(t, order.CheckedAt)
+			assert.Nil(t, order.NextCheckAt)
+			continue
+		}
+		require.NotNil(t, order.CheckedAt)
+		require.NotNil(t, order.NextCheckAt)
+		assert.Equal(t, time.Minute, order.NextCheckAt.Sub(*order.CheckedAt))
+	}
+}
+
+func TestPoolWorker_Status(t *testing.T) {
+	pool := NewPoolWorker(newFakeAccrual(), NewUserService(getStore(t), ordernumber.DefaultSources(), nil, nil), 5*time.Millisecond)
+	assert.Equal(t, PoolStateStopped, pool.Status().State)
+}
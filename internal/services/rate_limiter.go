@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"go.uber.org/zap"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rateSweepInterval = time.Minute
+
+// ParseRateLimit reads the limit written as "requests/period", e.g. "60/1m".
+func ParseRateLimit(value string) (internal.RateLimit, error) {
+	count, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return internal.RateLimit{}, fmt.Errorf("rate limit %q isn't requests/period", value)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(count))
+	if err != nil || limit <= 0 {
+		return internal.RateLimit{}, fmt.Errorf("wrong number of requests in rate limit %q", value)
+	}
+	duration, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || duration <= 0 {
+		return internal.RateLimit{}, fmt.Errorf("wrong period in rate limit %q", value)
+	}
+	return internal.RateLimit{Limit: limit, Period: duration}, nil
+}
+
+func rateDecision(bucket *internal.RateBucket, limit internal.RateLimit) *internal.RateDecision {
+	rate := limit.Rate()
+	decision := &internal.RateDecision{
+		Allowed:   bucket.Allowed,
+		Limit:     limit.Limit,
+		Remaining: int(math.Max(0, math.Floor(bucket.Tokens))),
+		Reset:     secondsToDuration((float64(limit.Limit) - bucket.Tokens) / rate),
+	}
+	if !bucket.Allowed {
+		decision.RetryAfter = secondsToDuration((1 - bucket.Tokens) / rate)
+	}
+	return decision
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Max(0, seconds) * float64(time.Second))
+}
+
+type memoryBucket struct {
+	tokens float64
+	update time.Time
+	period time.Duration
+}
+
+// MemoryRateLimiter keeps the buckets in the memory of the replica.
+type MemoryRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	sweptAt time.Time
+	now     func() time.Time
+}
+
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return &MemoryRateLimiter{buckets: make(map[string]*memoryBucket), now: time.Now}
+}
+
+func (l *MemoryRateLimiter) Take(_ context.Context, key string, limit internal.RateLimit) (*internal.RateDecision, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: float64(limit.Limit), update: now}
+		l.buckets[key] = b
+	}
+	elapsed := math.Max(0, now.Sub(b.update).Seconds())
+	b.tokens = math.Min(float64(limit.Limit), b.tokens+elapsed*limit.Rate())
+	b.update = now
+	b.period = limit.Period
+
+	bucket := internal.RateBucket{Tokens: b.tokens, Allowed: b.tokens >= 1}
+	if bucket.Allowed {
+		b.tokens--
+		bucket.Tokens = b.tokens
+	}
+	return rateDecision(&bucket, limit), nil
+}
+
+// sweep drops the buckets which are full already, they are the same as the new ones.
+func (l *MemoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.sweptAt) < rateSweepInterval {
+		return
+	}
+	l.sweptAt = now
+	for key, b := range l.buckets {
+		if now.Sub(b.update) >= b.period {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// StoreRateLimiter shares the buckets between the replicas through the store.
+type StoreRateLimiter struct {
+	db   repositories.Store
+	idle time.Duration
+}
+
+// NewStoreRateLimiter returns the limiter which deletes the buckets untouched for idle,
+// it should be the longest period of the limits.
+func NewStoreRateLimiter(storage repositories.Store, idle time.Duration) *StoreRateLimiter {
+	return &StoreRateLimiter{db: storage, idle: idle}
+}
+
+func (l *StoreRateLimiter) Take(ctx context.Context, key string, limit internal.RateLimit) (*internal.RateDecision, error) {
+	bucket, err := l.db.TakeRateToken(ctx, key, limit)
+	if err != nil {
+		return nil, err
+	}
+	return rateDecision(bucket, limit), nil
+}
+
+// Start deletes the idle buckets on every tick until ctx is done.
+func (l *StoreRateLimiter) Start(ctx context.Context, requestTime *time.Ticker) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-requestTime.C:
+		}
+		count, err := l.db.DeleteRateBuckets(ctx, l.idle)
+		if err != nil {
+			internal.Log.Error("error delete of idle rate buckets", zap.Error(err))
+			continue
+		}
+		internal.Logf.Debugf("%d idle rate buckets are deleted", count)
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    internal.RateLimit
+		wantErr bool
+	}{
+		{name: "per minute", value: "60/1m", want: internal.RateLimit{Limit: 60, Period: time.Minute}},
+		{name: "spaces", value: " 10 / 30s ", want: internal.RateLimit{Limit: 10, Period: 30 * time.Second}},
+		{name: "without period", value: "60", wantErr: true},
+		{name: "zero requests", value: "0/1m", wantErr: true},
+		{name: "wrong requests", value: "many/1m", wantErr: true},
+		{name: "wrong period", value: "60/minute", wantErr: true},
+		{name: "negative period", value: "60/-1m", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRateLimit(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMemoryRateLimiter_Take(t *testing.T) {
+	now := time.Date(2023, 11, 10, 14, 0, 0, 0, time.UTC)
+	limiter := NewMemoryRateLimiter()
+	limiter.now = func() time.Time { return now }
+	limit := internal.RateLimit{Limit: 3, Period: 3 * time.Second}
+	ctx := context.Background()
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		decision, err := limiter.Take(ctx, "user:1", limit)
+		require.NoError(t, err)
+		assert.True(t, decision.Allowed)
+		assert.Equal(t, remaining, decision.Remaining)
+		assert.Equal(t, 3, decision.Limit)
+	}
+	decision, err := limiter.Take(ctx, "user:1", limit)
+	require.NoError(t, err)
+	assert.False(t, decision.Allowed, "bucket is empty")
+	assert.Equal(t, time.Second, decision.RetryAfter)
+	assert.Equal(t, 3*time.Second, decision.Reset)
+
+	decision, err = limiter.Take(ctx, "user:2", limit)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed, "another key has own bucket")
+
+	now = now.Add(1500 * time.Millisecond)
+	decision, err = limiter.Take(ctx, "user:1", limit)
+	require.NoError(t, err)
+	assert.True(t, decision.Allowed, "bucket is refilled")
+	assert.Equal(t, 0, decision.Remaining)
+
+	now = now.Add(time.Hour)
+	decision, err = limiter.Take(ctx, "user:1", limit)
+	require.NoError(t, err)
+	assert.Equal(t, 2, decision.Remaining, "bucket isn't refilled over limit")
+	assert.Len(t, limiter.buckets, 1, "full buckets are swept")
+}
+
+func TestStoreRateLimiter_Take(t *testing.T) {
+	mockStore := getStore(t)
+	limit := internal.RateLimit{Limit: 10, Period: 10 * time.Second}
+	mockStore.EXPECT().TakeRateToken(gomock.Any(), "orders:user:1", limit).Return(&internal.RateBucket{Tokens: 4.5, Allowed: true}, nil)
+	mockStore.EXPECT().TakeRateToken(gomock.Any(), "orders:user:1", limit).Return(&internal.RateBucket{Tokens: 0.25, Allowed: false}, nil)
+	mockStore.EXPECT().TakeRateToken(gomock.Any(), "orders:user:1", limit).Return(nil, errors.New("db is down"))
+	limiter := NewStoreRateLimiter(mockStore, time.Minute)
+
+	decision, err := limiter.Take(context.Background(), "orders:user:1", limit)
+	require.NoError(t, err)
+	assert.Equal(t, &internal.RateDecision{Allowed: true, Limit: 10, Remaining: 4, Reset: 5500 * time.Millisecond}, decision)
+
+	decision, err = limiter.Take(context.Background(), "orders:user:1", limit)
+	require.NoError(t, err)
+	assert.Equal(t, &internal.RateDecision{Allowed: false, Limit: 10, Remaining: 0, Reset: 9750 * time.Millisecond, RetryAfter: 750 * time.Millisecond}, decision)
+
+	_, err = limiter.Take(context.Background(), "orders:user:1", limit)
+	assert.Error(t, err)
+}
+
+func TestStoreRateLimiter_Start(t *testing.T) {
+	mockStore := getStore(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	mockStore.EXPECT().DeleteRateBuckets(gomock.Any(), time.Minute).DoAndReturn(func(context.Context, time.Duration) (int64, error) {
+		cancel()
+		return 1, nil
+	})
+	limiter := NewStoreRateLimiter(mockStore, time.Minute)
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		limiter.Start(ctx, ticker)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Start() isn't stopped")
+	}
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"crypto/rand"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// referralCodeAlphabet has no letters and digits which are easy to confuse, e.g. O and 0.
+	referralCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	referralCodeLength   = 8
+)
+
+// DefaultReferralProgram is the referral program used when it isn't configured.
+const DefaultReferralProgram = "referrer=100,referee=50,min-accrual=100,limit=10/720h"
+
+// ReferralRule refuses the referral which mustn't be credited, the error wraps ErrReferralRefused.
+type ReferralRule interface {
+	Check(referral *internal.Referral, now time.Time) error
+}
+
+// NotSelfReferral refuses the referral whose referrer and referee are the same user.
+type NotSelfReferral struct{}
+
+func (NotSelfReferral) Check(referral *internal.Referral, now time.Time) error {
+	if referral.Referrer.ID == referral.Referee.ID {
+		return fmt.Errorf("user %s is own referrer, %w", referral.Referee.ID, errors2.ErrReferralRefused)
+	}
+	return nil
+}
+
+// ReferralMinAccrual refuses the referral whose processed order has the base accrual
+// less than Sum, so the bonuses can't be farmed with cheap orders.
+type ReferralMinAccrual struct {
+	Sum float32
+}
+
+func (r ReferralMinAccrual) Check(referral *internal.Referral, now time.Time) error {
+	if accrual := referral.Order.BaseAccrual(); accrual < r.Sum {
+		return fmt.Errorf("order %s has accrual %v less than %v, %w",
+			referral.Order.Number, accrual, r.Sum, errors2.ErrReferralRefused)
+	}
+	return nil
+}
+
+// ReferralLimit refuses the referral when the referrer has got the bonuses for Limit.Limit
+// referrals in the last Limit.Period.
+type ReferralLimit struct {
+	Limit internal.RateLimit
+}
+
+func (r ReferralLimit) Check(referral *internal.Referral, now time.Time) error {
+	var count int
+	since := now.Add(-r.Limit.Period)
+	for _, credit := range referral.ReferrerCredits {
+		if credit.CreateAt.After(since) {
+			count++
+		}
+	}
+	if count >= r.Limit.Limit {
+		return fmt.Errorf("referrer %s has got %d bonuses in %v, %w",
+			referral.Referrer.ID, count, r.Limit.Period, errors2.ErrReferralRefused)
+	}
+	return nil
+}
+
+// ReferralProgram credits ReferrerBonus to the referrer and RefereeBonus to the referee
+// when the referral passes all Rules.
+type ReferralProgram struct {
+	ReferrerBonus float32
+	RefereeBonus  float32
+	Rules         []ReferralRule
+}
+
+// Credits returns the bonuses of the referral, the zero bonus isn't credited.
+func (p *ReferralProgram) Credits(referral *internal.Referral) (*[]internal.ReferralCredit, error) {
+	now := time.Now()
+	for _, rule := range p.Rules {
+		if err := rule.Check(referral, now); err != nil {
+			return nil, err
+		}
+	}
+	credits := make([]internal.ReferralCredit, 0, 2)
+	for _, party := range []struct {
+		user  uuid.UUID
+		role  internal.ReferralRole
+		bonus float32
+	}{
+		{referral.Referrer.ID, internal.ReferralRoleReferrer, p.ReferrerBonus},
+		{referral.Referee.ID, internal.ReferralRoleReferee, p.RefereeBonus},
+	} {
+		if party.bonus <= 0 {
+			continue
+		}
+		credits = append(credits, internal.ReferralCredit{
+			ID:        uuid.New(),
+			CreateAt:  now,
+			UserID:    party.user,
+			RefereeID: referral.Referee.ID,
+			Role:      party.role,
+			Order:     referral.Order.Number,
+			Sum:       party.bonus,
+		})
+	}
+	return &credits, nil
+}
+
+// ParseReferralProgram reads the program written as "referrer=100,referee=50,min-accrual=100,limit=10/720h",
+// the limit is the number of credited referrals of one referrer per period. The empty program
+// and "off" disable the referral bonuses and are returned as nil.
+func ParseReferralProgram(value string) (*ReferralProgram, error) {
+	if value = strings.TrimSpace(value); value == "" || value == "off" {
+		return nil, nil
+	}
+	program := &ReferralProgram{Rules: []ReferralRule{NotSelfReferral{}}}
+	for _, part := range strings.Split(value, ",") {
+		name, arg, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("referral program rule %q isn't name=value", part)
+		}
+		name, arg = strings.TrimSpace(name), strings.TrimSpace(arg)
+		switch name {
+		case "referrer", "referee", "min-accrual":
+			sum, err := strconv.ParseFloat(arg, 32)
+			if err != nil || sum < 0 {
+				return nil, fmt.Errorf("wrong sum in referral program rule %q", part)
+			}
+			switch name {
+			case "referrer":
+				program.ReferrerBonus = float32(sum)
+			case "referee":
+				program.RefereeBonus = float32(sum)
+			default:
+				program.Rules = append(program.Rules, ReferralMinAccrual{Sum: float32(sum)})
+			}
+		case "limit":
+			limit, err := ParseRateLimit(arg)
+			if err != nil {
+				return nil, err
+			}
+			program.Rules = append(program.Rules, ReferralLimit{Limit: limit})
+		default:
+			return nil, fmt.Errorf("unknown referral program rule %q", part)
+		}
+	}
+	return program, nil
+}
+
+// newReferralCode returns the random code of referralCodeLength symbols of referralCodeAlphabet.
+func newReferralCode() (string, error) {
+	random := make([]byte, referralCodeLength)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("can't create referral code %w", err)
+	}
+	code := make([]byte, referralCodeLength)
+	for i, b := range random {
+		code[i] = referralCodeAlphabet[int(b)%len(referralCodeAlphabet)]
+	}
+	return string(code), nil
+}
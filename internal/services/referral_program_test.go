@@ -0,0 +1,142 @@
+package services
+
+import (
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseReferralProgram(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    *ReferralProgram
+		wantErr bool
+	}{
+		{name: "empty", value: ""},
+		{name: "off", value: " off "},
+		{
+			name:  "default",
+			value: DefaultReferralProgram,
+			want: &ReferralProgram{ReferrerBonus: 100, RefereeBonus: 50, Rules: []ReferralRule{
+				NotSelfReferral{},
+				ReferralMinAccrual{Sum: 100},
+				ReferralLimit{Limit: internal.RateLimit{Limit: 10, Period: 720 * time.Hour}},
+			}},
+		},
+		{
+			name:  "referrer only",
+			value: "referrer = 25.5",
+			want:  &ReferralProgram{ReferrerBonus: 25.5, Rules: []ReferralRule{NotSelfReferral{}}},
+		},
+		{name: "without value", value: "referrer", wantErr: true},
+		{name: "wrong sum", value: "referee=many", wantErr: true},
+		{name: "negative sum", value: "min-accrual=-1", wantErr: true},
+		{name: "wrong limit", value: "limit=10", wantErr: true},
+		{name: "unknown rule", value: "referrer=100,bonus=1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseReferralProgram(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestReferralProgram_Credits(t *testing.T) {
+	now := time.Now()
+	referrer := internal.User{ID: uuid.New()}
+	referee := internal.User{ID: uuid.New()}
+	referral := func(accrual float32, credited ...time.Time) *internal.Referral {
+		r := &internal.Referral{
+			Referrer: referrer,
+			Referee:  referee,
+			Order:    internal.Order{Number: "4539088167512356", Accrual: accrual},
+		}
+		for _, at := range credited {
+			r.ReferrerCredits = append(r.ReferrerCredits, internal.ReferralCredit{CreateAt: at, Role: internal.ReferralRoleReferrer})
+		}
+		return r
+	}
+	program, err := ParseReferralProgram("referrer=100,referee=50,min-accrual=100,limit=2/24h")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		program  *ReferralProgram
+		referral *internal.Referral
+		want     map[internal.ReferralRole]float32
+		wantErr  bool
+	}{
+		{
+			name:     "credited",
+			program:  program,
+			referral: referral(100, now.Add(-25*time.Hour), now.Add(-25*time.Hour), now.Add(-time.Hour)),
+			want:     map[internal.ReferralRole]float32{internal.ReferralRoleReferrer: 100, internal.ReferralRoleReferee: 50},
+		},
+		{
+			name:     "zero bonus",
+			program:  &ReferralProgram{ReferrerBonus: 100},
+			referral: referral(1),
+			want:     map[internal.ReferralRole]float32{internal.ReferralRoleReferrer: 100},
+		},
+		{
+			name:     "small accrual",
+			program:  program,
+			referral: referral(99.9),
+			wantErr:  true,
+		},
+		{
+			name:     "limit",
+			program:  program,
+			referral: referral(100, now.Add(-2*time.Hour), now.Add(-time.Hour)),
+			wantErr:  true,
+		},
+		{
+			name:     "self referral",
+			program:  program,
+			referral: &internal.Referral{Referrer: referee, Referee: referee, Order: internal.Order{Accrual: 100}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			credits, err := tt.program.Credits(tt.referral)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, errors2.ErrReferralRefused)
+				return
+			}
+			require.NoError(t, err)
+			got := make(map[internal.ReferralRole]float32)
+			for _, credit := range *credits {
+				got[credit.Role] = credit.Sum
+				assert.Equal(t, referee.ID, credit.RefereeID)
+				assert.Equal(t, "4539088167512356", credit.Order)
+				if credit.Role == internal.ReferralRoleReferrer {
+					assert.Equal(t, referrer.ID, credit.UserID)
+				} else {
+					assert.Equal(t, referee.ID, credit.UserID)
+				}
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_newReferralCode(t *testing.T) {
+	code, err := newReferralCode()
+	require.NoError(t, err)
+	assert.Regexp(t, `^[A-HJ-NP-Z2-9]{8}$`, code)
+	other, err := newReferralCode()
+	require.NoError(t, err)
+	assert.NotEqual(t, code, other)
+}
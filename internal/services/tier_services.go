@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultLoyaltyTiers are the tiers used when they aren't configured.
+const DefaultLoyaltyTiers = "bronze=from:0,campaign:1,withdraw:5000/24h;" +
+	"silver=from:1000,campaign:1.25,withdraw:20000/24h;gold=from:5000,campaign:1.5"
+
+// tierNames are the tiers from the lowest to the highest.
+var tierNames = []internal.Tier{internal.TierBronze, internal.TierSilver, internal.TierGold}
+
+// LoyaltyTier is reached by the user with MinAccrual points accrued in the last 12 months.
+// CampaignFactor multiplies the bonuses of the campaigns, the user can withdraw at most
+// WithdrawalLimit points in WithdrawalPeriod and the zero limit doesn't limit them.
+type LoyaltyTier struct {
+	Name             internal.Tier
+	MinAccrual       float32
+	CampaignFactor   float32
+	WithdrawalLimit  float32
+	WithdrawalPeriod time.Duration
+}
+
+// LoyaltyTiers are the tiers from the lowest to the highest, the empty tiers are disabled.
+type LoyaltyTiers []LoyaltyTier
+
+// Tier returns the tier of the name, the unknown tier is the lowest one. It's nil when
+// the tiers are disabled.
+func (t LoyaltyTiers) Tier(name internal.Tier) *LoyaltyTier {
+	if len(t) == 0 {
+		return nil
+	}
+	for i := range t {
+		if t[i].Name == name {
+			return &t[i]
+		}
+	}
+	return &t[0]
+}
+
+// Next returns the tier after the tier of the name, it's nil for the highest tier.
+func (t LoyaltyTiers) Next(name internal.Tier) *LoyaltyTier {
+	for i := range t {
+		if t[i].Name == name && i+1 < len(t) {
+			return &t[i+1]
+		}
+	}
+	return nil
+}
+
+// ForAccrual returns the highest tier reached with the accrual.
+func (t LoyaltyTiers) ForAccrual(accrual float32) *LoyaltyTier {
+	var tier *LoyaltyTier
+	for i := range t {
+		if accrual >= t[i].MinAccrual {
+			tier = &t[i]
+		}
+	}
+	return tier
+}
+
+// ParseLoyaltyTiers reads the tiers written as "bronze=from:0,campaign:1,withdraw:5000/24h;silver=from:1000,...",
+// from is the points accrued in the last 12 months, campaign is the factor of the bonuses of
+// the campaigns and withdraw is the limit of the withdrawals per period, the tier without
+// it doesn't limit them. All tiers must be set, bronze is reached from 0. The empty tiers
+// and "off" disable them and are returned as nil.
+func ParseLoyaltyTiers(value string) (LoyaltyTiers, error) {
+	if value = strings.TrimSpace(value); value == "" || value == "off" {
+		return nil, nil
+	}
+	parsed := make(map[internal.Tier]LoyaltyTier)
+	for _, part := range strings.Split(value, ";") {
+		name, rules, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("loyalty tier %q isn't tier=rule,rule", part)
+		}
+		tier := LoyaltyTier{Name: internal.Tier(strings.ToUpper(strings.TrimSpace(name))), CampaignFactor: 1}
+		if !isTierName(tier.Name) {
+			return nil, fmt.Errorf("unknown loyalty tier %q", name)
+		}
+		if _, ok := parsed[tier.Name]; ok {
+			return nil, fmt.Errorf("loyalty tier %q is repeated", name)
+		}
+		if err := parseTierRules(&tier, rules); err != nil {
+			return nil, err
+		}
+		parsed[tier.Name] = tier
+	}
+
+	tiers := make(LoyaltyTiers, 0, len(tierNames))
+	for _, name := range tierNames {
+		tier, ok := parsed[name]
+		if !ok {
+			return nil, fmt.Errorf("loyalty tier %s isn't set", name)
+		}
+		if len(tiers) == 0 && tier.MinAccrual != 0 {
+			return nil, fmt.Errorf("loyalty tier %s must be reached from 0", name)
+		}
+		if len(tiers) > 0 && tier.MinAccrual <= tiers[len(tiers)-1].MinAccrual {
+			return nil, fmt.Errorf("loyalty tier %s must be reached after %s", name, tiers[len(tiers)-1].Name)
+		}
+		tiers = append(tiers, tier)
+	}
+	return tiers, nil
+}
+
+func parseTierRules(tier *LoyaltyTier, rules string) error {
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, ok := strings.Cut(strings.TrimSpace(rule), ":")
+		if !ok {
+			return fmt.Errorf("loyalty tier rule %q isn't name:value", rule)
+		}
+		name, arg = strings.TrimSpace(name), strings.TrimSpace(arg)
+		switch name {
+		case "from", "campaign":
+			number, err := strconv.ParseFloat(arg, 32)
+			if err != nil || number < 0 || (name == "campaign" && number < 1) {
+				return fmt.Errorf("wrong value in loyalty tier rule %q", rule)
+			}
+			if name == "from" {
+				tier.MinAccrual = float32(number)
+			} else {
+				tier.CampaignFactor = float32(number)
+			}
+		case "withdraw":
+			sum, period, ok := strings.Cut(arg, "/")
+			if !ok {
+				return fmt.Errorf("loyalty tier rule %q isn't withdraw:sum/period", rule)
+			}
+			limit, err := strconv.ParseFloat(strings.TrimSpace(sum), 32)
+			if err != nil || limit <= 0 {
+				return fmt.Errorf("wrong sum in loyalty tier rule %q", rule)
+			}
+			duration, err := time.ParseDuration(strings.TrimSpace(period))
+			if err != nil || duration <= 0 {
+				return fmt.Errorf("wrong period in loyalty tier rule %q", rule)
+			}
+			tier.WithdrawalLimit, tier.WithdrawalPeriod = float32(limit), duration
+		default:
+			return fmt.Errorf("unknown loyalty tier rule %q", rule)
+		}
+	}
+	return nil
+}
+
+func isTierName(name internal.Tier) bool {
+	for _, tier := range tierNames {
+		if tier == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTimeOfDay reads the time of day written as "03:00" and returns it as the duration
+// since midnight.
+func ParseTimeOfDay(value string) (time.Duration, error) {
+	at, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("time of day %q isn't HH:MM", value)
+	}
+	return time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute, nil
+}
+
+// TierService recomputes the tiers of the users from the points accrued in the last 12 months.
+type TierService struct {
+	db    repositories.Store
+	tiers LoyaltyTiers
+}
+
+func NewTierService(storage repositories.Store, tiers LoyaltyTiers) *TierService {
+	return &TierService{db: storage, tiers: tiers}
+}
+
+// Start recomputes the tiers every day at the time of day at in the time zone of the service.
+func (ts *TierService) Start(ctx context.Context, at time.Duration) {
+	for {
+		timer := time.NewTimer(time.Until(nextTierRecompute(time.Now(), at)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		changed, err := ts.Recompute(ctx)
+		if err != nil {
+			internal.Log.Error("error recompute of tiers", zap.Error(err))
+			continue
+		}
+		internal.Logf.Infof("tiers are recomputed, %d users changed tier", changed)
+	}
+}
+
+// Recompute saves the tier and the accrual of every user whose accrual in the last 12 months
+// is changed and returns the number of users whose tier is changed.
+func (ts *TierService) Recompute(ctx context.Context) (int, error) {
+	now := time.Now()
+	accruals, err := ts.db.GetTierAccruals(ctx, now.AddDate(-1, 0, 0))
+	if err != nil {
+		return 0, err
+	}
+	var changed int
+	for _, accrual := range *accruals {
+		tier := ts.tiers.ForAccrual(accrual.Accrual)
+		if tier == nil || (tier.Name == accrual.Tier && accrual.Accrual == accrual.TierAccrual) {
+			continue
+		}
+		change := &internal.TierChange{
+			UserID:   accrual.UserID,
+			CreateAt: now,
+			From:     accrual.Tier,
+			To:       tier.Name,
+			Accrual:  accrual.Accrual,
+		}
+		if err = ts.db.UpdateTier(ctx, change); err != nil {
+			return changed, fmt.Errorf("update tier of user %s, %w", accrual.UserID, err)
+		}
+		if change.From != change.To {
+			changed++
+			internal.Logf.Infof("user %s moves from tier %s to %s with accrual %v",
+				change.UserID, change.From, change.To, change.Accrual)
+		}
+	}
+	return changed, nil
+}
+
+// nextTierRecompute returns the first time of day at after now.
+func nextTierRecompute(now time.Time, at time.Duration) time.Time {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	next := midnight.Add(at)
+	if !next.After(now) {
+		next = midnight.AddDate(0, 0, 1).Add(at)
+	}
+	return next
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/ordernumber"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func defaultTiers(t *testing.T) LoyaltyTiers {
+	t.Helper()
+	tiers, err := ParseLoyaltyTiers(DefaultLoyaltyTiers)
+	require.NoError(t, err)
+	return tiers
+}
+
+func TestParseLoyaltyTiers(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    LoyaltyTiers
+		wantErr bool
+	}{
+		{name: "empty", value: ""},
+		{name: "off", value: " off "},
+		{
+			name:  "default",
+			value: DefaultLoyaltyTiers,
+			want: LoyaltyTiers{
+				{Name: internal.TierBronze, CampaignFactor: 1, WithdrawalLimit: 5000, WithdrawalPeriod: 24 * time.Hour},
+				{Name: internal.TierSilver, MinAccrual: 1000, CampaignFactor: 1.25, WithdrawalLimit: 20000, WithdrawalPeriod: 24 * time.Hour},
+				{Name: internal.TierGold, MinAccrual: 5000, CampaignFactor: 1.5},
+			},
+		},
+		{
+			name:  "any order of tiers",
+			value: " GOLD = from:300 ; silver=from:200,withdraw:10/1h;bronze=from:0",
+			want: LoyaltyTiers{
+				{Name: internal.TierBronze, CampaignFactor: 1},
+				{Name: internal.TierSilver, MinAccrual: 200, CampaignFactor: 1, WithdrawalLimit: 10, WithdrawalPeriod: time.Hour},
+				{Name: internal.TierGold, MinAccrual: 300, CampaignFactor: 1},
+			},
+		},
+		{name: "missing tier", value: "bronze=from:0;silver=from:100", wantErr: true},
+		{name: "unknown tier", value: "bronze=from:0;silver=from:100;gold=from:200;platinum=from:300", wantErr: true},
+		{name: "repeated tier", value: "bronze=from:0;silver=from:100;silver=from:200;gold=from:300", wantErr: true},
+		{name: "bronze from 100", value: "bronze=from:100;silver=from:200;gold=from:300", wantErr: true},
+		{name: "gold before silver", value: "bronze=from:0;silver=from:300;gold=from:300", wantErr: true},
+		{name: "campaign less than 1", value: "bronze=from:0,campaign:0.5;silver=from:100;gold=from:200", wantErr: true},
+		{name: "wrong withdraw", value: "bronze=from:0,withdraw:100;silver=from:100;gold=from:200", wantErr: true},
+		{name: "unknown rule", value: "bronze=from:0,bonus:1;silver=from:100;gold=from:200", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLoyaltyTiers(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoyaltyTiers(t *testing.T) {
+	tiers := defaultTiers(t)
+	for accrual, want := range map[float32]internal.Tier{
+		0:       internal.TierBronze,
+		999.99:  internal.TierBronze,
+		1000:    internal.TierSilver,
+		4999:    internal.TierSilver,
+		5000:    internal.TierGold,
+		1000000: internal.TierGold,
+	} {
+		assert.Equal(t, want, tiers.ForAccrual(accrual).Name, "tier of %v", accrual)
+	}
+	assert.Equal(t, internal.TierSilver, tiers.Next(internal.TierBronze).Name)
+	assert.Nil(t, tiers.Next(internal.TierGold))
+	assert.Equal(t, internal.TierBronze, tiers.Tier("").Name, "unknown tier is the lowest")
+
+	var disabled LoyaltyTiers
+	assert.Nil(t, disabled.Tier(internal.TierGold))
+	assert.Nil(t, disabled.ForAccrual(100))
+}
+
+func Test_nextTierRecompute(t *testing.T) {
+	at := 3 * time.Hour
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{name: "before", now: time.Date(2023, 11, 4, 1, 0, 0, 0, time.UTC), want: time.Date(2023, 11, 4, 3, 0, 0, 0, time.UTC)},
+		{name: "at", now: time.Date(2023, 11, 4, 3, 0, 0, 0, time.UTC), want: time.Date(2023, 11, 5, 3, 0, 0, 0, time.UTC)},
+		{name: "after", now: time.Date(2023, 11, 30, 23, 0, 0, 0, time.UTC), want: time.Date(2023, 12, 1, 3, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, nextTierRecompute(tt.now, at))
+		})
+	}
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+	at, err := ParseTimeOfDay("03:30")
+	require.NoError(t, err)
+	assert.Equal(t, 3*time.Hour+30*time.Minute, at)
+	_, err = ParseTimeOfDay("3am")
+	assert.Error(t, err)
+}
+
+// TestTierService_Recompute moves the user to the tier of the accrual of 12 months, the tier
+// increases the bonus of the campaign and is shown by the profile.
+func TestTierService_Recompute(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	tiers := defaultTiers(t)
+	us := NewUserService(store, ordernumber.DefaultSources(), nil, tiers)
+	ts := NewTierService(store, tiers)
+	silver, err := us.CreateNewUser(ctx, &internal.UserDto{Login: "silver", Pass: "password"})
+	require.NoError(t, err)
+	bronze, err := us.CreateNewUser(ctx, &internal.UserDto{Login: "bronze", Pass: "password"})
+	require.NoError(t, err)
+	require.NoError(t, us.AddOrder(ctx, silver.ID.String(), "", "4539088167512356"))
+	require.NoError(t, us.AddOrder(ctx, bronze.ID.String(), "", "79927398713"))
+	require.NoError(t, us.UpdateOrder(&internal.AccrualDto{Order: "4539088167512356", Status: "PROCESSED", Accrual: 1200}, internal.UpdateSourcePoll))
+	require.NoError(t, us.UpdateOrder(&internal.AccrualDto{Order: "79927398713", Status: "PROCESSED", Accrual: 100}, internal.UpdateSourcePoll))
+
+	changed, err := ts.Recompute(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, changed)
+	changed, err = ts.Recompute(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, changed, "tiers aren't changed twice")
+
+	profile, err := us.GetProfile(ctx, silver.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, "SILVER", profile.Tier)
+	assert.Equal(t, float32(1200), profile.TierAccrual)
+	assert.Equal(t, "GOLD", profile.NextTier)
+	assert.Equal(t, float32(3800), profile.ToNextTier)
+	assert.Equal(t, float32(1.25), profile.CampaignFactor)
+	assert.Equal(t, float32(20000), profile.WithdrawalLimit)
+	assert.Equal(t, "24h0m0s", profile.WithdrawalPeriod)
+	assert.NotNil(t, profile.TierUpdatedAt)
+	profile, err = us.GetProfile(ctx, bronze.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, "BRONZE", profile.Tier)
+	assert.Equal(t, float32(900), profile.ToNextTier)
+
+	events, err := store.ClaimOutboxEvents(ctx, 100, time.Minute)
+	require.NoError(t, err)
+	var tierEvents int
+	for _, event := range *events {
+		if event.Type == internal.EventTierChanged {
+			tierEvents++
+			assert.Equal(t, silver.ID, event.UserID)
+			assert.JSONEq(t, `{"from":"BRONZE","to":"SILVER","accrual":1200}`, string(event.Payload))
+		}
+	}
+	assert.Equal(t, 1, tierEvents)
+
+	cs := NewCampaignService(store)
+	_, err = cs.CreateCampaign(ctx, internal.CampaignDto{Name: "Double", Multiplier: 2,
+		StartsAt: time.Now().Add(-time.Hour), EndsAt: time.Now().Add(time.Hour)})
+	require.NoError(t, err)
+	require.NoError(t, us.AddOrder(ctx, silver.ID.String(), "", "3536137811022331"))
+	require.NoError(t, us.UpdateOrder(&internal.AccrualDto{Order: "3536137811022331", Status: "PROCESSED", Accrual: 100}, internal.UpdateSourcePoll))
+	order, err := us.GetOrder(ctx, silver.ID.String(), "3536137811022331")
+	require.NoError(t, err)
+	assert.Equal(t, float32(125), order.CampaignBonus, "bonus is increased by the factor of the tier")
+}
+
+// TestUserService_AddWithdraw_TierLimit refuses the withdrawal which exceeds the limit of the tier
+// with the withdrawals of the period.
+func TestUserService_AddWithdraw_TierLimit(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	tiers := defaultTiers(t)
+	us := NewUserService(store, ordernumber.DefaultSources(), nil, tiers)
+	user, err := us.CreateNewUser(ctx, &internal.UserDto{Login: "user", Pass: "password"})
+	require.NoError(t, err)
+	require.NoError(t, us.AddOrder(ctx, user.ID.String(), "", "4539088167512356"))
+	require.NoError(t, us.UpdateOrder(&internal.AccrualDto{Order: "4539088167512356", Status: "PROCESSED", Accrual: 6000}, internal.UpdateSourcePoll))
+
+	require.NoError(t, us.AddWithdraw(ctx, internal.WithdrawDto{Order: "2377225624", Sum: 3000}, user.ID.String(), ""))
+	err = us.AddWithdraw(ctx, internal.WithdrawDto{Order: "12345678903", Sum: 2500}, user.ID.String(), "")
+	assert.ErrorIs(t, err, errors2.ErrWithdrawalLimit)
+	require.NoError(t, us.AddWithdraw(ctx, internal.WithdrawDto{Order: "12345678903", Sum: 2000}, user.ID.String(), ""))
+
+	_, err = NewTierService(store, tiers).Recompute(ctx)
+	require.NoError(t, err)
+	require.NoError(t, us.AddWithdraw(ctx, internal.WithdrawDto{Order: "79927398713", Sum: 1000}, user.ID.String(), ""),
+		"gold tier isn't limited")
+	balance, err := us.GetBalance(ctx, user.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, float32(0), balance.Current)
+}
@@ -2,25 +2,37 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal/auth"
 	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/ordernumber"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
 	"github.com/google/uuid"
-	"strconv"
+	"math"
 	"strings"
 	"time"
 )
 
+// MaxBatchOrders is the limit of numbers in one batch upload.
+const MaxBatchOrders = 100
+
 type UserService struct {
-	db repositories.Store
+	db        repositories.Store
+	sources   ordernumber.Sources
+	referrals *ReferralProgram
+	tiers     LoyaltyTiers
 }
 
-func NewUserService(storage repositories.Store) *UserService {
-	return &UserService{db: storage}
+// NewUserService creates the service, nil referrals and tiers disable the referral bonuses and the tier rules.
+func NewUserService(storage repositories.Store, sources ordernumber.Sources, referrals *ReferralProgram,
+	tiers LoyaltyTiers) *UserService {
+	return &UserService{db: storage, sources: sources, referrals: referrals, tiers: tiers}
 }
 
+// CreateNewUser registers the user with a new referral code, the user registered with
+// the referral code of another user is the referee of that user.
 func (us *UserService) CreateNewUser(ctx context.Context, user *internal.UserDto) (*internal.User, error) {
 	if isIllegalUserArgument(user) {
 		return nil, errors2.ErrIllegalUserArgument
@@ -30,23 +42,38 @@ func (us *UserService) CreateNewUser(ctx context.Context, user *internal.UserDto
 	if err != nil {
 		return nil, fmt.Errorf("can't create password, %w", err)
 	}
-	entity := &internal.User{ID: uuid.New(), CreateAt: time.Now(), Login: user.Login, Password: password}
+	code, err := newReferralCode()
+	if err != nil {
+		return nil, err
+	}
+	entity := &internal.User{ID: uuid.New(), CreateAt: time.Now(), Login: user.Login, Password: password, ReferralCode: code}
+	if referralCode := strings.ToUpper(strings.TrimSpace(user.ReferralCode)); referralCode != "" {
+		referrer, err := us.db.FindUserByReferralCode(ctx, referralCode)
+		if errors.Is(err, errors2.ErrUserNotFound) {
+			return nil, fmt.Errorf("referral code %q, %w", user.ReferralCode, errors2.ErrIllegalReferralCode)
+		}
+		if err != nil {
+			return nil, err
+		}
+		entity.ReferredBy = &referrer.ID
+	}
 	if err := us.db.AddUser(ctx, entity); err != nil {
 		return nil, err
 	}
 	return entity, nil
 }
 
-func (us *UserService) AddOrder(ctx context.Context, id string, orderID string) error {
-	luna, ok := isLuna(orderID)
-	if !ok {
-		return errors2.ErrIllegalOrder
+// AddOrder uploads the number of the order from source, the number is saved normalized.
+func (us *UserService) AddOrder(ctx context.Context, id string, source string, orderID string) error {
+	number, err := us.sources.Validate(source, orderID)
+	if err != nil {
+		return err
 	}
 	userID, err := uuid.Parse(id)
 	if err != nil {
 		return err
 	}
-	order := &internal.Order{ID: uuid.New(), CreateAt: time.Now(), Number: int64(luna), Status: internal.OrderStatusNew, UserID: userID}
+	order := &internal.Order{ID: uuid.New(), CreateAt: time.Now(), Number: number, Status: internal.OrderStatusNew, UserID: userID}
 	_, err = us.db.AddOrder(ctx, order)
 	if err != nil {
 		return err
@@ -54,6 +81,63 @@ func (us *UserService) AddOrder(ctx context.Context, id string, orderID string)
 	return nil
 }
 
+// AddOrders uploads the batch of numbers from source and returns the result of every
+// number in the order of the batch, the accepted orders are saved at once.
+func (us *UserService) AddOrders(ctx context.Context, id string, source string, numbers []string) (*[]internal.BatchOrderDto, error) {
+	if len(numbers) == 0 || len(numbers) > MaxBatchOrders {
+		return nil, fmt.Errorf("batch has %d numbers, expected 1..%d, %w", len(numbers), MaxBatchOrders, errors2.ErrIllegalBatch)
+	}
+	if _, err := us.sources.Validator(source); err != nil {
+		return nil, err
+	}
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]internal.BatchOrderDto, 0, len(numbers))
+	accepted := make(map[int]string)
+	orders := make([]internal.Order, 0, len(numbers))
+	batch := make(map[string]bool)
+	for _, n := range numbers {
+		result := internal.BatchOrderDto{Number: n, Result: internal.BatchOrderAccepted}
+		number, err := us.sources.Validate(source, n)
+		switch {
+		case err != nil:
+			result.Result = internal.BatchOrderIllegalNumber
+		case batch[number]:
+			result.Result = internal.BatchOrderUploaded
+		default:
+			batch[number] = true
+			accepted[len(results)] = number
+			orders = append(orders, internal.Order{ID: uuid.New(), CreateAt: time.Now(), Number: number, Status: internal.OrderStatusNew, UserID: userID})
+		}
+		results = append(results, result)
+	}
+	if len(orders) == 0 {
+		return &results, nil
+	}
+
+	existOrders, err := us.db.AddOrders(ctx, &orders)
+	if err != nil {
+		return nil, err
+	}
+	exist := make(map[string]internal.BatchOrderResult)
+	for _, order := range *existOrders {
+		if order.UserID == userID {
+			exist[order.Number] = internal.BatchOrderUploaded
+		} else {
+			exist[order.Number] = internal.BatchOrderAnotherUser
+		}
+	}
+	for i, number := range accepted {
+		if result, ok := exist[number]; ok {
+			results[i].Result = result
+		}
+	}
+	return &results, nil
+}
+
 func (us *UserService) LoginUser(ctx context.Context, user internal.UserDto) (*uuid.UUID, error) {
 	login, err := us.db.FindUserByLogin(ctx, user.Login)
 	if err != nil {
@@ -69,17 +153,14 @@ func (us *UserService) LoginUser(ctx context.Context, user internal.UserDto) (*u
 	return &login.ID, nil
 }
 
-func (us *UserService) GetOrdersNotProcessed() ([]string, error) {
-	orders, err := us.db.GetOrdersNotProcessed(context.Background())
+func (us *UserService) GetOrdersNotProcessed(ctx context.Context) ([]string, error) {
+	orders, err := us.db.GetOrdersNotProcessed(ctx)
 	if err != nil {
 		return nil, err
 	}
 	numbers := make([]string, 0)
 	for _, order := range *orders {
-		numbers = append(numbers, strconv.FormatInt(order.Number, 10))
-	}
-	if len(numbers) == 0 {
-		return nil, fmt.Errorf("empty list")
+		numbers = append(numbers, order.Number)
 	}
 	return numbers, nil
 }
@@ -97,27 +178,186 @@ func (us *UserService) GetOrders(ctx context.Context, id string) (*[]internal.Or
 	ordersDto := make([]internal.OrderDto, 0)
 	for _, order := range *orders {
 		d := internal.OrderDto{
-			Number:  strconv.FormatInt(order.Number, 10),
+			Number:  order.Number,
 			Status:  string(order.Status),
 			Accrual: order.Accrual,
 			Upload:  order.CreateAt,
 		}
+		if order.CampaignBonus > 0 {
+			d.BaseAccrual = order.BaseAccrual()
+			d.CampaignBonus = order.CampaignBonus
+		}
 		ordersDto = append(ordersDto, d)
 	}
 	return &ordersDto, nil
 }
 
-func (us *UserService) UpdateOrder(accrual *internal.AccrualDto) error {
-	number, err := strconv.Atoi(accrual.Order)
+// accrualStatuses maps the statuses of the accrual system to the statuses of the order,
+// the order registered by the accrual system is processing for the user.
+var accrualStatuses = map[string]internal.OrderStatus{
+	string(internal.OrderStatusRegistered): internal.OrderStatusProcessing,
+	string(internal.OrderStatusProcessing): internal.OrderStatusProcessing,
+	string(internal.OrderStatusInvalid):    internal.OrderStatusInvalid,
+	string(internal.OrderStatusProcessed):  internal.OrderStatusProcessed,
+}
+
+// UpdateOrder applies the accrual state received from source, the repeated state and
+// the state the order can't move to are ignored. The campaign and referral bonuses are
+// applied by the store in the same transaction as the accrual of the order.
+func (us *UserService) UpdateOrder(accrual *internal.AccrualDto, source internal.UpdateSource) error {
+	number, err := ordernumber.Normalize(accrual.Order)
 	if err != nil {
-		return fmt.Errorf("parse accrual number %s, %w", accrual.Order, err)
+		return fmt.Errorf("parse accrual number, %w", err)
+	}
+	status, ok := accrualStatuses[accrual.Status]
+	if !ok {
+		return fmt.Errorf("unknown accrual status %s, %w", accrual.Status, errors2.ErrIllegalOrder)
+	}
+	order := &internal.Order{
+		Number:       number,
+		Accrual:      accrual.Accrual,
+		Status:       status,
+		UpdateSource: source,
+	}
+	var referral repositories.ReferralRules
+	if us.referrals != nil {
+		referral = us.referrals.Credits
+	}
+	return us.db.UpdateOrder(context.Background(), order, referral, us.campaign)
+}
+
+// campaign decides the best campaign for the order, its bonus is increased by the campaign
+// factor of the tier of the user.
+func (us *UserService) campaign(order *internal.Order, user *internal.User, campaigns []internal.Campaign) (*internal.Campaign, float32) {
+	if order.Accrual <= 0 {
+		return nil, 0
+	}
+	factor := float32(1)
+	if tier := us.tiers.Tier(user.Tier); tier != nil {
+		factor = tier.CampaignFactor
 	}
-	order := &internal.Order{Number: int64(number), Accrual: accrual.Accrual, Status: internal.OrderStatus(accrual.Status)}
-	err = us.db.UpdateOrder(context.Background(), order)
+	campaign, bonus := bestCampaign(campaigns, order, user, factor)
+	if campaign != nil && bonus > 0 {
+		internal.Logf.Infof("campaign %q adds %v to accrual %v of order %s with factor %v of tier %s",
+			campaign.Name, bonus, order.Accrual, order.Number, factor, user.Tier)
+	}
+	return campaign, bonus
+}
+
+// GetReferral returns the referral code of the user, the number of users registered with
+// it and the referral bonuses credited to the user, the last first.
+func (us *UserService) GetReferral(ctx context.Context, id string) (*internal.ReferralDto, error) {
+	userID, err := uuid.Parse(id)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	user, err := us.db.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	invited, err := us.db.CountReferees(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	credits, err := us.db.GetReferralCredits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	dto := &internal.ReferralDto{
+		Code:    user.ReferralCode,
+		Invited: invited,
+		Credits: make([]internal.ReferralCreditDto, 0, len(*credits)),
+	}
+	for _, credit := range *credits {
+		dto.Earned += credit.Sum
+		dto.Credits = append(dto.Credits, internal.ReferralCreditDto{
+			Role:     string(credit.Role),
+			Order:    credit.Order,
+			Sum:      credit.Sum,
+			CreateAt: credit.CreateAt,
+		})
+	}
+	return dto, nil
+}
+
+// SaveOrderCheck counts the check of the accrual of the order made at checkedAt,
+// the next check is scheduled at nextCheckAt.
+func (us *UserService) SaveOrderCheck(number string, checkedAt time.Time, nextCheckAt time.Time) error {
+	return us.db.SaveOrderCheck(context.Background(), number, checkedAt, nextCheckAt)
+}
+
+// GetOrder returns the order of the user with the history of its statuses, the checks
+// of its accrual and the withdrawals paid for it. The order of another user is refused
+// before anything else of it is read.
+func (us *UserService) GetOrder(ctx context.Context, id string, number string) (*internal.OrderDetailDto, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	normalized, err := ordernumber.Normalize(number)
+	if err != nil {
+		return nil, err
+	}
+	order, err := us.db.GetOrder(ctx, normalized)
+	if err != nil {
+		return nil, err
+	}
+	if order.UserID != userID {
+		return nil, errors2.ErrOrderOfAnotherUser
+	}
+	history, err := us.db.GetOrderHistory(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	withdrawals, err := us.db.GetOrderWithdrawals(ctx, userID, order.Number)
+	if err != nil {
+		return nil, err
+	}
+
+	dto := &internal.OrderDetailDto{
+		Number:      order.Number,
+		Status:      string(order.Status),
+		Accrual:     order.Accrual,
+		Upload:      order.CreateAt,
+		History:     make([]internal.OrderStatusChangeDto, 0, len(*history)),
+		PollCount:   order.PollCount,
+		CheckedAt:   order.CheckedAt,
+		Withdrawals: make([]internal.WithdrawDto, 0, len(*withdrawals)),
+	}
+	if !order.Status.IsFinal() {
+		dto.NextCheckAt = order.NextCheckAt
+	}
+	if order.CampaignBonus > 0 {
+		dto.BaseAccrual = order.BaseAccrual()
+		dto.CampaignBonus = order.CampaignBonus
+	}
+	if order.CampaignID != nil {
+		campaign, err := us.db.GetCampaign(ctx, *order.CampaignID)
+		if err != nil && !errors.Is(err, errors2.ErrCampaignNotFound) {
+			return nil, err
+		}
+		if campaign != nil {
+			dto.Campaign = campaign.Name
+		}
+	}
+	for _, change := range *history {
+		dto.History = append(dto.History, internal.OrderStatusChangeDto{
+			From:     string(change.FromStatus),
+			Status:   string(change.Status),
+			Source:   string(change.Source),
+			CreateAt: change.CreateAt,
+		})
+	}
+	for _, withdrawal := range *withdrawals {
+		dto.Withdrawals = append(dto.Withdrawals, internal.WithdrawDto{
+			Order:    withdrawal.Order,
+			Sum:      withdrawal.Sum,
+			CreateAt: withdrawal.CreateAt,
+		})
+	}
+	return dto, nil
 }
 
 func (us *UserService) GetWithdrawals(ctx context.Context, id string) (*[]internal.WithdrawDto, error) {
@@ -133,7 +373,7 @@ func (us *UserService) GetWithdrawals(ctx context.Context, id string) (*[]intern
 	dtos := make([]internal.WithdrawDto, 0)
 	for _, withdraw := range *withdrawals {
 		dto := internal.WithdrawDto{
-			Order:    strconv.FormatInt(withdraw.Order, 10),
+			Order:    withdraw.Order,
 			Sum:      withdraw.Sum,
 			CreateAt: withdraw.CreateAt,
 		}
@@ -142,6 +382,16 @@ func (us *UserService) GetWithdrawals(ctx context.Context, id string) (*[]intern
 	return &dtos, nil
 }
 
+// GetVersion returns the version of the account of the user, the orders, the balance and
+// the withdrawals of the user are the same while the version isn't changed.
+func (us *UserService) GetVersion(ctx context.Context, id string) (int64, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return 0, err
+	}
+	return us.db.GetUserVersion(ctx, userID)
+}
+
 func (us *UserService) GetBalance(ctx context.Context, id string) (*internal.Balance, error) {
 	userID, err := uuid.Parse(id)
 	if err != nil {
@@ -164,51 +414,108 @@ func (us *UserService) GetBalance(ctx context.Context, id string) (*internal.Bal
 	return &internal.Balance{Current: user.Bill, Withdrawn: withdrawn}, nil
 }
 
-func (us *UserService) AddWithdraw(ctx context.Context, dto internal.WithdrawDto, id string) error {
+// GetProfile returns the tier of the user with the accrual it was decided by and the points
+// the user still needs to accrue for the next tier.
+func (us *UserService) GetProfile(ctx context.Context, id string) (*internal.ProfileDto, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	user, err := us.db.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	dto := &internal.ProfileDto{
+		Login:          user.Login,
+		CreateAt:       user.CreateAt,
+		Tier:           string(user.Tier),
+		TierAccrual:    user.TierAccrual,
+		CampaignFactor: 1,
+		TierUpdatedAt:  user.TierUpdatedAt,
+	}
+	if tier := us.tiers.Tier(user.Tier); tier != nil {
+		dto.Tier = string(tier.Name)
+		dto.CampaignFactor = tier.CampaignFactor
+		if tier.WithdrawalLimit > 0 {
+			dto.WithdrawalLimit = tier.WithdrawalLimit
+			dto.WithdrawalPeriod = tier.WithdrawalPeriod.String()
+		}
+		if next := us.tiers.Next(tier.Name); next != nil {
+			dto.NextTier = string(next.Name)
+			dto.ToNextTier = float32(math.Max(0, math.Round(float64(next.MinAccrual-user.TierAccrual)*100)/100))
+		}
+	}
+	return dto, nil
+}
+
+// AddWithdraw pays the order from source with the bill of the user.
+func (us *UserService) AddWithdraw(ctx context.Context, dto internal.WithdrawDto, id string, source string) error {
 	userID, err := uuid.Parse(id)
 	if err != nil {
 		return err
 	}
 
-	luna, ok := isLuna(dto.Order)
-	if !ok {
-		return errors2.ErrIllegalOrder
+	number, err := us.sources.Validate(source, dto.Order)
+	if err != nil {
+		return err
 	}
 
 	withdraw := &internal.Withdraw{
 		ID:       uuid.New(),
 		CreateAt: time.Now(),
-		Order:    int64(luna),
+		Order:    number,
 		Sum:      dto.Sum,
 		UserID:   userID,
 	}
-
-	return us.db.SaveWithdrawal(ctx, withdraw)
+	var rules repositories.WithdrawalRules
+	if len(us.tiers) > 0 {
+		rules = func(user *internal.User, withdrawn func(since time.Time) (float32, error)) error {
+			return us.checkWithdrawalLimit(user, withdrawn, withdraw)
+		}
+	}
+	return us.db.SaveWithdrawal(ctx, withdraw, rules)
 }
 
-func isLuna(order string) (int, bool) {
-	number, err := strconv.Atoi(order)
+// checkWithdrawalLimit refuses the withdrawal which exceeds the withdrawal limit of the tier
+// of the user together with the withdrawals of the user in the period of the limit. It's
+// checked by the store under the lock of the user, so the parallel withdrawals can't exceed it.
+func (us *UserService) checkWithdrawalLimit(user *internal.User, withdrawn func(since time.Time) (float32, error),
+	withdraw *internal.Withdraw) error {
+	tier := us.tiers.Tier(user.Tier)
+	if tier.WithdrawalLimit <= 0 {
+		return nil
+	}
+	sum, err := withdrawn(withdraw.CreateAt.Add(-tier.WithdrawalPeriod))
 	if err != nil {
-		return number, false
+		return err
 	}
-	return number, (number%10+checksum(number/10))%10 == 0
+	if sum+withdraw.Sum > tier.WithdrawalLimit {
+		return fmt.Errorf("tier %s allows to withdraw %v in %v, %w",
+			tier.Name, tier.WithdrawalLimit, tier.WithdrawalPeriod, errors2.ErrWithdrawalLimit)
+	}
+	return nil
 }
 
-func checksum(number int) int {
-	var luhn int
-	for i := 0; number > 0; i++ {
-		cur := number % 10
-		if i%2 == 0 {
-			cur = cur * 2
-			if cur > 9 {
-				cur = cur%10 + cur/10
-			}
-		}
-
-		luhn += cur
-		number = number / 10
+// WriteStatement passes the statement of the user in [from, to) to write one entry at a time.
+func (us *UserService) WriteStatement(ctx context.Context, id string, from time.Time, to time.Time,
+	write func(dto *internal.StatementDto) error) error {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+	if !from.Before(to) {
+		return fmt.Errorf("period from %v to %v, %w", from, to, errors2.ErrIllegalPeriod)
 	}
-	return luhn % 10
+	return us.db.GetStatement(ctx, userID, from, to, func(entry *internal.StatementEntry) error {
+		return write(&internal.StatementDto{
+			Date:      entry.Date,
+			Operation: string(entry.Operation),
+			Order:     entry.Order,
+			Amount:    entry.Amount,
+			Balance:   entry.Balance,
+		})
+	})
 }
 
 func isIllegalUserArgument(user *internal.UserDto) bool {
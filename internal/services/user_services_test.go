@@ -2,17 +2,23 @@ package services
 
 import (
 	"context"
+	"errors"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
 	mock "github.com/bonus2k/go-musthave-diploma-tpl/internal/mocks"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/ordernumber"
 	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories/memory"
 	"github.com/golang/mock/gomock"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"log"
 	"os"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -45,12 +51,12 @@ func TestNewUserService(t *testing.T) {
 		{
 			name: "smoke test",
 			args: args{storage: mockStore},
-			want: &UserService{db: mockStore},
+			want: &UserService{db: mockStore, sources: ordernumber.DefaultSources()},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := NewUserService(tt.args.storage); !reflect.DeepEqual(got, tt.want) {
+			if got := NewUserService(tt.args.storage, ordernumber.DefaultSources(), nil, nil); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("NewUserService() = %v, want %v", got, tt.want)
 			}
 		})
@@ -109,9 +115,10 @@ func TestUserService_AddOrder(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			us := &UserService{
-				db: tt.db,
+				db:      tt.db,
+				sources: ordernumber.DefaultSources(),
 			}
-			err := us.AddOrder(tt.args.ctx, tt.args.id, tt.args.orderID)
+			err := us.AddOrder(tt.args.ctx, tt.args.id, "", tt.args.orderID)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("AddOrder() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -122,9 +129,133 @@ func TestUserService_AddOrder(t *testing.T) {
 	}
 }
 
+func TestUserService_AddOrders(t *testing.T) {
+	userID := uuid.New()
+	tooLarge := make([]string, MaxBatchOrders+1)
+	for i := range tooLarge {
+		tooLarge[i] = "4539088167512356"
+	}
+	sources := ordernumber.DefaultSources()
+	sources["marketplace"] = ordernumber.Rules{ordernumber.Prefix{Prefixes: []string{"MP-"}}, ordernumber.Length{Min: 8, Max: 40}}
+	tests := []struct {
+		name        string
+		source      string
+		numbers     []string
+		existOrders []internal.Order
+		wantSaved   []string
+		want        []internal.BatchOrderDto
+		wantErr     error
+	}{
+		{
+			name:    "add_orders",
+			numbers: []string{"4539088167512356", "12345", "3536137811022331", "3533841638640315", "4539088167512356"},
+			existOrders: []internal.Order{
+				{Number: "3536137811022331", UserID: userID},
+				{Number: "3533841638640315", UserID: uuid.New()},
+			},
+			wantSaved: []string{"4539088167512356", "3536137811022331", "3533841638640315"},
+			want: []internal.BatchOrderDto{
+				{Number: "4539088167512356", Result: internal.BatchOrderAccepted},
+				{Number: "12345", Result: internal.BatchOrderIllegalNumber},
+				{Number: "3536137811022331", Result: internal.BatchOrderUploaded},
+				{Number: "3533841638640315", Result: internal.BatchOrderAnotherUser},
+				{Number: "4539088167512356", Result: internal.BatchOrderUploaded},
+			},
+		},
+		{
+			name:    "add_orders_without_valid_numbers",
+			numbers: []string{"12345", "number"},
+			want: []internal.BatchOrderDto{
+				{Number: "12345", Result: internal.BatchOrderIllegalNumber},
+				{Number: "number", Result: internal.BatchOrderIllegalNumber},
+			},
+		},
+		{
+			name:      "add_orders_marketplace",
+			source:    "marketplace",
+			numbers:   []string{" mp-ab 12345678901234567890 ", "MP-AB12345678901234567890", "4539088167512356", "MP-1"},
+			wantSaved: []string{"MP-AB12345678901234567890"},
+			want: []internal.BatchOrderDto{
+				{Number: " mp-ab 12345678901234567890 ", Result: internal.BatchOrderAccepted},
+				{Number: "MP-AB12345678901234567890", Result: internal.BatchOrderUploaded},
+				{Number: "4539088167512356", Result: internal.BatchOrderIllegalNumber},
+				{Number: "MP-1", Result: internal.BatchOrderIllegalNumber},
+			},
+		},
+		{
+			name:    "add_orders_unknown_source",
+			source:  "partner",
+			numbers: []string{"4539088167512356"},
+			wantErr: errors2.ErrUnknownOrderSource,
+		},
+		{
+			name:    "add_orders_empty_batch",
+			wantErr: errors2.ErrIllegalBatch,
+		},
+		{
+			name:    "add_orders_too_large_batch",
+			numbers: tooLarge,
+			wantErr: errors2.ErrIllegalBatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := getStore(t)
+			if tt.wantSaved != nil {
+				mockStore.EXPECT().AddOrders(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, orders *[]internal.Order) (*[]internal.Order, error) {
+						saved := make([]string, 0)
+						for _, order := range *orders {
+							assert.Equal(t, userID, order.UserID)
+							assert.Equal(t, internal.OrderStatusNew, order.Status)
+							saved = append(saved, order.Number)
+						}
+						assert.Equal(t, tt.wantSaved, saved)
+						return &tt.existOrders, nil
+					})
+			}
+			us := NewUserService(mockStore, sources, nil, nil)
+			got, err := us.AddOrders(context.Background(), userID.String(), tt.source, tt.numbers)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, *got)
+		})
+	}
+}
+
+func TestUserService_WriteStatement(t *testing.T) {
+	mockStore := getStore(t)
+	userID := uuid.New()
+	from := time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	mockStore.EXPECT().GetStatement(gomock.Any(), userID, from, to, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, userID uuid.UUID, from time.Time, to time.Time, fn func(entry *internal.StatementEntry) error) error {
+			return fn(&internal.StatementEntry{Date: from, Operation: internal.StatementWithdrawal, Order: "140672056", Amount: -12.64, Balance: 87.36})
+		})
+	us := NewUserService(mockStore, ordernumber.DefaultSources(), nil, nil)
+
+	var got []internal.StatementDto
+	err := us.WriteStatement(context.Background(), userID.String(), from, to, func(dto *internal.StatementDto) error {
+		got = append(got, *dto)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []internal.StatementDto{
+		{Date: from, Operation: "WITHDRAWAL", Order: "140672056", Amount: -12.64, Balance: 87.36},
+	}, got)
+
+	err = us.WriteStatement(context.Background(), userID.String(), to, from, func(dto *internal.StatementDto) error {
+		return nil
+	})
+	assert.ErrorIs(t, err, errors2.ErrIllegalPeriod)
+}
+
 func TestUserService_AddWithdraw(t *testing.T) {
 	mockStore := getStore(t)
-	mockStore.EXPECT().SaveWithdrawal(gomock.Any(), gomock.Any()).Return(nil)
+	mockStore.EXPECT().SaveWithdrawal(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 	type args struct {
 		ctx context.Context
 		dto internal.WithdrawDto
@@ -174,9 +305,10 @@ func TestUserService_AddWithdraw(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			us := &UserService{
-				db: tt.db,
+				db:      tt.db,
+				sources: ordernumber.DefaultSources(),
 			}
-			err := us.AddWithdraw(tt.args.ctx, tt.args.dto, tt.args.id)
+			err := us.AddWithdraw(tt.args.ctx, tt.args.dto, tt.args.id, "")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("AddWithdraw() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -235,7 +367,8 @@ func TestUserService_CreateNewUser(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			us := &UserService{
-				db: tt.db,
+				db:      tt.db,
+				sources: ordernumber.DefaultSources(),
 			}
 			got, err := us.CreateNewUser(tt.args.ctx, tt.args.user)
 			if (err != nil) != tt.wantErr {
@@ -258,21 +391,21 @@ func TestUserService_GetBalance(t *testing.T) {
 		{
 			ID:       uuid.MustParse("35e1cbd0-c3ba-44eb-8632-0d91c280dee6"),
 			CreateAt: time.Date(2023, 11, 10, 14, 00, 00, 000, time.Local),
-			Order:    140672056,
+			Order:    "140672056",
 			Sum:      12.64,
 			UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
 		},
 		{
 			ID:       uuid.MustParse("35e1cbd0-c3ba-44eb-8632-0d91c280dee7"),
 			CreateAt: time.Date(2023, 12, 10, 14, 00, 00, 000, time.Local),
-			Order:    140672057,
+			Order:    "140672057",
 			Sum:      27.385,
 			UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
 		},
 		{
 			ID:       uuid.MustParse("35e1cbd0-c3ba-44eb-8632-0d91c280dee8"),
 			CreateAt: time.Date(2023, 11, 11, 14, 00, 00, 000, time.Local),
-			Order:    140672058,
+			Order:    "140672058",
 			Sum:      0.11111111,
 			UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
 		},
@@ -314,7 +447,8 @@ func TestUserService_GetBalance(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			us := &UserService{
-				db: tt.db,
+				db:      tt.db,
+				sources: ordernumber.DefaultSources(),
 			}
 			got, err := us.GetBalance(tt.args.ctx, tt.args.id)
 			if (err != nil) != tt.wantErr {
@@ -334,7 +468,7 @@ func TestUserService_GetOrders(t *testing.T) {
 		{
 			ID:       uuid.MustParse("334b0360-8222-44fc-bf2e-77ced208f2cd"),
 			CreateAt: time.Date(2023, 01, 01, 14, 01, 00, 000, time.Local),
-			Number:   4539088167512356,
+			Number:   "4539088167512356",
 			Accrual:  100.0,
 			Status:   internal.OrderStatusProcessed,
 			UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
@@ -342,7 +476,7 @@ func TestUserService_GetOrders(t *testing.T) {
 		{
 			ID:       uuid.MustParse("334b0360-8222-44fc-bf2e-77ced208f2ce"),
 			CreateAt: time.Date(2023, 01, 01, 14, 02, 00, 000, time.Local),
-			Number:   3536137811022331,
+			Number:   "3536137811022331",
 			Accrual:  0,
 			Status:   internal.OrderStatusNew,
 			UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
@@ -350,7 +484,7 @@ func TestUserService_GetOrders(t *testing.T) {
 		{
 			ID:       uuid.MustParse("334b0360-8222-44fc-bf2e-77ced208f2cf"),
 			CreateAt: time.Date(2023, 01, 01, 14, 03, 00, 000, time.Local),
-			Number:   3533841638640315,
+			Number:   "3533841638640315",
 			Accrual:  0,
 			Status:   internal.OrderStatusInvalid,
 			UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
@@ -412,7 +546,8 @@ func TestUserService_GetOrders(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			us := &UserService{
-				db: tt.db,
+				db:      tt.db,
+				sources: ordernumber.DefaultSources(),
 			}
 			got, err := us.GetOrders(tt.args.ctx, tt.args.id)
 			if (err != nil) != tt.wantErr {
@@ -442,7 +577,7 @@ func TestUserService_GetOrdersNotProcessed(t *testing.T) {
 		{
 			ID:       uuid.MustParse("334b0360-8222-44fc-bf2e-77ced208f2ce"),
 			CreateAt: time.Date(2023, 01, 01, 14, 02, 00, 000, time.Local),
-			Number:   3536137811022331,
+			Number:   "3536137811022331",
 			Accrual:  0,
 			Status:   internal.OrderStatusNew,
 			UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
@@ -450,6 +585,8 @@ func TestUserService_GetOrdersNotProcessed(t *testing.T) {
 	}
 	mockStore1.EXPECT().GetOrdersNotProcessed(gomock.Any()).Return(orders, nil)
 	mockStore2.EXPECT().GetOrdersNotProcessed(gomock.Any()).Return(&[]internal.Order{}, nil)
+	mockStore3 := getStore(t)
+	mockStore3.EXPECT().GetOrdersNotProcessed(gomock.Any()).Return(nil, errors.New("connection refused"))
 	tests := []struct {
 		name       string
 		db         repositories.Store
@@ -467,17 +604,25 @@ func TestUserService_GetOrdersNotProcessed(t *testing.T) {
 		{
 			name:       "get_orders_not_processed_empty_list",
 			db:         mockStore2,
+			want:       []string{},
+			wantErr:    false,
+			wantErrMsg: "",
+		},
+		{
+			name:       "get_orders_not_processed_db_is_failed",
+			db:         mockStore3,
 			want:       nil,
 			wantErr:    true,
-			wantErrMsg: "empty list",
+			wantErrMsg: "connection refused",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			us := &UserService{
-				db: tt.db,
+				db:      tt.db,
+				sources: ordernumber.DefaultSources(),
 			}
-			got, err := us.GetOrdersNotProcessed()
+			got, err := us.GetOrdersNotProcessed(context.Background())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetOrdersNotProcessed() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -496,21 +641,21 @@ func TestUserService_GetWithdrawals(t *testing.T) {
 		{
 			ID:       uuid.MustParse("35e1cbd0-c3ba-44eb-8632-0d91c280dee6"),
 			CreateAt: time.Date(2023, 11, 10, 14, 00, 00, 000, time.Local),
-			Order:    140672056,
+			Order:    "140672056",
 			Sum:      12.64,
 			UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
 		},
 		{
 			ID:       uuid.MustParse("35e1cbd0-c3ba-44eb-8632-0d91c280dee7"),
 			CreateAt: time.Date(2023, 12, 10, 14, 00, 00, 000, time.Local),
-			Order:    140672057,
+			Order:    "140672057",
 			Sum:      27.385,
 			UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
 		},
 		{
 			ID:       uuid.MustParse("35e1cbd0-c3ba-44eb-8632-0d91c280dee8"),
 			CreateAt: time.Date(2023, 11, 11, 14, 00, 00, 000, time.Local),
-			Order:    140672058,
+			Order:    "140672058",
 			Sum:      0.11111111,
 			UserID:   uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026"),
 		},
@@ -567,7 +712,8 @@ func TestUserService_GetWithdrawals(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			us := &UserService{
-				db: tt.db,
+				db:      tt.db,
+				sources: ordernumber.DefaultSources(),
 			}
 			got, err := us.GetWithdrawals(tt.args.ctx, tt.args.id)
 			if (err != nil) != tt.wantErr {
@@ -644,7 +790,8 @@ func TestUserService_LoginUser(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			us := &UserService{
-				db: tt.db,
+				db:      tt.db,
+				sources: ordernumber.DefaultSources(),
 			}
 			got, err := us.LoginUser(tt.args.ctx, tt.args.user)
 			if (err != nil) != tt.wantErr {
@@ -660,7 +807,12 @@ func TestUserService_LoginUser(t *testing.T) {
 
 func TestUserService_UpdateOrder(t *testing.T) {
 	mockStore := getStore(t)
-	mockStore.EXPECT().UpdateOrder(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockStore.EXPECT().UpdateOrder(gomock.Any(), &internal.Order{
+		Number:       "4539088167512356",
+		Accrual:      0.01,
+		Status:       internal.OrderStatusProcessing,
+		UpdateSource: internal.UpdateSourcePoll,
+	}, gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
 
 	tests := []struct {
 		name       string
@@ -674,7 +826,7 @@ func TestUserService_UpdateOrder(t *testing.T) {
 			db:   mockStore,
 			accrual: &internal.AccrualDto{
 				Order:   "4539088167512356",
-				Status:  "NEW",
+				Status:  "REGISTERED",
 				Accrual: 0.01,
 			},
 			wantErr:    false,
@@ -685,19 +837,31 @@ func TestUserService_UpdateOrder(t *testing.T) {
 			db:   mockStore,
 			accrual: &internal.AccrualDto{
 				Order:   " ",
-				Status:  "NEW",
+				Status:  "PROCESSING",
 				Accrual: 0.01,
 			},
 			wantErr:    true,
 			wantErrMsg: "parse accrual number",
 		},
+		{
+			name: "update_order_unknown_status",
+			db:   mockStore,
+			accrual: &internal.AccrualDto{
+				Order:   "4539088167512356",
+				Status:  "NEW",
+				Accrual: 0.01,
+			},
+			wantErr:    true,
+			wantErrMsg: "unknown accrual status NEW",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			us := &UserService{
-				db: tt.db,
+				db:      tt.db,
+				sources: ordernumber.DefaultSources(),
 			}
-			err := us.UpdateOrder(tt.accrual)
+			err := us.UpdateOrder(tt.accrual, internal.UpdateSourcePoll)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("UpdateOrder() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -709,25 +873,195 @@ func TestUserService_UpdateOrder(t *testing.T) {
 	}
 }
 
-func Test_checksum(t *testing.T) {
+// TestUserService_UpdateOrder_Replay replays the same accrual from the poll and the
+// callback, only the first one credits the bill.
+func TestUserService_UpdateOrder_Replay(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewStore()
+	us := NewUserService(store, ordernumber.DefaultSources(), nil, nil)
+	user, err := us.CreateNewUser(ctx, &internal.UserDto{Login: "user", Pass: "password"})
+	assert.NoError(t, err)
+	assert.NoError(t, us.AddOrder(ctx, user.ID.String(), "", "4539088167512356"))
+
+	accrual := &internal.AccrualDto{Order: "4539088167512356", Status: "PROCESSED", Accrual: 729.98}
+	for _, source := range []internal.UpdateSource{
+		internal.UpdateSourcePoll, internal.UpdateSourceCallback, internal.UpdateSourcePoll,
+	} {
+		assert.NoError(t, us.UpdateOrder(accrual, source))
+	}
+
+	balance, err := us.GetBalance(ctx, user.ID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, float32(729.98), balance.Current)
+	orders, err := store.GetOrders(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, internal.UpdateSourcePoll, (*orders)[0].UpdateSource)
+	assert.NotNil(t, (*orders)[0].CreditedAt)
+	events, err := store.GetUserEvents(ctx, user.ID, 0, 100)
+	assert.NoError(t, err)
+	assert.Len(t, *events, 2, "status and balance are written once")
+}
+
+// TestUserService_UpdateOrder_Transitions applies the accrual states out of order, the final
+// status isn't overwritten and every transition is written to the history of the order.
+func TestUserService_UpdateOrder_Transitions(t *testing.T) {
+	ctx := context.Background()
+	us := NewUserService(memory.NewStore(), ordernumber.DefaultSources(), nil, nil)
+	user, err := us.CreateNewUser(ctx, &internal.UserDto{Login: "user", Pass: "password"})
+	require.NoError(t, err)
+	require.NoError(t, us.AddOrder(ctx, user.ID.String(), "", "4539088167512356"))
+
+	for _, accrual := range []internal.AccrualDto{
+		{Order: "4539088167512356", Status: "REGISTERED"},
+		{Order: "4539088167512356", Status: "PROCESSING"},
+		{Order: "4539088167512356", Status: "INVALID"},
+		{Order: "4539088167512356", Status: "PROCESSED", Accrual: 100},
+		{Order: "4539088167512356", Status: "REGISTERED"},
+	} {
+		require.NoError(t, us.UpdateOrder(&accrual, internal.UpdateSourceCallback))
+	}
+
+	order, err := us.GetOrder(ctx, user.ID.String(), "4539088167512356")
+	require.NoError(t, err)
+	assert.Equal(t, string(internal.OrderStatusInvalid), order.Status)
+	assert.Equal(t, float32(0), order.Accrual)
+	transitions := make([]string, 0)
+	for _, change := range order.History {
+		transitions = append(transitions, change.From+">"+change.Status+":"+change.Source)
+	}
+	assert.Equal(t, []string{">NEW:UPLOAD", "NEW>PROCESSING:CALLBACK", "PROCESSING>INVALID:CALLBACK"}, transitions)
+}
+
+// TestUserService_CreateNewUser_Referral registers the user with the referral code of another
+// user, the code is case-insensitive and the unknown code refuses the registration.
+func TestUserService_CreateNewUser_Referral(t *testing.T) {
+	ctx := context.Background()
+	us := NewUserService(memory.NewStore(), ordernumber.DefaultSources(), nil, nil)
+	referrer, err := us.CreateNewUser(ctx, &internal.UserDto{Login: "referrer", Pass: "password"})
+	require.NoError(t, err)
+	assert.Nil(t, referrer.ReferredBy)
+	assert.Len(t, referrer.ReferralCode, referralCodeLength)
+
+	referee, err := us.CreateNewUser(ctx, &internal.UserDto{Login: "referee", Pass: "password",
+		ReferralCode: " " + strings.ToLower(referrer.ReferralCode) + " "})
+	require.NoError(t, err)
+	require.NotNil(t, referee.ReferredBy)
+	assert.Equal(t, referrer.ID, *referee.ReferredBy)
+	assert.NotEqual(t, referrer.ReferralCode, referee.ReferralCode)
+
+	_, err = us.CreateNewUser(ctx, &internal.UserDto{Login: "user", Pass: "password", ReferralCode: "UNKNOWN"})
+	assert.ErrorIs(t, err, errors2.ErrIllegalReferralCode)
+}
+
+// TestUserService_UpdateOrder_Referral credits the referral bonuses when the order of the
+// referee with the large enough accrual is processed.
+func TestUserService_UpdateOrder_Referral(t *testing.T) {
+	ctx := context.Background()
+	program, err := ParseReferralProgram("referrer=100,referee=50,min-accrual=100")
+	require.NoError(t, err)
+	us := NewUserService(memory.NewStore(), ordernumber.DefaultSources(), program, nil)
+	referrer, err := us.CreateNewUser(ctx, &internal.UserDto{Login: "referrer", Pass: "password"})
+	require.NoError(t, err)
+	referee, err := us.CreateNewUser(ctx, &internal.UserDto{Login: "referee", Pass: "password", ReferralCode: referrer.ReferralCode})
+	require.NoError(t, err)
+	require.NoError(t, us.AddOrder(ctx, referee.ID.String(), "", "4539088167512356"))
+	require.NoError(t, us.AddOrder(ctx, referee.ID.String(), "", "79927398713"))
+
+	accrual := &internal.AccrualDto{Order: "4539088167512356", Status: "PROCESSED", Accrual: 10}
+	require.NoError(t, us.UpdateOrder(accrual, internal.UpdateSourceCallback), "refused referral isn't an error")
+	balance, err := us.GetBalance(ctx, referrer.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, float32(0), balance.Current)
+
+	accrual = &internal.AccrualDto{Order: "79927398713", Status: "PROCESSED", Accrual: 200}
+	require.NoError(t, us.UpdateOrder(accrual, internal.UpdateSourceCallback))
+	balance, err = us.GetBalance(ctx, referee.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, float32(260), balance.Current, "refused referral is checked with the next order")
+
+	referral, err := us.GetReferral(ctx, referrer.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, referrer.ReferralCode, referral.Code)
+	assert.Equal(t, 1, referral.Invited)
+	assert.Equal(t, float32(100), referral.Earned)
+	require.Len(t, referral.Credits, 1)
+	assert.Equal(t, "79927398713", referral.Credits[0].Order)
+}
+
+// TestUserService_UpdateOrder_ReferralCredited credits the referrer and the referee once.
+func TestUserService_UpdateOrder_ReferralCredited(t *testing.T) {
+	ctx := context.Background()
+	program, err := ParseReferralProgram(DefaultReferralProgram)
+	require.NoError(t, err)
+	us := NewUserService(memory.NewStore(), ordernumber.DefaultSources(), program, nil)
+	referrer, err := us.CreateNewUser(ctx, &internal.UserDto{Login: "referrer", Pass: "password"})
+	require.NoError(t, err)
+	referee, err := us.CreateNewUser(ctx, &internal.UserDto{Login: "referee", Pass: "password", ReferralCode: referrer.ReferralCode})
+	require.NoError(t, err)
+	require.NoError(t, us.AddOrder(ctx, referee.ID.String(), "", "4539088167512356"))
+
+	accrual := &internal.AccrualDto{Order: "4539088167512356", Status: "PROCESSED", Accrual: 100}
+	for _, source := range []internal.UpdateSource{internal.UpdateSourcePoll, internal.UpdateSourceCallback} {
+		require.NoError(t, us.UpdateOrder(accrual, source))
+	}
+
+	referral, err := us.GetReferral(ctx, referrer.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, float32(100), referral.Earned)
+	require.Len(t, referral.Credits, 1)
+	assert.Equal(t, string(internal.ReferralRoleReferrer), referral.Credits[0].Role)
+	assert.Equal(t, "4539088167512356", referral.Credits[0].Order)
+	balance, err := us.GetBalance(ctx, referee.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, float32(150), balance.Current)
+}
+
+func TestUserService_GetOrder(t *testing.T) {
+	ctx := context.Background()
+	us := NewUserService(memory.NewStore(), ordernumber.DefaultSources(), nil, nil)
+	owner, err := us.CreateNewUser(ctx, &internal.UserDto{Login: "owner", Pass: "password"})
+	require.NoError(t, err)
+	another, err := us.CreateNewUser(ctx, &internal.UserDto{Login: "another", Pass: "password"})
+	require.NoError(t, err)
+	require.NoError(t, us.AddOrder(ctx, owner.ID.String(), "", "4539088167512356"))
+	require.NoError(t, us.AddOrder(ctx, owner.ID.String(), "", "79927398713"))
+	require.NoError(t, us.UpdateOrder(&internal.AccrualDto{Order: "79927398713", Status: "PROCESSED", Accrual: 100},
+		internal.UpdateSourcePoll))
+	require.NoError(t, us.AddWithdraw(ctx, internal.WithdrawDto{Order: "4539088167512356", Sum: 30}, owner.ID.String(), ""))
+	checkedAt := time.Date(2023, 11, 10, 11, 0, 0, 0, time.UTC)
+	require.NoError(t, us.SaveOrderCheck("4539088167512356", checkedAt, checkedAt.Add(time.Minute)))
+	require.NoError(t, us.SaveOrderCheck("4539088167512356", checkedAt, checkedAt.Add(time.Minute)))
 
 	tests := []struct {
-		name     string
-		checksum map[int]int
+		name    string
+		userID  string
+		number  string
+		wantErr error
 	}{
-		{
-			name:     "test_checksum_batch",
-			checksum: map[int]int{1: 2, 10: 1, 2000000000: 2, 4539088167512356: 8, 3536137811022331: 1, 3533841638640315: 5},
-		},
+		{name: "owner", userID: owner.ID.String(), number: "4539088167512356"},
+		{name: "another user", userID: another.ID.String(), number: "4539088167512356", wantErr: errors2.ErrOrderOfAnotherUser},
+		{name: "unknown order", userID: owner.ID.String(), number: "3536137811022331", wantErr: errors2.ErrOrderNotFound},
+		{name: "wrong number", userID: owner.ID.String(), number: "order#1", wantErr: errors2.ErrIllegalOrder},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			for k, v := range tt.checksum {
-				if got := checksum(k); got != v {
-					t.Errorf("checksum(%v) = %v, want %v", k, got, v)
-				}
+			order, err := us.GetOrder(ctx, tt.userID, tt.number)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, order)
+				return
 			}
-
+			require.NoError(t, err)
+			assert.Equal(t, tt.number, order.Number)
+			assert.Equal(t, string(internal.OrderStatusNew), order.Status)
+			require.Len(t, order.History, 1)
+			assert.Equal(t, string(internal.UpdateSourceUpload), order.History[0].Source)
+			assert.Equal(t, 2, order.PollCount)
+			assert.Equal(t, &checkedAt, order.CheckedAt)
+			require.NotNil(t, order.NextCheckAt)
+			assert.Equal(t, checkedAt.Add(time.Minute), *order.NextCheckAt)
+			require.Len(t, order.Withdrawals, 1)
+			assert.Equal(t, float32(30), order.Withdrawals[0].Sum)
 		})
 	}
 }
@@ -780,36 +1114,16 @@ func Test_isIllegalUserArgument(t *testing.T) {
 	}
 }
 
-func Test_isLuna(t *testing.T) {
-	type order struct {
-		str string
-		num int
-	}
-	tests := []struct {
-		name   string
-		orders map[order]bool
-	}{
-		{
-			name: "test_isLuna_batch",
-			orders: map[order]bool{
-				order{"1", 1}:                               false,
-				order{"1234567890", 1234567890}:             false,
-				order{"4539088167512356", 4539088167512356}: true,
-				order{"3536137811022331", 3536137811022331}: true,
-				order{"112345678912345", 112345678912345}:   false,
-				order{"140672056", 140672056}:               true,
-				order{"10000000000000", 10000000000000}:     false},
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			for order, b := range tt.orders {
-				got, ok := isLuna(order.str)
-				if got != order.num || b != ok {
-					t.Errorf("isLuna(%v) = %v, %v, want %v, %v", order.str, order.num, b, got, ok)
-				}
-			}
+func TestUserService_GetVersion(t *testing.T) {
+	mockStore := getStore(t)
+	userID := uuid.MustParse("98dcfb07-e16f-4e53-9a28-d2a2e4eed026")
+	mockStore.EXPECT().GetUserVersion(gomock.Any(), userID).Return(int64(5), nil)
+	us := NewUserService(mockStore, ordernumber.DefaultSources(), nil, nil)
 
-		})
-	}
+	version, err := us.GetVersion(context.Background(), userID.String())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), version)
+
+	_, err = us.GetVersion(context.Background(), "12345")
+	assert.Error(t, err)
 }
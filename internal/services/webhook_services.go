@@ -0,0 +1,341 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/auth"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/clients"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/repositories"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	webhookBatchSize     = 100
+	webhookLease         = 1 * time.Minute
+	webhookMaxAttempts   = 10
+	webhookDeliveriesLog = 100
+	webhookSecretSize    = 32
+	webhookMaxPerUser    = 10
+)
+
+var webhookEventTypes = map[internal.EventType]bool{
+	internal.EventOrderProcessed:   true,
+	internal.EventOrderInvalid:     true,
+	internal.EventWithdrawal:       true,
+	internal.EventReferralCredited: true,
+	internal.EventTierChanged:      true,
+}
+
+// WebhookSender posts the body to the webhook, e.g. clients.ClientWebhook.
+type WebhookSender interface {
+	Send(ctx context.Context, url string, headers map[string]string, body []byte) (int, error)
+}
+
+type WebhookService struct {
+	db          repositories.Store
+	sender      WebhookSender
+	maxAttempts int
+}
+
+func NewWebhookService(storage repositories.Store, sender WebhookSender) *WebhookService {
+	return &WebhookService{db: storage, sender: sender, maxAttempts: webhookMaxAttempts}
+}
+
+// Name and Send make WebhookService the sink of the outbox, every event is enqueued
+// for the webhooks of its user.
+func (ws *WebhookService) Name() string {
+	return "user-webhooks"
+}
+
+func (ws *WebhookService) Send(ctx context.Context, event *internal.OutboxEvent) error {
+	return ws.db.AddWebhookDeliveries(ctx, event)
+}
+
+func (ws *WebhookService) CreateWebhook(ctx context.Context, id string, dto internal.WebhookDto) (*internal.WebhookDto, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	eventTypes, err := validateWebhook(dto)
+	if err != nil {
+		return nil, err
+	}
+	secret := make([]byte, webhookSecretSize)
+	if _, err = rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("can't create secret, %w", err)
+	}
+
+	webhook := &internal.Webhook{
+		ID:         uuid.New(),
+		CreateAt:   time.Now(),
+		UserID:     userID,
+		URL:        dto.URL,
+		Secret:     hex.EncodeToString(secret),
+		EventTypes: eventTypes,
+		Active:     dto.Active == nil || *dto.Active,
+	}
+	if err = ws.db.AddWebhook(ctx, webhook, webhookMaxPerUser); err != nil {
+		return nil, err
+	}
+	result := toWebhookDto(webhook)
+	result.Secret = webhook.Secret
+	return &result, nil
+}
+
+func (ws *WebhookService) GetWebhooks(ctx context.Context, id string) (*[]internal.WebhookDto, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	webhooks, err := ws.db.GetWebhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	dtos := make([]internal.WebhookDto, 0)
+	for i := range *webhooks {
+		dtos = append(dtos, toWebhookDto(&(*webhooks)[i]))
+	}
+	return &dtos, nil
+}
+
+func (ws *WebhookService) GetWebhook(ctx context.Context, id string, webhookID string) (*internal.WebhookDto, error) {
+	webhook, err := ws.getWebhook(ctx, id, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	dto := toWebhookDto(webhook)
+	return &dto, nil
+}
+
+func (ws *WebhookService) UpdateWebhook(ctx context.Context, id string, webhookID string, dto internal.WebhookDto) (*internal.WebhookDto, error) {
+	webhook, err := ws.getWebhook(ctx, id, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	eventTypes, err := validateWebhook(dto)
+	if err != nil {
+		return nil, err
+	}
+	webhook.URL = dto.URL
+	webhook.EventTypes = eventTypes
+	if dto.Active != nil {
+		webhook.Active = *dto.Active
+	}
+	if err = ws.db.UpdateWebhook(ctx, webhook); err != nil {
+		return nil, err
+	}
+	result := toWebhookDto(webhook)
+	return &result, nil
+}
+
+func (ws *WebhookService) DeleteWebhook(ctx context.Context, id string, webhookID string) error {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return err
+	}
+	hookID, err := uuid.Parse(webhookID)
+	if err != nil {
+		return errors2.ErrWebhookNotFound
+	}
+	return ws.db.DeleteWebhook(ctx, userID, hookID)
+}
+
+func (ws *WebhookService) GetDeliveries(ctx context.Context, id string, webhookID string) (*[]internal.WebhookDeliveryDto, error) {
+	webhook, err := ws.getWebhook(ctx, id, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := ws.db.GetWebhookDeliveries(ctx, webhook.UserID, webhook.ID, webhookDeliveriesLog)
+	if err != nil {
+		return nil, err
+	}
+	dtos := make([]internal.WebhookDeliveryDto, 0)
+	for i := range *deliveries {
+		dtos = append(dtos, toWebhookDeliveryDto(&(*deliveries)[i]))
+	}
+	return &dtos, nil
+}
+
+// SendTestEvent delivers the test event to the webhook at once, the failed delivery is retried as usual.
+func (ws *WebhookService) SendTestEvent(ctx context.Context, id string, webhookID string) (*internal.WebhookDeliveryDto, error) {
+	webhook, err := ws.getWebhook(ctx, id, webhookID)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(map[string]string{"message": "test event"})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	delivery := &internal.WebhookDelivery{
+		ID:            uuid.New(),
+		CreateAt:      now,
+		WebhookID:     webhook.ID,
+		EventID:       uuid.New(),
+		EventType:     internal.EventWebhookTest,
+		Payload:       payload,
+		Status:        internal.OutboxStatusPending,
+		NextAttemptAt: now.Add(webhookLease),
+		URL:           webhook.URL,
+		Secret:        webhook.Secret,
+	}
+	if err = ws.db.AddWebhookDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	ws.deliver(ctx, delivery)
+	if err = ws.db.SaveWebhookDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+	dto := toWebhookDeliveryDto(delivery)
+	return &dto, nil
+}
+
+// Start delivers due deliveries on every tick until ctx is done.
+func (ws *WebhookService) Start(ctx context.Context, requestTime *time.Ticker) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-requestTime.C:
+		}
+		for {
+			count, err := ws.Deliver(ctx)
+			if err != nil {
+				internal.Log.Error("error delivery of webhooks", zap.Error(err))
+			}
+			if err != nil || count < webhookBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// Deliver sends one batch of due deliveries and returns the size of the batch.
+func (ws *WebhookService) Deliver(ctx context.Context) (int, error) {
+	deliveries, err := ws.db.ClaimWebhookDeliveries(ctx, webhookBatchSize, webhookLease)
+	if err != nil {
+		return 0, err
+	}
+	for i := range *deliveries {
+		delivery := &(*deliveries)[i]
+		ws.deliver(ctx, delivery)
+		if err = ws.db.SaveWebhookDelivery(ctx, delivery); err != nil {
+			return i, err
+		}
+	}
+	return len(*deliveries), nil
+}
+
+func (ws *WebhookService) deliver(ctx context.Context, delivery *internal.WebhookDelivery) {
+	body, err := json.Marshal(internal.WebhookEventDto{
+		ID:       delivery.EventID.String(),
+		Type:     string(delivery.EventType),
+		CreateAt: delivery.CreateAt,
+		Payload:  delivery.Payload,
+	})
+	if err == nil {
+		headers := map[string]string{
+			clients.HeaderSignature:       auth.SignBody(body, []byte(delivery.Secret)),
+			clients.HeaderWebhookEvent:    string(delivery.EventType),
+			clients.HeaderWebhookDelivery: delivery.ID.String(),
+		}
+		delivery.ResponseCode, err = ws.sender.Send(ctx, delivery.URL, headers, body)
+	}
+	// the error of transport isn't shown to the user, it would tell about the internal network
+	lastError := "webhook is unreachable"
+	if err == nil && (delivery.ResponseCode < http.StatusOK || delivery.ResponseCode >= http.StatusMultipleChoices) {
+		err = fmt.Errorf("webhook responded %d", delivery.ResponseCode)
+		lastError = err.Error()
+	}
+
+	delivery.Attempts++
+	if err == nil {
+		now := time.Now()
+		delivery.Status = internal.OutboxStatusDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+		return
+	}
+
+	internal.Log.Debug("webhook delivery is failed", zap.String("delivery", delivery.ID.String()), zap.Error(err))
+	delivery.LastError = lastError
+	if delivery.Attempts >= ws.maxAttempts {
+		delivery.Status = internal.OutboxStatusDead
+		return
+	}
+	delivery.NextAttemptAt = time.Now().Add(retryDelay(delivery.Attempts))
+}
+
+func (ws *WebhookService) getWebhook(ctx context.Context, id string, webhookID string) (*internal.Webhook, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, err
+	}
+	hookID, err := uuid.Parse(webhookID)
+	if err != nil {
+		return nil, errors2.ErrWebhookNotFound
+	}
+	return ws.db.GetWebhook(ctx, userID, hookID)
+}
+
+func validateWebhook(dto internal.WebhookDto) (string, error) {
+	u, err := url.Parse(dto.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("url %q %w", dto.URL, errors2.ErrIllegalWebhook)
+	}
+	if len(dto.EventTypes) == 0 {
+		return "", fmt.Errorf("event types are empty %w", errors2.ErrIllegalWebhook)
+	}
+	types := make([]string, 0, len(dto.EventTypes))
+	seen := make(map[string]bool)
+	for _, t := range dto.EventTypes {
+		if !webhookEventTypes[internal.EventType(t)] {
+			return "", fmt.Errorf("event type %q %w", t, errors2.ErrIllegalWebhook)
+		}
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	return strings.Join(types, ","), nil
+}
+
+func toWebhookDto(webhook *internal.Webhook) internal.WebhookDto {
+	active := webhook.Active
+	return internal.WebhookDto{
+		ID:         webhook.ID.String(),
+		URL:        webhook.URL,
+		EventTypes: strings.Split(webhook.EventTypes, ","),
+		Active:     &active,
+		CreateAt:   webhook.CreateAt,
+	}
+}
+
+func toWebhookDeliveryDto(delivery *internal.WebhookDelivery) internal.WebhookDeliveryDto {
+	dto := internal.WebhookDeliveryDto{
+		ID:           delivery.ID.String(),
+		EventID:      delivery.EventID.String(),
+		EventType:    string(delivery.EventType),
+		Status:       string(delivery.Status),
+		Attempts:     delivery.Attempts,
+		ResponseCode: delivery.ResponseCode,
+		LastError:    delivery.LastError,
+		CreateAt:     delivery.CreateAt,
+		DeliveredAt:  delivery.DeliveredAt,
+	}
+	if delivery.Status == internal.OutboxStatusPending {
+		next := delivery.NextAttemptAt
+		dto.NextAttempt = &next
+	}
+	return dto
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/auth"
+	errors2 "github.com/bonus2k/go-musthave-diploma-tpl/internal/errors"
+	"github.com/bonus2k/go-musthave-diploma-tpl/internal/interfaces/clients"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type fakeSender struct {
+	statusCode int
+	err        error
+	url        string
+	headers    map[string]string
+	body       []byte
+}
+
+func (f *fakeSender) Send(ctx context.Context, url string, headers map[string]string, body []byte) (int, error) {
+	f.url = url
+	f.headers = headers
+	f.body = body
+	return f.statusCode, f.err
+}
+
+func TestWebhookService_CreateWebhook(t *testing.T) {
+	mockStore := getStore(t)
+	mockStore.EXPECT().AddWebhook(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	inactive := false
+
+	tests := []struct {
+		name       string
+		dto        internal.WebhookDto
+		wantTypes  []string
+		wantActive bool
+		wantErr    error
+	}{
+		{
+			name:       "create_webhook",
+			dto:        internal.WebhookDto{URL: "https://partner.example/hook", EventTypes: []string{"order.processed", "order.processed", "balance.withdrawn"}},
+			wantTypes:  []string{"order.processed", "balance.withdrawn"},
+			wantActive: true,
+		},
+		{
+			name:       "create_inactive_webhook",
+			dto:        internal.WebhookDto{URL: "http://partner.example/hook", EventTypes: []string{"order.invalid"}, Active: &inactive},
+			wantTypes:  []string{"order.invalid"},
+			wantActive: false,
+		},
+		{
+			name:    "create_webhook_wrong_url",
+			dto:     internal.WebhookDto{URL: "ftp://partner.example/hook", EventTypes: []string{"order.processed"}},
+			wantErr: errors2.ErrIllegalWebhook,
+		},
+		{
+			name:    "create_webhook_unknown_event",
+			dto:     internal.WebhookDto{URL: "https://partner.example/hook", EventTypes: []string{"order.deleted"}},
+			wantErr: errors2.ErrIllegalWebhook,
+		},
+		{
+			name:    "create_webhook_without_events",
+			dto:     internal.WebhookDto{URL: "https://partner.example/hook"},
+			wantErr: errors2.ErrIllegalWebhook,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := NewWebhookService(mockStore, &fakeSender{})
+			got, err := ws.CreateWebhook(context.Background(), uuid.New().String(), tt.dto)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantTypes, got.EventTypes)
+			assert.Equal(t, tt.wantActive, *got.Active)
+			assert.Len(t, got.Secret, 2*webhookSecretSize)
+		})
+	}
+}
+
+func testDelivery(attempts int) internal.WebhookDelivery {
+	return internal.WebhookDelivery{
+		ID:        uuid.MustParse("35e1cbd0-c3ba-44eb-8632-0d91c280dee6"),
+		CreateAt:  time.Date(2023, 01, 01, 14, 00, 00, 000, time.UTC),
+		WebhookID: uuid.MustParse("334b0360-8222-44fc-bf2e-77ced208f2cd"),
+		EventID:   uuid.MustParse("3e23bb5c-5cd6-4ca9-afa5-8d498576a080"),
+		EventType: internal.EventOrderProcessed,
+		Payload:   []byte(`{"order":"4539088167512356","status":"PROCESSED","accrual":100}`),
+		Status:    internal.OutboxStatusPending,
+		Attempts:  attempts,
+		URL:       "https://partner.example/hook",
+		Secret:    "secret",
+	}
+}
+
+func TestWebhookService_Deliver(t *testing.T) {
+	tests := []struct {
+		name         string
+		attempts     int
+		sender       *fakeSender
+		wantStatus   internal.OutboxStatus
+		wantAttempts int
+		wantError    string
+	}{
+		{
+			name:         "delivery_is_delivered",
+			sender:       &fakeSender{statusCode: http.StatusOK},
+			wantStatus:   internal.OutboxStatusDelivered,
+			wantAttempts: 1,
+		},
+		{
+			name:         "delivery_is_rejected",
+			attempts:     1,
+			sender:       &fakeSender{statusCode: http.StatusGone},
+			wantStatus:   internal.OutboxStatusPending,
+			wantAttempts: 2,
+			wantError:    "webhook responded 410",
+		},
+		{
+			name:         "delivery_is_dead",
+			attempts:     webhookMaxAttempts - 1,
+			sender:       &fakeSender{err: errors.New("dial tcp 10.0.0.5:8080: connect: connection refused")},
+			wantStatus:   internal.OutboxStatusDead,
+			wantAttempts: webhookMaxAttempts,
+			wantError:    "webhook is unreachable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStore := getStore(t)
+			var saved internal.WebhookDelivery
+			mockStore.EXPECT().ClaimWebhookDeliveries(gomock.Any(), webhookBatchSize, webhookLease).
+				Return(&[]internal.WebhookDelivery{testDelivery(tt.attempts)}, nil)
+			mockStore.EXPECT().SaveWebhookDelivery(gomock.Any(), gomock.Any()).
+				DoAndReturn(func(ctx context.Context, delivery *internal.WebhookDelivery) error {
+					saved = *delivery
+					return nil
+				})
+
+			ws := NewWebhookService(mockStore, tt.sender)
+			count, err := ws.Deliver(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, 1, count)
+
+			assert.Equal(t, tt.wantStatus, saved.Status)
+			assert.Equal(t, tt.wantAttempts, saved.Attempts)
+			assert.Equal(t, tt.wantError, saved.LastError)
+			if tt.wantStatus == internal.OutboxStatusPending {
+				assert.True(t, saved.NextAttemptAt.After(time.Now()))
+			}
+
+			assert.Equal(t, "https://partner.example/hook", tt.sender.url)
+			assert.JSONEq(t, `{
+				"id":"3e23bb5c-5cd6-4ca9-afa5-8d498576a080",
+				"type":"order.processed",
+				"created_at":"2023-01-01T14:00:00Z",
+				"payload":{"order":"4539088167512356","status":"PROCESSED","accrual":100}
+			}`, string(tt.sender.body))
+			assert.Equal(t, auth.SignBody(tt.sender.body, []byte("secret")), tt.sender.headers[clients.HeaderSignature])
+			assert.Equal(t, "order.processed", tt.sender.headers[clients.HeaderWebhookEvent])
+		})
+	}
+}
+
+func TestWebhookService_SendTestEvent(t *testing.T) {
+	mockStore := getStore(t)
+	userID := uuid.New()
+	webhook := &internal.Webhook{ID: uuid.New(), UserID: userID, URL: "https://partner.example/hook", Secret: "secret", EventTypes: "order.processed", Active: true}
+	mockStore.EXPECT().GetWebhook(gomock.Any(), userID, webhook.ID).Return(webhook, nil)
+	mockStore.EXPECT().GetWebhook(gomock.Any(), userID, gomock.Any()).Return(nil, errors2.ErrWebhookNotFound)
+	mockStore.EXPECT().AddWebhookDelivery(gomock.Any(), gomock.Any()).Return(nil)
+	mockStore.EXPECT().SaveWebhookDelivery(gomock.Any(), gomock.Any()).Return(nil)
+
+	sender := &fakeSender{statusCode: http.StatusAccepted}
+	ws := NewWebhookService(mockStore, sender)
+	got, err := ws.SendTestEvent(context.Background(), userID.String(), webhook.ID.String())
+	require.NoError(t, err)
+	assert.Equal(t, string(internal.OutboxStatusDelivered), got.Status)
+	assert.Equal(t, string(internal.EventWebhookTest), got.EventType)
+	assert.Equal(t, http.StatusAccepted, got.ResponseCode)
+	assert.Equal(t, string(internal.EventWebhookTest), sender.headers[clients.HeaderWebhookEvent])
+
+	_, err = ws.SendTestEvent(context.Background(), userID.String(), uuid.New().String())
+	assert.ErrorIs(t, err, errors2.ErrWebhookNotFound)
+	_, err = ws.SendTestEvent(context.Background(), userID.String(), "webhook")
+	assert.ErrorIs(t, err, errors2.ErrWebhookNotFound)
+}
+
+func TestWebhookService_Send(t *testing.T) {
+	mockStore := getStore(t)
+	event := &(*outboxEvents(0))[0]
+	mockStore.EXPECT().AddWebhookDeliveries(gomock.Any(), event).Return(nil)
+
+	var sink EventSink = NewWebhookService(mockStore, &fakeSender{})
+	assert.NoError(t, sink.Send(context.Background(), event))
+}